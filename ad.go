@@ -0,0 +1,44 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"crypto/hmac"
+)
+
+const (
+	// domain separation label for associated data fold-in.
+	labelAssociatedData = "passwd/ad/v1"
+)
+
+// foldAssociatedData binds the password to the associated data:
+//
+// data = b64(hmac_sha3-256(label || 0x00 || password, ad))
+//
+// the result is base64 encoded to remain usable by algorithms expecting
+// text (bcrypt).
+func foldAssociatedData(ad, password []byte) []byte {
+	h := hmac.New(newSHA3256, ad)
+	h.Write([]byte(labelAssociatedData))
+	h.Write([]byte{0x00})
+	h.Write(password)
+	return base64Encode(h.Sum(nil))
+}
+
+// SetAssociatedData binds produced hashes to contextual data (i.e. the user
+// ID), a hash copied onto another user's row no longer verifies.
+// The associated data is not stored, Compare() requires the same
+// associated data to be setup.
+func (p *Profile) SetAssociatedData(ad []byte) error {
+	p.ad = ad
+	return nil
+}
+
+// WithAssociatedData is the per-call variant of SetAssociatedData(), it
+// returns a copy of the profile bound to ad, leaving p untouched.
+func (p *Profile) WithAssociatedData(ad []byte) *Profile {
+	c := p.clone()
+	c.ad = ad
+	return c
+}
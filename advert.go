@@ -0,0 +1,191 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+//
+// signed parameters advertisement.
+//
+// clients pre-hashing passwords (relief mode, challenge-response..) fetch
+// the public parameters of a user's hash, the advertisement is signed so a
+// tampered response cannot downgrade them:
+//
+// $2v$ALGID$b64(SALT)$P0$P1$P2$KEYLEN$VERSION$EXPIRES$b64(ed25519(label || 0x00 || ...))
+//
+// the secret is never part of it. for masked profiles the cost fields are
+// zeroed and the client resolves VERSION (see ParamsVersion()) against the
+// parameters it was built with.
+//
+
+const (
+	idAdvertisement = "2v"
+
+	labelAdvertisement = "passwd/advertisement/v1"
+	labelParamsVersion = "passwd/paramsversion/v1"
+)
+
+// Advertisement is a signed export of the public parameters of a hash.
+type Advertisement struct {
+	Params    *ClientParams // cost fields are zero for masked profiles
+	Version   string        // ParamsVersion() of the complete parameters
+	Expires   int64         // unix seconds
+	Signature []byte
+}
+
+// ParamsVersion returns the public identifier of the cost parameters of cp
+// (algorithm, costs and key length, not the salt):
+//
+// VERSION = hex(SHA3-256("passwd/paramsversion/v1" || ALGID$P0$P1$P2$KEYLEN)[:8])
+func ParamsVersion(cp *ClientParams) string {
+	h := newSHA3256()
+	h.Write([]byte(labelParamsVersion))
+	switch cp.Algorithm {
+	case idScrypt:
+		fmt.Fprintf(h, "%s%c%d%c%d%c%d%c%d", cp.Algorithm, separatorRune, cp.N, separatorRune, cp.R, separatorRune, cp.P, separatorRune, cp.Keylen)
+	default:
+		fmt.Fprintf(h, "%s%c%d%c%d%c%d%c%d", cp.Algorithm, separatorRune, cp.Time, separatorRune, cp.Memory, separatorRune, cp.Thread, separatorRune, cp.Keylen)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// signed returns the signed part of the encoding.
+func (a *Advertisement) signed() ([]byte, error) {
+	enc, err := encodeRelief(idAdvertisement, a.Params, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("%s%c%s%c%d", enc, separatorRune, a.Version, separatorRune, a.Expires)), nil
+}
+
+func signedMessage(signed []byte) []byte {
+	msg := make([]byte, 0, len(labelAdvertisement)+1+len(signed))
+	msg = append(msg, labelAdvertisement...)
+	msg = append(msg, 0x00)
+	return append(msg, signed...)
+}
+
+// String returns the advertisement encoding.
+func (a *Advertisement) String() string {
+	signed, err := a.signed()
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s%c%s", signed, separatorRune, base64Encode(a.Signature))
+}
+
+// advertisedParams returns the client parameters of hashed.
+func (p *Profile) advertisedParams(hashed []byte) (*ClientParams, error) {
+	for _, id := range []string{idRelief, idChallenge} {
+		if bytes.HasPrefix(hashed, []byte(string(separatorRune)+id+string(separatorRune))) {
+			return ClientParamsFromHash(hashed)
+		}
+	}
+
+	if hasIntegrityTag(hashed) {
+		hashed = hashed[:bytes.LastIndexByte(hashed, byte(separatorRune))]
+	}
+	core, md, err := splitMetadata(hashed)
+	if err != nil {
+		return nil, err
+	}
+	tier, err := storedTier(md)
+	if err != nil {
+		return nil, err
+	}
+	c, err := p.atTier(tier)
+	if err != nil {
+		return nil, err
+	}
+
+	salt, err := parseFromHashToSalt(core)
+	if err != nil {
+		return nil, err
+	}
+	if !c.masked() {
+		parsed, err := parseFromHashToParams(core)
+		if err != nil {
+			return nil, err
+		}
+		c = c.clone()
+		c.params = parsed
+	}
+	return c.ClientParams(salt)
+}
+
+// Advertise returns the advertisement of the parameters of hashed, a
+// stored hash (relief and challenge values included) of the profile,
+// signed with key and valid for ttl.
+func (p *Profile) Advertise(key ed25519.PrivateKey, hashed []byte, ttl time.Duration) (*Advertisement, error) {
+	if len(key) != ed25519.PrivateKeySize || ttl <= 0 {
+		return nil, ErrUnsupported
+	}
+
+	cp, err := p.advertisedParams(hashed)
+	if err != nil {
+		return nil, err
+	}
+
+	a := Advertisement{
+		Params:  cp,
+		Version: ParamsVersion(cp),
+		Expires: now().Add(ttl).Unix(),
+	}
+	if p.masked() {
+		a.Params = &ClientParams{Algorithm: cp.Algorithm, Salt: cp.Salt}
+	}
+
+	signed, err := a.signed()
+	if err != nil {
+		return nil, err
+	}
+	a.Signature = ed25519.Sign(key, signedMessage(signed))
+	return &a, nil
+}
+
+// ParseAdvertisement parses and verifies an advertisement encoding with the
+// server public key, it returns ErrCorrupted if the signature does not
+// verify and ErrExpired if it expired.
+func ParseAdvertisement(pub ed25519.PublicKey, s string) (*Advertisement, error) {
+	i := strings.LastIndexByte(s, byte(separatorRune))
+	if i < 0 || len(pub) != ed25519.PublicKeySize {
+		return nil, ErrParse
+	}
+	signed := s[:i]
+
+	fields := strings.Split(signed, string(separatorRune))
+	if len(fields) != 10 || fields[0] != "" || fields[1] != idAdvertisement {
+		return nil, ErrParse
+	}
+	sig, err := base64Decode([]byte(s[i+1:]))
+	if err != nil {
+		return nil, ErrParse
+	}
+	if !ed25519.Verify(pub, signedMessage([]byte(signed)), sig) {
+		return nil, ErrCorrupted
+	}
+
+	cp, err := parseClientParams(fields[2:8])
+	if err != nil {
+		return nil, err
+	}
+	expires, err := strconv.ParseInt(fields[9], 10, 64)
+	if err != nil {
+		return nil, ErrParse
+	}
+	if now().Unix() >= expires {
+		return nil, ErrExpired
+	}
+
+	return &Advertisement{Params: cp, Version: fields[8], Expires: expires, Signature: sig}, nil
+}
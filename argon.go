@@ -5,11 +5,12 @@ package passwd
 
 import (
 	"bytes"
+	"context"
 	"crypto/subtle"
 	"fmt"
 	"strconv"
 
-	"golang.org/x/crypto/argon2"
+	"github.com/ermites-io/passwd/internal/argon2"
 )
 
 const (
@@ -17,11 +18,16 @@ const (
 	Argon2id = iota // default
 	// Argon2i constant is to select argon flavor in Argon2Params version field
 	Argon2i
+	// Argon2d constant is to select argon flavor in Argon2Params version
+	// field, its data dependent memory accesses leak through side channels,
+	// it is for key derivation where the attacker cannot observe the host.
+	Argon2d
 )
 
 const (
 	idArgon2i  = "2i"
 	idArgon2id = "2id"
+	idArgon2d  = "2d"
 )
 
 var (
@@ -82,6 +88,30 @@ var (
 		//salt
 		//masked: false,
 	}
+
+	/*
+		argon2i has data independent memory accesses only, it resists
+		the side channels argon2id still exposes in its later passes,
+		at the price of weaker time-memory tradeoffs: it needs more
+		passes (libsodium refuses less than 3).
+	*/
+	argon2iCommonParameters = Argon2Params{
+		Version: Argon2i,
+		Time:    3,
+		Memory:  64 * 1024,
+		Thread:  16,
+		Saltlen: 16,
+		Keylen:  32,
+	}
+
+	argon2iParanoidParameters = Argon2Params{
+		Version: Argon2i,
+		Time:    4,
+		Memory:  512 * 1024,
+		Thread:  32,
+		Saltlen: 32,
+		Keylen:  64,
+	}
 )
 
 // Argon2Params are the parameters for the argon2 key derivation.
@@ -93,8 +123,37 @@ type Argon2Params struct {
 	Keylen  uint32
 	Thread  uint8
 	Masked  bool   // are parameters private
-	salt    []byte // on compare only..
 	secret  []byte // secret for key'ed hashes..
+
+	pepper   PepperStrategy               // how the secret is applied
+	post     func([]byte) ([]byte, error) // digest post processing
+	progress func(done, total int)        // progress hook
+	ctx      context.Context              // cancellation of the derivation
+	pool     *argon2.Pool                 // reused memory of the derivations
+}
+
+// variant returns the hash identifier and the argon2 mode of the Version.
+func (p *Argon2Params) variant() (string, int) {
+	switch p.Version {
+	case Argon2i:
+		return idArgon2i, argon2.ModeI
+	case Argon2d:
+		return idArgon2d, argon2.ModeD
+	}
+	return idArgon2id, argon2.ModeID
+}
+
+// argonVersion returns the Version of the argon2 hash identifier id.
+func argonVersion(id string) (int, bool) {
+	switch id {
+	case idArgon2id:
+		return Argon2id, true
+	case idArgon2i:
+		return Argon2i, true
+	case idArgon2d:
+		return Argon2d, true
+	}
+	return 0, false
 }
 
 // [0] password: 'prout' hashed: '$2id$aiOE.rPFUFkkehxc6utWY.$1$65536$8$32$Wv1IMP6xwaqVaQGOX6Oxe.eSEbozeRJLzln8ZlthZfS'
@@ -107,43 +166,49 @@ func newArgon2ParamsFromFields(fields []string) (*Argon2Params, error) {
 	// salt
 	salt, err := base64Decode([]byte(fields[0])) // process the salt
 	if err != nil {
-		return nil, ErrParse
+		return nil, parseError(ErrParse, err)
 	}
 	saltlen := uint32(len(salt))
 
 	// ARGON FIELD: ["mezIC/cmChATxAfFFe9ele" "2" "65536" "8" "32" "omYy81uRZcZv6JkbH17wA0s1CSpH4UQttXBB42oKMXK"]
-	timeint, err := strconv.ParseInt(fields[1], 10, 32)
+	time, err := strconv.ParseUint(fields[1], 10, 32)
 	if err != nil {
-		return nil, ErrParse
+		return nil, parseError(ErrParse, err)
 	}
-	time := uint32(timeint)
 
-	memoryint, err := strconv.ParseInt(fields[2], 10, 32)
+	memory, err := strconv.ParseUint(fields[2], 10, 32)
 	if err != nil {
-		return nil, ErrParse
+		return nil, parseError(ErrParse, err)
 	}
-	memory := uint32(memoryint)
 
-	threadint, err := strconv.ParseInt(fields[3], 10, 32)
+	thread, err := strconv.ParseUint(fields[3], 10, 8)
 	if err != nil {
-		return nil, ErrParse
+		return nil, parseError(ErrParse, err)
 	}
-	thread := uint8(threadint)
 
-	keylenint, err := strconv.ParseInt(fields[4], 10, 32)
+	keylen, err := strconv.ParseUint(fields[4], 10, 32)
 	if err != nil {
+		return nil, parseError(ErrParse, err)
+	}
+
+	// bounds, before anything is allocated.
+	switch {
+	case time == 0, thread == 0, saltlen == 0:
+		return nil, ErrParse
+	case memory < 8*thread, memory > maxParseArgon2Memory, time*memory > maxParseArgon2Work:
+		return nil, ErrParse
+	case keylen == 0, keylen > maxParseKeylen:
 		return nil, ErrParse
 	}
-	keylen := uint32(keylenint)
 
 	// we just what we need.
 	ap := Argon2Params{
 		Version: Argon2id, // default for now..
-		Time:    time,
-		Memory:  memory,
-		Thread:  thread,
+		Time:    uint32(time),
+		Memory:  uint32(memory),
+		Thread:  uint8(thread),
 		Saltlen: saltlen,
-		Keylen:  keylen,
+		Keylen:  uint32(keylen),
 		//salt:    salt,
 	}
 
@@ -158,27 +223,19 @@ func (p *Argon2Params) validate(min *Argon2Params) error {
 	return nil
 }
 
-func (p *Argon2Params) deriveFromPassword(password []byte) (key []byte, err error) {
+func (p *Argon2Params) deriveFromPassword(password, salt []byte) (key []byte, err error) {
 	err = p.validate(&argonMinParameters)
 	if err != nil {
 		return nil, err
 	}
 
-	switch p.Version {
-	case Argon2i:
-		key = argon2.Key(password, p.salt, p.Time, p.Memory, p.Thread, p.Keylen)
-	case Argon2id:
-		fallthrough
-	default:
-		key = argon2.IDKey(password, p.salt, p.Time, p.Memory, p.Thread, p.Keylen)
-	}
-
-	return key, nil
+	_, mode := p.variant()
+	return p.key(mode, password, salt, nil)
 }
 
 func (p *Argon2Params) generateFromParams(salt, password []byte) (out []byte, err error) {
-	var key []byte
-	var id, params string
+	var key, native []byte
+	var params string
 	var hash bytes.Buffer
 	var data []byte
 
@@ -186,26 +243,46 @@ func (p *Argon2Params) generateFromParams(salt, password []byte) (out []byte, er
 	// the profile dictactes
 	psalt := make([]byte, p.Saltlen)
 	copy(psalt, salt)
+	defer wipe(psalt)
 
 	data = password
 
 	// we want to hmac a secret to have the resulting hash
 	if len(p.secret) > 0 {
-		data, err = hmacKeyHash(p.secret, psalt, password)
+		switch p.pepper {
+		case PepperNative:
+			native = p.secret
+		case PepperPreHash:
+			data, err = hmacKeyHash(p.secret, psalt, password)
+			if err != nil {
+				return nil, err
+			}
+			defer wipe(data)
+		}
+	}
+
+	id, mode := p.variant()
+	key, err = p.key(mode, data, psalt, native)
+	if err != nil {
+		return nil, err
+	}
+
+	// or hmac the resulting digest
+	if len(p.secret) > 0 && p.pepper == PepperPostHash {
+		raw := key
+		key, err = hmacKeyHash(p.secret, psalt, raw)
+		wipe(raw)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	switch p.Version {
-	case Argon2i:
-		id = idArgon2i
-		key = argon2.Key(data, psalt, p.Time, p.Memory, p.Thread, p.Keylen)
-	case Argon2id:
-		fallthrough
-	default:
-		id = idArgon2id
-		key = argon2.IDKey(data, psalt, p.Time, p.Memory, p.Thread, p.Keylen)
+	// digest post processing (i.e. blinding)
+	if p.post != nil {
+		key, err = p.post(key)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// need to b64.
@@ -236,6 +313,7 @@ func (p *Argon2Params) generateFromParams(salt, password []byte) (out []byte, er
 	// $ID$b64(SALT)$TIME$MEM$THREAD$KEYLEN$b64(ENCRYPTED)
 	// ID:
 	// $2D == ARGON2D
+	// $2I == Argon2i
 	// $2ID == Argon2id
 	//return hash.Bytes(), nil
 	out = hash.Bytes()
@@ -255,8 +333,7 @@ func (p *Argon2Params) generateFromPassword(password []byte) ([]byte, error) {
 func (p *Argon2Params) compare(hashed, password []byte) error {
 	salt, err := parseFromHashToSalt(hashed)
 	if err != nil {
-		fmt.Printf("compare parse error: %v\n", err)
-		return ErrMismatch
+		return err
 	}
 
 	compared, err := p.generateFromParams(salt, password)
@@ -272,7 +349,6 @@ func (p *Argon2Params) compare(hashed, password []byte) error {
 		}
 	*/
 
-	//fmt.Printf("COMPARE (%d)%s vs (%d)%s\n", len(hashed), hashed, len(compared), compared)
 	//if subtle.ConstantTimeCompare(compared, hashed[:hashlen]) == 1 {
 	if subtle.ConstantTimeCompare(compared, hashed) == 1 {
 		return nil
@@ -0,0 +1,59 @@
+//go:build go1.12
+// +build go1.12
+
+// Package argon2kdf exposes the Argon2 core used by the passwd package
+// (RFC 9106, version 0x13), for building custom formats on the same
+// implementation.
+//
+// the API is stable: Key and IDKey match golang.org/x/crypto/argon2, Derive
+// adds the secret (K) and associated data (X) inputs and reports invalid
+// parameters instead of panicking.
+package argon2kdf
+
+import (
+	"errors"
+
+	"github.com/ermites-io/passwd/internal/argon2"
+)
+
+// Version is the Argon2 version implemented.
+const Version = argon2.Version
+
+// Mode is the Argon2 variant.
+type Mode int
+
+// Argon2 variants.
+const (
+	Argon2d  Mode = argon2.ModeD
+	Argon2i  Mode = argon2.ModeI
+	Argon2id Mode = argon2.ModeID
+)
+
+// ErrParams is returned by Derive for invalid parameters.
+var ErrParams = errors.New("argon2kdf: invalid parameters")
+
+// Key derives a key from password and salt using Argon2i.
+func Key(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	return argon2.DeriveKey(argon2.ModeI, password, salt, nil, nil, time, memory, threads, keyLen)
+}
+
+// IDKey derives a key from password and salt using Argon2id.
+func IDKey(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	return argon2.DeriveKey(argon2.ModeID, password, salt, nil, nil, time, memory, threads, keyLen)
+}
+
+// Derive derives a key with the variant mode and the full set of Argon2
+// inputs, secret and data are optional.
+// time >= 1, threads >= 1 and keyLen >= 4 are required, memory (KiB) is
+// rounded like the specification does.
+func Derive(mode Mode, password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) ([]byte, error) {
+	switch mode {
+	case Argon2d, Argon2i, Argon2id:
+	default:
+		return nil, ErrParams
+	}
+	if time < 1 || threads < 1 || keyLen < 4 {
+		return nil, ErrParams
+	}
+	return argon2.DeriveKey(int(mode), password, salt, secret, data, time, memory, threads, keyLen), nil
+}
@@ -0,0 +1,44 @@
+package argon2kdf
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// RFC 9106 section 5 test vectors.
+func TestDerive(t *testing.T) {
+	password := make([]byte, 32)
+	salt := make([]byte, 16)
+	secret := make([]byte, 8)
+	data := make([]byte, 12)
+	for i := range password {
+		password[i] = 0x01
+	}
+	for i := range salt {
+		salt[i] = 0x02
+	}
+	for i := range secret {
+		secret[i] = 0x03
+	}
+	for i := range data {
+		data[i] = 0x04
+	}
+
+	for i, test := range []struct {
+		mode Mode
+		want string
+	}{
+		{Argon2d, "512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb"},
+		{Argon2i, "c814d9d1dc7f37aa13f0d77f2494bda1c8de6b016dd388d29952a4c4672b6ce8"},
+		{Argon2id, "0d640df58d78766c08c037a34a8b53c9d01ef0452d75b65eb52520e96b01e659"},
+	} {
+		key, err := Derive(test.mode, password, salt, secret, data, 3, 32, 4, 32)
+		if err != nil || hex.EncodeToString(key) != test.want {
+			t.Fatalf("test #%d: derive %x (%v) vs expected: %s\n", i, key, err, test.want)
+		}
+	}
+
+	if _, err := Derive(Argon2id, password, salt, nil, nil, 0, 32, 4, 32); err != ErrParams {
+		t.Fatalf("derive err: %v vs expected: %v\n", err, ErrParams)
+	}
+}
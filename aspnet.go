@@ -0,0 +1,104 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+//
+// ASP.NET Core Identity interop (verify only).
+//
+// the PasswordHasher encodings are base64 of:
+//
+// v2: 0x00 || SALT(16) || SUBKEY(32)                      (PBKDF2-HMAC-SHA1, 1000 iterations)
+// v3: 0x01 || PRF || ITER || SALTLEN || SALT || SUBKEY    (big endian uint32 PRF, ITER, SALTLEN)
+//
+// hashes verified by CompareASPNETIdentity() should be rehashed with a
+// profile of this package, ASPNETIdentity is meant to be a Suite legacy
+// verifier.
+//
+
+const (
+	aspnetV2 = 0x00
+	aspnetV3 = 0x01
+
+	aspnetV2Iterations = 1000
+	aspnetV2SaltLen    = 16
+	aspnetV2KeyLen     = 32
+
+	aspnetV3HeaderLen = 13
+	aspnetMinLen      = 16 // minimum salt and subkey lengths (128 bits)
+)
+
+// v3 PRF identifiers (KeyDerivationPrf).
+const (
+	aspnetHMACSHA1   = 0
+	aspnetHMACSHA256 = 1
+	aspnetHMACSHA512 = 2
+)
+
+// ASPNETIdentity is the Verifier of the ASP.NET Core Identity hashes.
+var ASPNETIdentity = Named("aspnet-identity", VerifierFunc(CompareASPNETIdentity))
+
+// CompareASPNETIdentity compares an ASP.NET Core Identity v2 or v3
+// PasswordHasher hash against password, in constant time.
+func CompareASPNETIdentity(hashed, password []byte) error {
+	raw, err := base64.StdEncoding.DecodeString(string(hashed))
+	if err != nil || len(raw) == 0 {
+		return ErrMismatch
+	}
+
+	var prf func() hash.Hash
+	var iter int
+	var salt, subkey []byte
+
+	switch raw[0] {
+	case aspnetV2:
+		if len(raw) != 1+aspnetV2SaltLen+aspnetV2KeyLen {
+			return ErrMismatch
+		}
+		prf, iter = sha1.New, aspnetV2Iterations
+		salt, subkey = raw[1:1+aspnetV2SaltLen], raw[1+aspnetV2SaltLen:]
+	case aspnetV3:
+		if len(raw) < aspnetV3HeaderLen {
+			return ErrMismatch
+		}
+		switch binary.BigEndian.Uint32(raw[1:5]) {
+		case aspnetHMACSHA1:
+			prf = sha1.New
+		case aspnetHMACSHA256:
+			prf = sha256.New
+		case aspnetHMACSHA512:
+			prf = sha512.New
+		default:
+			return ErrUnsupported
+		}
+
+		it := binary.BigEndian.Uint32(raw[5:9])
+		saltlen := binary.BigEndian.Uint32(raw[9:13])
+		body := raw[aspnetV3HeaderLen:]
+		if it < 1 || it > 1<<31-1 || saltlen < aspnetMinLen || uint64(saltlen)+aspnetMinLen > uint64(len(body)) {
+			return ErrMismatch
+		}
+		iter = int(it)
+		salt, subkey = body[:saltlen], body[saltlen:]
+	default:
+		return ErrUnsupported
+	}
+
+	key := pbkdf2.Key(password, salt, iter, len(subkey), prf)
+	if subtle.ConstantTimeCompare(key, subkey) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
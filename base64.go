@@ -1,3 +1,4 @@
+//go:build go1.11
 // +build go1.11
 
 // Copyright 2011 The Go Authors. All rights reserved.
@@ -10,7 +11,11 @@
 
 package passwd
 
-import "encoding/base64"
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+)
 
 const alphabet = "./ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
 
@@ -19,19 +24,24 @@ func base64Encode(src []byte) []byte {
 	n := bcEncoding.EncodedLen(len(src))
 	dst := make([]byte, n)
 	bcEncoding.Encode(dst, src)
-	for dst[n-1] == '=' {
+	for n > 0 && dst[n-1] == '=' {
 		n--
 	}
 	return dst[:n]
 }
 
+// base64Decode is strict: the input is unpadded, of the alphabet only and
+// canonical (unused trailing bits are zero).
 func base64Decode(src []byte) ([]byte, error) {
-	numOfEquals := 4 - (len(src) % 4)
-	for i := 0; i < numOfEquals; i++ {
-		src = append(src, '=')
+	if i := bytes.IndexFunc(src, func(r rune) bool { return strings.IndexRune(alphabet, r) < 0 }); i >= 0 {
+		return nil, base64.CorruptInputError(i)
 	}
 
-	bcEncoding := base64.NewEncoding(alphabet)
+	// pad a copy, src might be a sub slice of the caller's buffer.
+	numOfEquals := (4 - (len(src) % 4)) % 4
+	src = append(src[:len(src):len(src)], bytes.Repeat([]byte{'='}, numOfEquals)...)
+
+	bcEncoding := base64.NewEncoding(alphabet).Strict()
 	dst := make([]byte, bcEncoding.DecodedLen(len(src)))
 	n, err := bcEncoding.Decode(dst, src)
 	if err != nil {
@@ -0,0 +1,120 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+//
+// batch verification.
+//
+// CompareBatch() verifies many hash/password pairs (i.e. breach audits)
+// over a pool of goroutines sharing the profile, the results are in the
+// order of the pairs.
+// the workers are bounded by the memory budget of the profile (if any),
+// a pair refused for lack of memory (ErrBusy) waits for the budget instead
+// of failing, the rate limiter and Limiter of the profile apply as usual,
+// give the batch a PriorityBackground copy (see WithPriority()) not to
+// starve the interactive logins.
+//
+
+const (
+	batchRetryMin = time.Millisecond
+	batchRetryMax = 100 * time.Millisecond
+)
+
+// HashPasswordPair is a batch verification input.
+type HashPasswordPair struct {
+	Hashed   []byte
+	Password []byte
+}
+
+// CompareBatch compares the pairs on workers goroutines (GOMAXPROCS if
+// <= 0) and returns the Compare() error of every pair, nil for a match.
+func (p *Profile) CompareBatch(pairs []HashPasswordPair, workers int) []error {
+	return p.CompareBatchContext(context.Background(), pairs, workers)
+}
+
+// CompareBatchContext is CompareBatch() giving up when ctx is done, the
+// pairs not verified by then get ctx.Err().
+func (p *Profile) CompareBatchContext(ctx context.Context, pairs []HashPasswordPair, workers int) []error {
+	errs := make([]error, len(pairs))
+
+	workers = p.batchWorkers(workers)
+	if workers > len(pairs) {
+		workers = len(pairs)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = p.compareWait(ctx, pairs[i].Hashed, pairs[i].Password)
+			}
+		}()
+	}
+
+	i := 0
+	for ; i < len(pairs); i++ {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for ; i < len(pairs); i++ {
+		errs[i] = ctx.Err()
+	}
+	return errs
+}
+
+// batchWorkers bounds n to the computations fitting the memory budget.
+func (p *Profile) batchWorkers(n int) int {
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	if p.memory == nil {
+		return n
+	}
+
+	fit := 1
+	if m := paramsMemory(p.params); m > 0 && p.memory.size/m > 1 {
+		fit = int(p.memory.size / m)
+	}
+	if n > fit {
+		n = fit
+	}
+	return n
+}
+
+// compareWait is CompareContext() waiting for the memory budget.
+func (p *Profile) compareWait(ctx context.Context, hashed, password []byte) error {
+	delay := batchRetryMin
+	for {
+		err := p.CompareContext(ctx, hashed, password)
+		if err != ErrBusy || p.memory == nil || paramsMemory(p.params) > p.memory.size {
+			return err // not a lack of memory, or it will never fit
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		if delay *= 2; delay > batchRetryMax {
+			delay = batchRetryMax
+		}
+	}
+}
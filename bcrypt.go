@@ -3,7 +3,7 @@
 package passwd
 
 import (
-	"golang.org/x/crypto/bcrypt"
+	"github.com/ermites-io/passwd/internal/bcrypt"
 )
 
 var (
@@ -13,18 +13,26 @@ var (
 
 const (
 	idBcrypt = "2a"
+
+	// bcrypt salts are always 16 bytes
+	bcryptSaltlen = 16
 )
 
 // BcryptParams are the parameters for the bcrypt key derivation.
 type BcryptParams struct {
 	Cost   int
-	Masked bool // XXX UNUSED
+	Masked bool   // XXX UNUSED
+	Salt   []byte // explicit 16 bytes salt, random if empty (interop/vectors only)
+	secret []byte // secret for key'ed hashes (HMAC-SHA-512 pre-hash)
 }
 
 func newBcryptParamsFromHash(hashed []byte) (*BcryptParams, error) {
 	hashCost, err := bcrypt.Cost(hashed)
 	if err != nil {
-		return nil, err
+		if _, ok := err.(bcrypt.HashVersionTooNewError); ok {
+			return nil, parseError(ErrIncompatibleVersion, err)
+		}
+		return nil, parseError(ErrParse, err)
 	}
 
 	bp := BcryptParams{
@@ -34,7 +42,18 @@ func newBcryptParamsFromHash(hashed []byte) (*BcryptParams, error) {
 }
 
 func (bp *BcryptParams) generateFromPassword(password []byte) ([]byte, error) {
-	return bcrypt.GenerateFromPassword(password, bp.Cost)
+	salt := bp.Salt
+	if len(salt) == 0 {
+		var err error
+		salt, err = getSalt(bcryptSaltlen)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(salt) != bcryptSaltlen {
+		return nil, ErrUnsupported
+	}
+	return bcrypt.GenerateFromPasswordSalt(password, salt, bp.Cost)
 }
 
 func (bp *BcryptParams) compare(hashed, password []byte) error {
@@ -0,0 +1,143 @@
+//go:build go1.12
+// +build go1.12
+
+// Package bcrypt is a drop-in replacement for golang.org/x/crypto/bcrypt
+// routing new hashes through a passwd.Profile (argon2id by default) while
+// still verifying the existing bcrypt hashes.
+//
+// swapping the import path is enough:
+//
+//	import "github.com/ermites-io/passwd/bcrypt"
+package bcrypt
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/ermites-io/passwd"
+	xbcrypt "golang.org/x/crypto/bcrypt"
+)
+
+// the constants and errors of golang.org/x/crypto/bcrypt.
+const (
+	MinCost     = xbcrypt.MinCost
+	MaxCost     = xbcrypt.MaxCost
+	DefaultCost = xbcrypt.DefaultCost
+)
+
+var (
+	ErrHashTooShort              = xbcrypt.ErrHashTooShort
+	ErrMismatchedHashAndPassword = xbcrypt.ErrMismatchedHashAndPassword
+	ErrPasswordTooLong           = xbcrypt.ErrPasswordTooLong
+)
+
+// the error types of golang.org/x/crypto/bcrypt.
+type (
+	HashVersionTooNewError = xbcrypt.HashVersionTooNewError
+	InvalidCostError       = xbcrypt.InvalidCostError
+	InvalidHashPrefixError = xbcrypt.InvalidHashPrefixError
+)
+
+var (
+	mu      sync.RWMutex
+	profile *passwd.Profile
+)
+
+func init() {
+	profile, _ = passwd.New(passwd.Argon2idDefault)
+}
+
+// SetProfile replaces the profile used by GenerateFromPassword and
+// CompareHashAndPassword, nil restores the default argon2id profile.
+func SetProfile(p *passwd.Profile) {
+	if p == nil {
+		p, _ = passwd.New(passwd.Argon2idDefault)
+	}
+
+	mu.Lock()
+	profile = p
+	mu.Unlock()
+}
+
+func current() *passwd.Profile {
+	mu.RLock()
+	defer mu.RUnlock()
+	return profile
+}
+
+// bcryptHashSize is the size of the golang.org/x/crypto/bcrypt hashes.
+const bcryptHashSize = 60
+
+// isBcrypt returns true for the plain $2a$, $2b$, $2x$ and $2y$ bcrypt
+// hashes ("$2a$10$..."), the profile bcrypt hashes carrying metadata or an
+// integrity tag are not.
+func isBcrypt(hashed []byte) bool {
+	return len(hashed) == bcryptHashSize && bytes.HasPrefix(hashed, []byte("$2")) &&
+		bytes.IndexByte([]byte("abxy"), hashed[2]) >= 0 && hashed[3] == '$' &&
+		isDigit(hashed[4]) && isDigit(hashed[5]) && hashed[6] == '$'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// maxPasswordLength is the golang.org/x/crypto/bcrypt password limit.
+const maxPasswordLength = 72
+
+// GenerateFromPassword hashes password with the configured profile, cost is
+// validated like golang.org/x/crypto/bcrypt does and otherwise ignored: the
+// profile parameters apply, bcrypt profiles included.
+// passwords longer than 72 bytes, or than the profile policy allows, are
+// refused with ErrPasswordTooLong as golang.org/x/crypto/bcrypt does.
+func GenerateFromPassword(password []byte, cost int) ([]byte, error) {
+	if len(password) > maxPasswordLength {
+		return nil, ErrPasswordTooLong
+	}
+	if cost < MinCost || cost > MaxCost {
+		return nil, InvalidCostError(cost)
+	}
+
+	hashed, err := current().Hash(password)
+	if err == passwd.ErrPasswordTooLong {
+		return nil, ErrPasswordTooLong
+	}
+	return hashed, err
+}
+
+// CompareHashAndPassword compares a bcrypt or profile hash with its possible
+// plaintext equivalent, it returns nil on success or an error on failure.
+func CompareHashAndPassword(hashedPassword, password []byte) error {
+	if isBcrypt(hashedPassword) {
+		return xbcrypt.CompareHashAndPassword(hashedPassword, password)
+	}
+
+	err := current().Compare(hashedPassword, password)
+	if err == passwd.ErrMismatch {
+		return ErrMismatchedHashAndPassword
+	}
+	return err
+}
+
+// Cost returns the cost of a bcrypt hash.
+// the profile hashes have no bcrypt cost, for the usual "rehash when the
+// cost is below the expected one" check, Cost() returns MaxCost for the
+// ones the profile does not need to rehash (see passwd.Profile.NeedsRehash())
+// and MinCost for the others.
+func Cost(hashedPassword []byte) (int, error) {
+	if isBcrypt(hashedPassword) {
+		return xbcrypt.Cost(hashedPassword)
+	}
+
+	info, err := passwd.Info(hashedPassword)
+	if err != nil {
+		return xbcrypt.Cost(hashedPassword)
+	}
+	if bp, ok := info.Params.(*passwd.BcryptParams); ok {
+		return bp.Cost, nil
+	}
+
+	if current().NeedsRehash(hashedPassword) {
+		return MinCost, nil
+	}
+	return MaxCost, nil
+}
@@ -0,0 +1,90 @@
+package bcrypt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ermites-io/passwd"
+	xbcrypt "golang.org/x/crypto/bcrypt"
+)
+
+func TestDropIn(t *testing.T) {
+	p, _ := passwd.NewCustom(&passwd.Argon2Params{Version: passwd.Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+	SetProfile(p)
+	defer SetProfile(nil)
+
+	password := []byte("prout")
+
+	hashed, err := GenerateFromPassword(password, DefaultCost)
+	if err != nil {
+		t.Fatalf("generate error: %v\n", err)
+	}
+	legacy, _ := xbcrypt.GenerateFromPassword(password, MinCost)
+
+	for i, test := range []struct {
+		hashed   []byte
+		password []byte
+		want     error
+	}{
+		{hashed, password, nil},
+		{legacy, password, nil},
+		{hashed, []byte("wrong"), ErrMismatchedHashAndPassword},
+		{legacy, []byte("wrong"), ErrMismatchedHashAndPassword},
+	} {
+		if err := CompareHashAndPassword(test.hashed, test.password); err != test.want {
+			t.Fatalf("test #%d: compare %s err: %v vs expected: %v\n", i, test.hashed, err, test.want)
+		}
+	}
+
+	if _, err := GenerateFromPassword(password, MaxCost+1); err != InvalidCostError(MaxCost+1) {
+		t.Fatalf("invalid cost err: %v\n", err)
+	}
+
+	// the x/crypto password limit, and the profile one.
+	if _, err := GenerateFromPassword(bytes.Repeat([]byte("a"), 73), DefaultCost); err != ErrPasswordTooLong {
+		t.Fatalf("long password err: %v\n", err)
+	}
+	_ = p.SetPolicy(passwd.Policy{MaxLength: 4})
+	if _, err := GenerateFromPassword(password, DefaultCost); err != ErrPasswordTooLong {
+		t.Fatalf("profile long password err: %v\n", err)
+	}
+	_ = p.SetPolicy(passwd.Policy{})
+
+	// the costs of the bcrypt and profile hashes.
+	stronger, _ := passwd.NewCustom(&passwd.Argon2Params{Version: passwd.Argon2id, Time: 2, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+	for i, test := range []struct {
+		profile *passwd.Profile
+		hashed  []byte
+		cost    int
+	}{
+		{p, legacy, MinCost},
+		{p, hashed, MaxCost},
+		{stronger, hashed, MinCost},
+	} {
+		SetProfile(test.profile)
+		if cost, err := Cost(test.hashed); err != nil || cost != test.cost {
+			t.Fatalf("test #%d: cost %d (%v) vs expected: %d\n", i, cost, err, test.cost)
+		}
+	}
+	// the key'ed bcrypt profile hashes carry metadata.
+	keyed, _ := passwd.New(passwd.BcryptDefault)
+	_ = keyed.SetKey([]byte("0123456789abcdef0123456789abcdef"))
+	SetProfile(keyed)
+	kh, err := GenerateFromPassword(password, DefaultCost)
+	if err != nil {
+		t.Fatalf("keyed generate error: %v\n", err)
+	}
+	if err := CompareHashAndPassword(kh, password); err != nil {
+		t.Fatalf("keyed compare %s err: %v\n", kh, err)
+	}
+	if err := CompareHashAndPassword(kh, []byte("wrong")); err != ErrMismatchedHashAndPassword {
+		t.Fatalf("keyed compare err: %v\n", err)
+	}
+	if cost, err := Cost(kh); err != nil || cost < MinCost {
+		t.Fatalf("keyed cost %d (%v)\n", cost, err)
+	}
+
+	if _, err := Cost([]byte("$2")); err != ErrHashTooShort {
+		t.Fatalf("short hash err: %v\n", err)
+	}
+}
@@ -0,0 +1,42 @@
+//go:build go1.12
+// +build go1.12
+
+// Package bcryptkdf exposes the bcrypt core used by the passwd package, for
+// building custom formats on the same implementation.
+//
+// the API is stable and matches golang.org/x/crypto/bcrypt, with the
+// addition of explicit salts.
+package bcryptkdf
+
+import (
+	"github.com/ermites-io/passwd/internal/bcrypt"
+)
+
+// Cost limits.
+const (
+	MinCost     = bcrypt.MinCost
+	MaxCost     = bcrypt.MaxCost
+	DefaultCost = bcrypt.DefaultCost
+)
+
+// GenerateFromPassword returns the bcrypt hash of password at cost, with a
+// random salt.
+func GenerateFromPassword(password []byte, cost int) ([]byte, error) {
+	return bcrypt.GenerateFromPassword(password, cost)
+}
+
+// GenerateFromPasswordSalt returns the bcrypt hash of password at cost,
+// with the provided 16 bytes salt.
+func GenerateFromPasswordSalt(password, salt []byte, cost int) ([]byte, error) {
+	return bcrypt.GenerateFromPasswordSalt(password, salt, cost)
+}
+
+// CompareHashAndPassword compares a bcrypt hash with password.
+func CompareHashAndPassword(hashed, password []byte) error {
+	return bcrypt.CompareHashAndPassword(hashed, password)
+}
+
+// Cost returns the cost of a bcrypt hash.
+func Cost(hashed []byte) (int, error) {
+	return bcrypt.Cost(hashed)
+}
@@ -0,0 +1,66 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"crypto/hmac"
+)
+
+//
+// blind hashing.
+//
+// the digest produced by the derivation is sent to an external hardening
+// service (an appliance, a HSM, a remote service...) that returns a
+// deterministic keyed value of it (i.e. HMAC by a key that never leaves the
+// service), only that blinded value is stored.
+//
+// hash:    d = KDF(password, salt, params)  ; b = Blind(d) ; store b
+// compare: d' = KDF(password, salt, params) ; b' = Blind(d') ; b' == b ?
+//
+// a database only breach yields values that cannot be attacked offline
+// without access to the hardening service.
+//
+
+// Blinder is the interface an external hardening service must implement,
+// Blind must be deterministic for a given digest.
+type Blinder interface {
+	Blind(digest []byte) ([]byte, error)
+}
+
+// HMACBlinder is a reference Blinder implementation, to be run on the
+// hardening service side (or for tests).
+type HMACBlinder struct {
+	key []byte
+}
+
+// NewHMACBlinder returns a Blinder computing hmac_sha3-256(digest, key).
+func NewHMACBlinder(key []byte) (*HMACBlinder, error) {
+	if len(key) == 0 {
+		return nil, ErrUnsupported
+	}
+	return &HMACBlinder{key: key}, nil
+}
+
+// Blind implements the Blinder interface.
+func (b *HMACBlinder) Blind(digest []byte) ([]byte, error) {
+	h := hmac.New(newSHA3256, b.key)
+	_, err := h.Write(digest)
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// SetBlinder setup an external hardening service for the profile, produced
+// hashes digests are blinded through b before being encoded.
+// Compare() on those hashes requires the same blinder.
+func (p *Profile) SetBlinder(b Blinder) error {
+	err := p.setPost(p.posthash, b)
+	if err != nil {
+		return err
+	}
+
+	p.blinder = b
+	return nil
+}
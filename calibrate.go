@@ -0,0 +1,200 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"time"
+
+	"github.com/ermites-io/passwd/internal/bcrypt"
+)
+
+//
+// auto-calibration.
+//
+// the static profiles do not fit every host, Calibrate() benchmarks the
+// KDF and tunes the parameters of an algorithm to a target hash duration:
+//
+// argon2: the memory budget is used, then the passes fill the target
+// scrypt: the largest N fitting the memory budget and the target (r=8, p=1)
+// bcrypt: the highest cost meeting the target
+// pbkdf2: the iterations filling the target
+//
+// memory is traded for time only when a single pass exceeds the target.
+// the salt, key lengths and argon2 threads are the profile ones.
+//
+
+// calibrationPassword is hashed by the benchmarks.
+const calibrationPassword = "passwd/calibrate"
+
+// Calibrate returns a custom Profile of the profileType algorithm (i.e.
+// Argon2idDefault or Argon2Custom for argon2id) whose hashes take at most
+// about target on this host, using at most maxMemory KiB (the profileType
+// memory if 0).
+// the benchmarks run hashes of increasing costs, it takes a few times
+// target, the result should be computed at deployment time (i.e. with
+// FormatSpec()) rather than at every startup.
+func Calibrate(profileType HashProfile, target time.Duration, maxMemory uint32) (*Profile, error) {
+	if target <= 0 {
+		return nil, ErrUnsupported
+	}
+
+	var tuned interface{}
+	var err error
+
+	switch v := calibrationBase(profileType).(type) {
+	case Argon2Params:
+		tuned, err = calibrateArgon2(v, target, maxMemory)
+	case ScryptParams:
+		tuned, err = calibrateScrypt(v, target, maxMemory)
+	case BcryptParams:
+		tuned, err = calibrateBcrypt(target)
+	case Pbkdf2Params:
+		tuned, err = calibratePbkdf2(v, target)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewCustom(tuned)
+}
+
+// calibrationBase returns the parameters the calibration of profileType
+// starts from.
+func calibrationBase(profileType HashProfile) interface{} {
+	switch profileType {
+	case Argon2Custom:
+		return argonCommonParameters
+	case ScryptCustom:
+		return scryptCommonParameters
+	case BcryptCustom:
+		return bcryptCommonParameters
+	case Pbkdf2Custom:
+		return pbkdf2CommonParameters
+	}
+	return params[profileType]
+}
+
+// measure returns the fastest of two hashes with params.
+func measure(params interface{}) (time.Duration, error) {
+	p := Profile{params: params}
+
+	var best time.Duration
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		_, err := p.hash([]byte(calibrationPassword))
+		elapsed := time.Since(start)
+		if err != nil {
+			return 0, err
+		}
+		if i == 0 || elapsed < best {
+			best = elapsed
+		}
+	}
+	return best, nil
+}
+
+func calibrateArgon2(p Argon2Params, target time.Duration, maxMemory uint32) (*Argon2Params, error) {
+	if maxMemory > 0 {
+		p.Memory = maxMemory
+	}
+	// argon2 needs 8 KiB per lane.
+	if p.Memory < 8 {
+		return nil, ErrUnsupported
+	}
+	if p.Memory < 8*uint32(p.Thread) {
+		p.Thread = uint8(p.Memory / 8)
+	}
+
+	p.Time = 1
+	d, err := measure(&p)
+	if err != nil {
+		return nil, err
+	}
+	for d > target && p.Memory/2 >= 8*uint32(p.Thread) {
+		p.Memory /= 2
+		d, err = measure(&p)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if d > target || d == 0 {
+		return &p, nil
+	}
+
+	p.Time = uint32(target / d)
+	for p.Time > 1 {
+		d, err = measure(&p)
+		if err != nil {
+			return nil, err
+		}
+		if d <= target {
+			break
+		}
+		p.Time--
+	}
+	return &p, nil
+}
+
+func calibrateScrypt(p ScryptParams, target time.Duration, maxMemory uint32) (*ScryptParams, error) {
+	p.R, p.P = 8, 1
+
+	// V is N blocks of 128 * r bytes.
+	budget := uint64(p.N) * 128 * uint64(p.R) / 1024
+	if maxMemory > 0 {
+		budget = uint64(maxMemory)
+	}
+	p.N = 2
+	for uint64(p.N)*2*128*uint64(p.R)/1024 <= budget && p.N < 1<<30 {
+		p.N *= 2
+	}
+
+	for {
+		d, err := measure(&p)
+		if err != nil {
+			return nil, err
+		}
+		if d <= target || p.N <= 2 {
+			return &p, nil
+		}
+		p.N /= 2
+	}
+}
+
+func calibrateBcrypt(target time.Duration) (*BcryptParams, error) {
+	p := BcryptParams{Cost: bcrypt.MinCost}
+	for p.Cost < bcrypt.MaxCost {
+		// the next cost doubles the work.
+		d, err := measure(&p)
+		if err != nil {
+			return nil, err
+		}
+		if 2*d > target {
+			break
+		}
+		p.Cost++
+	}
+	return &p, nil
+}
+
+func calibratePbkdf2(p Pbkdf2Params, target time.Duration) (*Pbkdf2Params, error) {
+	p.Iterations = pbkdf2MinParameters.Iterations * 10
+	d, err := measure(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	// linear in the iterations.
+	if d > 0 {
+		iter := uint64(p.Iterations) * uint64(target) / uint64(d)
+		switch {
+		case iter < uint64(pbkdf2MinParameters.Iterations):
+			iter = uint64(pbkdf2MinParameters.Iterations)
+		case iter > 1<<31:
+			iter = 1 << 31
+		}
+		p.Iterations = uint32(iter)
+	}
+	return &p, nil
+}
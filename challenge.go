@@ -0,0 +1,140 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+)
+
+//
+// challenge-response verifiers.
+//
+// a SCRAM (RFC 5802) like exchange where the salted password comes from
+// the profile KDF, the server stores keys it cannot log in with and the
+// password (or an equivalent) never goes over the wire:
+//
+// salted    = KDF(password, salt, params)
+// clientkey = hmac_sha256(salted, "Client Key")
+// storedkey = sha256(clientkey)
+// serverkey = hmac_sha256(salted, "Server Key")
+//
+// for every authentication both sides build the same auth message (i.e.
+// the concatenation of a server nonce from NewChallenge() and the client
+// identity), then:
+//
+// client: proof = clientkey XOR hmac_sha256(storedkey, authmessage)
+// server: sha256(proof XOR hmac_sha256(storedkey, authmessage)) == storedkey
+// server: signature = hmac_sha256(serverkey, authmessage)
+//
+// the client verifies the signature to authenticate the server.
+// stored verifiers reuse the relief layout:
+//
+// $2c$ALGID$b64(SALT)$P0$P1$P2$KEYLEN$b64(STOREDKEY)$b64(SERVERKEY)
+//
+
+const (
+	idChallenge = "2c"
+
+	challengeNoncelen = 32
+)
+
+// ChallengeVerifier is the server side material of the challenge-response
+// authentication.
+type ChallengeVerifier struct {
+	Params    *ClientParams // public KDF parameters, sent to the client
+	StoredKey []byte
+	ServerKey []byte
+}
+
+func challengeKeys(salted []byte) (clientKey, storedKey, serverKey []byte) {
+	clientKey = hmacSHA256(salted, []byte("Client Key"))
+	sum := sha256.Sum256(clientKey)
+	serverKey = hmacSHA256(salted, []byte("Server Key"))
+	return clientKey, sum[:], serverKey
+}
+
+func hmacSHA256(key, msg []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+// NewChallengeVerifier derives the challenge verifier of password with the
+// profile parameters (ClientParams()) and a new salt.
+func (p *Profile) NewChallengeVerifier(password []byte) (*ChallengeVerifier, error) {
+	cp, err := p.ClientParams(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	salted, err := ClientHash(cp, password)
+	if err != nil {
+		return nil, err
+	}
+
+	_, storedKey, serverKey := challengeKeys(salted)
+	return &ChallengeVerifier{Params: cp, StoredKey: storedKey, ServerKey: serverKey}, nil
+}
+
+// MarshalText encodes the verifier for storage.
+func (v *ChallengeVerifier) MarshalText() ([]byte, error) {
+	if v.Params == nil {
+		return nil, ErrUnsupported
+	}
+	return encodeRelief(idChallenge, v.Params, v.StoredKey, v.ServerKey)
+}
+
+// UnmarshalText decodes a stored verifier.
+func (v *ChallengeVerifier) UnmarshalText(text []byte) error {
+	cp, storedKey, serverKey, err := parseRelief(idChallenge, text)
+	if err != nil || len(storedKey) != sha256.Size || len(serverKey) != sha256.Size {
+		return ErrParse
+	}
+	v.Params, v.StoredKey, v.ServerKey = cp, storedKey, serverKey
+	return nil
+}
+
+// NewChallenge returns a random nonce for the auth message.
+func NewChallenge() ([]byte, error) {
+	return getSalt(challengeNoncelen)
+}
+
+// ChallengeProof is the client half, it returns the proof of knowledge of
+// password for authMessage and the server signature to expect.
+func ChallengeProof(cp *ClientParams, password, authMessage []byte) (proof, signature []byte, err error) {
+	salted, err := ClientHash(cp, password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clientKey, storedKey, serverKey := challengeKeys(salted)
+	proof = hmacSHA256(storedKey, authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+
+	return proof, hmacSHA256(serverKey, authMessage), nil
+}
+
+// Verify checks the client proof for authMessage and returns the server
+// signature proving the server knows the verifier.
+func (v *ChallengeVerifier) Verify(authMessage, proof []byte) ([]byte, error) {
+	if len(proof) != sha256.Size || len(v.StoredKey) != sha256.Size {
+		return nil, ErrMismatch
+	}
+
+	clientKey := hmacSHA256(v.StoredKey, authMessage)
+	for i := range clientKey {
+		clientKey[i] ^= proof[i]
+	}
+
+	sum := sha256.Sum256(clientKey)
+	if subtle.ConstantTimeCompare(sum[:], v.StoredKey) != 1 {
+		return nil, ErrMismatch
+	}
+
+	return hmacSHA256(v.ServerKey, authMessage), nil
+}
@@ -0,0 +1,266 @@
+//go:build go1.12
+// +build go1.12
+
+// passwd hashes, verifies, inspects and benchmarks password hashes.
+//
+//	passwd hash [-profile name | -params spec] [-mask] [-key-file file]
+//	passwd verify [-profile name | -params spec] [-mask] [-key-file file] hash
+//	passwd inspect hash
+//	passwd bench [-algorithm name] [-target duration] [-memory KiB]
+//
+// the passwords are read from stdin, one per line, never from the command
+// line (it leaks in the process list and the shell history): hash prints
+// a hash per password, verify exits with 1 on a mismatch.
+// profiles are named profiles (i.e. "argon2id-paranoid"), params are
+// parameters specifications (i.e. "argon2id:m=65536,t=3,p=4"), the
+// hashes of a key'ed or masked profile are only verified with the same
+// options.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/ermites-io/passwd"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: passwd hash [-profile name | -params spec] [-mask] [-key-file file]\n")
+	fmt.Fprintf(os.Stderr, "       passwd verify [-profile name | -params spec] [-mask] [-key-file file] hash\n")
+	fmt.Fprintf(os.Stderr, "       passwd inspect hash\n")
+	fmt.Fprintf(os.Stderr, "       passwd bench [-algorithm name] [-target duration] [-memory KiB]\n")
+	os.Exit(2)
+}
+
+// errMismatch is reported by verify, with the exit status 1.
+var errMismatch = errors.New("password mismatch")
+
+// profileFlags are the flags selecting the profile.
+type profileFlags struct {
+	profile *string
+	params  *string
+	mask    *bool
+	keyFile *string
+}
+
+func newProfileFlags(fs *flag.FlagSet) *profileFlags {
+	return &profileFlags{
+		profile: fs.String("profile", "", "named profile (i.e. argon2id-default)"),
+		params:  fs.String("params", "", "parameters specification (i.e. argon2id:m=65536,t=3,p=4)"),
+		mask:    fs.Bool("mask", false, "masked hashes (parameters not stored)"),
+		keyFile: fs.String("key-file", "", "read the profile secret from file"),
+	}
+}
+
+// new returns the profile of the flags, argon2id-default if none.
+func (pf *profileFlags) new() (*passwd.Profile, error) {
+	cfg := passwd.Config{Profile: *pf.profile, Params: *pf.params, Masked: *pf.mask}
+	if len(cfg.Profile) == 0 && len(cfg.Params) == 0 {
+		cfg.Profile = "argon2id-default"
+	}
+
+	p, err := passwd.NewFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(*pf.keyFile) > 0 {
+		key, err := ioutil.ReadFile(*pf.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		err = p.SetKey(bytes.TrimRight(key, "\r\n"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// readPasswords calls fn with every line of r.
+func readPasswords(r io.Reader, fn func(password []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		err := fn(bytes.TrimRight(scanner.Bytes(), "\r"))
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func hash(args []string) error {
+	fs := flag.NewFlagSet("hash", flag.ExitOnError)
+	pf := newProfileFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		usage()
+	}
+
+	p, err := pf.new()
+	if err != nil {
+		return err
+	}
+
+	return readPasswords(os.Stdin, func(password []byte) error {
+		hashed, err := p.Hash(password)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", hashed)
+		return nil
+	})
+}
+
+func verify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	pf := newProfileFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+	hashed := []byte(fs.Arg(0))
+
+	// the hash parameters, unless a profile is given.
+	compare := passwd.Compare
+	if len(*pf.profile) > 0 || len(*pf.params) > 0 || *pf.mask || len(*pf.keyFile) > 0 {
+		if len(*pf.profile) == 0 && len(*pf.params) == 0 {
+			info, err := passwd.Info(hashed)
+			if err == nil && info.Params != nil {
+				*pf.params, _ = passwd.FormatSpec(info.Params)
+			}
+		}
+		p, err := pf.new()
+		if err != nil {
+			return err
+		}
+		compare = func(hashed, password []byte) error {
+			_, err := p.CompareEx(hashed, password)
+			return err
+		}
+	}
+
+	return readPasswords(os.Stdin, func(password []byte) error {
+		err := compare(hashed, password)
+		switch err {
+		case nil:
+			fmt.Printf("ok\n")
+			return nil
+		case passwd.ErrMismatch:
+			return errMismatch
+		}
+		return err
+	})
+}
+
+func inspect(args []string) error {
+	if len(args) != 1 {
+		usage()
+	}
+
+	info, err := passwd.Info([]byte(args[0]))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("algorithm: %s\n", info.Algorithm)
+	fmt.Printf("id: %s\n", info.ID)
+	if info.Version > 0 {
+		fmt.Printf("version: %#x\n", info.Version)
+	}
+	fmt.Printf("salt: %d bytes\n", info.Saltlen)
+	if info.Params != nil {
+		spec, err := passwd.FormatSpec(info.Params)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("params: %s\n", spec)
+	}
+	fmt.Printf("masked: %v\n", info.Masked)
+	fmt.Printf("keyed: %v\n", info.Keyed)
+	fmt.Printf("locked: %v\n", info.Locked)
+	if !info.IssuedAt.IsZero() {
+		fmt.Printf("issued: %s\n", info.IssuedAt.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// benchProfiles are the algorithms bench calibrates.
+var benchProfiles = map[string]passwd.HashProfile{
+	"argon2id": passwd.Argon2idDefault,
+	"scrypt":   passwd.ScryptDefault,
+	"bcrypt":   passwd.BcryptDefault,
+	"pbkdf2":   passwd.Pbkdf2Default,
+}
+
+func bench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	algFlag := fs.String("algorithm", "argon2id", "argon2id, scrypt, bcrypt or pbkdf2")
+	targetFlag := fs.Duration("target", 250*time.Millisecond, "hash duration")
+	memoryFlag := fs.Uint("memory", 0, "maximum memory in KiB (the default profile one if 0)")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		usage()
+	}
+
+	profile, ok := benchProfiles[*algFlag]
+	if !ok {
+		usage()
+	}
+
+	p, err := passwd.Calibrate(profile, *targetFlag, uint32(*memoryFlag))
+	if err != nil {
+		return err
+	}
+
+	// the calibrated parameters, from a hash.
+	start := time.Now()
+	hashed, err := p.Hash([]byte("passwd/bench"))
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+
+	info, err := passwd.Info(hashed)
+	if err != nil {
+		return err
+	}
+	spec, err := passwd.FormatSpec(info.Params)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\t%v\n", spec, elapsed.Round(time.Millisecond))
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "hash":
+		err = hash(os.Args[2:])
+	case "verify":
+		err = verify(os.Args[2:])
+	case "inspect":
+		err = inspect(os.Args[2:])
+	case "bench":
+		err = bench(os.Args[2:])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "passwd: %v\n", err)
+		os.Exit(1)
+	}
+}
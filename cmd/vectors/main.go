@@ -0,0 +1,99 @@
+//go:build go1.12
+// +build go1.12
+
+// vectors generates and checks the passwd reproducibility vectors.
+//
+//	vectors generate [-o vectors.json]
+//	vectors check vectors.json
+//
+// it can be used from go:generate:
+//
+//	//go:generate go run github.com/ermites-io/passwd/cmd/vectors generate -o testdata/passwd-vectors.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/ermites-io/passwd"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: vectors generate [-o file]\n")
+	fmt.Fprintf(os.Stderr, "       vectors check file\n")
+	os.Exit(2)
+}
+
+func generate(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	outFlag := fs.String("o", "", "write the vectors to file instead of stdout")
+	fs.Parse(args)
+
+	vectors, err := passwd.GenerateVectors()
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if len(*outFlag) > 0 {
+		f, err := os.Create(*outFlag)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(vectors)
+}
+
+func check(args []string) error {
+	if len(args) != 1 {
+		usage()
+	}
+
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	var vectors []passwd.Vector
+	err = json.Unmarshal(data, &vectors)
+	if err != nil {
+		return err
+	}
+
+	err = passwd.CheckVectors(vectors)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d vectors verified\n", len(vectors))
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "generate":
+		err = generate(os.Args[2:])
+	case "check":
+		err = check(os.Args[2:])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "vectors: %v\n", err)
+		os.Exit(1)
+	}
+}
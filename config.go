@@ -0,0 +1,181 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+//
+// configuration files.
+//
+// the parameters types are text (un)marshalers using the ParseSpec()
+// notation, they configure from JSON, TOML or YAML values:
+//
+// {"params": "argon2id:m=65536,t=3,p=4,l=32,s=16"}
+//
+// NewFromConfig() builds the profile of a Config and refuses, at startup,
+// the parameters the options constructors refuse (see OptionError).
+// secrets are not configuration, they are set on the returned profile
+// (SetKey(), SetSecrets()..) from a secret store.
+//
+
+// Config describes a profile, either a named profile or parameters.
+type Config struct {
+	Profile string `json:"profile,omitempty"` // named profile, i.e. "argon2id-default"
+	Params  string `json:"params,omitempty"`  // parameters specification, see ParseSpec()
+	Masked  bool   `json:"masked,omitempty"`  // parameters are not stored in the hashes
+}
+
+// ParseConfig decodes a JSON Config.
+func ParseConfig(data []byte) (Config, error) {
+	var cfg Config
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&cfg)
+	if err != nil {
+		return Config{}, parseError(ErrParse, err)
+	}
+	return cfg, nil
+}
+
+// NewFromConfig returns the profile cfg describes, exactly one of Profile
+// and Params must be set.
+func NewFromConfig(cfg Config) (*Profile, error) {
+	switch {
+	case len(cfg.Profile) > 0 && len(cfg.Params) > 0:
+		return nil, ErrUnsupported
+	case len(cfg.Profile) > 0:
+		profile, ok := profileByName(cfg.Profile)
+		if !ok {
+			return nil, ErrUnsupported
+		}
+		if cfg.Masked {
+			return NewMasked(profile)
+		}
+		return New(profile)
+	case len(cfg.Params) > 0:
+		params, err := ParseSpec(cfg.Params)
+		if err != nil {
+			return nil, err
+		}
+		err = checkOptions(params)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Masked {
+			err = maskParams(params)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return NewCustom(params)
+	}
+	return nil, ErrUnsupported
+}
+
+// maskParams sets the Masked field of params.
+func maskParams(params interface{}) error {
+	switch v := params.(type) {
+	case *Argon2Params:
+		v.Masked = true
+	case *ScryptParams:
+		v.Masked = true
+	case *Pbkdf2Params:
+		v.Masked = true
+	default:
+		return ErrUnsupported
+	}
+	return nil
+}
+
+// unmarshalSpec parses text into the parameters of the type of dst.
+func unmarshalSpec(dst interface{}, text []byte) error {
+	params, err := ParseSpec(string(text))
+	if err != nil {
+		return err
+	}
+
+	switch d := dst.(type) {
+	case *Argon2Params:
+		v, ok := params.(*Argon2Params)
+		if !ok {
+			return ErrUnsupported
+		}
+		d.Version, d.Time, d.Memory, d.Thread = v.Version, v.Time, v.Memory, v.Thread
+		d.Saltlen, d.Keylen = v.Saltlen, v.Keylen
+	case *ScryptParams:
+		v, ok := params.(*ScryptParams)
+		if !ok {
+			return ErrUnsupported
+		}
+		d.N, d.R, d.P = v.N, v.R, v.P
+		d.Saltlen, d.Keylen = v.Saltlen, v.Keylen
+	case *BcryptParams:
+		v, ok := params.(*BcryptParams)
+		if !ok {
+			return ErrUnsupported
+		}
+		d.Cost = v.Cost
+	case *Pbkdf2Params:
+		v, ok := params.(*Pbkdf2Params)
+		if !ok {
+			return ErrUnsupported
+		}
+		d.PRF, d.Iterations = v.PRF, v.Iterations
+		d.Saltlen, d.Keylen = v.Saltlen, v.Keylen
+	default:
+		return ErrUnsupported
+	}
+	return nil
+}
+
+// MarshalText returns the parameters specification, see FormatSpec().
+func (p Argon2Params) MarshalText() ([]byte, error) {
+	s, err := FormatSpec(&p)
+	return []byte(s), err
+}
+
+// UnmarshalText parses an argon2 parameters specification, Masked is left
+// untouched.
+func (p *Argon2Params) UnmarshalText(text []byte) error {
+	return unmarshalSpec(p, text)
+}
+
+// MarshalText returns the parameters specification, see FormatSpec().
+func (p ScryptParams) MarshalText() ([]byte, error) {
+	s, err := FormatSpec(&p)
+	return []byte(s), err
+}
+
+// UnmarshalText parses a scrypt parameters specification, Masked is left
+// untouched.
+func (p *ScryptParams) UnmarshalText(text []byte) error {
+	return unmarshalSpec(p, text)
+}
+
+// MarshalText returns the parameters specification, see FormatSpec().
+func (p BcryptParams) MarshalText() ([]byte, error) {
+	s, err := FormatSpec(&p)
+	return []byte(s), err
+}
+
+// UnmarshalText parses a bcrypt parameters specification.
+func (p *BcryptParams) UnmarshalText(text []byte) error {
+	return unmarshalSpec(p, text)
+}
+
+// MarshalText returns the parameters specification, see FormatSpec().
+func (p Pbkdf2Params) MarshalText() ([]byte, error) {
+	s, err := FormatSpec(&p)
+	return []byte(s), err
+}
+
+// UnmarshalText parses a pbkdf2 parameters specification, Masked is left
+// untouched.
+func (p *Pbkdf2Params) UnmarshalText(text []byte) error {
+	return unmarshalSpec(p, text)
+}
@@ -0,0 +1,77 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"context"
+)
+
+//
+// cancellation.
+//
+// the Context variants give up the hashing work when ctx is done: while
+// waiting for the profile Limiter, and within the derivation for argon2
+// (at the next synchronization point, 4 per pass) and scrypt (within
+// 1/16th of a mixing loop), ctx.Err() is returned then.
+// bcrypt and pbkdf2 are not interruptible, ctx is only checked before they
+// start.
+// the argon2 and scrypt derivations use the Go implementation whatever the
+// backend.
+//
+
+// HashContext is Hash() giving up when ctx is done.
+func (p *Profile) HashContext(ctx context.Context, password []byte) ([]byte, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	hashed, err := p.withContext(ctx).Hash(password)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return hashed, err
+}
+
+// CompareContext is Compare() giving up when ctx is done.
+func (p *Profile) CompareContext(ctx context.Context, hashed, password []byte) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	err = p.withContext(ctx).Compare(hashed, password)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// DeriveContext is Derive() giving up when ctx is done.
+func (p *Profile) DeriveContext(ctx context.Context, password, salt []byte) ([]byte, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := p.withContext(ctx).Derive(password, salt)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return key, err
+}
+
+// withContext returns a copy of the profile whose work is cancelled by
+// ctx, the parameters of the profile are left untouched.
+func (p *Profile) withContext(ctx context.Context) *Profile {
+	c := p.copy()
+	c.ctx = ctx
+	switch v := c.params.(type) {
+	case *ScryptParams:
+		v.ctx = ctx
+	case *Argon2Params:
+		v.ctx = ctx
+	}
+	return c
+}
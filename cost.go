@@ -0,0 +1,105 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"strings"
+)
+
+//
+// cost model.
+//
+// the work factor of a parameter set is expressed in KiB x passes, roughly
+// the memory an attacker has to fill times the number of times it is walked
+// per guess:
+//
+// argon2: Time * Memory
+// scrypt: P * N * R / 4 (2 x N blocks of 128 x R bytes per lane)
+// bcrypt: 2^Cost * 4 (4KiB state, 2^Cost expensive key setups)
+// pbkdf2: Iterations * blocks / 1024 (no memory, 1KiB per 1024 HMAC)
+//
+// parallelism (argon2 threads) does not change the attacker cost, it is
+// ignored, so are the salt and key lengths.
+//
+
+func paramsCost(params interface{}) (uint64, error) {
+	switch v := params.(type) {
+	case *Argon2Params:
+		return uint64(v.Time) * uint64(v.Memory), nil
+	case *ScryptParams:
+		return uint64(v.P) * uint64(v.N) * uint64(v.R) / 4, nil
+	case *BcryptParams:
+		if v.Cost < 0 || v.Cost > 31 {
+			return 0, ErrUnsupported
+		}
+		return uint64(1) << uint(v.Cost) * 4, nil
+	case *Pbkdf2Params:
+		_, h, err := v.prf()
+		if err != nil {
+			return 0, err
+		}
+		size := uint64(h().Size())
+		blocks := (uint64(v.Keylen) + size - 1) / size
+		return uint64(v.Iterations) * blocks / 1024, nil
+	}
+	return 0, ErrUnsupported
+}
+
+// StrongerParams compares the work factors of two parameter sets
+// (*Argon2Params, *ScryptParams or *BcryptParams) and returns 1 if a is
+// stronger than b, -1 if b is stronger than a and 0 if they are equivalent.
+func StrongerParams(a, b interface{}) (int, error) {
+	ca, err := paramsCost(a)
+	if err != nil {
+		return 0, err
+	}
+	cb, err := paramsCost(b)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case ca > cb:
+		return 1, nil
+	case ca < cb:
+		return -1, nil
+	}
+	return 0, nil
+}
+
+// Stronger compares the work factors of two non-masked hashes, see
+// StrongerParams().
+func Stronger(a, b []byte) (int, error) {
+	pa, err := hashParams(a)
+	if err != nil {
+		return 0, err
+	}
+	pb, err := hashParams(b)
+	if err != nil {
+		return 0, err
+	}
+	return StrongerParams(pa, pb)
+}
+
+// hashParams returns the parameters stored in a native or PHC hash.
+func hashParams(hashed []byte) (interface{}, error) {
+	if isPHC(hashed) {
+		native, err := Reencode(hashed, FormatNative)
+		if err != nil {
+			return nil, err
+		}
+		hashed = native
+	}
+
+	core, err := coreHash(hashed)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.FieldsFunc(string(core), token)
+	if maskedFields(fields) {
+		return nil, ErrUnsupported // masked
+	}
+	return parseFromHashToParams(core)
+}
@@ -0,0 +1,62 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"github.com/ermites-io/passwd/internal/argon2"
+	"golang.org/x/sys/cpu"
+)
+
+//
+// CPU features and code paths.
+//
+// the fastest code path compiled in for the CPU is selected at startup,
+// the same binary serves heterogeneous fleets. the selection can be
+// inspected (i.e. in Doctor() reports) and overridden to rule out a code
+// path, every path produces identical outputs.
+// the wide vector extensions (AVX2, NEON..) are detected and reported,
+// they are only used by the code paths compiled in for them.
+//
+
+// CPUFeatures returns the detected CPU features relevant to the KDFs.
+func CPUFeatures() []string {
+	var features []string
+
+	for _, f := range []struct {
+		name string
+		has  bool
+	}{
+		{"sse4.1", cpu.X86.HasSSE41},
+		{"avx2", cpu.X86.HasAVX2},
+		{"avx512f", cpu.X86.HasAVX512F},
+		{"neon", cpu.ARM64.HasASIMD || cpu.ARM.HasNEON},
+		{"sha2", cpu.ARM64.HasSHA2},
+	} {
+		if f.has {
+			features = append(features, f.name)
+		}
+	}
+	return features
+}
+
+// KDFImplementations returns the argon2 code paths available on the CPU,
+// fastest first.
+func KDFImplementations() []string {
+	return argon2.Implementations()
+}
+
+// KDFImplementation returns the argon2 code path in use (i.e. "sse4.1",
+// "generic").
+func KDFImplementation() string {
+	return argon2.Implementation()
+}
+
+// SetKDFImplementation selects one of the KDFImplementations(), it must be
+// called before hashing starts (i.e. at init time).
+func SetKDFImplementation(name string) error {
+	if !argon2.SetImplementation(name) {
+		return ErrUnsupported
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+//
+// credential records are the structured storage of an account
+// credential, besides the hash they carry the per account parameter
+// override (i.e. paranoid parameters for privileged accounts), honored by
+// HashRecord() and CompareRecord() instead of the profile parameters.
+//
+
+// CredentialRecord is the stored credential of an account.
+type CredentialRecord struct {
+	Hash    string `json:"hash"`
+	Profile string `json:"profile,omitempty"` // parameters override, i.e. "argon2id-paranoid"
+}
+
+// forRecord returns the profile hashing and verifying rec, the override
+// profile must use the profile algorithm, its secret, digest transforms
+// and masking apply.
+func (p *Profile) forRecord(rec *CredentialRecord) (*Profile, error) {
+	if len(rec.Profile) == 0 {
+		return p, nil
+	}
+
+	profile, ok := profileByName(rec.Profile)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	var override interface{}
+	switch v := params[profile].(type) {
+	case Argon2Params:
+		pv, ok := p.params.(*Argon2Params)
+		if !ok {
+			return nil, ErrUnsupported
+		}
+		v.Masked = pv.Masked
+		override = &v
+	case ScryptParams:
+		pv, ok := p.params.(*ScryptParams)
+		if !ok {
+			return nil, ErrUnsupported
+		}
+		v.Masked = pv.Masked
+		override = &v
+	case Pbkdf2Params:
+		pv, ok := p.params.(*Pbkdf2Params)
+		if !ok {
+			return nil, ErrUnsupported
+		}
+		v.Masked = pv.Masked
+		override = &v
+	case BcryptParams:
+		if _, ok := p.params.(*BcryptParams); !ok {
+			return nil, ErrUnsupported
+		}
+		override = &v
+	}
+
+	o := p.clone()
+	o.params = p.carryParams(override)
+	return o, nil
+}
+
+// HashRecord hashes password into rec with the rec parameters override,
+// if any.
+func (p *Profile) HashRecord(rec *CredentialRecord, password []byte) error {
+	o, err := p.forRecord(rec)
+	if err != nil {
+		return err
+	}
+
+	hashed, err := o.Hash(password)
+	if err != nil {
+		return err
+	}
+	rec.Hash = string(hashed)
+	return nil
+}
+
+// CompareRecord compares the rec hash against password like CompareEx(),
+// NeedsRehash is reported if the hash parameters differ from the rec
+// override ones (the profile ones if none).
+func (p *Profile) CompareRecord(rec *CredentialRecord, password []byte) (Result, error) {
+	o, err := p.forRecord(rec)
+	if err != nil {
+		return Result{}, err
+	}
+	return o.CompareEx([]byte(rec.Hash), password)
+}
@@ -0,0 +1,89 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+//
+// degraded hashing.
+//
+// when the rate limiter or the memory budget refuses the hashing work, a
+// profile with a fallback hashes with the (cheaper) fallback parameters instead of
+// failing, the produced hashes are flagged:
+//
+// $ID$dg=1$b64(SALT)$...
+//
+// Compare() verifies flagged hashes with the fallback parameters and
+// CompareEx() reports them with NeedsRehash set, so they are upgraded at
+// the next successful login.
+//
+
+const metaDegraded = "dg" // produced with the fallback parameters
+
+// SetFallback sets the lower cost parameters used by Hash() when the rate
+// limiter (SetRateLimiter()) or the memory budget (SetMemoryBudget())
+// refuses the work, nil removes the fallback.
+// params must use the profile algorithm, the profile secret and digest
+// transforms apply, and must stay configured to verify degraded hashes.
+func (p *Profile) SetFallback(params interface{}) error {
+	switch v := params.(type) {
+	case nil:
+		p.fallback = nil
+		return nil
+	case *ScryptParams:
+		if _, ok := p.params.(*ScryptParams); ok {
+			fb := *v
+			p.fallback = &fb
+			return nil
+		}
+	case *Argon2Params:
+		if _, ok := p.params.(*Argon2Params); ok {
+			fb := *v
+			p.fallback = &fb
+			return nil
+		}
+	case *BcryptParams:
+		if _, ok := p.params.(*BcryptParams); ok {
+			fb := *v
+			p.fallback = &fb
+			return nil
+		}
+	case *Pbkdf2Params:
+		if _, ok := p.params.(*Pbkdf2Params); ok {
+			fb := *v
+			p.fallback = &fb
+			return nil
+		}
+	}
+	return ErrUnsupported
+}
+
+// degraded returns a copy of the profile using the fallback parameters.
+func (p *Profile) degraded() *Profile {
+	var params interface{}
+
+	switch v := p.fallback.(type) {
+	case *ScryptParams:
+		fb := *v
+		params = &fb
+	case *Argon2Params:
+		fb := *v
+		params = &fb
+	case *BcryptParams:
+		fb := *v
+		params = &fb
+	case *Pbkdf2Params:
+		fb := *v
+		params = &fb
+	}
+
+	d := p.clone()
+	d.params = p.carryParams(params)
+	return d
+}
+
+// Degraded returns true if hashed was produced with fallback parameters
+// and should be rehashed.
+func Degraded(hashed []byte) bool {
+	_, md, err := splitMetadata(hashed)
+	return err == nil && md[metaDegraded] == "1"
+}
@@ -0,0 +1,193 @@
+//go:build go1.12
+// +build go1.12
+
+// Package denylist provides a compact bloom filter of common (leaked)
+// passwords usable as a passwd.PolicyChecker.
+package denylist
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/ermites-io/passwd"
+)
+
+//
+// the filter is a classic bloom filter of m bits and k probes, the probes
+// are derived by double hashing:
+//
+// h1 || h2 = SHA-256(lowercase(word))[:16]
+// probe_i  = (h1 + i * h2) mod m
+//
+// words are lower cased, "Password123" and "password123" are the same entry.
+// the binary form is:
+//
+// "pdl1" || k (1 byte) || m (8 bytes, big endian) || bits
+//
+
+const (
+	magic = "pdl1"
+
+	// maxProbes bounds the number of probes of a filter
+	maxProbes = 32
+)
+
+// Error is the type helping defining errors as constants.
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+const (
+	// ErrFormat when a serialized filter is invalid
+	ErrFormat = Error("invalid filter")
+)
+
+// Filter is a bloom filter of denied passwords, a Filter is a
+// passwd.PolicyChecker.
+// a Filter is built by New() or UnmarshalBinary(), the zero Filter is
+// empty: it contains nothing and refuses the words added to it.
+type Filter struct {
+	k    uint8
+	m    uint64
+	bits []byte
+}
+
+// New returns an empty filter sized for n words with a false positive rate
+// of at most fp (0 < fp < 1).
+func New(n int, fp float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+	if fp <= 0 || fp >= 1 {
+		fp = 0.001
+	}
+
+	m := uint64(math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2)))
+	k := int(math.Round(float64(m) / float64(n) * math.Ln2))
+	switch {
+	case k < 1:
+		k = 1
+	case k > maxProbes:
+		k = maxProbes
+	}
+
+	m = (m + 7) &^ 7 // whole bytes
+	return &Filter{
+		k:    uint8(k),
+		m:    m,
+		bits: make([]byte, m/8),
+	}
+}
+
+func (f *Filter) probes(word string) (h1, h2 uint64) {
+	sum := sha256.Sum256([]byte(strings.ToLower(word)))
+	h1 = binary.BigEndian.Uint64(sum[0:8])
+	h2 = binary.BigEndian.Uint64(sum[8:16]) | 1 // odd, never 0
+	return h1, h2
+}
+
+// Add inserts word in the filter, a zero Filter ignores it.
+func (f *Filter) Add(word string) {
+	if f.m == 0 {
+		return
+	}
+
+	h1, h2 := f.probes(word)
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// AddFrom inserts every non empty line read from r (i.e. a wordlist), it
+// returns the number of added words.
+func (f *Filter) AddFrom(r io.Reader) (int, error) {
+	if f.m == 0 {
+		return 0, passwd.ErrUnsupported
+	}
+	count := 0
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		word := strings.TrimRight(scanner.Text(), "\r")
+		if word == "" {
+			continue
+		}
+		f.Add(word)
+		count++
+	}
+
+	return count, scanner.Err()
+}
+
+// Contains returns true if password is (probably) in the filter, false
+// positives are possible, false negatives are not.
+func (f *Filter) Contains(password []byte) bool {
+	if f.m == 0 {
+		return false
+	}
+
+	h1, h2 := f.probes(string(password))
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Check implements passwd.PolicyChecker, denied passwords are reported
+// with a *passwd.PolicyError.
+func (f *Filter) Check(password []byte) error {
+	if !f.Contains(password) {
+		return nil
+	}
+
+	return &passwd.PolicyError{
+		Violations: []passwd.Violation{
+			{Rule: "denylist", Reason: "common password"},
+		},
+	}
+}
+
+// MarshalBinary returns the compact binary form of the filter.
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	if f.m == 0 {
+		return nil, passwd.ErrUnsupported
+	}
+
+	out := make([]byte, 0, len(magic)+1+8+len(f.bits))
+	out = append(out, magic...)
+	out = append(out, f.k)
+
+	var m [8]byte
+	binary.BigEndian.PutUint64(m[:], f.m)
+	out = append(out, m[:]...)
+
+	return append(out, f.bits...), nil
+}
+
+// UnmarshalBinary loads a filter produced by MarshalBinary.
+func (f *Filter) UnmarshalBinary(data []byte) error {
+	hdr := len(magic) + 1 + 8
+	if len(data) < hdr || string(data[:len(magic)]) != magic {
+		return ErrFormat
+	}
+
+	k := data[len(magic)]
+	m := binary.BigEndian.Uint64(data[len(magic)+1 : hdr])
+	bits := data[hdr:]
+	if k < 1 || k > maxProbes || m == 0 || m%8 != 0 || m/8 != uint64(len(bits)) {
+		return ErrFormat
+	}
+
+	f.k = k
+	f.m = m
+	f.bits = append([]byte(nil), bits...)
+	return nil
+}
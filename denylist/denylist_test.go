@@ -0,0 +1,78 @@
+package denylist
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ermites-io/passwd"
+)
+
+func TestFilter(t *testing.T) {
+	words := "password\n123456\r\npassword123\n\nqwerty\n"
+
+	f := New(1000, 0.001)
+	n, err := f.AddFrom(strings.NewReader(words))
+	if err != nil || n != 4 {
+		t.Fatalf("add from: %d (%v) vs expected: %d\n", n, err, 4)
+	}
+
+	data, _ := f.MarshalBinary()
+	var loaded Filter
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal: %v\n", err)
+	}
+
+	for _, filter := range []*Filter{f, &loaded} {
+		for i, test := range []struct {
+			password string
+			denied   bool
+		}{
+			{"password", true},
+			{"Password123", true},
+			{"qwerty", true},
+			{"correct horse battery staple", false},
+			{"", false},
+		} {
+			if filter.Contains([]byte(test.password)) != test.denied {
+				t.Fatalf("test #%d: contains %q vs expected: %v\n", i, test.password, test.denied)
+			}
+			err := filter.Check([]byte(test.password))
+			if _, ok := err.(*passwd.PolicyError); ok != test.denied {
+				t.Fatalf("test #%d: check %q err: %v\n", i, test.password, err)
+			}
+		}
+	}
+
+	// false positive rate sanity check.
+	fp := 0
+	for i := 0; i < 10000; i++ {
+		if f.Contains([]byte(fmt.Sprintf("not-in-the-list-%d", i))) {
+			fp++
+		}
+	}
+	if fp > 50 {
+		t.Fatalf("%d false positives out of 10000\n", fp)
+	}
+
+	for i, data := range [][]byte{nil, []byte("pdl1"), append([]byte("pdl1\x05\x00\x00\x00\x00\x00\x00\x00\x10"), 0x00)} {
+		if err := loaded.UnmarshalBinary(data); err != ErrFormat {
+			t.Fatalf("test #%d: unmarshal err: %v vs expected: %v\n", i, err, ErrFormat)
+		}
+	}
+}
+
+func TestZeroFilter(t *testing.T) {
+	var f Filter
+
+	f.Add("password")
+	if f.Contains([]byte("password")) || f.Check([]byte("password")) != nil {
+		t.Fatalf("zero filter contains a password\n")
+	}
+	if _, err := f.AddFrom(strings.NewReader("password\n")); err != passwd.ErrUnsupported {
+		t.Fatalf("add from err: %v vs expected: %v\n", err, passwd.ErrUnsupported)
+	}
+	if _, err := f.MarshalBinary(); err != passwd.ErrUnsupported {
+		t.Fatalf("marshal err: %v vs expected: %v\n", err, passwd.ErrUnsupported)
+	}
+}
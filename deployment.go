@@ -0,0 +1,71 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"encoding/binary"
+)
+
+//
+// deployment binding.
+//
+// a lighter sibling of the row binding (WithRecord()): the hashes are
+// bound to the deployment identity through the associated data mechanism,
+// a hash copied from staging to production (or across services) no
+// longer verifies:
+//
+// ad = label || 0x00 || len(service) || service || len(env) || env || len(host) || host
+//
+// lengths are uvarint encoded, the identity is not stored, Compare()
+// requires the same expected deployment.
+//
+
+const labelDeployment = "passwd/deployment/v1"
+
+// Deployment is the identity produced hashes are bound to.
+type Deployment struct {
+	Service     string // service name (i.e. "accounts")
+	Environment string // i.e. "production", "staging"
+	Host        string // optional, binds the hashes to a single host
+}
+
+func (d Deployment) encode() []byte {
+	var length [binary.MaxVarintLen64]byte
+
+	ad := []byte(labelDeployment)
+	ad = append(ad, 0x00)
+	for _, v := range []string{d.Service, d.Environment, d.Host} {
+		n := binary.PutUvarint(length[:], uint64(len(v)))
+		ad = append(ad, length[:n]...)
+		ad = append(ad, v...)
+	}
+	return ad
+}
+
+// SetDeployment binds produced hashes to the deployment identity d, the
+// service is required, the zero Deployment removes the binding.
+// it combines with SetAssociatedData().
+func (p *Profile) SetDeployment(d Deployment) error {
+	switch {
+	case d == Deployment{}:
+		p.deployment = nil
+	case d.Service == "":
+		return ErrUnsupported
+	default:
+		p.deployment = d.encode()
+	}
+	return nil
+}
+
+// WithDeployment returns a copy of the profile bound to d (i.e. to verify
+// hashes created by another environment during a migration), leaving p
+// untouched.
+func (p *Profile) WithDeployment(d Deployment) (*Profile, error) {
+	c := p.clone()
+	err := c.SetDeployment(d)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
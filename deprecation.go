@@ -0,0 +1,57 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"sync"
+)
+
+// DeprecationPolicy returns true if params (*Argon2Params, *ScryptParams or
+// *BcryptParams) are deprecated.
+type DeprecationPolicy func(params interface{}) bool
+
+var (
+	deprecationMu      sync.RWMutex
+	deprecationPolicy  DeprecationPolicy
+	deprecationHandler func(params interface{})
+)
+
+// OnDeprecated registers handler to be called with the parameters of every
+// hash successfully verified by Compare() that policy marks as deprecated
+// (i.e. to count the remaining bcrypt cost 10 users), the parameters are a
+// copy without any secret.
+// a nil policy or handler removes the registration.
+// handler is called synchronously, it must be fast and safe for concurrent
+// use.
+func OnDeprecated(policy DeprecationPolicy, handler func(params interface{})) {
+	deprecationMu.Lock()
+	defer deprecationMu.Unlock()
+
+	deprecationPolicy = policy
+	deprecationHandler = handler
+}
+
+// WeakerThan returns a DeprecationPolicy marking as deprecated the
+// parameters with a lower work factor than min (see StrongerParams()).
+func WeakerThan(min interface{}) DeprecationPolicy {
+	return func(params interface{}) bool {
+		cmp, err := StrongerParams(params, min)
+		return err == nil && cmp < 0
+	}
+}
+
+func notifyDeprecated(params interface{}) {
+	deprecationMu.RLock()
+	policy, handler := deprecationPolicy, deprecationHandler
+	deprecationMu.RUnlock()
+
+	if policy == nil || handler == nil {
+		return
+	}
+
+	public := publicParams(params)
+	if policy(public) {
+		handler(public)
+	}
+}
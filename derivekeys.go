@@ -0,0 +1,56 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+//
+// multiple keys derivation.
+//
+// the profile KDF stretches the password once, every key is expanded from
+// the stretched key with its own info label:
+//
+// key[i] = HKDF-SHA3-256(Derive(password, salt), info = infos[i])
+//
+// the keys have the length of Derive() ones and are independent, knowing
+// one of them tells nothing about the others.
+//
+
+// DeriveKeys derives one key per info label (i.e. "encryption", "mac")
+// from password and salt, with the cost of a single Derive().
+// the labels must be distinct, the same password, salt and label always
+// give the same key.
+func (p *Profile) DeriveKeys(password, salt []byte, infos ...[]byte) ([][]byte, error) {
+	if len(infos) == 0 {
+		return nil, ErrUnsupported
+	}
+	for i := range infos {
+		for j := 0; j < i; j++ {
+			if bytes.Equal(infos[i], infos[j]) {
+				return nil, ErrUnsupported
+			}
+		}
+	}
+
+	key, err := p.Derive(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(key)
+
+	keys := make([][]byte, len(infos))
+	for i, info := range infos {
+		keys[i] = make([]byte, len(key))
+		_, err = io.ReadFull(hkdf.New(newSHA3256, key, nil, info), keys[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
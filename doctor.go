@@ -0,0 +1,124 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+//
+// environment diagnostics.
+//
+// Doctor() reports what the host offers to the KDFs and benchmarks the
+// profiles, for startup checks and support bundles. the memory figures are
+// read from /proc and the cgroup hierarchy on linux, they are 0 (unknown)
+// on the other systems.
+//
+
+// slowHash is the benchmark duration over which a profile is reported as
+// slow for interactive logins.
+const slowHash = time.Second
+
+// DoctorBenchmark is the benchmark of a profile.
+type DoctorBenchmark struct {
+	Profile  string        // profile name, i.e. "argon2id-default"
+	Memory   uint64        // estimated peak memory (bytes)
+	Duration time.Duration // one hash, 0 if skipped
+	Skipped  bool          // not run, it does not fit in memory
+}
+
+// DoctorReport describes the host and the profiles costs.
+type DoctorReport struct {
+	GOOS       string
+	GOARCH     string
+	CPUs       int
+	GOMAXPROCS int
+	Backend    string   // KDF backend, see Backend()
+	KDFPath    string   // argon2 code path, see KDFImplementation()
+	Features   []string // see CPUFeatures()
+
+	MemTotal     uint64 // bytes, 0 if unknown
+	MemAvailable uint64 // bytes, 0 if unknown
+	SwapTotal    uint64 // bytes, swap is enabled if > 0
+	CgroupLimit  uint64 // cgroup memory limit (bytes), 0 if none or unknown
+
+	Benchmarks []DoctorBenchmark
+	Warnings   []string
+}
+
+func mib(n uint64) string {
+	return fmt.Sprintf("%d MiB", n>>20)
+}
+
+// Doctor returns the report of the host and the benchmark of a hash for
+// each of profiles (VectorProfiles if none), the profiles exceeding the
+// memory limits are not run.
+func Doctor(profiles ...HashProfile) *DoctorReport {
+	if len(profiles) == 0 {
+		profiles = VectorProfiles
+	}
+
+	r := DoctorReport{
+		GOOS:       runtime.GOOS,
+		GOARCH:     runtime.GOARCH,
+		CPUs:       runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Backend:    Backend(),
+		KDFPath:    KDFImplementation(),
+		Features:   CPUFeatures(),
+	}
+	r.MemTotal, r.MemAvailable, r.SwapTotal = hostMemory()
+	r.CgroupLimit = cgroupMemoryLimit()
+
+	if r.SwapTotal > 0 {
+		r.Warnings = append(r.Warnings, "swap is enabled, KDF memory (derived from passwords) may be written to disk")
+	}
+
+	for _, profile := range profiles {
+		r.benchmark(profile)
+	}
+	return &r
+}
+
+func (r *DoctorReport) warnf(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+func (r *DoctorReport) benchmark(profile HashProfile) {
+	name, _ := profileName(profile)
+	p, err := New(profile)
+	if err != nil {
+		r.warnf("%s: %v", name, err)
+		return
+	}
+
+	b := DoctorBenchmark{Profile: name, Memory: paramsMemory(p.params)}
+	switch {
+	case r.CgroupLimit > 0 && b.Memory > r.CgroupLimit:
+		r.warnf("%s needs %s, exceeds the cgroup memory limit (%s)", name, mib(b.Memory), mib(r.CgroupLimit))
+		b.Skipped = true
+	case r.MemAvailable > 0 && b.Memory > r.MemAvailable:
+		r.warnf("%s needs %s, exceeds the available memory (%s)", name, mib(b.Memory), mib(r.MemAvailable))
+		b.Skipped = true
+	}
+
+	if v, ok := p.params.(*Argon2Params); ok && int(v.Thread) > r.GOMAXPROCS {
+		r.warnf("%s uses %d threads, GOMAXPROCS is %d", name, v.Thread, r.GOMAXPROCS)
+	}
+
+	if !b.Skipped {
+		start := time.Now()
+		_, err = p.Hash([]byte("passwd/doctor"))
+		b.Duration = time.Since(start)
+		switch {
+		case err != nil:
+			r.warnf("%s: %v", name, err)
+		case b.Duration > slowHash:
+			r.warnf("%s takes %v per hash", name, b.Duration.Round(time.Millisecond))
+		}
+	}
+	r.Benchmarks = append(r.Benchmarks, b)
+}
@@ -0,0 +1,64 @@
+//go:build go1.12 && linux
+// +build go1.12,linux
+
+package passwd
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// hostMemory returns the total, available and swap memory from
+// /proc/meminfo.
+func hostMemory() (total, available, swap uint64) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, 0, 0
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = kb << 10
+		case "MemAvailable:":
+			available = kb << 10
+		case "SwapTotal:":
+			swap = kb << 10
+		}
+	}
+	return total, available, swap
+}
+
+// cgroupMemoryLimit returns the memory limit of the cgroup v2 (or v1)
+// hierarchy, 0 if unlimited.
+func cgroupMemoryLimit() uint64 {
+	for _, path := range []string{
+		"/sys/fs/cgroup/memory.max",
+		"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+	} {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		// "max" (v2) or a page rounded huge value (v1) when unlimited.
+		limit, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil || limit >= 1<<62 {
+			return 0
+		}
+		return limit
+	}
+	return 0
+}
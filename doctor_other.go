@@ -0,0 +1,12 @@
+//go:build go1.12 && !linux
+// +build go1.12,!linux
+
+package passwd
+
+func hostMemory() (total, available, swap uint64) {
+	return 0, 0, 0
+}
+
+func cgroupMemoryLimit() uint64 {
+	return 0
+}
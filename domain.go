@@ -0,0 +1,61 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"crypto/hmac"
+)
+
+//
+// application domain separation.
+//
+// the password is folded with the application domain label before the
+// derivation, the same password hashed for two applications gives
+// unrelated hashes and a hash leaked from one cannot be verified by the
+// other:
+//
+// data = b64(hmac_sha3-256(label || 0x00 || password, domain))
+//
+// the produced hashes record a short digest of the domain:
+//
+// $ID$dm=b64(sha3-256(label || 0x00 || domain)[:8])$b64(SALT)$...
+//
+
+const (
+	labelDomain = "passwd/domain/v1"
+
+	domainTagLen = 8
+)
+
+func foldDomain(domain string, password []byte) []byte {
+	h := hmac.New(newSHA3256, []byte(domain))
+	h.Write([]byte(labelDomain))
+	h.Write([]byte{0x00})
+	h.Write(password)
+	return base64Encode(h.Sum(nil))
+}
+
+func domainTag(domain string) string {
+	h := newSHA3256()
+	h.Write([]byte(labelDomain))
+	h.Write([]byte{0x00})
+	h.Write([]byte(domain))
+	return string(base64Encode(h.Sum(nil)[:domainTagLen]))
+}
+
+// SetDomain binds produced hashes to the application domain label (i.e.
+// "accounts.example.com"), Compare() requires the same domain, an empty
+// domain removes the binding.
+func (p *Profile) SetDomain(domain string) error {
+	p.domain = domain
+	return nil
+}
+
+// WithDomain returns a copy of the profile bound to domain, leaving p
+// untouched.
+func (p *Profile) WithDomain(domain string) *Profile {
+	c := p.clone()
+	c.domain = domain
+	return c
+}
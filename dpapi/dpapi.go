@@ -0,0 +1,51 @@
+//go:build go1.12
+// +build go1.12
+
+// Package dpapi stores and retrieves the passwd pepper protected by the
+// Windows Data Protection API, so Windows service deployments do not keep
+// the secret in a plaintext configuration file.
+//
+// on other platforms every function returns passwd.ErrUnsupported.
+package dpapi
+
+import (
+	"io/ioutil"
+)
+
+// Scope selects who can unprotect the data.
+type Scope int
+
+const (
+	// UserScope restricts unprotecting to the current user (i.e. the
+	// service account).
+	UserScope Scope = iota
+	// MachineScope allows any process of the machine to unprotect.
+	MachineScope
+)
+
+// entropy binds the protected blobs to this package.
+var entropy = []byte("passwd/dpapi/v1")
+
+// StoreSecret protects secret with scope and writes the blob to path.
+func StoreSecret(path string, secret []byte, scope Scope) error {
+	blob, err := Protect(secret, scope)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, blob, 0600)
+}
+
+// FileSecret is a passwd.SecretProvider reading a blob written by
+// StoreSecret().
+type FileSecret struct {
+	Path string
+}
+
+// Secret reads and unprotects the secret.
+func (f FileSecret) Secret() ([]byte, error) {
+	blob, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	return Unprotect(blob)
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package dpapi
+
+import (
+	"github.com/ermites-io/passwd"
+)
+
+// Protect is only supported on windows.
+func Protect(data []byte, scope Scope) ([]byte, error) {
+	return nil, passwd.ErrUnsupported
+}
+
+// Unprotect is only supported on windows.
+func Unprotect(data []byte) ([]byte, error) {
+	return nil, passwd.ErrUnsupported
+}
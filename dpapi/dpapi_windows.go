@@ -0,0 +1,53 @@
+//go:build windows
+// +build windows
+
+package dpapi
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+func blob(b []byte) *windows.DataBlob {
+	if len(b) == 0 {
+		return &windows.DataBlob{}
+	}
+	return &windows.DataBlob{Size: uint32(len(b)), Data: &b[0]}
+}
+
+// take copies and frees a DataBlob allocated by the system.
+func take(out *windows.DataBlob) []byte {
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+
+	b := make([]byte, out.Size)
+	copy(b, (*[1 << 30]byte)(unsafe.Pointer(out.Data))[:out.Size:out.Size])
+	return b
+}
+
+// Protect encrypts data with DPAPI for scope.
+func Protect(data []byte, scope Scope) ([]byte, error) {
+	var out windows.DataBlob
+
+	flags := uint32(windows.CRYPTPROTECT_UI_FORBIDDEN)
+	if scope == MachineScope {
+		flags |= windows.CRYPTPROTECT_LOCAL_MACHINE
+	}
+
+	err := windows.CryptProtectData(blob(data), nil, blob(entropy), 0, nil, flags, &out)
+	if err != nil {
+		return nil, err
+	}
+	return take(&out), nil
+}
+
+// Unprotect decrypts a blob produced by Protect().
+func Unprotect(data []byte) ([]byte, error) {
+	var out windows.DataBlob
+
+	err := windows.CryptUnprotectData(blob(data), nil, blob(entropy), 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out)
+	if err != nil {
+		return nil, err
+	}
+	return take(&out), nil
+}
@@ -0,0 +1,54 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+//
+// dual write migrations.
+//
+// while a legacy system still reads the credentials table, both a hash it
+// understands (i.e. bcrypt) and the new one (i.e. argon2id) are stored,
+// the legacy column is dropped once the legacy system is retired.
+//
+
+// DualWrite hashes with and verifies hashes of two profiles.
+type DualWrite struct {
+	Legacy  *Profile // profile of the hashes the legacy system reads
+	Current *Profile // profile of the new hashes
+}
+
+// RehashPair returns the hashes of password with both profiles, either
+// both hashes are returned or none.
+func (d *DualWrite) RehashPair(password []byte) (legacy, current []byte, err error) {
+	if d.Legacy == nil || d.Current == nil {
+		return nil, nil, ErrUnsupported
+	}
+
+	defer d.Current.wipePassword(password)
+
+	current, err = d.Current.keep().Hash(password)
+	if err != nil {
+		return nil, nil, err
+	}
+	legacy, err = d.Legacy.Hash(password)
+	if err != nil {
+		return nil, nil, err
+	}
+	return legacy, current, nil
+}
+
+// Compare verifies hashed produced by either profile, the current profile
+// is tried first, the legacy one only on ErrMismatch or ErrUnsupportedAlgo.
+func (d *DualWrite) Compare(hashed, password []byte) error {
+	if d.Legacy == nil || d.Current == nil {
+		return ErrUnsupported
+	}
+
+	defer d.Current.wipePassword(password)
+
+	err := d.Current.keep().Compare(hashed, password)
+	if err != ErrMismatch && !isError(err, ErrUnsupportedAlgo) {
+		return err
+	}
+	return d.Legacy.Compare(hashed, password)
+}
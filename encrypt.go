@@ -0,0 +1,124 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+//
+// encrypted hashes.
+//
+// with an encryption key the whole encoded hash (identifier, parameters,
+// metadata, salt and digest) is sealed with XChaCha20-Poly1305 into an
+// opaque value:
+//
+// $2e$b64(NONCE|CIPHERTEXT)
+//
+// a stolen database then reveals neither the algorithm, its costs nor the
+// salts, and offline guessing needs the key, which stays in the
+// application (or its KMS), unlike a pepper it also protects the hashes of
+// profiles without secret.
+// Compare() opens the encrypted hashes and verifies the plain ones as
+// before, CompareEx() reports NeedsRehash for the plain ones,
+// EncryptHash() converts stored hashes without the passwords.
+// the functions inspecting a stored hash (Info(), SecretID()..) see an
+// opaque value, DecryptHash() first.
+//
+
+const (
+	idEncrypted = "2e"
+
+	labelEncrypted = "passwd/aead/v1"
+)
+
+// SetEncryptionKey makes the profile encrypt the hashes it produces with
+// key (32 bytes), nil removes it.
+func (p *Profile) SetEncryptionKey(key []byte) error {
+	if key == nil {
+		p.aead = nil
+		return nil
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return ErrUnsupported
+	}
+	p.aead = aead
+	return nil
+}
+
+// isEncrypted returns true if hashed is an encrypted hash.
+func isEncrypted(hashed []byte) bool {
+	return bytes.HasPrefix(hashed, []byte(string(separatorRune)+idEncrypted+string(separatorRune)))
+}
+
+// EncryptHash returns hashed encrypted with the profile key, hashed if it
+// is already encrypted.
+func (p *Profile) EncryptHash(hashed []byte) ([]byte, error) {
+	if p.aead == nil {
+		return nil, ErrUnsupported
+	}
+	if isEncrypted(hashed) {
+		return hashed, nil
+	}
+	return sealHash(p.aead, hashed)
+}
+
+// DecryptHash returns the hash encrypted in hashed, hashed if it is not
+// encrypted, ErrCorrupted if it does not open with the profile key.
+func (p *Profile) DecryptHash(hashed []byte) ([]byte, error) {
+	if !isEncrypted(hashed) {
+		return hashed, nil
+	}
+	if p.aead == nil {
+		return nil, ErrUnsupported
+	}
+	return openHash(p.aead, hashed)
+}
+
+// sealHash encrypts hashed.
+func sealHash(aead cipher.AEAD, hashed []byte) ([]byte, error) {
+	nonce, err := getSalt(uint32(aead.NonceSize()))
+	if err != nil {
+		return nil, err
+	}
+	sealed := aead.Seal(nonce, nonce, hashed, []byte(labelEncrypted))
+
+	var out bytes.Buffer
+	_, err = fmt.Fprintf(&out, "%c%s%c%s",
+		separatorRune, idEncrypted,
+		separatorRune, base64Encode(sealed))
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// openHash decrypts the encrypted hash hashed.
+func openHash(aead cipher.AEAD, hashed []byte) ([]byte, error) {
+	sealed, err := base64Decode(hashed[len(idEncrypted)+2:])
+	if err != nil || len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrCorrupted
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, []byte(labelEncrypted))
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+	return plain, nil
+}
+
+// encryptHash encrypts the produced hash if the profile has a key.
+func (p *Profile) encryptHash(hashed []byte) ([]byte, error) {
+	if p.aead == nil {
+		return hashed, nil
+	}
+	return sealHash(p.aead, hashed)
+}
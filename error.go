@@ -13,7 +13,6 @@ type Error string
 func (e Error) Error() string { return string(e) }
 
 const (
-	errSalt = Error("salt error")
 	// ErrParse when a parse error happened
 	ErrParse = Error("parse error")
 	// ErrHash when a hashing error occurs
@@ -24,4 +23,104 @@ const (
 	ErrMismatch = Error("mismatch")
 	// ErrUnsafe is to notify of password hashing parameters strength
 	ErrUnsafe = Error("unsafe parameters")
+	// ErrSecretRequired when hashing without a secret is forbidden by the
+	// profile
+	ErrSecretRequired = Error("secret required")
+	// ErrSecretTooShort when the provided secret is too short
+	ErrSecretTooShort = Error("secret too short")
+	// ErrSecretWeak when the provided secret looks weak (all zero, low
+	// entropy..)
+	ErrSecretWeak = Error("weak secret")
+	// ErrCorrupted when a stored hash fails its integrity check
+	ErrCorrupted = Error("corrupted hash")
+	// ErrBinding when a stored hash is not bound to the expected record
+	ErrBinding = Error("binding mismatch")
+	// ErrLocked when the stored hash carries a lock marker
+	ErrLocked = Error("locked")
+	// ErrExpired when the password matches but the stored hash expired
+	ErrExpired = Error("expired")
+	// ErrPasswordEmpty when hashing an empty password is forbidden by the
+	// profile
+	ErrPasswordEmpty = Error("empty password")
+	// ErrPasswordTooShort when the password is shorter than the profile
+	// minimum length
+	ErrPasswordTooShort = Error("password too short")
+	// ErrPasswordTooLong when a password exceeds the profile maximum length
+	// (see SetPolicy()), the io.Reader limit or bcrypt 72 bytes (see
+	// SetTruncationPolicy())
+	ErrPasswordTooLong = Error("password too long")
+	// ErrWeakPassword when the password is refused by the profile policy (a
+	// common password, a *PolicyError of the checker)
+	ErrWeakPassword = Error("weak password")
+	// ErrBusy when the hashing work is refused by a rate limiter (the
+	// returned *BusyError has a retry delay) or a memory budget
+	ErrBusy = Error("busy")
+	// ErrEntropy when the random source fails its health checks, salts
+	// are not generated
+	ErrEntropy = Error("entropy source failure")
+	// ErrShares when secret shares are insufficient or inconsistent
+	ErrShares = Error("invalid secret shares")
+	// ErrSelfTest when a known-answer self-test failed, the package
+	// refuses to operate
+	ErrSelfTest = Error("self-test failure")
+	// ErrNoUserKey when the per user key of a subject does not exist (or
+	// was shredded)
+	ErrNoUserKey = Error("user key not found")
+	// ErrSecretPermissions when a secret file is not a regular file or is
+	// too widely accessible
+	ErrSecretPermissions = Error("insecure secret file")
+	// ErrRevoked when a verification token was revoked
+	ErrRevoked = Error("revoked")
+	// ErrUnsupportedAlgo when a stored hash identifier is not one of a
+	// known algorithm
+	ErrUnsupportedAlgo = Error("unsupported algorithm")
+	// ErrIncompatibleVersion when a stored hash was produced by a version
+	// of its algorithm this package does not implement
+	ErrIncompatibleVersion = Error("incompatible version")
 )
+
+// ParseError is returned when a stored hash cannot be parsed, distinct
+// from ErrMismatch so that corrupted storage is not taken for a wrong
+// password.
+// with the errors package, errors.Is() matches its Kind and Unwrap()
+// returns the underlying cause (if any).
+type ParseError struct {
+	Kind  error // ErrParse, ErrUnsupportedAlgo or ErrIncompatibleVersion
+	Cause error // underlying error, may be nil
+}
+
+func (e *ParseError) Error() string {
+	if e.Cause == nil {
+		return e.Kind.Error()
+	}
+	return e.Kind.Error() + ": " + e.Cause.Error()
+}
+
+// Unwrap returns the cause.
+func (e *ParseError) Unwrap() error { return e.Cause }
+
+// Is reports whether target is the Kind of the error.
+func (e *ParseError) Is(target error) bool { return target == e.Kind }
+
+func parseError(kind, cause error) error {
+	return &ParseError{Kind: kind, Cause: cause}
+}
+
+// isError reports whether err is target or wraps it (errors.Is(), which
+// is not available before go1.13).
+func isError(err, target error) bool {
+	for err != nil {
+		if err == target {
+			return true
+		}
+		if x, ok := err.(interface{ Is(error) bool }); ok && x.Is(target) {
+			return true
+		}
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return false
+		}
+		err = u.Unwrap()
+	}
+	return false
+}
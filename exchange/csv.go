@@ -0,0 +1,116 @@
+//go:build go1.12
+// +build go1.12
+
+package exchange
+
+import (
+	"encoding/csv"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var csvHeader = []string{"subject", "hash", "alg", "meta"}
+
+type csvReader struct {
+	r      *csv.Reader
+	v      validator
+	line   int
+	header bool
+}
+
+// NewCSVReader returns a Reader of the CSV encoding.
+func NewCSVReader(r io.Reader) Reader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(csvHeader)
+	cr.ReuseRecord = true
+	return &csvReader{r: cr}
+}
+
+func (c *csvReader) Read() (*Record, error) {
+	if !c.header {
+		fields, err := c.r.Read()
+		if err == io.EOF {
+			return nil, &RecordError{Line: 1, Err: ErrFormat}
+		}
+		if err != nil || strings.Join(fields, ",") != strings.Join(csvHeader, ",") {
+			return nil, &RecordError{Line: 1, Err: ErrFormat}
+		}
+		c.header = true
+	}
+
+	fields, err := c.r.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	c.line++
+	line := c.line + 1 // after the header
+	if err != nil {
+		return nil, &RecordError{Line: line, Err: ErrFormat}
+	}
+
+	r := Record{Subject: fields[0], Hash: fields[1], Algorithm: fields[2]}
+	if fields[3] != "" {
+		values, err := url.ParseQuery(fields[3])
+		if err != nil {
+			return nil, &RecordError{Line: line, Err: ErrFormat}
+		}
+		r.Metadata = make(map[string]string, len(values))
+		for k, v := range values {
+			if len(v) != 1 {
+				return nil, &RecordError{Line: line, Err: ErrFormat}
+			}
+			r.Metadata[k] = v[0]
+		}
+	}
+
+	err = c.v.check(line, &r)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+// NewCSVWriter returns a Writer of the CSV encoding.
+func NewCSVWriter(w io.Writer) Writer {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(r *Record) error {
+	err := r.Validate()
+	if err != nil {
+		return err
+	}
+
+	if !c.header {
+		err = c.w.Write(csvHeader)
+		if err != nil {
+			return err
+		}
+		c.header = true
+	}
+
+	// sorted keys so the output is stable.
+	keys := make([]string, 0, len(r.Metadata))
+	for k := range r.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, url.QueryEscape(k)+"="+url.QueryEscape(r.Metadata[k]))
+	}
+
+	return c.w.Write([]string{r.Subject, r.Hash, r.Algorithm, strings.Join(pairs, "&")})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
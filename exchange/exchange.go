@@ -0,0 +1,156 @@
+//go:build go1.12
+// +build go1.12
+
+// Package exchange reads and writes credential interchange files, with
+// streaming validation, for migrations between systems.
+package exchange
+
+import (
+	"strconv"
+	"strings"
+)
+
+//
+// a credential file is a sequence of records, one per subject:
+//
+// subject  identifier of the account in the source system (required)
+// hash     stored value, as found in the source system (required)
+// alg      hash identifier (optional, derived from the hash), i.e.
+//          "2id", "2s", "2a", "argon2id", "scrypt"..
+// meta     free form key=value attributes (optional)
+//
+// two encodings are supported, CSV with a mandatory header line:
+//
+// subject,hash,alg,meta
+// alice,$2id$...,2id,source=ldap&migrated=2021-04-01
+//
+// where meta is URL query encoded, and JSON lines:
+//
+// {"subject":"alice","hash":"$2id$...","alg":"2id","meta":{"source":"ldap"}}
+//
+// readers validate every record as it is read and reject duplicate
+// subjects.
+//
+
+// Error is the type helping defining errors as constants.
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+const (
+	// ErrFormat when the file does not follow the format
+	ErrFormat = Error("invalid format")
+	// ErrSubject when a record has no subject
+	ErrSubject = Error("missing subject")
+	// ErrHash when a record has no or a malformed hash
+	ErrHash = Error("invalid hash")
+	// ErrAlgorithm when the record algorithm is unknown or does not
+	// match the hash
+	ErrAlgorithm = Error("invalid algorithm")
+	// ErrDuplicate when a subject appears more than once
+	ErrDuplicate = Error("duplicate subject")
+)
+
+// RecordError reports the invalid record of a file.
+type RecordError struct {
+	Line int // 1-based line of the record (CSV: record, header included)
+	Err  error
+}
+
+func (e *RecordError) Error() string {
+	return "line " + strconv.Itoa(e.Line) + ": " + e.Err.Error()
+}
+
+// Unwrap returns the validation error.
+func (e *RecordError) Unwrap() error { return e.Err }
+
+// Record is a credential of the interchange format.
+type Record struct {
+	Subject   string            `json:"subject"`
+	Hash      string            `json:"hash"`
+	Algorithm string            `json:"alg,omitempty"`
+	Metadata  map[string]string `json:"meta,omitempty"`
+}
+
+// known hash identifiers, native and modular crypt / PHC ones.
+var algorithms = map[string]bool{
+	"2id": true, "2i": true, "2s": true, "2a": true, "2b": true, "2y": true,
+	"2r": true, "2c": true,
+	"argon2id": true, "argon2i": true, "argon2d": true, "scrypt": true,
+	"1": true, "5": true, "6": true, "pbkdf2-sha256": true, "pbkdf2-sha512": true,
+}
+
+// Algorithm returns the identifier of hash, lock markers are skipped.
+func Algorithm(hash string) string {
+	hash = strings.TrimPrefix(hash, "!locked!")
+	hash = strings.TrimLeft(hash, "!")
+	if !strings.HasPrefix(hash, "$") {
+		return ""
+	}
+	hash = hash[1:]
+	if i := strings.IndexByte(hash, '$'); i >= 0 {
+		return hash[:i]
+	}
+	return ""
+}
+
+// Validate checks the record and derives its algorithm if unset.
+func (r *Record) Validate() error {
+	if r.Subject == "" {
+		return ErrSubject
+	}
+	// disabled accounts ("*") have no algorithm.
+	if r.Hash == "*" {
+		if r.Algorithm != "" {
+			return ErrAlgorithm
+		}
+		return nil
+	}
+
+	alg := Algorithm(r.Hash)
+	if alg == "" || strings.ContainsAny(r.Hash, " \t\r\n") {
+		return ErrHash
+	}
+	if !algorithms[alg] || (r.Algorithm != "" && r.Algorithm != alg) {
+		return ErrAlgorithm
+	}
+	r.Algorithm = alg
+
+	return nil
+}
+
+// Reader reads validated records.
+type Reader interface {
+	// Read returns the next record, io.EOF at the end of the file and a
+	// *RecordError if the record is invalid.
+	Read() (*Record, error)
+}
+
+// Writer writes records.
+type Writer interface {
+	// Write validates and writes r.
+	Write(r *Record) error
+	// Flush writes any buffered data.
+	Flush() error
+}
+
+// validator tracks the subjects of a file.
+type validator struct {
+	seen map[string]bool
+}
+
+func (v *validator) check(line int, r *Record) error {
+	err := r.Validate()
+	if err == nil && v.seen[r.Subject] {
+		err = ErrDuplicate
+	}
+	if err != nil {
+		return &RecordError{Line: line, Err: err}
+	}
+
+	if v.seen == nil {
+		v.seen = make(map[string]bool)
+	}
+	v.seen[r.Subject] = true
+	return nil
+}
@@ -0,0 +1,91 @@
+package exchange
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+var records = []*Record{
+	{Subject: "alice", Hash: "$2id$aGVsbG8$1$65536$4$32$aGVsbG8", Metadata: map[string]string{"source": "ldap", "note": "a=b&c"}},
+	{Subject: "bob", Hash: "$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga", Algorithm: "2a"},
+	{Subject: "carol", Hash: "!locked!$argon2id$v=19$m=65536,t=1,p=4$c2FsdA$aGFzaA"},
+	{Subject: "dave", Hash: "*"},
+}
+
+func roundtrip(t *testing.T, w Writer, buf *bytes.Buffer, newReader func(io.Reader) Reader) {
+	for _, r := range records {
+		if err := w.Write(r); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	rd := newReader(buf)
+	for i, expected := range records {
+		r, err := rd.Read()
+		if err != nil {
+			t.Fatalf("record #%d: Read: %v", i, err)
+		}
+		if r.Subject != expected.Subject || r.Hash != expected.Hash || r.Algorithm != expected.Algorithm || len(r.Metadata) != len(expected.Metadata) {
+			t.Fatalf("record #%d: %+v vs expected %+v", i, r, expected)
+		}
+		for k, v := range expected.Metadata {
+			if r.Metadata[k] != v {
+				t.Fatalf("record #%d: meta %s: %q vs expected %q", i, k, r.Metadata[k], v)
+			}
+		}
+	}
+	if _, err := rd.Read(); err != io.EOF {
+		t.Fatalf("Read: got %v, expected io.EOF", err)
+	}
+}
+
+func TestRoundtrip(t *testing.T) {
+	var buf bytes.Buffer
+	roundtrip(t, NewCSVWriter(&buf), &buf, NewCSVReader)
+	roundtrip(t, NewJSONLWriter(&buf), &buf, NewJSONLReader)
+
+	if records[2].Algorithm != "argon2id" {
+		t.Fatalf("algorithm not derived: %q", records[2].Algorithm)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	vectors := []struct {
+		input string
+		csv   bool
+		line  int
+		err   error
+	}{
+		{"subject,hash\n", true, 1, ErrFormat},
+		{"subject,hash,alg,meta\nalice,,,\n", true, 2, ErrHash},
+		{"subject,hash,alg,meta\nalice,$2s$x$y,2id,\n", true, 2, ErrAlgorithm},
+		{"subject,hash,alg,meta\nalice,$2s$x$y,,%zz\n", true, 2, ErrFormat},
+		{"subject,hash,alg,meta\nalice,$2s$x$y,,\nalice,$2s$x$z,,\n", true, 3, ErrDuplicate},
+		{"{\"subject\":\"\",\"hash\":\"$2s$x$y\"}\n", false, 1, ErrSubject},
+		{"\n{\"subject\":\"a\",\"hash\":\"$zz$x$y\"}\n", false, 2, ErrAlgorithm},
+		{"{\"subject\":\"a\",\"hash\":\"$2s$x$y\",\"password\":\"x\"}\n", false, 1, ErrFormat},
+	}
+
+	for i, test := range vectors {
+		var rd Reader
+		if test.csv {
+			rd = NewCSVReader(strings.NewReader(test.input))
+		} else {
+			rd = NewJSONLReader(strings.NewReader(test.input))
+		}
+
+		var err error
+		for err == nil {
+			_, err = rd.Read()
+		}
+		re, ok := err.(*RecordError)
+		if !ok || re.Line != test.line || re.Err != test.err {
+			t.Fatalf("test #%d: got %v, expected line %d: %v", i, err, test.line, test.err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+//go:build go1.12
+// +build go1.12
+
+package exchange
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// maxLine bounds the length of a JSON line.
+const maxLine = 1 << 20
+
+type jsonlReader struct {
+	s    *bufio.Scanner
+	v    validator
+	line int
+}
+
+// NewJSONLReader returns a Reader of the JSON lines encoding, empty lines
+// are skipped.
+func NewJSONLReader(r io.Reader) Reader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 4096), maxLine)
+	return &jsonlReader{s: s}
+}
+
+func (j *jsonlReader) Read() (*Record, error) {
+	for j.s.Scan() {
+		j.line++
+
+		line := bytes.TrimSpace(j.s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var r Record
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&r); err != nil || dec.More() {
+			return nil, &RecordError{Line: j.line, Err: ErrFormat}
+		}
+
+		err := j.v.check(j.line, &r)
+		if err != nil {
+			return nil, err
+		}
+		return &r, nil
+	}
+
+	if err := j.s.Err(); err != nil {
+		return nil, &RecordError{Line: j.line + 1, Err: ErrFormat}
+	}
+	return nil, io.EOF
+}
+
+type jsonlWriter struct {
+	w *bufio.Writer
+}
+
+// NewJSONLWriter returns a Writer of the JSON lines encoding.
+func NewJSONLWriter(w io.Writer) Writer {
+	return &jsonlWriter{w: bufio.NewWriter(w)}
+}
+
+func (j *jsonlWriter) Write(r *Record) error {
+	err := r.Validate()
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	_, err = j.w.Write(b)
+	return err
+}
+
+func (j *jsonlWriter) Flush() error {
+	return j.w.Flush()
+}
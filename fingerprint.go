@@ -0,0 +1,105 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+)
+
+//
+// configuration fingerprint.
+//
+// instances of a service hashing with divergent configurations (a stale
+// deploy, a missing secret..) produce hashes the others reject or flag for
+// rehash, the fingerprint exported as a metric or log field makes the
+// drift visible:
+//
+// FINGERPRINT = hex(SHA3-256("passwd/fingerprint/v1" || configuration)[:8])
+//
+// the configuration covers the algorithm, parameters (risk tiers and
+// fallback included), metadata flags, the KeyID() of the secrets and the
+// length, expiry, integrity and truncation policies, not the secrets
+// themselves nor the operational settings (limiters, budgets, hooks).
+//
+
+const labelFingerprint = "passwd/fingerprint/v1"
+
+func fingerprintParams(w io.Writer, name string, params interface{}) {
+	spec, err := FormatSpec(params)
+	if hp, ok := params.(*hasherParams); ok {
+		var marshaled []byte
+		marshaled, err = hp.h.MarshalParams()
+		spec = hp.id + ":" + string(marshaled)
+	}
+	if err != nil {
+		spec = fmt.Sprintf("%T", params)
+	}
+
+	masked := false
+	switch v := params.(type) {
+	case *ScryptParams:
+		masked = v.Masked
+	case *Argon2Params:
+		masked = v.Masked
+	case *Pbkdf2Params:
+		masked = v.Masked
+	}
+	fmt.Fprintf(w, "%s %s masked=%v\n", name, spec, masked)
+}
+
+// Fingerprint returns a stable digest of the effective profile
+// configuration.
+func (p *Profile) Fingerprint() string {
+	h := newSHA3256()
+	h.Write([]byte(labelFingerprint))
+
+	fingerprintParams(h, "params", p.params)
+
+	tiers := make([]int, 0, len(p.riskTiers))
+	for tier := range p.riskTiers {
+		tiers = append(tiers, tier)
+	}
+	sort.Ints(tiers)
+	for _, tier := range tiers {
+		fingerprintParams(h, fmt.Sprintf("tier %d", tier), p.riskTiers[tier])
+	}
+	if p.fallback != nil {
+		fingerprintParams(h, "fallback", p.fallback)
+	}
+
+	// the time metadata values change at every hash.
+	md := p.metadata()
+	for _, k := range []string{metaTimestamp, metaExpiry} {
+		if _, ok := md[k]; ok {
+			md[k] = "1"
+		}
+	}
+	fmt.Fprintf(h, "metadata %s\n", md.encode())
+
+	if secret := p.key(); len(secret) > 0 {
+		fmt.Fprintf(h, "key %s\n", KeyID(secret))
+	}
+	for _, m := range p.masters {
+		fmt.Fprintf(h, "master %s\n", KeyID(m))
+	}
+	fmt.Fprintf(h, "deployment %x\n", p.deployment)
+	if p.encoding != FormatNative {
+		fmt.Fprintf(h, "encoding %d\n", p.encoding)
+	}
+
+	minLength := p.minLength
+	if pinnedMinLength > minLength {
+		minLength = pinnedMinLength
+	}
+	fmt.Fprintf(h, "length min=%d reject-empty=%v\n", minLength, p.rejectEmpty)
+	fmt.Fprintf(h, "secret required=%v integrity=%v expiry=%v truncation=%d\n", p.requireSecret, p.integrity, p.expiry, p.truncation)
+	if p.policy != nil {
+		fmt.Fprintf(h, "policy %T\n", p.policy)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
@@ -0,0 +1,48 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"hash"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// the SHA3 constructors used by the HMAC constructions of the package, on
+// go1.24+ toolchains they are the standard library (FIPS 140-3 module)
+// implementation, outputs are identical.
+var (
+	newSHA3256 func() hash.Hash = sha3.New256
+	newSHA3384 func() hash.Hash = sha3.New384
+)
+
+// Cryptographic module modes reported by CryptoMode().
+const (
+	CryptoStandard     = "standard"     // regular Go cryptography
+	CryptoBoringCrypto = "boringcrypto" // GOEXPERIMENT=boringcrypto
+	CryptoFIPS140      = "fips140"      // Go FIPS 140-3 module enabled
+)
+
+// cryptoModes are filled by the toolchain specific files, the last enabled
+// mode wins.
+var cryptoModes []func() (string, bool)
+
+// CryptoMode returns the cryptographic module mode of the running binary.
+// note that argon2, scrypt and bcrypt are not FIPS approved algorithms,
+// in FIPS mode they keep running on their regular implementations.
+func CryptoMode() string {
+	mode := CryptoStandard
+	for _, m := range cryptoModes {
+		if name, enabled := m(); enabled {
+			mode = name
+		}
+	}
+	return mode
+}
+
+// FIPS returns true if the binary runs with a FIPS validated module
+// (boringcrypto or the Go FIPS 140-3 module).
+func FIPS() bool {
+	return CryptoMode() != CryptoStandard
+}
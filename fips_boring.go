@@ -0,0 +1,14 @@
+//go:build goexperiment.boringcrypto
+// +build goexperiment.boringcrypto
+
+package passwd
+
+import (
+	"crypto/boring"
+)
+
+func init() {
+	cryptoModes = append(cryptoModes, func() (string, bool) {
+		return CryptoBoringCrypto, boring.Enabled()
+	})
+}
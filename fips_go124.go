@@ -0,0 +1,19 @@
+//go:build go1.24
+// +build go1.24
+
+package passwd
+
+import (
+	"crypto/fips140"
+	"crypto/sha3"
+	"hash"
+)
+
+func init() {
+	newSHA3256 = func() hash.Hash { return sha3.New256() }
+	newSHA3384 = func() hash.Hash { return sha3.New384() }
+
+	cryptoModes = append(cryptoModes, func() (string, bool) {
+		return CryptoFIPS140, fips140.Enabled()
+	})
+}
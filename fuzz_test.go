@@ -0,0 +1,53 @@
+//go:build go1.18
+// +build go1.18
+
+package passwd
+
+import (
+	"testing"
+)
+
+// FuzzParse feeds the hash parser adversarial input: it must not panic and
+// the parameters it accepts must stay within the parsing bounds.
+func FuzzParse(f *testing.F) {
+	for _, seed := range []string{
+		"$2s$sT/eXtwSAJHP6rsglmolxe$65536$8$1$32$LIFT/xDaVv1XcFRLY/XBLjIztaJoK9BLtjFIiLnaXvW",
+		"$2s$Lh8gOCN2H29b.O4S9BDzNO$zShzcWyU7K6PAVwylCkPF9i7aNpmQ2NB5/O6BqlCI3i",
+		"$2id$aiOE.rPFUFkkehxc6utWY.$1$65536$8$32$Wv1IMP6xwaqVaQGOX6Oxe.eSEbozeRJLzln8ZlthZfS",
+		"$2a$10$zlKoI5wrYXIa9d186fXI9OAic/y2F5YNyBXpmz5xTpl9hhBAtza6m",
+		"$2k$c2FsdHNhbHRzYWx0c2FsdA$1000$32$aGFzaA",
+		"$2id$mv=v1,ki=k1$aiOE.rPFUFkkehxc6utWY.$Wv1IMP6xwaqVaQGOX6Oxe",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$aGFzaGhhc2g",
+		"",
+		"$",
+		"$$$$",
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, hashed []byte) {
+		_, _, _ = splitMetadata(hashed)
+		_, _ = parseFromHashToSalt(hashed)
+		_, _ = Info(hashed)
+		_, _ = Reencode(hashed, FormatNative)
+
+		params, err := parseFromHashToParams(hashed)
+		if err != nil {
+			return
+		}
+		switch v := params.(type) {
+		case *Argon2Params:
+			if v.Time == 0 || v.Thread == 0 || v.Memory > maxParseArgon2Memory || v.Keylen > maxParseKeylen {
+				t.Fatalf("argon2 out of bounds: %+v", v)
+			}
+		case *ScryptParams:
+			if v.N <= 1 || uint64(v.N)*128*uint64(v.R) > maxParseScryptMemory || v.Keylen > maxParseKeylen {
+				t.Fatalf("scrypt out of bounds: %+v", v)
+			}
+		case *Pbkdf2Params:
+			if v.Iterations == 0 || v.Iterations > maxParsePbkdf2Iterations || v.Keylen > maxParseKeylen {
+				t.Fatalf("pbkdf2 out of bounds: %+v", v)
+			}
+		}
+	})
+}
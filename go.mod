@@ -4,5 +4,6 @@ go 1.12
 
 require (
 	golang.org/x/crypto v0.7.0
+	golang.org/x/sys v0.6.0
 	golang.org/x/text v0.8.0
 )
@@ -0,0 +1,20 @@
+module github.com/ermites-io/passwd/grpcauth
+
+go 1.17
+
+require (
+	github.com/ermites-io/passwd v0.2.2-0.20230312090503-7fcc5ef37080
+	google.golang.org/grpc v1.54.0
+)
+
+require (
+	github.com/golang/protobuf v1.5.2 // indirect
+	golang.org/x/crypto v0.7.0 // indirect
+	golang.org/x/net v0.8.0 // indirect
+	golang.org/x/sys v0.6.0 // indirect
+	golang.org/x/text v0.8.0 // indirect
+	google.golang.org/genproto v0.0.0-20230110181048-76db0878b65f // indirect
+	google.golang.org/protobuf v1.28.1 // indirect
+)
+
+replace github.com/ermites-io/passwd => ../
@@ -0,0 +1,165 @@
+//go:build go1.12
+// +build go1.12
+
+// Package grpcauth provides gRPC server interceptors verifying per-RPC
+// static credentials against passwd hashes.
+//
+// it is a separate module so the passwd package does not depend on gRPC.
+package grpcauth
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+
+	"github.com/ermites-io/passwd"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Lookup returns the stored hash of principal, found is false for unknown
+// principals.
+type Lookup func(ctx context.Context, principal string) (hashed []byte, found bool, err error)
+
+// Extractor extracts the principal and password from the incoming
+// metadata.
+type Extractor func(md metadata.MD) (principal string, password []byte, err error)
+
+var errCredentials = status.Error(codes.Unauthenticated, "invalid credentials")
+
+// BasicExtractor reads HTTP basic style credentials from the
+// "authorization" metadata ("Basic base64(principal:password)").
+func BasicExtractor(md metadata.MD) (string, []byte, error) {
+	values := md.Get("authorization")
+	if len(values) != 1 {
+		return "", nil, errCredentials
+	}
+
+	const prefix = "basic "
+	if len(values[0]) < len(prefix) || !strings.EqualFold(values[0][:len(prefix)], prefix) {
+		return "", nil, errCredentials
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(values[0][len(prefix):])
+	if err != nil {
+		return "", nil, errCredentials
+	}
+
+	i := strings.IndexByte(string(decoded), ':')
+	if i < 0 {
+		return "", nil, errCredentials
+	}
+	return string(decoded[:i]), decoded[i+1:], nil
+}
+
+// HeaderExtractor reads the principal and password from two custom
+// metadata keys.
+func HeaderExtractor(principalKey, passwordKey string) Extractor {
+	return func(md metadata.MD) (string, []byte, error) {
+		principals, passwords := md.Get(principalKey), md.Get(passwordKey)
+		if len(principals) != 1 || len(passwords) != 1 {
+			return "", nil, errCredentials
+		}
+		return principals[0], []byte(passwords[0]), nil
+	}
+}
+
+type principalKey struct{}
+
+// Principal returns the principal authenticated by the interceptors.
+func Principal(ctx context.Context) (string, bool) {
+	principal, ok := ctx.Value(principalKey{}).(string)
+	return principal, ok
+}
+
+// Authenticator verifies the credentials of incoming RPCs.
+type Authenticator struct {
+	profile *passwd.Profile
+	lookup  Lookup
+	extract Extractor
+	dummy   []byte // compared for unknown principals
+}
+
+// New returns an Authenticator verifying credentials extracted by extract
+// (BasicExtractor if nil) against the hashes returned by lookup using p.
+func New(p *passwd.Profile, lookup Lookup, extract Extractor) (*Authenticator, error) {
+	if p == nil || lookup == nil {
+		return nil, passwd.ErrUnsupported
+	}
+	if extract == nil {
+		extract = BasicExtractor
+	}
+
+	// unknown principals cost the same as known ones.
+	dummy, err := p.Hash([]byte("passwd/grpcauth/dummy"))
+	if err != nil {
+		return nil, err
+	}
+
+	a := Authenticator{
+		profile: p,
+		lookup:  lookup,
+		extract: extract,
+		dummy:   dummy,
+	}
+	return &a, nil
+}
+
+func (a *Authenticator) authenticate(ctx context.Context) (context.Context, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, errCredentials
+	}
+
+	principal, password, err := a.extract(md)
+	if err != nil {
+		return nil, errCredentials
+	}
+
+	hashed, found, err := a.lookup(ctx, principal)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "credentials lookup failed")
+	}
+	if !found {
+		a.profile.Compare(a.dummy, password)
+		return nil, errCredentials
+	}
+
+	if a.profile.Compare(hashed, password) != nil {
+		return nil, errCredentials
+	}
+	return context.WithValue(ctx, principalKey{}, principal), nil
+}
+
+// UnaryServerInterceptor returns the unary interceptor.
+func (a *Authenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := a.authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamServerInterceptor returns the stream interceptor.
+func (a *Authenticator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authenticate(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
@@ -0,0 +1,78 @@
+package grpcauth
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/ermites-io/passwd"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *fakeStream) Context() context.Context { return s.ctx }
+
+func TestInterceptors(t *testing.T) {
+	p, _ := passwd.NewCustom(&passwd.ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	hashed, _ := p.Hash([]byte("prout"))
+
+	lookup := func(ctx context.Context, principal string) ([]byte, bool, error) {
+		if principal == "alice" {
+			return hashed, true, nil
+		}
+		return nil, false, nil
+	}
+
+	a, err := New(p, lookup, nil)
+	if err != nil {
+		t.Fatalf("new error: %v\n", err)
+	}
+
+	basic := func(creds string) context.Context {
+		md := metadata.Pairs("authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(creds)))
+		return metadata.NewIncomingContext(context.Background(), md)
+	}
+
+	for i, test := range []struct {
+		ctx  context.Context
+		code codes.Code
+	}{
+		{basic("alice:prout"), codes.OK},
+		{basic("alice:wrong"), codes.Unauthenticated},
+		{basic("bob:prout"), codes.Unauthenticated},
+		{basic("alice"), codes.Unauthenticated},
+		{context.Background(), codes.Unauthenticated},
+	} {
+		var principal string
+		unary := func(ctx context.Context, req interface{}) (interface{}, error) {
+			principal, _ = Principal(ctx)
+			return nil, nil
+		}
+		_, err := a.UnaryServerInterceptor()(test.ctx, nil, &grpc.UnaryServerInfo{}, unary)
+		if status.Code(err) != test.code || (err == nil && principal != "alice") {
+			t.Fatalf("test #%d: unary err: %v (%s) vs expected: %v\n", i, err, principal, test.code)
+		}
+
+		stream := func(srv interface{}, ss grpc.ServerStream) error {
+			principal, _ = Principal(ss.Context())
+			return nil
+		}
+		err = a.StreamServerInterceptor()(nil, &fakeStream{ctx: test.ctx}, &grpc.StreamServerInfo{}, stream)
+		if status.Code(err) != test.code {
+			t.Fatalf("test #%d: stream err: %v vs expected: %v\n", i, err, test.code)
+		}
+	}
+
+	h, _ := New(p, lookup, HeaderExtractor("x-user", "x-password"))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-user", "alice", "x-password", "prout"))
+	if _, err := h.authenticate(ctx); err != nil {
+		t.Fatalf("header err: %v vs expected: %v\n", err, nil)
+	}
+}
@@ -0,0 +1,85 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ProfileHandle holds a live Profile that can be replaced at runtime, the
+// swap is atomic: subsequent hashes use the new settings while in-flight
+// operations finish with the profile they loaded.
+type ProfileHandle struct {
+	mu sync.Mutex // serializes the updates
+	v  atomic.Value
+}
+
+// NewProfileHandle returns a handle holding p.
+func NewProfileHandle(p *Profile) *ProfileHandle {
+	var h ProfileHandle
+	h.v.Store(p)
+	return &h
+}
+
+// Load returns the current profile, it must not be modified.
+func (h *ProfileHandle) Load() *Profile {
+	return h.v.Load().(*Profile)
+}
+
+// Store replaces the current profile with p.
+func (h *ProfileHandle) Store(p *Profile) {
+	h.mu.Lock()
+	h.v.Store(p)
+	h.mu.Unlock()
+}
+
+// Update applies f to a copy of the current profile and swaps it in if f
+// succeeds, i.e. to rotate the secret:
+//
+//	h.Update(func(p *Profile) error { return p.SetSecret(secret) })
+func (h *ProfileHandle) Update(f func(p *Profile) error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	p := h.Load().copy()
+	err := f(p)
+	if err != nil {
+		return err
+	}
+
+	h.v.Store(p)
+	return nil
+}
+
+// Hash hashes password with the current profile.
+func (h *ProfileHandle) Hash(password []byte) ([]byte, error) {
+	return h.Load().Hash(password)
+}
+
+// Compare compares hashed and password with the current profile.
+func (h *ProfileHandle) Compare(hashed, password []byte) error {
+	return h.Load().Compare(hashed, password)
+}
+
+// copy returns a copy of the profile with its own parameters.
+func (p *Profile) copy() *Profile {
+	c := p.clone()
+
+	switch v := p.params.(type) {
+	case *BcryptParams:
+		params := *v
+		c.params = &params
+	case *ScryptParams:
+		params := *v
+		c.params = &params
+	case *Argon2Params:
+		params := *v
+		c.params = &params
+	case *Pbkdf2Params:
+		params := *v
+		c.params = &params
+	}
+	return c
+}
@@ -0,0 +1,66 @@
+//go:build go1.12
+// +build go1.12
+
+// Package hasher adapts a passwd.Profile to the context aware hasher
+// interfaces of the common Go authentication stacks, i.e. Ory Kratos:
+//
+//	type Hasher interface {
+//		Compare(ctx context.Context, password []byte, hash []byte) error
+//		Generate(ctx context.Context, password []byte) ([]byte, error)
+//		Understands(hash []byte) bool
+//	}
+package hasher
+
+import (
+	"context"
+
+	"github.com/ermites-io/passwd"
+)
+
+// Hasher wraps a passwd.Profile.
+type Hasher struct {
+	profile *passwd.Profile
+}
+
+// New returns a Hasher hashing and verifying with p.
+func New(p *passwd.Profile) *Hasher {
+	return &Hasher{profile: p}
+}
+
+// Hash returns the hash of password, the derivation gives up when ctx is
+// done (see passwd.Profile.HashContext()).
+func (h *Hasher) Hash(ctx context.Context, password []byte) ([]byte, error) {
+	return h.profile.HashContext(ctx, password)
+}
+
+// Generate is Hash under the Ory name.
+func (h *Hasher) Generate(ctx context.Context, password []byte) ([]byte, error) {
+	return h.Hash(ctx, password)
+}
+
+// Compare verifies password against hash, the derivation gives up when ctx
+// is done (see passwd.Profile.CompareContext()), a mismatch is
+// passwd.ErrMismatch.
+func (h *Hasher) Compare(ctx context.Context, password, hash []byte) error {
+	return h.profile.CompareContext(ctx, hash, password)
+}
+
+// Understands returns true if hash parses as a hash of the passwd package
+// (see passwd.Info()): native or PHC encoded, locked, or encrypted with the
+// profile key.
+func (h *Hasher) Understands(hash []byte) bool {
+	if passwd.Locked(hash) {
+		unlocked, err := passwd.Unlock(hash)
+		if err != nil {
+			return false
+		}
+		hash = unlocked
+	}
+
+	plain, err := h.profile.DecryptHash(hash)
+	if err != nil {
+		return false
+	}
+	_, err = passwd.Info(plain)
+	return err == nil
+}
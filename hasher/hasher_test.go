@@ -0,0 +1,67 @@
+package hasher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ermites-io/passwd"
+)
+
+func TestHasher(t *testing.T) {
+	p, _ := passwd.NewCustom(&passwd.ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	h := New(p)
+	ctx := context.Background()
+
+	hashed, err := h.Generate(ctx, []byte("prout"))
+	if err != nil || !h.Understands(hashed) {
+		t.Fatalf("generate %s error: %v\n", hashed, err)
+	}
+
+	if err := h.Compare(ctx, []byte("prout"), hashed); err != nil {
+		t.Fatalf("compare err: %v vs expected: %v\n", err, nil)
+	}
+	if err := h.Compare(ctx, []byte("wrong"), hashed); err != passwd.ErrMismatch {
+		t.Fatalf("compare err: %v vs expected: %v\n", err, passwd.ErrMismatch)
+	}
+	if h.Understands([]byte("$pbkdf2-sha256$i=1000$salt$hash")) {
+		t.Fatalf("foreign hash understood\n")
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := h.Hash(canceled, []byte("prout")); err != context.Canceled {
+		t.Fatalf("canceled hash err: %v vs expected: %v\n", err, context.Canceled)
+	}
+	if err := h.Compare(canceled, []byte("prout"), hashed); err != context.Canceled {
+		t.Fatalf("canceled compare err: %v vs expected: %v\n", err, context.Canceled)
+	}
+}
+
+func TestUnderstands(t *testing.T) {
+	argon2d, _ := passwd.NewCustom(&passwd.Argon2Params{Version: passwd.Argon2d, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+	pbkdf2, _ := passwd.NewCustom(&passwd.Pbkdf2Params{PRF: passwd.Pbkdf2SHA512, Iterations: 1000, Saltlen: 16, Keylen: 32})
+	phc, _ := passwd.NewCustom(&passwd.Argon2Params{Version: passwd.Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+	_ = phc.SetEncoding(passwd.FormatPHC)
+	encrypted, _ := passwd.NewCustom(&passwd.ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	_ = encrypted.SetEncryptionKey(make([]byte, 32))
+
+	ctx := context.Background()
+	for i, p := range []*passwd.Profile{argon2d, pbkdf2, phc, encrypted} {
+		h := New(p)
+		hashed, err := h.Generate(ctx, []byte("prout"))
+		if err != nil {
+			t.Fatalf("test #%d: generate error: %v\n", i, err)
+		}
+		if !h.Understands(hashed) || !h.Understands(passwd.Lock(hashed)) {
+			t.Fatalf("test #%d: %s not understood\n", i, hashed)
+		}
+		if err := h.Compare(ctx, []byte("prout"), hashed); err != nil {
+			t.Fatalf("test #%d: compare err: %v vs expected: %v\n", i, err, nil)
+		}
+	}
+
+	hashed, _ := New(encrypted).Generate(ctx, []byte("prout"))
+	if New(pbkdf2).Understands(hashed) {
+		t.Fatalf("encrypted hash understood without the key\n")
+	}
+}
@@ -4,16 +4,13 @@ package passwd
 
 import (
 	"crypto/hmac"
-	"crypto/rand"
-
-	"golang.org/x/crypto/sha3"
 )
 
 func getSalt(sz uint32) ([]byte, error) {
 	salt := make([]byte, sz)
-	n, err := rand.Read(salt)
-	if err != nil || n != int(sz) {
-		return nil, errSalt
+	err := readRandom(salt)
+	if err != nil {
+		return nil, err
 	}
 	return salt, nil
 }
@@ -21,15 +18,16 @@ func getSalt(sz uint32) ([]byte, error) {
 func hmacKeyHash(secret, salt, password []byte) (hret []byte, err error) {
 	// new formula.
 	// 1. hashed_first_pass = hmac_sha3-256(password, secret:salt)
-	h := hmac.New(sha3.New256, salt)
+	h := hmac.New(newSHA3256, salt)
 	_, err = h.Write(password)
 	if err != nil {
 		return nil, err
 	}
 	hResult := h.Sum(nil)
+	defer wipe(hResult)
 
 	// 2. hashed_full_pass = hmac_sha3-384(hashed_first_pass, secret)
-	hFinal := hmac.New(sha3.New384, secret)
+	hFinal := hmac.New(newSHA3384, secret)
 	_, err = hFinal.Write(hResult)
 	if err != nil {
 		return nil, err
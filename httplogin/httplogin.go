@@ -0,0 +1,169 @@
+//go:build go1.12
+// +build go1.12
+
+// Package httplogin provides a net/http login handler built on a
+// passwd.Suite: credentials decoding, lookup, verification, optional
+// rehash and store, failure delay and callbacks.
+package httplogin
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/ermites-io/passwd"
+)
+
+// maxBodySize bounds the size of the login request body.
+const maxBodySize = 1 << 16
+
+// Lookup returns the stored hash of username, found is false for unknown
+// users.
+type Lookup func(ctx context.Context, username string) (hashed []byte, found bool, err error)
+
+// Store saves the new hash of username after a rehash.
+type Store func(ctx context.Context, username string, hashed []byte) error
+
+// Handler is the login http.Handler, it accepts POST requests with either
+// form ("username", "password") or JSON ({"username":..,"password":..})
+// credentials.
+type Handler struct {
+	Suite  *passwd.Suite // hashes and verifies the passwords
+	Lookup Lookup        // stored hash lookup
+	Store  Store         // optional, stores rehashed passwords
+
+	// Delay is waited before reporting a failure.
+	Delay time.Duration
+
+	// OnSuccess is called for authenticated users, by default it replies
+	// 204 No Content.
+	OnSuccess func(w http.ResponseWriter, r *http.Request, username string)
+
+	// OnFailure is called for bad requests and failed logins (err is
+	// passwd.ErrMismatch for wrong credentials), by default it replies 401
+	// Unauthorized.
+	OnFailure func(w http.ResponseWriter, r *http.Request, username string, err error)
+
+	// OnRehashError is called when the rehash or the Store of a verified
+	// password fails (i.e. the policy refuses a legacy password), the login
+	// still succeeds.
+	OnRehashError func(r *http.Request, username string, err error)
+}
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func decode(r *http.Request) (*credentials, error) {
+	var c credentials
+
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch ct {
+	case "application/json":
+		err := json.NewDecoder(r.Body).Decode(&c)
+		if err != nil {
+			return nil, passwd.ErrParse
+		}
+	case "application/x-www-form-urlencoded":
+		err := r.ParseForm()
+		if err != nil {
+			return nil, passwd.ErrParse
+		}
+		c.Username = r.PostForm.Get("username")
+		c.Password = r.PostForm.Get("password")
+	case "multipart/form-data":
+		err := r.ParseMultipartForm(maxBodySize)
+		if err != nil {
+			return nil, passwd.ErrParse
+		}
+		c.Username = r.PostForm.Get("username")
+		c.Password = r.PostForm.Get("password")
+	default:
+		return nil, passwd.ErrUnsupported
+	}
+
+	if c.Username == "" {
+		return nil, passwd.ErrParse
+	}
+	return &c, nil
+}
+
+// verify checks c against the stored hash, rehashing it if needed.
+func (h *Handler) verify(r *http.Request, c *credentials) error {
+	ctx := r.Context()
+
+	hashed, found, err := h.Lookup(ctx, c.Username)
+	if err != nil {
+		// as long as a verification.
+		h.Suite.DummyVerify([]byte(c.Password))
+		return err
+	}
+	if !found {
+		return h.Suite.DummyVerify([]byte(c.Password))
+	}
+
+	needsRehash, err := h.Suite.Verify(hashed, []byte(c.Password))
+	if err != nil {
+		return err
+	}
+
+	if needsRehash && h.Store != nil {
+		err = h.rehash(ctx, c)
+		if err != nil && h.OnRehashError != nil {
+			h.OnRehashError(r, c.Username, err)
+		}
+	}
+	return nil
+}
+
+// rehash stores a new hash of the verified password.
+func (h *Handler) rehash(ctx context.Context, c *credentials) error {
+	rehashed, err := h.Suite.Hash([]byte(c.Password))
+	if err != nil {
+		return err
+	}
+	return h.Store(ctx, c.Username, rehashed)
+}
+
+func (h *Handler) fail(w http.ResponseWriter, r *http.Request, username string, err error) {
+	if h.Delay > 0 {
+		time.Sleep(h.Delay)
+	}
+
+	if h.OnFailure != nil {
+		h.OnFailure(w, r, username, err)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// ServeHTTP handles a login request.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	c, err := decode(r)
+	if err != nil {
+		h.fail(w, r, "", err)
+		return
+	}
+
+	err = h.verify(r, c)
+	if err != nil {
+		h.fail(w, r, c.Username, err)
+		return
+	}
+
+	if h.OnSuccess != nil {
+		h.OnSuccess(w, r, c.Username)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
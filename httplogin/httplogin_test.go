@@ -0,0 +1,129 @@
+package httplogin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ermites-io/passwd"
+)
+
+func TestHandler(t *testing.T) {
+	preferred, _ := passwd.NewCustom(&passwd.Argon2Params{Version: passwd.Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+	legacy, _ := passwd.NewCustom(&passwd.ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	suite, _ := passwd.NewSuite(preferred, passwd.NativeVerifier)
+
+	old, _ := legacy.Hash([]byte("prout"))
+	users := map[string][]byte{"alice": old}
+
+	h := &Handler{
+		Suite: suite,
+		Lookup: func(ctx context.Context, username string) ([]byte, bool, error) {
+			hashed, ok := users[username]
+			return hashed, ok, nil
+		},
+		Store: func(ctx context.Context, username string, hashed []byte) error {
+			users[username] = hashed
+			return nil
+		},
+	}
+
+	form := func(username, password string) *http.Request {
+		v := url.Values{"username": {username}, "password": {password}}
+		r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(v.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+	mp := func(username, password string) *http.Request {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		_ = mw.WriteField("username", username)
+		_ = mw.WriteField("password", password)
+		_ = mw.Close()
+		r := httptest.NewRequest(http.MethodPost, "/login", &body)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		return r
+	}
+	js := func(body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		return r
+	}
+
+	for i, test := range []struct {
+		r    *http.Request
+		code int
+	}{
+		{form("alice", "prout"), http.StatusNoContent},
+		{js(`{"username":"alice","password":"prout"}`), http.StatusNoContent},
+		{mp("alice", "prout"), http.StatusNoContent},
+		{mp("alice", "wrong"), http.StatusUnauthorized},
+		{form("alice", "wrong"), http.StatusUnauthorized},
+		{form("bob", "prout"), http.StatusUnauthorized},
+		{js(`{"username":`), http.StatusUnauthorized},
+		{httptest.NewRequest(http.MethodGet, "/login", nil), http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, test.r)
+		if w.Code != test.code {
+			t.Fatalf("test #%d: status %d vs expected: %d\n", i, w.Code, test.code)
+		}
+	}
+
+	// the first login upgraded the stored hash.
+	if preferred.Compare(users["alice"], []byte("prout")) != nil {
+		t.Fatalf("hash %s not upgraded\n", users["alice"])
+	}
+
+	// unknown users cost a compare, even when the profile refuses new
+	// hashes of the password.
+	_ = preferred.SetPolicy(passwd.Policy{MinLength: 64})
+	_ = preferred.SetCompareDuration(20 * time.Millisecond)
+	start := time.Now()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, form("bob", "prout"))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown user: status %d vs expected: %d\n", w.Code, http.StatusUnauthorized)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("unknown user: replied after %v\n", elapsed)
+	}
+
+	// so do the lookup failures.
+	lookup := h.Lookup
+	h.Lookup = func(ctx context.Context, username string) ([]byte, bool, error) {
+		return nil, false, errors.New("database down")
+	}
+	start = time.Now()
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, form("alice", "prout"))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("lookup error: status %d vs expected: %d\n", w.Code, http.StatusUnauthorized)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("lookup error: replied after %v\n", elapsed)
+	}
+	h.Lookup = lookup
+
+	// a verified legacy password the policy refuses still logs in.
+	users["carol"] = old
+	var rehashErr error
+	h.OnRehashError = func(r *http.Request, username string, err error) {
+		rehashErr = err
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, form("carol", "prout"))
+	if w.Code != http.StatusNoContent || rehashErr != passwd.ErrPasswordTooShort {
+		t.Fatalf("rehash error: status %d (%v) vs expected: %d (%v)\n", w.Code, rehashErr, http.StatusNoContent, passwd.ErrPasswordTooShort)
+	}
+	if string(users["carol"]) != string(old) {
+		t.Fatalf("hash %s replaced\n", users["carol"])
+	}
+}
@@ -0,0 +1,137 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ermites-io/passwd/internal/argon2"
+)
+
+//
+// hash inspection.
+//
+// Info() describes a stored hash without comparing it, for audits over the
+// stored hashes (i.e. counting the bcrypt hashes of cost 10), the
+// parameters are the ones the Compare() parser reads.
+//
+
+// HashInfo describes a stored hash.
+type HashInfo struct {
+	ID        string      // hash identifier (i.e. "2id", "2s", "2a")
+	Algorithm string      // algorithm name (i.e. "argon2id", "scrypt", "bcrypt"), the ID if unknown
+	Version   int         // algorithm version (argon2 0x13), 0 if none
+	Saltlen   int         // salt length in bytes
+	Params    interface{} // *Argon2Params, *ScryptParams, *BcryptParams or *Pbkdf2Params, nil if masked
+	Masked    bool        // parameters are not stored in the hash
+	Keyed     bool        // the hash records a secret (keyring, master, pepper strategy, integrity tag..)
+	Locked    bool        // the hash carries a lock marker
+	IssuedAt  time.Time   // creation time (see SetTimestamp()), zero if none
+}
+
+// infoAlgorithms are the names of the native identifiers.
+var infoAlgorithms = map[string]string{
+	idArgon2id:     specArgon2id,
+	idArgon2i:      specArgon2i,
+	idArgon2d:      specArgon2d,
+	idScrypt:       specScrypt,
+	idBcrypt:       specBcrypt,
+	idPbkdf2SHA256: specPbkdf2SHA256,
+	idPbkdf2SHA512: specPbkdf2SHA512,
+}
+
+// infoKeyed are the metadata recording a secret.
+var infoKeyed = []string{
+	metaSecretID,
+	metaMaster,
+	metaUserKey,
+	metaBcryptKeyed,
+	metaPepper,
+	metaRecord,
+}
+
+// Info parses hashed (native or PHC encoded) and describes it, the errors
+// are the Compare() *ParseError ones.
+// key'ed hashes are reported as such when they record it, the hashes of a
+// profile with a single secret (SetKey()) look non-key'ed.
+func Info(hashed []byte) (HashInfo, error) {
+	var info HashInfo
+
+	if Locked(hashed) {
+		info.Locked = true
+		unlocked, err := Unlock(hashed)
+		if err != nil {
+			return info, parseError(ErrParse, err)
+		}
+		hashed = unlocked
+	}
+
+	if isPHC(hashed) {
+		native, err := Reencode(hashed, FormatNative)
+		if err != nil {
+			return info, err
+		}
+		hashed = native
+	}
+
+	info.Keyed = hasIntegrityTag(hashed)
+	core, err := coreHash(hashed)
+	if err != nil {
+		return info, err
+	}
+	_, md, _ := splitMetadata(hashed)
+	for _, k := range infoKeyed {
+		if _, ok := md[k]; ok {
+			info.Keyed = true
+		}
+	}
+	if ts, err := mdTime(md, metaTimestamp); err == nil {
+		info.IssuedAt = ts
+	}
+
+	fields := strings.FieldsFunc(string(core), token)
+	if len(fields) == 0 {
+		return info, ErrParse
+	}
+	info.ID = fields[0]
+	info.Algorithm = info.ID
+	if name, ok := infoAlgorithms[info.ID]; ok {
+		info.Algorithm = name
+	}
+	switch info.ID {
+	case idArgon2id, idArgon2i, idArgon2d:
+		info.Version = argon2.Version
+	}
+
+	if maskedFields(fields) {
+		if _, ok := infoAlgorithms[info.ID]; !ok {
+			return info, ErrUnsupportedAlgo
+		}
+		salt, err := base64Decode([]byte(fields[1]))
+		if err != nil {
+			return info, parseError(ErrParse, err)
+		}
+		info.Masked = true
+		info.Saltlen = len(salt)
+		return info, nil
+	}
+
+	params, err := parseFromHashToParams(core)
+	if err != nil {
+		return info, err
+	}
+	switch v := params.(type) {
+	case *Argon2Params:
+		info.Saltlen = int(v.Saltlen)
+	case *ScryptParams:
+		info.Saltlen = int(v.Saltlen)
+	case *Pbkdf2Params:
+		info.Saltlen = int(v.Saltlen)
+	case *BcryptParams:
+		info.Saltlen = bcryptSaltlen
+	}
+	info.Params = publicParams(params)
+	return info, nil
+}
@@ -0,0 +1,100 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"fmt"
+)
+
+//
+// integrity tag.
+//
+// a short (key'ed if the profile has a secret) tag over the encoded hash
+// appended as a trailing field:
+//
+// $ID$b64(SALT)$b64(HASH)$t=b64(TAG)
+//
+// TAG = hmac_sha3-256(encoded, hmac_sha3-256(label, secret))[:6]
+//
+// it allows Compare() to distinguish a wrong password from a corrupted or
+// truncated stored value, before any KDF work. without a secret it is a
+// plain checksum, verified by the package level Compare() as well.
+//
+
+const (
+	labelIntegrity = "passwd/integrity/v1"
+
+	integrityTagPrefix = "t="
+	integrityTagLen    = 6
+)
+
+func integrityTag(secret, encoded []byte) []byte {
+	k := hmac.New(newSHA3256, secret)
+	k.Write([]byte(labelIntegrity))
+
+	h := hmac.New(newSHA3256, k.Sum(nil))
+	h.Write(encoded)
+	return h.Sum(nil)[:integrityTagLen]
+}
+
+func appendIntegrityTag(secret, encoded []byte) []byte {
+	var out bytes.Buffer
+
+	fmt.Fprintf(&out, "%s%c%s%s",
+		encoded,
+		separatorRune, integrityTagPrefix, base64Encode(integrityTag(secret, encoded)))
+	return out.Bytes()
+}
+
+// checkIntegrityTag verifies and strips the integrity tag.
+func checkIntegrityTag(secret, hashed []byte) ([]byte, error) {
+	if !hasIntegrityTag(hashed) {
+		return nil, ErrCorrupted
+	}
+	i := bytes.LastIndexByte(hashed, byte(separatorRune))
+
+	tag, err := base64Decode(hashed[i+1+len(integrityTagPrefix):])
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+
+	encoded := hashed[:i]
+	if !hmac.Equal(tag, integrityTag(secret, encoded)) {
+		return nil, ErrCorrupted
+	}
+
+	return encoded, nil
+}
+
+// hasIntegrityTag returns true if hashed ends with an integrity tag field,
+// neither the base64 alphabet nor bcrypt's use the '=' character.
+func hasIntegrityTag(hashed []byte) bool {
+	i := bytes.LastIndexByte(hashed, byte(separatorRune))
+	return i >= 0 && bytes.HasPrefix(hashed[i+1:], []byte(integrityTagPrefix))
+}
+
+// masked returns true if the profile produces masked hashes.
+func (p *Profile) masked() bool {
+	switch v := p.params.(type) {
+	case *ScryptParams:
+		return v.Masked
+	case *Argon2Params:
+		return v.Masked
+	case *Pbkdf2Params:
+		return v.Masked
+	}
+	return false
+}
+
+// SetIntegrityTag enables a short integrity tag appended to the hashes
+// produced by the profile, the tag is key'ed with the profile secret if
+// any.
+// Compare() returns ErrCorrupted instead of ErrMismatch when the stored
+// value has been corrupted or truncated.
+func (p *Profile) SetIntegrityTag(enabled bool) error {
+	p.integrity = enabled
+	return nil
+}
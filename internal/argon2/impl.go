@@ -0,0 +1,46 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package argon2
+
+// block function code paths.
+const (
+	ImplSSE4    = "sse4.1"
+	ImplSSE2    = "sse2"
+	ImplGeneric = "generic"
+)
+
+// implementations are the code paths available on the CPU, fastest first,
+// the fastest is selected at init time.
+var implementations = []string{ImplGeneric}
+
+// Implementations returns the code paths available on the CPU, fastest
+// first.
+func Implementations() []string {
+	return append([]string{}, implementations...)
+}
+
+// Implementation returns the code path in use.
+func Implementation() string {
+	switch {
+	case useGeneric || len(implementations) == 1:
+		return ImplGeneric
+	case useSSE4:
+		return ImplSSE4
+	}
+	return ImplSSE2
+}
+
+// SetImplementation selects an available code path, it must not be called
+// concurrently with the derivations.
+func SetImplementation(name string) bool {
+	for _, impl := range implementations {
+		if impl == name {
+			useSSE4 = name == ImplSSE4
+			useGeneric = name == ImplGeneric && len(implementations) > 1
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package argon2
+
+import (
+	"context"
+	"sync"
+)
+
+// Pool keeps the memory of finished derivations for the next ones of the
+// same size instead of allocating and collecting it for every call.
+// At most size buffers are kept, they are zeroed when returned to the pool:
+// the memory of a derivation depends on the password.
+type Pool struct {
+	mu   sync.Mutex
+	size int
+	idle int
+	free map[uint32][][]block
+}
+
+// NewPool returns a pool keeping at most size idle buffers, usually the
+// number of concurrent derivations.
+func NewPool(size int) *Pool {
+	return &Pool{
+		size: size,
+		free: make(map[uint32][][]block),
+	}
+}
+
+// Idle returns the number of buffers kept by the pool.
+func (p *Pool) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.idle
+}
+
+func (p *Pool) get(memory uint32) []block {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	free := p.free[memory]
+	if len(free) == 0 {
+		return make([]block, memory)
+	}
+	B := free[len(free)-1]
+	p.free[memory] = free[:len(free)-1]
+	p.idle--
+	return B
+}
+
+func (p *Pool) put(B []block) {
+	for i := range B {
+		B[i] = block{}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.idle >= p.size {
+		return
+	}
+	memory := uint32(len(B))
+	p.free[memory] = append(p.free[memory], B)
+	p.idle++
+}
+
+// DeriveKey is DeriveKeyContext using the memory of the pool, ctx and
+// progress may be nil.
+func (p *Pool) DeriveKey(ctx context.Context, mode int, password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32, progress func(done, total int)) ([]byte, error) {
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+
+	key := deriveKey(mode, password, salt, secret, data, time, memory, threads, keyLen, progress, done, p)
+	if key == nil {
+		return nil, ctx.Err()
+	}
+	return key, nil
+}
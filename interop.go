@@ -0,0 +1,265 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+//
+// migration off other ecosystems.
+//
+// CompareAny() recognizes the hashes of the other common stacks besides
+// the native and PHC ones:
+//
+// PHP password_hash() bcrypt:  $2y$10$... / $2b$10$...
+// Unix crypt(3) SHA-crypt:     $6$[rounds=N$]SALT$HASH / $5$[rounds=N$]SALT$HASH
+// Django PBKDF2:               pbkdf2_sha256$ITER$SALT$b64(HASH) / pbkdf2_sha1$...
+//
+// the verified hashes should be rehashed with a profile of this package,
+// InteropVerifier is meant to be a Suite legacy verifier.
+//
+
+const (
+	djangoPBKDF2SHA256 = "pbkdf2_sha256"
+	djangoPBKDF2SHA1   = "pbkdf2_sha1"
+
+	shaCryptSHA512 = "$6$"
+	shaCryptSHA256 = "$5$"
+
+	shaCryptRounds        = "rounds="
+	shaCryptDefaultRounds = 5000
+	shaCryptMinRounds     = 1000
+	shaCryptMaxSalt       = 16
+)
+
+// interop parsing bounds, like the native ones a stored hash must not hold
+// a verification for minutes: they are well above the current defaults
+// (passlib 656000 SHA-crypt rounds, Django 1200000 iterations).
+const (
+	maxInteropSHACryptRounds   = 1 << 23
+	maxInteropPbkdf2Iterations = 1 << 23
+)
+
+// InteropVerifier is the Verifier of the hashes recognized by CompareAny().
+var InteropVerifier = Named("interop", VerifierFunc(CompareAny))
+
+// CompareAny compares hashed against password, hashed being a native, PHC,
+// PHP bcrypt, SHA-crypt or Django PBKDF2 hash, ErrUnsupported is returned
+// for the other formats.
+// like Compare(), the native hashes must be non-key'ed and non-masked.
+func CompareAny(hashed, password []byte) error {
+	switch {
+	case isPHC(hashed):
+		return comparePHC(hashed, password)
+	case bytes.HasPrefix(hashed, []byte("$2y$")), bytes.HasPrefix(hashed, []byte("$2b$")):
+		// the same algorithm as $2a$ for bug free implementations.
+		native := append([]byte{}, hashed...)
+		native[2] = 'a'
+		return Compare(native, password)
+	case bytes.HasPrefix(hashed, []byte(shaCryptSHA512)):
+		return compareSHACrypt(sha512.New, shaCryptSHA512, hashed, password)
+	case bytes.HasPrefix(hashed, []byte(shaCryptSHA256)):
+		return compareSHACrypt(sha256.New, shaCryptSHA256, hashed, password)
+	case bytes.HasPrefix(hashed, []byte(djangoPBKDF2SHA256+"$")):
+		return compareDjango(sha256.New, hashed, password)
+	case bytes.HasPrefix(hashed, []byte(djangoPBKDF2SHA1+"$")):
+		return compareDjango(sha1.New, hashed, password)
+	case wellFormed(hashed) == nil:
+		return Compare(hashed, password)
+	}
+	return ErrUnsupported
+}
+
+// compareDjango verifies a Django PBKDF2PasswordHasher hash, the salt is
+// used as is.
+func compareDjango(h func() hash.Hash, hashed, password []byte) error {
+	fields := strings.Split(string(hashed), string(separatorRune))
+	if len(fields) != 4 {
+		return ErrMismatch
+	}
+
+	iter, err := strconv.ParseUint(fields[1], 10, 31)
+	if err != nil || iter == 0 {
+		return ErrMismatch
+	}
+	if iter > maxInteropPbkdf2Iterations || len(fields[3]) > base64.StdEncoding.EncodedLen(maxParseKeylen) {
+		return ErrParse
+	}
+	stored, err := base64.StdEncoding.DecodeString(fields[3])
+	if err != nil || len(stored) == 0 {
+		return ErrMismatch
+	}
+
+	key := pbkdf2.Key(password, []byte(fields[2]), int(iter), len(stored), h)
+	if subtle.ConstantTimeCompare(key, stored) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
+
+// the SHA-crypt output bytes order, in groups of 3.
+var (
+	shaCryptSHA512Order = []int{
+		0, 21, 42, 22, 43, 1, 44, 2, 23, 3, 24, 45, 25, 46, 4, 47, 5, 26, 6, 27, 48, 28, 49, 7,
+		50, 8, 29, 9, 30, 51, 31, 52, 10, 53, 11, 32, 12, 33, 54, 34, 55, 13, 56, 14, 35, 15, 36, 57,
+		37, 58, 16, 59, 17, 38, 18, 39, 60, 40, 61, 19, 62, 20, 41, 63,
+	}
+	shaCryptSHA256Order = []int{
+		0, 10, 20, 21, 1, 11, 12, 22, 2, 3, 13, 23, 24, 4, 14, 15, 25, 5, 6, 16, 26, 27, 7, 17,
+		18, 28, 8, 9, 19, 29, 31, 30,
+	}
+)
+
+// compareSHACrypt verifies a SHA-crypt hash (Ulrich Drepper's
+// specification, glibc crypt(3)).
+func compareSHACrypt(h func() hash.Hash, prefix string, hashed, password []byte) error {
+	fields := strings.Split(string(hashed[len(prefix):]), string(separatorRune))
+
+	rounds, explicit := shaCryptDefaultRounds, false
+	if len(fields) == 3 && strings.HasPrefix(fields[0], shaCryptRounds) {
+		r, err := strconv.ParseUint(fields[0][len(shaCryptRounds):], 10, 32)
+		if err != nil {
+			return ErrMismatch
+		}
+		// out of range values are clamped, the costly ones refused.
+		switch {
+		case r > maxInteropSHACryptRounds:
+			return ErrParse
+		case r < shaCryptMinRounds:
+			r = shaCryptMinRounds
+		}
+		rounds, explicit = int(r), true
+		fields = fields[1:]
+	}
+	if len(fields) != 2 {
+		return ErrMismatch
+	}
+
+	salt := fields[0]
+	if len(salt) > shaCryptMaxSalt {
+		salt = salt[:shaCryptMaxSalt]
+	}
+
+	computed := shaCrypt(h, []byte(salt), password, rounds)
+
+	var out bytes.Buffer
+	out.WriteString(prefix)
+	if explicit {
+		out.WriteString(shaCryptRounds + strconv.Itoa(rounds) + string(separatorRune))
+	}
+	out.WriteString(salt + string(separatorRune))
+	out.Write(computed)
+
+	if subtle.ConstantTimeCompare(out.Bytes(), hashed) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
+
+// shaCrypt returns the encoded SHA-crypt digest.
+func shaCrypt(h func() hash.Hash, salt, password []byte, rounds int) []byte {
+	// repeat returns digest repeated up to n bytes.
+	repeat := func(digest []byte, n int) []byte {
+		out := make([]byte, 0, n)
+		for len(out)+len(digest) <= n {
+			out = append(out, digest...)
+		}
+		return append(out, digest[:n-len(out)]...)
+	}
+
+	b := h()
+	b.Write(password)
+	b.Write(salt)
+	b.Write(password)
+	digestB := b.Sum(nil)
+
+	a := h()
+	a.Write(password)
+	a.Write(salt)
+	a.Write(repeat(digestB, len(password)))
+	for n := len(password); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			a.Write(digestB)
+		} else {
+			a.Write(password)
+		}
+	}
+	digestA := a.Sum(nil)
+
+	dp := h()
+	for range password {
+		dp.Write(password)
+	}
+	p := repeat(dp.Sum(nil), len(password))
+
+	ds := h()
+	for i := 0; i < 16+int(digestA[0]); i++ {
+		ds.Write(salt)
+	}
+	s := repeat(ds.Sum(nil), len(salt))
+
+	c := digestA
+	for i := 0; i < rounds; i++ {
+		r := h()
+		if i&1 != 0 {
+			r.Write(p)
+		} else {
+			r.Write(c)
+		}
+		if i%3 != 0 {
+			r.Write(s)
+		}
+		if i%7 != 0 {
+			r.Write(p)
+		}
+		if i&1 != 0 {
+			r.Write(c)
+		} else {
+			r.Write(p)
+		}
+		c = r.Sum(nil)
+	}
+
+	order := shaCryptSHA256Order
+	if len(c) == sha512.Size {
+		order = shaCryptSHA512Order
+	}
+	return cryptEncode(c, order)
+}
+
+// cryptEncode is the crypt(3) base64 of the digest bytes taken in order,
+// by groups of 3, the last group being short.
+func cryptEncode(digest []byte, order []int) []byte {
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	var out []byte
+	for i := 0; i < len(order); i += 3 {
+		var w uint32
+		n := 4
+		switch len(order) - i {
+		case 1:
+			w, n = uint32(digest[order[i]]), 2
+		case 2:
+			w, n = uint32(digest[order[i]])<<8|uint32(digest[order[i+1]]), 3
+		default:
+			w = uint32(digest[order[i]])<<16 | uint32(digest[order[i+1]])<<8 | uint32(digest[order[i+2]])
+		}
+		for ; n > 0; n-- {
+			out = append(out, itoa64[w&0x3f])
+			w >>= 6
+		}
+	}
+	return out
+}
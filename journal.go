@@ -0,0 +1,153 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+//
+// compliance journal.
+//
+// a profile with a journal appends an event for every hash, verify, rehash
+// and secret rotation, regulated deployments keep them in an append-only
+// store to prove when credentials were last re-hashed and which key
+// generation (see KeyID()) protected them.
+// the journal fails closed: an event that cannot be appended fails the
+// operation.
+//
+
+const labelKeyID = "passwd/keyid/v1"
+
+// journal events.
+const (
+	JournalHash           = "hash"
+	JournalVerify         = "verify"
+	JournalRehash         = "rehash"
+	JournalSecretRotation = "secret-rotation"
+)
+
+// JournalEvent is an entry of the journal, it never contains passwords,
+// hashes nor secrets.
+type JournalEvent struct {
+	Time      time.Time `json:"time"`
+	Event     string    `json:"event"`
+	Algorithm string    `json:"alg,omitempty"`    // hash identifier (i.e. "2id")
+	KeyID     string    `json:"key_id,omitempty"` // generation of the profile secret, if any
+	Result    string    `json:"result"`           // "ok" or the error
+}
+
+// Journal receives the events, Append is called synchronously.
+type Journal interface {
+	Append(e JournalEvent) error
+}
+
+// JournalFunc adapts an ordinary function to the Journal interface.
+type JournalFunc func(e JournalEvent) error
+
+// Append calls f(e).
+func (f JournalFunc) Append(e JournalEvent) error {
+	return f(e)
+}
+
+type jsonJournal struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONJournal returns a Journal writing the events as JSON lines to w
+// (i.e. a file opened with os.O_APPEND), writes are serialized.
+func NewJSONJournal(w io.Writer) Journal {
+	return &jsonJournal{enc: json.NewEncoder(w)}
+}
+
+func (j *jsonJournal) Append(e JournalEvent) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.enc.Encode(e)
+}
+
+type multiJournal []Journal
+
+// MultiJournal returns a Journal appending the events to all the journals,
+// in order, it stops at the first error.
+func MultiJournal(journals ...Journal) Journal {
+	return multiJournal(journals)
+}
+
+func (m multiJournal) Append(e JournalEvent) error {
+	for _, j := range m {
+		err := j.Append(e)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// KeyID returns the public identifier of a secret generation:
+//
+// KeyID = hex(SHA3-256("passwd/keyid/v1" || secret)[:8])
+func KeyID(secret []byte) string {
+	h := newSHA3256()
+	h.Write([]byte(labelKeyID))
+	h.Write(secret)
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// SetJournal attaches the journal receiving the profile events, nil
+// removes it.
+func (p *Profile) SetJournal(j Journal) error {
+	p.journal = j
+	return nil
+}
+
+// logEvent appends the event of an operation ending with err, a journal
+// failure replaces a nil err.
+func (p *Profile) logEvent(event string, err error) error {
+	if p.journal == nil {
+		return err
+	}
+
+	e := JournalEvent{
+		Time:      now().UTC(),
+		Event:     event,
+		Algorithm: paramsAlgorithm(p.params),
+		Result:    "ok",
+	}
+	if secret := p.key(); len(secret) > 0 {
+		e.KeyID = KeyID(secret)
+	}
+	if err != nil {
+		e.Result = err.Error()
+	}
+
+	jerr := p.journal.Append(e)
+	if err == nil {
+		err = jerr
+	}
+	return err
+}
+
+// Rehash compares hashed against password like CompareEx() and returns
+// the new hash to store if it needs a rehash, nil otherwise.
+func (p *Profile) Rehash(hashed, password []byte) ([]byte, error) {
+	defer p.wipePassword(password)
+
+	r, err := p.keep().CompareEx(hashed, password)
+	if err != nil || !r.NeedsRehash {
+		return nil, err
+	}
+
+	rehashed, err := p.hashPassword(password)
+	err = p.logEvent(JournalRehash, err)
+	if err != nil {
+		return nil, err
+	}
+	return rehashed, nil
+}
@@ -0,0 +1,51 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"github.com/ermites-io/passwd/internal/argon2"
+	"github.com/ermites-io/passwd/internal/scrypt"
+)
+
+// the KDF cores, the build tagged backends (libsodium, openssl..) replace
+// them at init time, their outputs must be identical and they fall back to
+// the Go implementation for the parameters they do not support.
+var (
+	argon2Key = argon2.DeriveKey
+	scryptKey = scrypt.Key
+
+	backend = "go"
+)
+
+// Backend returns the name of the KDF backend in use ("go" by default).
+func Backend() string {
+	return backend
+}
+
+// key runs the argon2 core, progress, cancellation and the buffer pool are
+// handled by the Go implementation only, the backends are skipped when a
+// progress hook, a context or a pool is set.
+func (p *Argon2Params) key(mode int, password, salt, secret []byte) ([]byte, error) {
+	if p.pool != nil {
+		return p.pool.DeriveKey(p.ctx, mode, password, salt, secret, nil, p.Time, p.Memory, p.Thread, p.Keylen, p.progress)
+	}
+	if p.ctx != nil {
+		return argon2.DeriveKeyContext(p.ctx, mode, password, salt, secret, nil, p.Time, p.Memory, p.Thread, p.Keylen, p.progress)
+	}
+	if p.progress != nil {
+		return argon2.DeriveKeyProgress(mode, password, salt, secret, nil, p.Time, p.Memory, p.Thread, p.Keylen, p.progress), nil
+	}
+	return argon2Key(mode, password, salt, secret, nil, p.Time, p.Memory, p.Thread, p.Keylen), nil
+}
+
+// key runs the scrypt core, see (*Argon2Params).key().
+func (p *ScryptParams) key(password, salt []byte) ([]byte, error) {
+	if p.ctx != nil {
+		return scrypt.KeyContext(p.ctx, password, salt, int(p.N), int(p.R), int(p.P), int(p.Keylen), p.progress)
+	}
+	if p.progress != nil {
+		return scrypt.KeyProgress(password, salt, int(p.N), int(p.R), int(p.P), int(p.Keylen), p.progress)
+	}
+	return scryptKey(password, salt, int(p.N), int(p.R), int(p.P), int(p.Keylen))
+}
@@ -0,0 +1,91 @@
+//go:build passwd_libsodium && cgo
+// +build passwd_libsodium,cgo
+
+package passwd
+
+//
+// libsodium backend, enabled with the "passwd_libsodium" build tag:
+//
+// go build -tags passwd_libsodium
+//
+// libsodium argon2 is single lane and has no secret/associated data
+// inputs, it only handles Thread == 1, 16 bytes salts, without a native
+// pepper, other parameters use the Go implementation.
+//
+
+/*
+#cgo pkg-config: libsodium
+#include <sodium.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/ermites-io/passwd/internal/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+func init() {
+	if C.sodium_init() < 0 {
+		return
+	}
+
+	argon2Key = sodiumArgon2Key
+	scryptKey = sodiumScryptKey
+	backend = "libsodium"
+}
+
+// cbytes returns a C pointer to b, never NULL.
+func cbytes(b []byte) *C.uchar {
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	return (*C.uchar)(unsafe.Pointer(&b[0]))
+}
+
+func sodiumArgon2Key(mode int, password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	var alg C.int
+	var minOps uint32
+
+	switch mode {
+	case argon2.ModeI:
+		alg, minOps = C.crypto_pwhash_ALG_ARGON2I13, 3
+	case argon2.ModeID:
+		alg, minOps = C.crypto_pwhash_ALG_ARGON2ID13, 1
+	default:
+		return argon2.DeriveKey(mode, password, salt, secret, data, time, memory, threads, keyLen)
+	}
+
+	if threads != 1 || len(salt) != C.crypto_pwhash_SALTBYTES || len(secret) > 0 || len(data) > 0 ||
+		time < minOps || memory < 8 || keyLen < C.crypto_pwhash_BYTES_MIN {
+		return argon2.DeriveKey(mode, password, salt, secret, data, time, memory, threads, keyLen)
+	}
+
+	key := make([]byte, keyLen)
+	rc := C.crypto_pwhash(cbytes(key), C.ulonglong(keyLen),
+		(*C.char)(unsafe.Pointer(cbytes(password))), C.ulonglong(len(password)),
+		cbytes(salt),
+		C.ulonglong(time), C.size_t(memory)*1024, alg)
+	if rc != 0 {
+		return argon2.DeriveKey(mode, password, salt, secret, data, time, memory, threads, keyLen)
+	}
+	return key
+}
+
+func sodiumScryptKey(password, salt []byte, N, r, p, keyLen int) ([]byte, error) {
+	if N <= 1 || N&(N-1) != 0 || r <= 0 || p <= 0 || keyLen <= 0 {
+		return scrypt.Key(password, salt, N, r, p, keyLen) // error reporting
+	}
+
+	key := make([]byte, keyLen)
+	rc := C.crypto_pwhash_scryptsalsa208sha256_ll(
+		cbytes(password), C.size_t(len(password)),
+		cbytes(salt), C.size_t(len(salt)),
+		C.uint64_t(N), C.uint32_t(r), C.uint32_t(p),
+		cbytes(key), C.size_t(keyLen))
+	if rc != 0 {
+		return scrypt.Key(password, salt, N, r, p, keyLen)
+	}
+	return key, nil
+}
@@ -0,0 +1,153 @@
+//go:build passwd_openssl && cgo
+// +build passwd_openssl,cgo
+
+package passwd
+
+//
+// OpenSSL EVP_KDF backend, enabled with the "passwd_openssl" build tag
+// (OpenSSL 3.0+, argon2 requires 3.2+):
+//
+// go build -tags passwd_openssl
+//
+// the parameters OpenSSL rejects use the Go implementation, do not combine
+// with the libsodium backend.
+//
+
+/*
+#cgo pkg-config: libcrypto
+#include <stdint.h>
+#include <openssl/opensslv.h>
+#include <openssl/core_names.h>
+#include <openssl/kdf.h>
+#include <openssl/params.h>
+
+static int passwd_derive(const char *name, OSSL_PARAM *params, unsigned char *out, size_t outlen) {
+	EVP_KDF *kdf = EVP_KDF_fetch(NULL, name, NULL);
+	if (kdf == NULL)
+		return 0;
+
+	EVP_KDF_CTX *ctx = EVP_KDF_CTX_new(kdf);
+	EVP_KDF_free(kdf);
+	if (ctx == NULL)
+		return 0;
+
+	int ok = EVP_KDF_derive(ctx, out, outlen, params);
+	EVP_KDF_CTX_free(ctx);
+	return ok;
+}
+
+static int passwd_scrypt(unsigned char *pass, size_t passlen, unsigned char *salt, size_t saltlen,
+	uint64_t n, uint32_t r, uint32_t p, unsigned char *out, size_t outlen) {
+	uint64_t maxmem = UINT64_MAX;
+	OSSL_PARAM params[] = {
+		OSSL_PARAM_octet_string(OSSL_KDF_PARAM_PASSWORD, pass, passlen),
+		OSSL_PARAM_octet_string(OSSL_KDF_PARAM_SALT, salt, saltlen),
+		OSSL_PARAM_uint64(OSSL_KDF_PARAM_SCRYPT_N, &n),
+		OSSL_PARAM_uint32(OSSL_KDF_PARAM_SCRYPT_R, &r),
+		OSSL_PARAM_uint32(OSSL_KDF_PARAM_SCRYPT_P, &p),
+		OSSL_PARAM_uint64(OSSL_KDF_PARAM_SCRYPT_MAXMEM, &maxmem),
+		OSSL_PARAM_END,
+	};
+	return passwd_derive("SCRYPT", params, out, outlen);
+}
+
+static int passwd_argon2(const char *name, unsigned char *pass, size_t passlen, unsigned char *salt, size_t saltlen,
+	unsigned char *secret, size_t secretlen, unsigned char *ad, size_t adlen,
+	uint32_t t, uint32_t m, uint32_t lanes, unsigned char *out, size_t outlen) {
+#if OPENSSL_VERSION_NUMBER >= 0x30200000L
+	uint32_t threads = 1; // lanes define the output, threads the parallelism
+	uint32_t version = 0x13;
+	OSSL_PARAM params[10], *q = params;
+
+	*q++ = OSSL_PARAM_construct_octet_string(OSSL_KDF_PARAM_PASSWORD, pass, passlen);
+	*q++ = OSSL_PARAM_construct_octet_string(OSSL_KDF_PARAM_SALT, salt, saltlen);
+	if (secretlen > 0)
+		*q++ = OSSL_PARAM_construct_octet_string(OSSL_KDF_PARAM_SECRET, secret, secretlen);
+	if (adlen > 0)
+		*q++ = OSSL_PARAM_construct_octet_string(OSSL_KDF_PARAM_ARGON2_AD, ad, adlen);
+	*q++ = OSSL_PARAM_construct_uint32(OSSL_KDF_PARAM_ITER, &t);
+	*q++ = OSSL_PARAM_construct_uint32(OSSL_KDF_PARAM_ARGON2_MEMCOST, &m);
+	*q++ = OSSL_PARAM_construct_uint32(OSSL_KDF_PARAM_ARGON2_LANES, &lanes);
+	*q++ = OSSL_PARAM_construct_uint32(OSSL_KDF_PARAM_THREADS, &threads);
+	*q++ = OSSL_PARAM_construct_uint32(OSSL_KDF_PARAM_ARGON2_VERSION, &version);
+	*q = OSSL_PARAM_construct_end();
+
+	return passwd_derive(name, params, out, outlen);
+#else
+	return 0;
+#endif
+}
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/ermites-io/passwd/internal/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+func init() {
+	argon2Key = opensslArgon2Key
+	scryptKey = opensslScryptKey
+	backend = "openssl"
+}
+
+// cbytes returns a C pointer to b, never NULL.
+func cbytes(b []byte) *C.uchar {
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	return (*C.uchar)(unsafe.Pointer(&b[0]))
+}
+
+var (
+	kdfArgon2i  = C.CString("ARGON2I")
+	kdfArgon2id = C.CString("ARGON2ID")
+	kdfArgon2d  = C.CString("ARGON2D")
+)
+
+func opensslArgon2Key(mode int, password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	var name *C.char
+
+	switch mode {
+	case argon2.ModeI:
+		name = kdfArgon2i
+	case argon2.ModeID:
+		name = kdfArgon2id
+	case argon2.ModeD:
+		name = kdfArgon2d
+	default:
+		return argon2.DeriveKey(mode, password, salt, secret, data, time, memory, threads, keyLen)
+	}
+
+	key := make([]byte, keyLen)
+	ok := C.passwd_argon2(name,
+		cbytes(password), C.size_t(len(password)),
+		cbytes(salt), C.size_t(len(salt)),
+		cbytes(secret), C.size_t(len(secret)),
+		cbytes(data), C.size_t(len(data)),
+		C.uint32_t(time), C.uint32_t(memory), C.uint32_t(threads),
+		cbytes(key), C.size_t(keyLen))
+	if ok != 1 {
+		return argon2.DeriveKey(mode, password, salt, secret, data, time, memory, threads, keyLen)
+	}
+	return key
+}
+
+func opensslScryptKey(password, salt []byte, N, r, p, keyLen int) ([]byte, error) {
+	if N <= 1 || N&(N-1) != 0 || r <= 0 || p <= 0 || keyLen <= 0 {
+		return scrypt.Key(password, salt, N, r, p, keyLen) // error reporting
+	}
+
+	key := make([]byte, keyLen)
+	ok := C.passwd_scrypt(
+		cbytes(password), C.size_t(len(password)),
+		cbytes(salt), C.size_t(len(salt)),
+		C.uint64_t(N), C.uint32_t(r), C.uint32_t(p),
+		cbytes(key), C.size_t(keyLen))
+	if ok != 1 {
+		return scrypt.Key(password, salt, N, r, p, keyLen)
+	}
+	return key, nil
+}
@@ -0,0 +1,140 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"crypto/aes"
+	"crypto/sha1"
+	"encoding/binary"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+//
+// Kerberos string-to-key (RFC 3962).
+//
+// the aes128-cts-hmac-sha1-96 and aes256-cts-hmac-sha1-96 long term keys
+// are derived from the principal password:
+//
+// tkey = PBKDF2-HMAC-SHA1(password, salt, iterations, keylen)
+// key  = DK(tkey, "kerberos")
+//
+// the default salt is the realm followed by the principal components (see
+// KerberosSalt()), the iterations count comes from the s2kparams of the
+// KDC (see KerberosIterations()).
+//
+
+// Kerberos encryption types (RFC 3962 section 7).
+const (
+	KerberosAES128 = 17 // aes128-cts-hmac-sha1-96
+	KerberosAES256 = 18 // aes256-cts-hmac-sha1-96
+
+	// KerberosDefaultIterations is the iterations count when the KDC sends
+	// no s2kparams.
+	KerberosDefaultIterations = 4096
+)
+
+var kerberosConstant = []byte("kerberos")
+
+// KerberosSalt returns the default salt of principal in realm, the
+// principal components are concatenated without separator (i.e.
+// "ATHENA.MIT.EDU" and "raeburn" give "ATHENA.MIT.EDUraeburn").
+func KerberosSalt(realm string, principal ...string) []byte {
+	salt := []byte(realm)
+	for _, c := range principal {
+		salt = append(salt, c...)
+	}
+	return salt
+}
+
+// KerberosIterations returns the iterations count of the s2kparams, a 32
+// bits big endian integer, nil params give KerberosDefaultIterations.
+// the value 0 (2^32 iterations) is not supported.
+func KerberosIterations(s2kparams []byte) (int, error) {
+	if s2kparams == nil {
+		return KerberosDefaultIterations, nil
+	}
+	if len(s2kparams) != 4 {
+		return 0, ErrParse
+	}
+
+	iterations := binary.BigEndian.Uint32(s2kparams)
+	if iterations == 0 {
+		return 0, ErrUnsupported
+	}
+	return int(iterations), nil
+}
+
+// DeriveKerberosKey derives the etype (KerberosAES128 or KerberosAES256)
+// key of password.
+func DeriveKerberosKey(etype int, password, salt []byte, iterations int) ([]byte, error) {
+	var keyLen int
+	switch etype {
+	case KerberosAES128:
+		keyLen = 16
+	case KerberosAES256:
+		keyLen = 32
+	default:
+		return nil, ErrUnsupported
+	}
+	if iterations <= 0 {
+		return nil, ErrUnsupported
+	}
+
+	tkey := pbkdf2.Key(password, salt, iterations, keyLen, sha1.New)
+	defer wipe(tkey)
+
+	return kerberosDK(tkey, kerberosConstant)
+}
+
+// kerberosDK is the RFC 3961 DK(), AES random-to-key is the identity.
+func kerberosDK(key, constant []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// the folded constant is one block, the CBC-CTS encryption is the
+	// block encryption.
+	in := nfold(constant, aes.BlockSize)
+	dk := make([]byte, 0, len(key)+aes.BlockSize)
+	for len(dk) < len(key) {
+		out := make([]byte, aes.BlockSize)
+		block.Encrypt(out, in)
+		dk = append(dk, out...)
+		in = out
+	}
+	return dk[:len(key)], nil
+}
+
+// nfold is the RFC 3961 n-fold of in to n bytes.
+func nfold(in []byte, n int) []byte {
+	k := len(in)
+	a, b := n, k
+	for b != 0 {
+		a, b = b, a%b
+	}
+	lcm := n * k / a
+
+	out := make([]byte, n)
+	carry := 0
+	for i := lcm - 1; i >= 0; i-- {
+		// the msbit of the (13 bits rotated) input byte added to this one.
+		msbit := ((k << 3) - 1) + ((k<<3)+13)*(i/k) + ((k - i%k) << 3)
+		msbit %= k << 3
+
+		v := (int(in[(k-1-msbit>>3)%k]) << 8) | int(in[(k-msbit>>3)%k])
+		carry += ((v >> uint(msbit&7+1)) & 0xff) + int(out[i%n])
+		out[i%n] = byte(carry)
+		carry >>= 8
+	}
+
+	// ones' complement addition, wrap the carry.
+	for i := n - 1; i >= 0 && carry != 0; i-- {
+		carry += int(out[i])
+		out[i] = byte(carry)
+		carry >>= 8
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+//
+// passphrase keypairs.
+//
+// signing and key agreement keypairs are derived deterministically from a
+// passphrase (wallets, backup recovery..), the profile KDF stretches the
+// passphrase and the seed is expanded with a per usage label:
+//
+// seed = HKDF-SHA3-256(Derive(password, salt), info = label)
+//
+// the same passphrase and salt always give the same keypairs, the labels
+// make the ed25519 and x25519 keys independent.
+//
+
+const (
+	labelEd25519 = "passwd/ed25519/v1"
+	labelX25519  = "passwd/x25519/v1"
+)
+
+// deriveSeed stretches password and expands the seed of the label usage.
+func (p *Profile) deriveSeed(password, salt []byte, label string, size int) ([]byte, error) {
+	key, err := p.Derive(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(key)
+
+	seed := make([]byte, size)
+	_, err = io.ReadFull(hkdf.New(newSHA3256, key, nil, []byte(label)), seed)
+	if err != nil {
+		return nil, err
+	}
+	return seed, nil
+}
+
+// DeriveSigningKey derives an ed25519 private key from password and salt,
+// the public key is its Public() method.
+func (p *Profile) DeriveSigningKey(password, salt []byte) (ed25519.PrivateKey, error) {
+	seed, err := p.deriveSeed(password, salt, labelEd25519, ed25519.SeedSize)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(seed)
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// DeriveAgreementKey derives a x25519 keypair from password and salt.
+func (p *Profile) DeriveAgreementKey(password, salt []byte) (private, public []byte, err error) {
+	private, err = p.deriveSeed(password, salt, labelX25519, curve25519.ScalarSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	public, err = curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		wipe(private)
+		return nil, nil, err
+	}
+	return private, public, nil
+}
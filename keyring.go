@@ -0,0 +1,145 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+)
+
+//
+// secrets keyring.
+//
+// the profile holds several secrets (peppers) under an identifier, the
+// active one keys the produced hashes which record its identifier:
+//
+// $ID$ki=KEYID$b64(SALT)$...
+//
+// Compare() selects the secret of the stored identifier, the hashes
+// produced before the keyring (without identifier) use the "" secret, if
+// any.
+// rotation: add the next secret, make it active, CompareEx() reports
+// NeedsRehash for the hashes of the other secrets and
+// RehashWithActiveSecret() upgrades them at login, once SecretID() finds
+// no hash left behind, the retired secret is removed from the keyring.
+//
+
+const (
+	metaSecretID = "ki" // keyring identifier of the secret
+
+	secretIDMaxLength = 32
+)
+
+// validSecretID returns true for the identifiers a keyring accepts:
+// letters, digits, '.', '_' and '-'.
+func validSecretID(id string) bool {
+	if len(id) == 0 || len(id) > secretIDMaxLength {
+		return false
+	}
+	for _, c := range []byte(id) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// SetSecrets sets the keyring of the profile, the produced hashes are
+// key'ed with the secret of activeID.
+// the secrets are validated like SetSecret(), the "" identifier is only
+// for the hashes produced before the keyring and cannot be active.
+func (p *Profile) SetSecrets(secrets map[string][]byte, activeID string) error {
+	switch p.params.(type) {
+	case *ScryptParams, *Argon2Params, *Pbkdf2Params, *BcryptParams:
+	default:
+		return ErrUnsupported
+	}
+
+	active, ok := secrets[activeID]
+	if !ok || !validSecretID(activeID) {
+		return ErrUnsupported
+	}
+
+	keyring := make(map[string][]byte, len(secrets))
+	for id, secret := range secrets {
+		if id != "" && !validSecretID(id) {
+			return ErrUnsupported
+		}
+		err := validateSecret(secret)
+		if err != nil {
+			return err
+		}
+		keyring[id] = secret
+	}
+
+	err := p.SetKey(active)
+	p.keyring = keyring
+	p.secretID = activeID
+	return err
+}
+
+// forSecret returns the profile verifying hashed, key'ed with the keyring
+// secret it was produced with.
+func (p *Profile) forSecret(hashed []byte) (*Profile, error) {
+	id := SecretID(hashed)
+	if id == p.secretID {
+		return p, nil
+	}
+
+	secret, ok := p.keyring[id]
+	if !ok {
+		return nil, ErrMismatch
+	}
+
+	c := p.copy()
+	switch v := c.params.(type) {
+	case *ScryptParams:
+		v.secret = secret
+	case *Argon2Params:
+		v.secret = secret
+	case *Pbkdf2Params:
+		v.secret = secret
+	case *BcryptParams:
+		v.secret = secret
+	}
+	c.secretID = id
+	return c, nil
+}
+
+// RehashWithActiveSecret compares hashed against password and returns the
+// hash to store: hashed if it is key'ed with the active secret, a new hash
+// otherwise.
+func (p *Profile) RehashWithActiveSecret(hashed, password []byte) ([]byte, error) {
+	defer p.wipePassword(password)
+
+	err := p.keep().Compare(hashed, password)
+	if err != nil {
+		return nil, err
+	}
+	if SecretID(hashed) == p.secretID {
+		return hashed, nil
+	}
+
+	rehashed, err := p.hashPassword(password)
+	err = p.logEvent(JournalRehash, err)
+	if err != nil {
+		return nil, err
+	}
+	return rehashed, nil
+}
+
+// SecretID returns the keyring identifier of the secret hashed was
+// produced with, empty if it was not produced with a keyring.
+func SecretID(hashed []byte) string {
+	if hasIntegrityTag(hashed) {
+		hashed = hashed[:bytes.LastIndexByte(hashed, byte(separatorRune))]
+	}
+	_, md, err := splitMetadata(hashed)
+	if err != nil {
+		return ""
+	}
+	return md[metaSecretID]
+}
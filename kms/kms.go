@@ -0,0 +1,235 @@
+//go:build go1.12
+// +build go1.12
+
+// Package kms provides a passwd.Blinder backed by AWS KMS HMAC keys
+// (GenerateMac), the key material never leaves KMS.
+//
+// the KMS key must be usable in all the configured regions (a multi-region
+// key or an alias of replicas), the regions are tried in order, a region
+// failing (network, throttling, 5xx) falls back to the next one.
+//
+// the pepper cannot be exported, which is the point, so this is a Blinder
+// and not a passwd.SecretProvider:
+//
+//	m, err := kms.New(kms.Config{KeyID: "alias/passwd", Regions: []string{"eu-west-1", "eu-central-1"}})
+//	err = profile.SetBlinder(m)
+package kms
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ermites-io/passwd"
+)
+
+// Error is the type helping defining errors as constants.
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+const (
+	// ErrConfig when the configuration is incomplete
+	ErrConfig = Error("invalid kms configuration")
+	// ErrResponse when kms returns an unexpected response or all the
+	// regions failed
+	ErrResponse = Error("invalid kms response")
+	// ErrRateLimited when the local request rate guardrail is exceeded
+	ErrRateLimited = Error("kms rate limited")
+)
+
+const (
+	service          = "kms"
+	targetGenerate   = "TrentService.GenerateMac"
+	defaultAlgorithm = "HMAC_SHA_256"
+)
+
+// Credentials are the AWS credentials used to sign the requests.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// EnvCredentials reads the credentials from the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+func EnvCredentials() Credentials {
+	return Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// Config is the KMS blinder configuration.
+type Config struct {
+	KeyID        string      // key id, arn or alias
+	MacAlgorithm string      // "HMAC_SHA_256" if empty
+	Regions      []string    // regions tried in order
+	Credentials  Credentials // EnvCredentials() if empty
+
+	// Endpoint returns the endpoint of region, by default
+	// https://kms.<region>.amazonaws.com
+	Endpoint func(region string) string
+
+	Client *http.Client // http.DefaultClient if nil
+
+	// Rate (requests per second) and Burst bound the requests sent to
+	// KMS, Blind() fails with ErrRateLimited beyond, 0 disables the
+	// guardrail.
+	Rate  float64
+	Burst int
+}
+
+// MAC is a passwd.Blinder computing the digests HMAC with KMS.
+type MAC struct {
+	cfg Config
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// New returns a KMS blinder.
+func New(cfg Config) (*MAC, error) {
+	if cfg.KeyID == "" || len(cfg.Regions) == 0 {
+		return nil, ErrConfig
+	}
+	if cfg.MacAlgorithm == "" {
+		cfg.MacAlgorithm = defaultAlgorithm
+	}
+	if cfg.Credentials.AccessKeyID == "" {
+		cfg.Credentials = EnvCredentials()
+	}
+	if cfg.Credentials.AccessKeyID == "" || cfg.Credentials.SecretAccessKey == "" {
+		return nil, ErrConfig
+	}
+	if cfg.Endpoint == nil {
+		cfg.Endpoint = func(region string) string {
+			return "https://kms." + region + ".amazonaws.com/"
+		}
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = 1
+	}
+
+	m := MAC{
+		cfg:    cfg,
+		tokens: float64(cfg.Burst),
+		last:   time.Now(),
+	}
+	return &m, nil
+}
+
+// allow is a token bucket, it returns false if no request can be sent.
+func (m *MAC) allow() bool {
+	if m.cfg.Rate <= 0 {
+		return true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.tokens += now.Sub(m.last).Seconds() * m.cfg.Rate
+	if m.tokens > float64(m.cfg.Burst) {
+		m.tokens = float64(m.cfg.Burst)
+	}
+	m.last = now
+
+	if m.tokens < 1 {
+		return false
+	}
+	m.tokens--
+	return true
+}
+
+// the json encoding of []byte is standard base64, as expected by KMS.
+type generateMacRequest struct {
+	KeyID        string `json:"KeyId"`
+	MacAlgorithm string `json:"MacAlgorithm"`
+	Message      []byte `json:"Message"`
+}
+
+type generateMacResponse struct {
+	Mac []byte `json:"Mac"`
+}
+
+// Blind implements the passwd.Blinder interface.
+func (m *MAC) Blind(digest []byte) ([]byte, error) {
+	if !m.allow() {
+		return nil, ErrRateLimited
+	}
+
+	body, err := json.Marshal(&generateMacRequest{
+		KeyID:        m.cfg.KeyID,
+		MacAlgorithm: m.cfg.MacAlgorithm,
+		Message:      digest,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, region := range m.cfg.Regions {
+		mac, retry, err := m.generate(region, body)
+		if err == nil {
+			return mac, nil
+		}
+		if !retry {
+			return nil, err
+		}
+	}
+	return nil, ErrResponse
+}
+
+// generate calls GenerateMac in region, retry is true if the next region
+// should be tried.
+func (m *MAC) generate(region string, body []byte) (mac []byte, retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, m.cfg.Endpoint(region), bytes.NewReader(body))
+	if err != nil {
+		return nil, true, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", targetGenerate)
+	sign(req, body, m.cfg.Credentials, region, service, time.Now())
+
+	resp, err := m.cfg.Client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusTooManyRequests:
+		return nil, true, ErrResponse
+	case resp.StatusCode == http.StatusBadRequest && isThrottling(resp):
+		return nil, true, ErrResponse
+	default:
+		return nil, false, ErrResponse
+	}
+
+	var gm generateMacResponse
+	err = json.NewDecoder(resp.Body).Decode(&gm)
+	if err != nil || len(gm.Mac) == 0 {
+		return nil, true, ErrResponse
+	}
+	return gm.Mac, false, nil
+}
+
+// isThrottling returns true for the KMS throttling errors (reported as 400).
+func isThrottling(resp *http.Response) bool {
+	var e struct {
+		Type string `json:"__type"`
+	}
+	json.NewDecoder(resp.Body).Decode(&e)
+	return e.Type == "ThrottlingException"
+}
+
+var _ passwd.Blinder = (*MAC)(nil)
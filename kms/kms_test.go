@@ -0,0 +1,93 @@
+package kms
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ermites-io/passwd"
+)
+
+// https://docs.aws.amazon.com/general/latest/gr/sigv4-signed-request-examples.html
+func TestSign(t *testing.T) {
+	creds := Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+
+	key := hex.EncodeToString(signingKey(creds.SecretAccessKey, "20150830", "us-east-1", "iam"))
+	if key != "c4afb1cc5771d871763a393e44b703571b55cc28424d1a5e86da6ed3c154a4b9" {
+		t.Fatalf("signing key %s\n", key)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	sign(req, nil, creds, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if got := req.Header.Get("Authorization"); got != expected {
+		t.Fatalf("authorization %s vs expected: %s\n", got, expected)
+	}
+}
+
+func TestMAC(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type":"ThrottlingException"}`))
+	}))
+	defer failing.Close()
+
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != targetGenerate || !strings.Contains(r.Header.Get("Authorization"), "/eu-central-1/kms/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var req generateMacRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		h := hmac.New(sha256.New, []byte("kms-key"))
+		h.Write(req.Message)
+		json.NewEncoder(w).Encode(&generateMacResponse{Mac: h.Sum(nil)})
+	}))
+	defer working.Close()
+
+	m, err := New(Config{
+		KeyID:       "alias/passwd",
+		Regions:     []string{"eu-west-1", "eu-central-1"},
+		Credentials: Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"},
+		Endpoint: func(region string) string {
+			if region == "eu-west-1" {
+				return failing.URL
+			}
+			return working.URL
+		},
+		Rate:  1,
+		Burst: 3,
+	})
+	if err != nil {
+		t.Fatalf("new error: %v\n", err)
+	}
+
+	p, _ := passwd.NewCustom(&passwd.ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	p.SetBlinder(m)
+
+	hashed, err := p.Hash([]byte("prout"))
+	if err != nil {
+		t.Fatalf("hash error: %v\n", err)
+	}
+	if err := p.Compare(hashed, []byte("prout")); err != nil {
+		t.Fatalf("compare err: %v vs expected: %v\n", err, nil)
+	}
+	if err := p.Compare(hashed, []byte("wrong")); err != passwd.ErrMismatch {
+		t.Fatalf("compare err: %v vs expected: %v\n", err, passwd.ErrMismatch)
+	}
+
+	// the burst is exhausted.
+	if _, err := m.Blind([]byte("digest")); err != ErrRateLimited {
+		t.Fatalf("blind err: %v vs expected: %v\n", err, ErrRateLimited)
+	}
+}
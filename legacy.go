@@ -0,0 +1,127 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+//
+// identity salted legacy digests.
+//
+// inherited systems often stored sha256(username + password) like
+// digests, the "salt" being an identity field of the account instead of a
+// stored value. LegacyDigest verifies them so they can be upgraded at
+// login (see Suite, with the Verifier() of the account identity).
+//
+
+// LegacyDigest template placeholders.
+const (
+	PlaceholderIdentity = "{identity}"
+	PlaceholderPassword = "{password}"
+)
+
+// LegacyDigest encodings.
+const (
+	DigestHex    = iota // lower or upper case hexadecimal
+	DigestBase64        // standard base64, padded or not
+)
+
+// LegacyDigest describes an identity salted digest scheme.
+type LegacyDigest struct {
+	// Hash is the digest function, its implementation must be linked in
+	// (i.e. import _ "crypto/md5").
+	Hash crypto.Hash
+	// Template is the digested input, "{identity}{password}" if empty
+	// (i.e. "{password}{identity}", "{identity}:{password}").
+	Template string
+	// LowerIdentity lowercases the identity (case insensitive usernames).
+	LowerIdentity bool
+	// Encoding is DigestHex or DigestBase64.
+	Encoding int
+}
+
+func (l *LegacyDigest) digest(identity, password []byte) ([]byte, error) {
+	if !l.Hash.Available() {
+		return nil, ErrUnsupported
+	}
+
+	template := l.Template
+	if template == "" {
+		template = PlaceholderIdentity + PlaceholderPassword
+	}
+	if l.LowerIdentity {
+		identity = bytes.ToLower(identity)
+	}
+
+	// the placeholders are substituted in a single pass, an identity
+	// containing "{password}" is not expanded.
+	h := l.Hash.New()
+	for len(template) > 0 {
+		i := strings.IndexByte(template, '{')
+		switch {
+		case i < 0:
+			h.Write([]byte(template))
+			template = ""
+		case strings.HasPrefix(template[i:], PlaceholderIdentity):
+			h.Write([]byte(template[:i]))
+			h.Write(identity)
+			template = template[i+len(PlaceholderIdentity):]
+		case strings.HasPrefix(template[i:], PlaceholderPassword):
+			h.Write([]byte(template[:i]))
+			h.Write(password)
+			template = template[i+len(PlaceholderPassword):]
+		default:
+			h.Write([]byte(template[:i+1]))
+			template = template[i+1:]
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+// decode returns the stored digest.
+func (l *LegacyDigest) decode(hashed []byte) ([]byte, error) {
+	s := string(bytes.TrimSpace(hashed))
+
+	switch l.Encoding {
+	case DigestHex:
+		return hex.DecodeString(s)
+	case DigestBase64:
+		return base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+	}
+	return nil, ErrUnsupported
+}
+
+// CompareIdentity compares the digest hashed of the account identity
+// against password, in constant time.
+func (l *LegacyDigest) CompareIdentity(identity, hashed, password []byte) error {
+	stored, err := l.decode(hashed)
+	if err != nil {
+		if err == ErrUnsupported {
+			return err
+		}
+		return ErrMismatch
+	}
+
+	digest, err := l.digest(identity, password)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(stored, digest) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
+
+// Verifier returns the Verifier of the account identity.
+func (l *LegacyDigest) Verifier(identity []byte) Verifier {
+	return VerifierFunc(func(hashed, password []byte) error {
+		return l.CompareIdentity(identity, hashed, password)
+	})
+}
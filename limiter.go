@@ -0,0 +1,269 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//
+// hashing work scheduling.
+//
+// a Limiter bounds the number of concurrent KDF computations of the
+// profiles it is attached to, waiting work is started by priority:
+// interactive logins first, background jobs (batch rehash, migrations)
+// only use the capacity left over and never the reserved slots.
+// the waiting work can be capped, work over the cap is refused with ErrBusy
+// instead of queueing until the memory of the host is exhausted.
+//
+
+// Priority is the scheduling priority of the hashing work of a profile.
+type Priority int
+
+const (
+	// PriorityInteractive is the default, for user facing operations.
+	PriorityInteractive Priority = iota
+	// PriorityBackground is for batch jobs running on leftover capacity.
+	PriorityBackground
+)
+
+// Limiter bounds the concurrent hashing work shared by profiles.
+type Limiter struct {
+	mu         sync.Mutex
+	slots      int // concurrent computations
+	reserved   int // slots background work cannot use
+	running    int
+	background int // running background computations
+	waiting    [2][]chan struct{}
+	maxWaiting int // waiting computations cap, < 0 is unbounded
+
+	started  uint64
+	rejected uint64
+}
+
+// LimiterStats is a snapshot of a Limiter activity.
+type LimiterStats struct {
+	Running  int    // computations running
+	Waiting  int    // computations waiting for a slot
+	Started  uint64 // computations started
+	Rejected uint64 // computations refused with ErrBusy
+}
+
+// NewLimiter returns a Limiter running at most slots computations at a
+// time, reserved of them are kept for interactive work.
+func NewLimiter(slots, reserved int) (*Limiter, error) {
+	if slots <= 0 || reserved < 0 || reserved >= slots {
+		return nil, ErrUnsupported
+	}
+	return &Limiter{slots: slots, reserved: reserved, maxWaiting: -1}, nil
+}
+
+// SetMaxWaiting caps the computations waiting for a slot to n, the work
+// over the cap is refused with ErrBusy, n < 0 removes the cap (default).
+func (l *Limiter) SetMaxWaiting(n int) error {
+	if n < 0 {
+		n = -1
+	}
+	l.mu.Lock()
+	l.maxWaiting = n
+	l.mu.Unlock()
+	return nil
+}
+
+// Stats returns the current activity of the limiter, for metrics export.
+func (l *Limiter) Stats() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return LimiterStats{
+		Running:  l.running,
+		Waiting:  len(l.waiting[PriorityInteractive]) + len(l.waiting[PriorityBackground]),
+		Started:  l.started,
+		Rejected: l.rejected,
+	}
+}
+
+func (l *Limiter) acquire(prio Priority) {
+	_ = l.wait(nil, prio)
+}
+
+// wait waits for a slot, it returns ErrBusy if the waiting work is over
+// the cap and gives up with ctx.Err() if ctx (if not nil) is done first.
+func (l *Limiter) wait(ctx context.Context, prio Priority) error {
+	ch := make(chan struct{})
+
+	l.mu.Lock()
+	l.waiting[prio] = append(l.waiting[prio], ch)
+	l.dispatch()
+	if q := l.waiting[prio]; l.maxWaiting >= 0 && len(q) > 0 && q[len(q)-1] == ch &&
+		len(l.waiting[PriorityInteractive])+len(l.waiting[PriorityBackground]) > l.maxWaiting {
+		l.waiting[prio] = q[:len(q)-1]
+		l.rejected++
+		l.mu.Unlock()
+		return ErrBusy
+	}
+	l.mu.Unlock()
+
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-done:
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	q := l.waiting[prio]
+	for i, w := range q {
+		if w == ch {
+			l.waiting[prio] = append(q[:i:i], q[i+1:]...)
+			return ctx.Err()
+		}
+	}
+
+	// started meanwhile, the slot goes to the next work.
+	l.running--
+	if prio == PriorityBackground {
+		l.background--
+	}
+	l.dispatch()
+	return ctx.Err()
+}
+
+func (l *Limiter) release(prio Priority) {
+	l.mu.Lock()
+	l.running--
+	if prio == PriorityBackground {
+		l.background--
+	}
+	l.dispatch()
+	l.mu.Unlock()
+}
+
+// dispatch starts waiting work while there is capacity, l.mu is held.
+func (l *Limiter) dispatch() {
+	for l.running < l.slots {
+		switch {
+		case len(l.waiting[PriorityInteractive]) > 0:
+			l.start(PriorityInteractive)
+		case len(l.waiting[PriorityBackground]) > 0 && l.background < l.slots-l.reserved:
+			l.background++
+			l.start(PriorityBackground)
+		default:
+			return
+		}
+	}
+}
+
+func (l *Limiter) start(prio Priority) {
+	ch := l.waiting[prio][0]
+	l.waiting[prio][0] = nil
+	l.waiting[prio] = l.waiting[prio][1:]
+	l.running++
+	l.started++
+	close(ch)
+}
+
+// SetLimiter attaches the profile hashing work to l, nil detaches it.
+func (p *Profile) SetLimiter(l *Limiter) error {
+	p.limiter = l
+	return nil
+}
+
+// SetMaxConcurrency attaches the profile hashing work to a new Limiter of
+// n slots (see NewLimiter()), at most waiting computations wait for a slot
+// (unbounded if < 0), the others are refused with ErrBusy.
+// the profile copies (i.e. WithPriority()) share the limiter, 0 detaches
+// it.
+func (p *Profile) SetMaxConcurrency(n, waiting int) error {
+	if n == 0 {
+		p.limiter = nil
+		return nil
+	}
+	l, err := NewLimiter(n, 0)
+	if err != nil {
+		return err
+	}
+	_ = l.SetMaxWaiting(waiting)
+	p.limiter = l
+	return nil
+}
+
+// Limiter returns the Limiter the profile hashing work is attached to (for
+// its Stats()), nil if none.
+func (p *Profile) Limiter() *Limiter {
+	return p.limiter
+}
+
+// WithPriority returns a copy of the profile scheduling its hashing work
+// with prio on the attached Limiter (if any).
+func (p *Profile) WithPriority(prio Priority) *Profile {
+	c := p.clone()
+	c.priority = prio
+	return c
+}
+
+// acquire checks the self-test state and the profile rate limiter then
+// starts the op computation (see start()).
+func (p *Profile) acquire(op string) (func(), error) {
+	err := selfTestGate()
+	if err != nil {
+		return nil, err
+	}
+	err = p.admit()
+	if err != nil {
+		return nil, err
+	}
+	return p.start(op)
+}
+
+// start waits for the profile limiter and reserves the memory budget (if
+// any) before the op computation, the returned function releases them.
+func (p *Profile) start(op string) (func(), error) {
+	begin := time.Now()
+	release := func() {}
+
+	if l := p.limiter; l != nil {
+		prio := p.priority
+		if prio != PriorityBackground {
+			prio = PriorityInteractive
+		}
+		err := l.wait(p.ctx, prio)
+		if err != nil {
+			return nil, err
+		}
+		release = func() { l.release(prio) }
+	}
+
+	free, err := p.Reserve()
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	if p.stats == nil {
+		return func() {
+			free()
+			release()
+		}, nil
+	}
+
+	done := p.measure(op, time.Since(begin))
+	return func() {
+		done()
+		free()
+		release()
+	}, nil
+}
+
+// busy returns true if err reports overload.
+func busy(err error) bool {
+	_, ok := err.(*BusyError)
+	return ok || err == ErrBusy
+}
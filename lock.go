@@ -0,0 +1,64 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+)
+
+//
+// lock markers.
+//
+// shadow(5) style markers disable an account in the hash field itself:
+//
+// *                  no valid password (cannot be unlocked)
+// !<hash>            locked
+// !locked!<hash>     locked by Lock()
+//
+// Compare() returns ErrLocked without doing any KDF work.
+//
+
+const (
+	lockPrefix   = "!locked!"
+	lockShadow   = '!'
+	lockDisabled = '*'
+)
+
+// Locked returns true if hashed carries a lock marker.
+func Locked(hashed []byte) bool {
+	return len(hashed) > 0 && (hashed[0] == lockShadow || hashed[0] == lockDisabled)
+}
+
+// Lock returns hashed wrapped in a lock marker, Unlock() restores it.
+func Lock(hashed []byte) []byte {
+	if Locked(hashed) {
+		return hashed
+	}
+
+	out := make([]byte, 0, len(lockPrefix)+len(hashed))
+	out = append(out, lockPrefix...)
+	out = append(out, hashed...)
+	return out
+}
+
+// Unlock removes the lock marker of hashed, hashes that are not locked are
+// returned as is, ErrUnsupported is returned for markers without a hash.
+func Unlock(hashed []byte) ([]byte, error) {
+	if !Locked(hashed) {
+		return hashed, nil
+	}
+
+	var unlocked []byte
+	switch {
+	case bytes.HasPrefix(hashed, []byte(lockPrefix)):
+		unlocked = hashed[len(lockPrefix):]
+	case hashed[0] == lockShadow:
+		unlocked = hashed[1:]
+	}
+
+	if len(unlocked) == 0 || Locked(unlocked) {
+		return nil, ErrUnsupported
+	}
+	return unlocked, nil
+}
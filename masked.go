@@ -0,0 +1,159 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"sync"
+)
+
+//
+// masked parameters versions.
+//
+// masked hashes do not store their parameters, the verifier must know
+// them, a MaskedRegistry maps opaque version tags to parameter sets and the
+// produced hashes record their tag, not their costs:
+//
+// $ID$mv=TAG$b64(SALT)$b64(HASH)
+//
+// Compare() verifies with the parameters of the stored tag, the masked
+// hashes produced before the registry (without tag) use the "" tag
+// parameters, if any.
+// tuning: register the new parameters under a new tag and make it the
+// profile one, CompareEx() reports NeedsRehash for the hashes of the other
+// tags, the tags must stay registered as long as hashes use them.
+//
+
+const metaMaskedTag = "mv" // masked parameters version tag
+
+// MaskedRegistry maps version tags to masked parameter sets, it can be
+// shared between profiles and goroutines.
+type MaskedRegistry struct {
+	mu     sync.RWMutex
+	params map[string]interface{}
+}
+
+// NewMaskedRegistry returns an empty registry.
+func NewMaskedRegistry() *MaskedRegistry {
+	return &MaskedRegistry{
+		params: make(map[string]interface{}),
+	}
+}
+
+// Register maps tag to params (*Argon2Params, *ScryptParams or
+// *Pbkdf2Params), the parameters are copied and masked.
+// tags are identifiers like the keyring ones (see SetSecrets()), the ""
+// tag is for the masked hashes produced before the registry, a tag cannot
+// be registered twice.
+func (r *MaskedRegistry) Register(tag string, params interface{}) error {
+	if tag != "" && !validSecretID(tag) {
+		return ErrUnsupported
+	}
+
+	var mp interface{}
+	switch v := params.(type) {
+	case *ScryptParams:
+		c := ScryptParams{N: v.N, R: v.R, P: v.P, Saltlen: v.Saltlen, Keylen: v.Keylen, Masked: true}
+		if err := c.validate(&scryptMinParameters); err != nil {
+			return err
+		}
+		mp = &c
+	case *Argon2Params:
+		c := Argon2Params{Version: v.Version, Time: v.Time, Memory: v.Memory, Thread: v.Thread, Saltlen: v.Saltlen, Keylen: v.Keylen, Masked: true}
+		if err := c.validate(&argonMinParameters); err != nil {
+			return err
+		}
+		mp = &c
+	case *Pbkdf2Params:
+		c := Pbkdf2Params{PRF: v.PRF, Iterations: v.Iterations, Saltlen: v.Saltlen, Keylen: v.Keylen, Masked: true}
+		if err := c.validate(&pbkdf2MinParameters); err != nil {
+			return err
+		}
+		mp = &c
+	default:
+		return ErrUnsupported
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.params[tag]; ok {
+		return ErrUnsupported
+	}
+	r.params[tag] = mp
+	return nil
+}
+
+// lookup returns a copy of the tag parameters.
+func (r *MaskedRegistry) lookup(tag string) (interface{}, bool) {
+	r.mu.RLock()
+	params, ok := r.params[tag]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	switch v := params.(type) {
+	case *ScryptParams:
+		c := *v
+		return &c, true
+	case *Argon2Params:
+		c := *v
+		return &c, true
+	case *Pbkdf2Params:
+		c := *v
+		return &c, true
+	}
+	return nil, false
+}
+
+// SetMaskedRegistry makes the profile hash with the parameters of tag in
+// registry and verify the masked hashes with the parameters of their tag.
+// the tag parameters must use the profile algorithm, the profile secret
+// and digest transforms apply.
+func (p *Profile) SetMaskedRegistry(registry *MaskedRegistry, tag string) error {
+	if registry == nil || tag == "" {
+		return ErrUnsupported
+	}
+
+	params, ok := registry.lookup(tag)
+	if !ok || paramsAlgorithm(params) != paramsAlgorithm(p.params) {
+		return ErrUnsupported
+	}
+
+	p.params = p.carryParams(params)
+	p.maskedRegistry = registry
+	p.maskedTag = tag
+	return nil
+}
+
+// forMaskedTag returns the profile verifying hashed, using the parameters
+// of its tag.
+func (p *Profile) forMaskedTag(hashed []byte) (*Profile, error) {
+	tag := MaskedTag(hashed)
+	if p.maskedRegistry == nil || tag == p.maskedTag {
+		return p, nil
+	}
+
+	params, ok := p.maskedRegistry.lookup(tag)
+	if !ok || paramsAlgorithm(params) != paramsAlgorithm(p.params) {
+		return nil, ErrMismatch
+	}
+
+	c := p.clone()
+	c.params = p.carryParams(params)
+	c.maskedTag = tag
+	return c, nil
+}
+
+// MaskedTag returns the version tag hashed records, empty if none.
+func MaskedTag(hashed []byte) string {
+	if hasIntegrityTag(hashed) {
+		hashed = hashed[:bytes.LastIndexByte(hashed, byte(separatorRune))]
+	}
+	_, md, err := splitMetadata(hashed)
+	if err != nil {
+		return ""
+	}
+	return md[metaMaskedTag]
+}
@@ -0,0 +1,126 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+//
+// storage sizing.
+//
+// the encoded hashes length only depends on the profile parameters and
+// options, MaxEncodedLen() gives it up front to size database columns and
+// protobuf fields.
+//
+
+// MaxEncodedLen returns the maximum length of the hashes produced by the
+// profile: its parameters (risk tier and fallback included), metadata,
+// integrity tag and encryption. post-hash transforms are assumed to keep
+// the digest length.
+func (p *Profile) MaxEncodedLen() (int, error) {
+	h, err := p.atTier(p.riskTier)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := h.maxEncodedLen(false)
+	if err != nil {
+		return 0, err
+	}
+	if p.fallback != nil {
+		dn, err := h.degraded().maxEncodedLen(true)
+		if err != nil {
+			return 0, err
+		}
+		if dn > n {
+			n = dn
+		}
+	}
+
+	if p.aead != nil {
+		// $2e$b64(NONCE|CIPHERTEXT)
+		sealed := p.aead.NonceSize() + n + p.aead.Overhead()
+		n = len(idEncrypted) + 2 + len(base64Encode(make([]byte, sealed)))
+	}
+	return n, nil
+}
+
+func (p *Profile) maxEncodedLen(degraded bool) (int, error) {
+	core, err := encodedCore(p.params)
+	if err != nil {
+		return 0, err
+	}
+	if p.encoding == FormatPHC {
+		// no metadata nor integrity tag.
+		phc, err := Reencode(core, FormatPHC)
+		if err != nil {
+			return 0, err
+		}
+		return len(phc), nil
+	}
+
+	md := p.metadata()
+	if degraded {
+		md[metaDegraded] = "1"
+	}
+	// unix times, the widest value.
+	for _, k := range []string{metaTimestamp, metaExpiry} {
+		if _, ok := md[k]; ok {
+			md[k] = strconv.FormatInt(math.MaxInt64, 10)
+		}
+	}
+	if len(p.record) > 0 {
+		md[metaRecord] = string(base64Encode(make([]byte, recordBindingLen)))
+	}
+
+	hashed := insertMetadata(core, md)
+	if p.integrity {
+		hashed = appendIntegrityTag(nil, hashed)
+	}
+	return len(hashed), nil
+}
+
+// encodedCore returns a placeholder core hash of params, with the
+// produced hashes length.
+func encodedCore(params interface{}) ([]byte, error) {
+	var id, fields string
+	var saltlen, keylen uint32
+
+	switch v := params.(type) {
+	case *BcryptParams:
+		// $2a$CC$ + 22 chars salt + 31 chars hash
+		return []byte(fmt.Sprintf("%c2a%c%02d%c%s", separatorRune, separatorRune, v.Cost, separatorRune, strings.Repeat(".", bcryptHashLen-7))), nil
+	case *ScryptParams:
+		id, saltlen, keylen = idScrypt, v.Saltlen, v.Keylen
+		if !v.Masked {
+			fields = fmt.Sprintf("%c%d%c%d%c%d%c%d", separatorRune, v.N, separatorRune, v.R, separatorRune, v.P, separatorRune, v.Keylen)
+		}
+	case *Argon2Params:
+		saltlen, keylen = v.Saltlen, v.Keylen
+		id, _ = v.variant()
+		if !v.Masked {
+			fields = fmt.Sprintf("%c%d%c%d%c%d%c%d", separatorRune, v.Time, separatorRune, v.Memory, separatorRune, v.Thread, separatorRune, v.Keylen)
+		}
+	case *Pbkdf2Params:
+		id, saltlen, keylen = idPbkdf2SHA256, v.Saltlen, v.Keylen
+		if v.PRF == Pbkdf2SHA512 {
+			id = idPbkdf2SHA512
+		}
+		if !v.Masked {
+			fields = fmt.Sprintf("%c%d%c%d", separatorRune, v.Iterations, separatorRune, v.Keylen)
+		}
+	default:
+		return nil, ErrUnsupported
+	}
+
+	return []byte(fmt.Sprintf("%c%s%c%s%s%c%s",
+		separatorRune, id,
+		separatorRune, base64Encode(make([]byte, saltlen)),
+		fields,
+		separatorRune, base64Encode(make([]byte, keylen)))), nil
+}
@@ -0,0 +1,103 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"sync"
+
+	"github.com/ermites-io/passwd/internal/argon2"
+)
+
+//
+// memory budget.
+//
+// a MemoryBudget bounds the memory the KDF computations of the profiles
+// it is attached to use at a time (estimated from the parameters), work
+// that does not fit is refused with ErrBusy before it starts instead of
+// being OOM-killed halfway through on constrained hosts.
+//
+
+// MemoryBudget is a memory reservation pool shared by profiles.
+type MemoryBudget struct {
+	mu       sync.Mutex
+	size     uint64
+	reserved uint64
+}
+
+// NewMemoryBudget returns a budget of size bytes.
+func NewMemoryBudget(size uint64) *MemoryBudget {
+	return &MemoryBudget{size: size}
+}
+
+// Available returns the number of bytes not reserved.
+func (b *MemoryBudget) Available() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size - b.reserved
+}
+
+func (b *MemoryBudget) reserve(n uint64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n > b.size-b.reserved {
+		return false
+	}
+	b.reserved += n
+	return true
+}
+
+func (b *MemoryBudget) release(n uint64) {
+	b.mu.Lock()
+	b.reserved -= n
+	b.mu.Unlock()
+}
+
+// SetMemoryBudget attaches the profile hashing work to b, nil detaches it.
+func (p *Profile) SetMemoryBudget(b *MemoryBudget) error {
+	p.memory = b
+	return nil
+}
+
+// CanHash returns ErrBusy if the memory a computation needs is not
+// available in the profile budget (if any) right now.
+func (p *Profile) CanHash() error {
+	if p.memory != nil && paramsMemory(p.params) > p.memory.Available() {
+		return ErrBusy
+	}
+	return nil
+}
+
+// Reserve reserves the memory of a computation from the profile budget
+// (if any) or returns ErrBusy, the returned function releases it.
+// Hash(), Compare() and Derive() reserve on their own, Reserve() is for
+// callers batching work ahead.
+func (p *Profile) Reserve() (release func(), err error) {
+	b, n := p.memory, paramsMemory(p.params)
+	if b == nil {
+		return func() {}, nil
+	}
+	if !b.reserve(n) {
+		return nil, ErrBusy
+	}
+
+	var once sync.Once
+	return func() { once.Do(func() { b.release(n) }) }, nil
+}
+
+// SetBufferPool makes the argon2 profile reuse the memory of its finished
+// derivations, keeping at most n idle buffers (i.e. the SetMaxConcurrency()
+// limit), instead of allocating it for every call, 0 removes the pool.
+// the idle buffers are zeroed and stay allocated, outside of the memory
+// budget, the KDF backends are not used with a pool.
+func (p *Profile) SetBufferPool(n int) error {
+	v, ok := p.params.(*Argon2Params)
+	if !ok || n < 0 {
+		return ErrUnsupported
+	}
+	v.pool = nil
+	if n > 0 {
+		v.pool = argon2.NewPool(n)
+	}
+	return nil
+}
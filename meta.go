@@ -0,0 +1,223 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//
+// metadata are optional "key=value" pairs describing how a hash was
+// produced (flags, markers, etc..), they are stored in a dedicated field
+// right after the hash identifier:
+//
+// $ID$k0=v0,k1=v1$b64(SALT)$...$b64(HASH)
+//
+// the '=' and ',' characters are not part of the base64 alphabet used for
+// the other fields, which makes the metadata field unambiguous.
+//
+
+const (
+	metaAssign    = '='
+	metaSeparator = ','
+)
+
+type metadata map[string]string
+
+// encode returns the metadata field content with sorted keys so the
+// output is stable.
+func (md metadata) encode() string {
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+string(metaAssign)+md[k])
+	}
+	return strings.Join(pairs, string(metaSeparator))
+}
+
+func parseMetadata(field string) (metadata, error) {
+	md := make(metadata)
+	for _, pair := range strings.Split(field, string(metaSeparator)) {
+		kv := strings.SplitN(pair, string(metaAssign), 2)
+		if len(kv) != 2 || len(kv[0]) == 0 {
+			return nil, ErrParse
+		}
+		if _, ok := md[kv[0]]; ok {
+			return nil, ErrParse
+		}
+		md[kv[0]] = kv[1]
+	}
+	return md, nil
+}
+
+// metadataField returns the start and end offsets of the field following
+// the hash identifier.
+func metadataField(hashed []byte) (start, end int, ok bool) {
+	if len(hashed) == 0 || hashed[0] != byte(separatorRune) {
+		return 0, 0, false
+	}
+
+	idEnd := bytes.IndexByte(hashed[1:], byte(separatorRune))
+	if idEnd < 0 {
+		return 0, 0, false
+	}
+	start = idEnd + 2 // skip both separators
+
+	end = bytes.IndexByte(hashed[start:], byte(separatorRune))
+	if end < 0 {
+		end = len(hashed)
+	} else {
+		end += start
+	}
+
+	return start, end, true
+}
+
+// splitMetadata separates the metadata field (if any) from the hash, the
+// returned hash is the "core" hash the algorithms know how to handle.
+func splitMetadata(hashed []byte) ([]byte, metadata, error) {
+	start, end, ok := metadataField(hashed)
+	if !ok {
+		return hashed, nil, nil
+	}
+
+	field := hashed[start:end]
+	if bytes.IndexByte(field, metaAssign) < 0 {
+		return hashed, nil, nil
+	}
+
+	md, err := parseMetadata(string(field))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// remove the field and its leading separator
+	core := make([]byte, 0, len(hashed)-(end-start)-1)
+	core = append(core, hashed[:start-1]...)
+	core = append(core, hashed[end:]...)
+
+	return core, md, nil
+}
+
+// insertMetadata adds the metadata field to a core hash.
+func insertMetadata(hashed []byte, md metadata) []byte {
+	if len(md) == 0 {
+		return hashed
+	}
+
+	start, _, ok := metadataField(hashed)
+	if !ok {
+		return hashed
+	}
+
+	field := md.encode()
+
+	out := make([]byte, 0, len(hashed)+len(field)+1)
+	out = append(out, hashed[:start]...)
+	out = append(out, field...)
+	out = append(out, byte(separatorRune))
+	out = append(out, hashed[start:]...)
+	return out
+}
+
+// metadata keys, flags are markers changing the way the hash is computed,
+// they must match between the stored hash and the profile to compare.
+const (
+	metaBlind     = "bl" // digest blinded by an external service
+	metaPreHash   = "ph" // password pre-hash transform applied
+	metaPostHash  = "po" // digest post-hash transform applied
+	metaAD        = "ad" // bound to associated data
+	metaPepper    = "pp" // pepper strategy (default is not recorded)
+	metaRecord    = "rb" // key'ed binding to a record identifier
+	metaTimestamp = "ts" // creation time (unix seconds)
+	metaExpiry    = "ex" // expiry time (unix seconds)
+	metaDomain    = "dm" // application domain digest
+)
+
+var metaFlags = []string{
+	metaBlind,
+	metaPreHash,
+	metaPostHash,
+	metaAD,
+	metaPepper,
+	metaDomain,
+	metaNamespace,
+	metaBcryptPreHash,
+	metaBcryptKeyed,
+	metaUserKey,
+}
+
+// metadata returns the metadata the profile embeds in produced hashes.
+func (p *Profile) metadata() metadata {
+	md := make(metadata)
+	if p.blinder != nil {
+		md[metaBlind] = "1"
+	}
+	if p.prehash != nil {
+		md[metaPreHash] = "1"
+	}
+	if p.posthash != nil {
+		md[metaPostHash] = "1"
+	}
+	if len(p.ad) > 0 || len(p.deployment) > 0 {
+		md[metaAD] = "1"
+	}
+	if len(p.userKey) > 0 {
+		md[metaUserKey] = "1"
+	}
+	if p.bcryptPreHash() {
+		md[metaBcryptPreHash] = "1"
+	}
+	if p.bcryptKeyed() {
+		md[metaBcryptKeyed] = "1"
+	}
+	if p.domain != "" {
+		md[metaDomain] = domainTag(p.domain)
+	}
+	if p.namespace != "" {
+		md[metaNamespace] = namespaceTag(p.namespace)
+	}
+	if tag := p.pepperTag(); tag != "" {
+		md[metaPepper] = tag
+	}
+	if p.riskTier > 0 {
+		md[metaRisk] = strconv.Itoa(p.riskTier)
+	}
+	if p.masterGen != "" {
+		md[metaMaster] = p.masterGen
+	}
+	if p.secretID != "" {
+		md[metaSecretID] = p.secretID
+	}
+	if p.maskedTag != "" {
+		md[metaMaskedTag] = p.maskedTag
+	}
+	if p.timestamp {
+		md[metaTimestamp] = strconv.FormatInt(now().Unix(), 10)
+	}
+	if p.expiry > 0 {
+		md[metaExpiry] = strconv.FormatInt(now().Add(p.expiry).Unix(), 10)
+	}
+	return md
+}
+
+// matchMetadata verifies the flags of a stored hash are consistent with
+// the profile, avoiding costly derivations that cannot match.
+func (p *Profile) matchMetadata(md metadata) bool {
+	expected := p.metadata()
+	for _, k := range metaFlags {
+		if md[k] != expected[k] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+//
+// namespace binding.
+//
+// the hashes are bound to a deployment namespace (i.e. "prod", "staging")
+// through the associated data mechanism, a credential or a row copied from
+// a staging database does not verify in production:
+//
+// data = b64(hmac_sha3-256(label || 0x00 || password, "passwd/namespace/v1" || 0x00 || namespace))
+//
+// the produced hashes record a short digest of the namespace, comparing
+// a hash of another namespace (or of none) fails without derivation:
+//
+// $ID$ns=b64(sha3-256(label || 0x00 || namespace)[:8])$b64(SALT)$...
+//
+
+const (
+	labelNamespace = "passwd/namespace/v1"
+
+	metaNamespace = "ns" // deployment namespace digest
+
+	namespaceTagLen = 8
+)
+
+func namespaceAD(namespace string) []byte {
+	ad := make([]byte, 0, len(labelNamespace)+1+len(namespace))
+	ad = append(ad, labelNamespace...)
+	ad = append(ad, 0x00)
+	ad = append(ad, namespace...)
+	return ad
+}
+
+func namespaceTag(namespace string) string {
+	h := newSHA3256()
+	h.Write([]byte(labelNamespace))
+	h.Write([]byte{0x00})
+	h.Write([]byte(namespace))
+	return string(base64Encode(h.Sum(nil)[:namespaceTagLen]))
+}
+
+// SetNamespace binds produced hashes to the deployment namespace (i.e.
+// "prod"), Compare() requires the same namespace, an empty namespace
+// removes the binding.
+// it combines with SetAssociatedData() and SetDeployment().
+func (p *Profile) SetNamespace(namespace string) error {
+	p.namespace = namespace
+	return nil
+}
+
+// WithNamespace returns a copy of the profile bound to namespace (i.e. to
+// verify the hashes of another environment during a migration), leaving p
+// untouched.
+func (p *Profile) WithNamespace(namespace string) *Profile {
+	c := p.clone()
+	c.namespace = namespace
+	return c
+}
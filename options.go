@@ -0,0 +1,312 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"fmt"
+
+	"github.com/ermites-io/passwd/internal/bcrypt"
+)
+
+//
+// functional options.
+//
+// NewArgon2(), NewScrypt(), NewBcrypt() and NewPbkdf2() start from the
+// Default profile parameters of the algorithm (without secret) and apply
+// the options:
+//
+// p, err := passwd.NewArgon2(passwd.WithMemory(128<<10), passwd.WithTime(3),
+//         passwd.WithParallelism(4), passwd.WithSaltLen(24), passwd.WithKeyLen(32))
+//
+// the resulting parameters are checked against the package minimums (the
+// ones the defaults are built on), an *OptionError describes what is
+// refused instead of silently hashing with unsafe parameters.
+//
+
+// Option is a parameter of the options constructors.
+type Option func(params interface{}) error
+
+// OptionError is returned by the options constructors, with the errors
+// package errors.Is() matches its Kind: ErrUnsupported for an option the
+// algorithm does not have or an invalid value, ErrUnsafe for a value under
+// the package minimums.
+type OptionError struct {
+	Kind   error  // ErrUnsupported or ErrUnsafe
+	Option string // option name (i.e. "memory")
+	Reason string // what is wrong with the value
+}
+
+func (e *OptionError) Error() string {
+	return e.Kind.Error() + ": " + e.Option + " " + e.Reason
+}
+
+// Is reports whether target is the Kind of the error.
+func (e *OptionError) Is(target error) bool { return target == e.Kind }
+
+func optionUnsupported(option string, params interface{}) error {
+	return &OptionError{Kind: ErrUnsupported, Option: option, Reason: "is not a " + paramsName(params) + " parameter"}
+}
+
+func optionInvalid(option, format string, args ...interface{}) error {
+	return &OptionError{Kind: ErrUnsupported, Option: option, Reason: fmt.Sprintf(format, args...)}
+}
+
+func optionUnsafe(option string, value, min uint64, unit string) error {
+	return &OptionError{Kind: ErrUnsafe, Option: option, Reason: fmt.Sprintf("%d%s, minimum %d%s", value, unit, min, unit)}
+}
+
+// paramsName returns the algorithm name of params.
+func paramsName(params interface{}) string {
+	switch params.(type) {
+	case *Argon2Params:
+		return "argon2"
+	case *ScryptParams:
+		return "scrypt"
+	case *BcryptParams:
+		return "bcrypt"
+	case *Pbkdf2Params:
+		return "pbkdf2"
+	}
+	return "unknown"
+}
+
+// WithMemory sets the argon2 memory in KiB.
+func WithMemory(kib uint32) Option {
+	return func(params interface{}) error {
+		switch v := params.(type) {
+		case *Argon2Params:
+			v.Memory = kib
+			return nil
+		}
+		return optionUnsupported("memory", params)
+	}
+}
+
+// WithTime sets the argon2 number of passes.
+func WithTime(passes uint32) Option {
+	return func(params interface{}) error {
+		switch v := params.(type) {
+		case *Argon2Params:
+			v.Time = passes
+			return nil
+		}
+		return optionUnsupported("time", params)
+	}
+}
+
+// WithParallelism sets the argon2 lanes or the scrypt P parameter.
+func WithParallelism(n uint8) Option {
+	return func(params interface{}) error {
+		switch v := params.(type) {
+		case *Argon2Params:
+			v.Thread = n
+			return nil
+		case *ScryptParams:
+			v.P = uint32(n)
+			return nil
+		}
+		return optionUnsupported("parallelism", params)
+	}
+}
+
+// WithN sets the scrypt CPU/memory cost N, a power of 2.
+func WithN(n uint32) Option {
+	return func(params interface{}) error {
+		switch v := params.(type) {
+		case *ScryptParams:
+			v.N = n
+			return nil
+		}
+		return optionUnsupported("N", params)
+	}
+}
+
+// WithBlockSize sets the scrypt block size r.
+func WithBlockSize(r uint32) Option {
+	return func(params interface{}) error {
+		switch v := params.(type) {
+		case *ScryptParams:
+			v.R = r
+			return nil
+		}
+		return optionUnsupported("block size", params)
+	}
+}
+
+// WithCost sets the bcrypt cost.
+func WithCost(cost int) Option {
+	return func(params interface{}) error {
+		switch v := params.(type) {
+		case *BcryptParams:
+			v.Cost = cost
+			return nil
+		}
+		return optionUnsupported("cost", params)
+	}
+}
+
+// WithIterations sets the pbkdf2 iteration count.
+func WithIterations(n uint32) Option {
+	return func(params interface{}) error {
+		switch v := params.(type) {
+		case *Pbkdf2Params:
+			v.Iterations = n
+			return nil
+		}
+		return optionUnsupported("iterations", params)
+	}
+}
+
+// WithPRF sets the pbkdf2 PRF (Pbkdf2SHA256 or Pbkdf2SHA512).
+func WithPRF(prf int) Option {
+	return func(params interface{}) error {
+		switch v := params.(type) {
+		case *Pbkdf2Params:
+			v.PRF = prf
+			return nil
+		}
+		return optionUnsupported("prf", params)
+	}
+}
+
+// WithSaltLen sets the salt length in bytes.
+func WithSaltLen(n uint32) Option {
+	return func(params interface{}) error {
+		switch v := params.(type) {
+		case *Argon2Params:
+			v.Saltlen = n
+			return nil
+		case *ScryptParams:
+			v.Saltlen = n
+			return nil
+		case *Pbkdf2Params:
+			v.Saltlen = n
+			return nil
+		}
+		return optionUnsupported("salt length", params)
+	}
+}
+
+// WithKeyLen sets the derived key (hash) length in bytes.
+func WithKeyLen(n uint32) Option {
+	return func(params interface{}) error {
+		switch v := params.(type) {
+		case *Argon2Params:
+			v.Keylen = n
+			return nil
+		case *ScryptParams:
+			v.Keylen = n
+			return nil
+		case *Pbkdf2Params:
+			v.Keylen = n
+			return nil
+		}
+		return optionUnsupported("key length", params)
+	}
+}
+
+// NewArgon2 returns an argon2id custom Profile, see Option.
+func NewArgon2(opts ...Option) (*Profile, error) {
+	c := argonCommonParameters
+	params := Argon2Params{Version: c.Version, Time: c.Time, Memory: c.Memory, Thread: c.Thread, Saltlen: c.Saltlen, Keylen: c.Keylen}
+	return newWithOptions(&params, opts)
+}
+
+// NewScrypt returns a scrypt custom Profile, see Option.
+func NewScrypt(opts ...Option) (*Profile, error) {
+	c := scryptCommonParameters
+	params := ScryptParams{N: c.N, R: c.R, P: c.P, Saltlen: c.Saltlen, Keylen: c.Keylen}
+	return newWithOptions(&params, opts)
+}
+
+// NewBcrypt returns a bcrypt custom Profile, see Option.
+func NewBcrypt(opts ...Option) (*Profile, error) {
+	params := BcryptParams{Cost: bcryptCommonParameters.Cost}
+	return newWithOptions(&params, opts)
+}
+
+// NewPbkdf2 returns a pbkdf2 custom Profile, see Option.
+func NewPbkdf2(opts ...Option) (*Profile, error) {
+	c := pbkdf2CommonParameters
+	params := Pbkdf2Params{PRF: c.PRF, Iterations: c.Iterations, Saltlen: c.Saltlen, Keylen: c.Keylen}
+	return newWithOptions(&params, opts)
+}
+
+func newWithOptions(params interface{}, opts []Option) (*Profile, error) {
+	for _, opt := range opts {
+		err := opt(params)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := checkOptions(params)
+	if err != nil {
+		return nil, err
+	}
+	return NewCustom(params)
+}
+
+// checkOptions refuses the invalid parameters and the ones under the
+// package minimums.
+func checkOptions(params interface{}) error {
+	switch v := params.(type) {
+	case *Argon2Params:
+		min := argonMinParameters
+		switch {
+		case v.Thread == 0:
+			return optionInvalid("parallelism", "must be at least 1")
+		case v.Time < min.Time:
+			return optionUnsafe("time", uint64(v.Time), uint64(min.Time), "")
+		case v.Memory < min.Memory:
+			return optionUnsafe("memory", uint64(v.Memory), uint64(min.Memory), " KiB")
+		case v.Memory < 8*uint32(v.Thread):
+			return optionInvalid("memory", "%d KiB, %d lanes need at least %d KiB", v.Memory, v.Thread, 8*uint32(v.Thread))
+		}
+		return checkLengths(v.Saltlen, v.Keylen, min.Saltlen, min.Keylen)
+	case *ScryptParams:
+		min := scryptMinParameters
+		switch {
+		case v.N <= 1 || v.N&(v.N-1) != 0:
+			return optionInvalid("N", "%d, must be a power of 2", v.N)
+		case v.N < min.N:
+			return optionUnsafe("N", uint64(v.N), uint64(min.N), "")
+		case v.R < min.R:
+			return optionUnsafe("block size", uint64(v.R), uint64(min.R), "")
+		case v.P < min.P:
+			return optionUnsafe("parallelism", uint64(v.P), uint64(min.P), "")
+		case uint64(v.R)*uint64(v.P) >= 1<<30:
+			return optionInvalid("block size", "%d * parallelism %d, must be under 2^30", v.R, v.P)
+		}
+		return checkLengths(v.Saltlen, v.Keylen, min.Saltlen, min.Keylen)
+	case *BcryptParams:
+		switch {
+		case v.Cost < bcryptCommonParameters.Cost:
+			return optionUnsafe("cost", uint64(v.Cost), uint64(bcryptCommonParameters.Cost), "")
+		case v.Cost > bcrypt.MaxCost:
+			return optionInvalid("cost", "%d, maximum %d", v.Cost, bcrypt.MaxCost)
+		}
+		return nil
+	case *Pbkdf2Params:
+		min := pbkdf2MinParameters
+		if _, _, err := v.prf(); err != nil {
+			return optionInvalid("prf", "%d is unknown", v.PRF)
+		}
+		if v.Iterations < min.Iterations {
+			return optionUnsafe("iterations", uint64(v.Iterations), uint64(min.Iterations), "")
+		}
+		return checkLengths(v.Saltlen, v.Keylen, min.Saltlen, min.Keylen)
+	}
+	return ErrUnsupported
+}
+
+func checkLengths(saltlen, keylen, minSalt, minKey uint32) error {
+	if saltlen < minSalt {
+		return optionUnsafe("salt length", uint64(saltlen), uint64(minSalt), " bytes")
+	}
+	if keylen < minKey {
+		return optionUnsafe("key length", uint64(keylen), uint64(minKey), " bytes")
+	}
+	return nil
+}
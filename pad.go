@@ -0,0 +1,52 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"time"
+)
+
+// SetCompareDuration pads every Compare() and CompareFinalized() call to
+// at least d (sleeping after the verification), whatever the outcome, the
+// algorithm or the hash format, 0 disables the padding.
+// d should exceed the slowest verification, calls running longer are not
+// padded.
+func (p *Profile) SetCompareDuration(d time.Duration) error {
+	if d < 0 {
+		return ErrUnsupported
+	}
+	p.compareDuration = d
+	return nil
+}
+
+// pad sleeps until d elapsed since start.
+func pad(start time.Time, d time.Duration) {
+	if left := d - time.Since(start); left > 0 {
+		time.Sleep(left)
+	}
+}
+
+// DummyCompare computes a Compare() of password against a hash of the
+// profile, with the same cost, and returns ErrMismatch (or the limiter
+// errors Compare() would return), for the unknown users: the response
+// timing does not tell whether the account exists.
+func (p *Profile) DummyCompare(password []byte) error {
+	if p.compareDuration > 0 {
+		defer pad(time.Now(), p.compareDuration)
+	}
+
+	release, err := p.acquire("compare")
+	if err != nil {
+		return p.logEvent(JournalVerify, err)
+	}
+	// the cost of a compare is the one of the hash, the result is not
+	// compared to anything.
+	input := p.input(password)
+	_, _ = p.hash(input)
+	release()
+	wipeCopy(input, password)
+	p.wipePassword(password)
+
+	return p.logEvent(JournalVerify, ErrMismatch)
+}
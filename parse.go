@@ -1,3 +1,4 @@
+//go:build go1.12
 // +build go1.12
 
 package passwd
@@ -13,6 +14,20 @@ const (
 	separatorRune = rune('$')
 )
 
+// parsing bounds, hashes outside of them are refused before any parameter
+// reaches a KDF: a stored hash must not make a verification allocate much
+// more than the largest profiles (the paranoid ones, 512 MiB), the memory
+// ceilings are twice that.
+const (
+	maxHashLength = 1024 // bytes
+
+	maxParseKeylen           = 1024    // bytes
+	maxParseArgon2Memory     = 1 << 20 // KiB (1 GiB)
+	maxParseArgon2Work       = 1 << 32 // passes * KiB
+	maxParseScryptMemory     = 1 << 30 // bytes (128 * r * N, 1 GiB)
+	maxParsePbkdf2Iterations = 1 << 31
+)
+
 var (
 	rangeTableSeparator = rangetable.New(separatorRune)
 )
@@ -21,8 +36,39 @@ func token(c rune) bool {
 	return unicode.Is(rangeTableSeparator, c)
 }
 
+// splitFields returns the fields of a native hash, "$ID$F1$..$Fn", empty
+// fields are refused.
+func splitFields(hashed []byte) ([]string, error) {
+	if len(hashed) > maxHashLength {
+		return nil, ErrParse
+	}
+	if len(hashed) == 0 || hashed[0] != byte(separatorRune) {
+		return nil, ErrParse
+	}
+
+	fields := strings.Split(string(hashed[1:]), string(separatorRune))
+	for _, f := range fields {
+		if len(f) == 0 {
+			return nil, ErrParse
+		}
+	}
+	return fields, nil
+}
+
 func parseFromHashToParams(hashed []byte) (interface{}, error) {
-	fields := strings.FieldsFunc(string(hashed), token)
+	if len(hashed) > maxHashLength {
+		return nil, ErrParse
+	}
+	if ids := strings.FieldsFunc(string(hashed), token); len(ids) > 0 {
+		if r, ok := registeredID(ids[0]); ok {
+			return parseRegistered(r, hashed)
+		}
+	}
+
+	fields, err := splitFields(hashed)
+	if err != nil {
+		return nil, err
+	}
 	if len(fields) < 3 {
 		return nil, ErrParse
 	}
@@ -38,27 +84,36 @@ func parseFromHashToParams(hashed []byte) (interface{}, error) {
 	case idScrypt:
 		sp, err := newScryptParamsFromFields(fields[1:]) // mismatch.
 		if err != nil {
-			// XXX wrapp the error
 			return nil, err
 		}
 		return sp, nil
-	case idArgon2i:
-		fallthrough
-	case idArgon2id:
+	case idArgon2i, idArgon2id, idArgon2d:
 		ap, err := newArgon2ParamsFromFields(fields[1:]) // mismatch.
 		if err != nil {
-			// XXX wrapp the error
 			return nil, err
 		}
+		ap.Version, _ = argonVersion(fields[0])
 		return ap, nil
+	case idPbkdf2SHA256, idPbkdf2SHA512:
+		kp, err := newPbkdf2ParamsFromFields(fields[1:])
+		if err != nil {
+			return nil, err
+		}
+		if fields[0] == idPbkdf2SHA512 {
+			kp.PRF = Pbkdf2SHA512
+		}
+		return kp, nil
 	}
-	return nil, ErrParse
+	return nil, ErrUnsupportedAlgo
 }
 
 func parseFromHashToSalt(hashed []byte) ([]byte, error) {
 	//var nilstr string
 
-	fields := strings.FieldsFunc(string(hashed), token)
+	fields, err := splitFields(hashed)
+	if err != nil {
+		return nil, err
+	}
 	if len(fields) < 3 {
 		return nil, ErrParse
 	}
@@ -67,15 +122,16 @@ func parseFromHashToSalt(hashed []byte) ([]byte, error) {
 		return nil, nil
 	case idScrypt:
 		fallthrough
-	case idArgon2i:
+	case idArgon2i, idArgon2d:
+		fallthrough
+	case idPbkdf2SHA256, idPbkdf2SHA512:
 		fallthrough
 	case idArgon2id: // with different salt len it might have matched.
 		salt, err := base64Decode([]byte(fields[1])) // process the salt
 		if err != nil {
-			return nil, ErrParse
+			return nil, parseError(ErrParse, err)
 		}
 		return salt, nil
 	}
-	return nil, ErrParse
-
+	return nil, ErrUnsupportedAlgo
 }
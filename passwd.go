@@ -5,7 +5,9 @@
 package passwd
 
 import (
-	"fmt"
+	"context"
+	"crypto/cipher"
+	"time"
 )
 
 //
@@ -51,6 +53,7 @@ import (
 // bcrypt (LEGACY support)
 // scrypt
 // argon2id
+// argon2i / argon2d (key derivation)
 //
 // a mix of (draft) RFC interpretation + documentation + cryptographer docs +
 // + cryptographers (PHDs, not bloggers) friends suggestions of interpretation
@@ -96,6 +99,21 @@ const (
 	Bcrypt
 )
 
+// PBKDF2 hashing profiles, for deployments restricted to FIPS approved
+// primitives.
+const (
+	Pbkdf2Default HashProfile = BcryptCustom + 1 + iota
+	Pbkdf2Paranoid
+	Pbkdf2Custom // value for custom
+)
+
+// argon2i hashing profiles, for side-channel sensitive key derivation,
+// custom argon2i (or argon2d) parameters use Argon2Custom.
+const (
+	Argon2iDefault HashProfile = Pbkdf2Custom + 1 + iota
+	Argon2iParanoid
+)
+
 var (
 	// XXX not sure yet it's the right approach
 	// limiting the choice for password storage avoid shooting yourself in
@@ -107,11 +125,20 @@ var (
 		ScryptParanoid:   scryptParanoidParameters,
 		BcryptDefault:    bcryptCommonParameters,
 		BcryptParanoid:   bcryptParanoidParameters,
+		Pbkdf2Default:    pbkdf2CommonParameters,
+		Pbkdf2Paranoid:   pbkdf2ParanoidParameters,
+		Argon2iDefault:   argon2iCommonParameters,
+		Argon2iParanoid:  argon2iParanoidParameters,
 	}
 )
 
 // Profile define the hashing profile you have select and is created using
 // New() / NewMasked() / NewCustom()
+// once configured, a Profile is safe for concurrent use: Hash(), Compare()
+// and Derive() keep their per call state (salt, derived keys) on the stack
+// and never modify the Profile, a single Profile can be shared by the
+// goroutines of a server. the setters are not, they must be called before
+// the Profile is shared.
 type Profile struct {
 	t HashProfile // type
 	// XXX TODO: this can now become an interface with the following calls
@@ -121,14 +148,89 @@ type Profile struct {
 	// setSalt
 	// setSecret
 	params interface{} // parameters
+
+	blinder  Blinder             // external hardening service
+	prehash  func([]byte) []byte // password pre-hash transform
+	posthash func([]byte) []byte // digest post-hash transform
+	ad       []byte              // associated data
+	domain   string              // application domain label
+
+	deployment []byte // encoded deployment identity (associated data)
+	namespace  string // deployment namespace (associated data)
+
+	requireSecret bool // forbid unkey'ed hashes
+	integrity     bool // integrity tag on produced hashes
+	timestamp     bool // creation time in produced hashes
+
+	encoding Format      // produced hashes encoding
+	aead     cipher.AEAD // produced hashes encryption
+
+	record []byte // record identifier the hashes are bound to
+
+	expiry time.Duration // validity of the produced hashes
+	maxAge time.Duration // age of the stored hashes needing a rehash
+
+	minLength    int  // minimum password length (runes)
+	maxLength    int  // maximum password length (bytes)
+	rejectEmpty  bool // forbid empty passwords
+	rejectCommon bool // forbid the common passwords
+
+	policy PolicyChecker // password policy consulted by Hash()
+
+	readerLimit int64 // HashReader()/CompareReader() size cap, 0 is default
+
+	limiter  *Limiter // concurrent hashing work bound
+	priority Priority // scheduling priority on the limiter
+
+	rateLimiter *RateLimiter // hashing work budget
+	fallback    interface{}  // parameters used when over budget
+	memory      *MemoryBudget
+
+	stats func(Stats) // per operation statistics hook
+
+	reliefTier ServerTier // relief mode finalization
+	reliefCost int        // relief mode bcrypt tier cost
+
+	compareDuration time.Duration // Compare() constant duration padding
+
+	riskTiers map[int]interface{} // tier parameters
+	riskTier  int                 // tier of the produced hashes
+
+	journal Journal // compliance events
+
+	userKey []byte // per user key (crypto-shredding)
+
+	masters   [][]byte // per user pepper master secrets, current first
+	user      []byte   // user of the per user pepper
+	masterGen string   // master generation of the per user pepper
+
+	keyring  map[string][]byte // secrets by identifier
+	secretID string            // keyring identifier of the secret in use
+
+	maskedRegistry *MaskedRegistry // masked parameters by version tag
+	maskedTag      string          // version tag of the parameters in use
+
+	truncation TruncationPolicy // bcrypt long passwords policy
+
+	wipeInput bool // zero the callers' passwords once used
+
+	ctx context.Context // cancellation of the current call (see HashContext())
 }
 
 // New instantiate a new Profile
 func New(profile HashProfile) (*Profile, error) {
 	var p Profile
 
+	if r, ok := registeredProfile(profile); ok {
+		p = Profile{
+			t:      profile,
+			params: &hasherParams{id: r.id, h: r.factory()},
+		}
+		return &p, nil
+	}
+
 	switch profile {
-	case Argon2idDefault, Argon2idParanoid, ScryptDefault, ScryptParanoid, BcryptDefault, BcryptParanoid:
+	case Argon2idDefault, Argon2idParanoid, ScryptDefault, ScryptParanoid, BcryptDefault, BcryptParanoid, Pbkdf2Default, Pbkdf2Paranoid, Argon2iDefault, Argon2iParanoid:
 		// TODO: type switch on params then add secret to the profiles.
 		// all authorized
 
@@ -157,6 +259,12 @@ func New(profile HashProfile) (*Profile, error) {
 				params: &v, // then typecast to avoid *interface{}
 			}
 			return &p, nil
+		case Pbkdf2Params:
+			p = Profile{
+				t:      profile,
+				params: &v,
+			}
+			return &p, nil
 		}
 	}
 
@@ -171,7 +279,7 @@ func NewMasked(profile HashProfile) (*Profile, error) {
 	var err error
 
 	switch profile {
-	case Argon2idDefault, Argon2idParanoid, ScryptDefault, ScryptParanoid:
+	case Argon2idDefault, Argon2idParanoid, ScryptDefault, ScryptParanoid, Pbkdf2Default, Pbkdf2Paranoid, Argon2iDefault, Argon2iParanoid:
 		// all authorized
 		mparams := params[profile]
 
@@ -190,6 +298,12 @@ func NewMasked(profile HashProfile) (*Profile, error) {
 				//params: (*Argon2Params)(&v),
 				params: &v,
 			}
+		case Pbkdf2Params:
+			v.Masked = true
+			p = Profile{
+				t:      profile,
+				params: &v,
+			}
 		}
 	default:
 		err = ErrUnsupported
@@ -221,6 +335,12 @@ func NewCustom(params interface{}) (*Profile, error) {
 			params: v,
 		}
 		return &p, nil
+	case *Pbkdf2Params:
+		p = Profile{
+			t:      Pbkdf2Custom,
+			params: v,
+		}
+		return &p, nil
 	}
 
 	return nil, ErrUnsupported
@@ -228,30 +348,68 @@ func NewCustom(params interface{}) (*Profile, error) {
 
 // SetKey setup a secret associated with the profile currently in
 // use following produced hashes, will use the new key'ed hashing algorithm
+// the secret is not validated, see SetSecret().
+// it replaces the keyring set by SetSecrets(), if any.
 func (p *Profile) SetKey(secret []byte) error {
 	switch v := p.params.(type) {
+	case *BcryptParams:
+		v.secret = secret
 	case *ScryptParams:
 		v.secret = secret
-		return nil
 	case *Argon2Params:
 		v.secret = secret
-		return nil
+	case *Pbkdf2Params:
+		v.secret = secret
+	default:
+		return ErrUnsupported
+	}
+	p.keyring, p.secretID = nil, ""
+	return p.logEvent(JournalSecretRotation, nil)
+}
+
+// clone returns a copy of the profile, parameters are shared.
+func (p *Profile) clone() *Profile {
+	c := *p
+	return &c
+}
+
+// key returns the secret currently associated with the profile, if any.
+func (p *Profile) key() []byte {
+	switch v := p.params.(type) {
+	case *BcryptParams:
+		return v.secret
+	case *ScryptParams:
+		return v.secret
+	case *Argon2Params:
+		return v.secret
+	case *Pbkdf2Params:
+		return v.secret
 	}
-	return ErrUnsupported
+	return nil
 }
 
 // Derive is the Profile's method for computing a cryptographic key
 // usable with symmetric AEAD using the user provided Profile, password and salt
 // it will return the derived key.
 func (p *Profile) Derive(password, salt []byte) ([]byte, error) {
+	defer p.wipePassword(password)
+
+	release, err := p.acquire("derive")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	switch v := p.params.(type) {
 	// Bcrypt is NOT supported to derive crypto keys
 	case *ScryptParams:
-		v.salt = salt
-		return v.deriveFromPassword(password)
+		return v.deriveFromPassword(password, salt)
 	case *Argon2Params:
-		v.salt = salt
-		return v.deriveFromPassword(password)
+		return v.deriveFromPassword(password, salt)
+	case *Pbkdf2Params:
+		return v.deriveFromPassword(password, salt)
+	case *hasherParams:
+		return v.h.DeriveFromPassword(password, salt)
 	}
 	// key, salt, nil
 	return nil, ErrUnsupported
@@ -262,11 +420,90 @@ func (p *Profile) Derive(password, salt []byte) ([]byte, error) {
 // it takes the plaintext password to hash and output its hashed value
 // ready for storage
 func (p *Profile) Hash(password []byte) ([]byte, error) {
-	//fmt.Printf("TYPE: %d PARAMS: %T\n", p.t, p.params)
+	defer p.wipePassword(password)
+
+	hashed, err := p.hashPassword(password)
+	err = p.logEvent(JournalHash, err)
+	if err != nil {
+		return nil, err
+	}
+	return hashed, nil
+}
+
+// hashPassword is Hash() without the journal.
+func (p *Profile) hashPassword(password []byte) ([]byte, error) {
+	if p.requireSecret && len(p.key()) == 0 {
+		return nil, ErrSecretRequired
+	}
+
+	err := p.checkLength(password)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.rejectCommon && commonPassword(password) {
+		return nil, ErrWeakPassword
+	}
+
+	if p.policy != nil {
+		err = p.policy.Check(password)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	h, err := p.atTier(p.riskTier)
+	if err != nil {
+		return nil, err
+	}
+	degraded := false
+	release, err := h.acquire("hash")
+	if busy(err) && p.fallback != nil {
+		h, degraded = h.degraded(), true
+		release, err = h.start("hash")
+	}
+	if err != nil {
+		return nil, err
+	}
+	input := p.input(password)
+	hashed, err := h.hash(input)
+	release()
+	wipeCopy(input, password)
+	if err != nil {
+		return nil, err
+	}
+	md := p.metadata()
+	if degraded {
+		md[metaDegraded] = "1"
+	}
+	if p.encoding == FormatPHC {
+		hashed, err = p.encodePHC(hashed, md)
+		if err != nil {
+			return nil, err
+		}
+		return p.encryptHash(hashed)
+	}
+	err = p.bindRecord(hashed, md)
+	if err != nil {
+		return nil, err
+	}
+	hashed = insertMetadata(hashed, md)
+
+	if p.integrity {
+		hashed = appendIntegrityTag(p.key(), hashed)
+	}
+	return p.encryptHash(hashed)
+}
+
+func (p *Profile) hash(password []byte) ([]byte, error) {
 	switch v := p.params.(type) {
 	case *BcryptParams:
-		//fmt.Printf("BCRYPT TYPE: %d PARAMS: %T\n", p.t, v)
-		return v.generateFromPassword(password)
+		input, err := p.bcryptInput(password)
+		if err != nil {
+			return nil, err
+		}
+		defer wipeCopy(input, password)
+		return v.generateFromPassword(input)
 	case *ScryptParams:
 		// TODO minimum params validation
 		err := v.validate(&scryptMinParameters)
@@ -280,7 +517,14 @@ func (p *Profile) Hash(password []byte) ([]byte, error) {
 		if err != nil {
 			return nil, err
 		}
-		//fmt.Printf("v.Masked: %v\n", v.Masked)
+		return v.generateFromPassword(password)
+	case *Pbkdf2Params:
+		err := v.validate(&pbkdf2MinParameters)
+		if err != nil {
+			return nil, err
+		}
+		return v.generateFromPassword(password)
+	case *hasherParams:
 		return v.generateFromPassword(password)
 	}
 	return nil, ErrUnsupported
@@ -298,31 +542,165 @@ func (p *Profile) Hash(password []byte) ([]byte, error) {
 // - profile is BcryptSomething
 // - compared hash is $2id$salt$...
 func (p *Profile) Compare(hashed, password []byte) error {
-	/*
-		id, salt, err := parseFromHashToSalt(hashed)
+	defer p.wipePassword(password)
+
+	return p.logEvent(JournalVerify, p.comparePassword(hashed, password))
+}
+
+// comparePassword is Compare() without the journal.
+func (p *Profile) comparePassword(hashed, password []byte) error {
+	// every outcome, early refusals included, takes the same duration.
+	if p.compareDuration > 0 {
+		defer pad(time.Now(), p.compareDuration)
+	}
+
+	// encrypted hashes are verified as the hash they seal.
+	if isEncrypted(hashed) {
+		if p.aead == nil {
+			return ErrMismatch
+		}
+		plain, err := openHash(p.aead, hashed)
+		if err != nil {
+			return err
+		}
+		hashed = plain
+	}
+
+	if Locked(hashed) {
+		return ErrLocked
+	}
+
+	// no KDF work on oversized passwords.
+	if p.maxLength > 0 && len(password) > p.maxLength {
+		return ErrMismatch
+	}
+
+	// PHC strings carry no metadata, they are verified as their native
+	// encoding.
+	if p.encoding == FormatPHC && isPHC(hashed) {
+		native, err := Reencode(hashed, FormatNative)
+		if isError(err, ErrIncompatibleVersion) {
+			return err
+		}
 		if err != nil {
-			fmt.Printf("compare parse error: %v\n", err)
 			return ErrMismatch
 		}
-	*/
+		hashed = native
+	}
 
-	switch v := p.params.(type) {
+	return p.compareHash(hashed, password)
+}
+
+// compareHash is comparePassword() of a plain native hash, the profiles
+// of the secrets and masked tags are dispatched to it, within the padding.
+func (p *Profile) compareHash(hashed, password []byte) error {
+	// the per user pepper of the hash generation.
+	if len(p.user) > 0 {
+		q, err := p.forMaster(hashed)
+		if err != nil {
+			return ErrMismatch
+		}
+		if q != p {
+			return q.compareHash(hashed, password)
+		}
+	}
+
+	// the keyring secret of the hash generation.
+	if len(p.keyring) > 0 {
+		q, err := p.forSecret(hashed)
+		if err != nil {
+			return ErrMismatch
+		}
+		if q != p {
+			return q.compareHash(hashed, password)
+		}
+	}
+
+	// the masked parameters of the hash version tag.
+	if p.maskedRegistry != nil {
+		q, err := p.forMaskedTag(hashed)
+		if err != nil {
+			return ErrMismatch
+		}
+		if q != p {
+			return q.compareHash(hashed, password)
+		}
+	}
+
+	if p.integrity {
+		var err error
+		hashed, err = checkIntegrityTag(p.key(), hashed)
+		if err != nil {
+			return err
+		}
+	}
+
+	hashed, md, err := splitMetadata(hashed)
+	if err != nil {
+		return err
+	}
+	if !p.matchMetadata(md) {
+		return ErrMismatch
+	}
+
+	err = p.checkRecord(hashed, md)
+	if err != nil {
+		return err
+	}
+	input := p.input(password)
+	defer wipeCopy(input, password)
+	password = input
+
+	tier, err := storedTier(md)
+	if err != nil {
+		return ErrMismatch
+	}
+	c, err := p.atTier(tier)
+	if err != nil {
+		return err
+	}
+	if md[metaDegraded] == "1" && p.fallback != nil {
+		c = c.degraded()
+	}
+
+	release, err := c.acquire("compare")
+	if err != nil {
+		return err
+	}
+	switch v := c.params.(type) {
 	case *BcryptParams:
-		return v.compare(hashed, password)
+		input, err = c.bcryptInput(password)
+		if err != nil {
+			err = ErrMismatch
+			break
+		}
+		err = v.compare(hashed, input)
+		wipeCopy(input, password)
 	case *ScryptParams:
-		return v.compare(hashed, password)
+		err = v.compare(hashed, password)
 	case *Argon2Params:
-		return v.compare(hashed, password)
+		err = v.compare(hashed, password)
+	case *Pbkdf2Params:
+		err = v.compare(hashed, password)
+	case *hasherParams:
+		err = v.compare(hashed, password)
+	default:
+		err = ErrMismatch
+	}
+	release()
+
+	if err != nil {
+		return err
 	}
 
-	return ErrMismatch
+	notifyDeprecated(c.params)
+	return checkExpiry(md)
 }
 
 // Compare verify a non-key'd & non-mask'd hash values against a plaintext password.
 func Compare(hashed, password []byte) error {
 	//var version, stuff string
 	//var num int
-	//fmt.Printf("HASHED: %s\n", hashed)
 	// FIELDS: ["2s" "ssSDTbMpkLQtIhZ558igpO" "16" "65536" "4" "32" "J/xbjklkXIhBqZ3FAF4t5xWu4rTjxr79eIjc28VYuqK"]
 	// field0 : sig
 	// field1 : salt
@@ -331,21 +709,40 @@ func Compare(hashed, password []byte) error {
 	// field4 : param2
 	// field5 : hash
 
-	params, err := parseFromHashToParams(hashed)
+	if Locked(hashed) {
+		return ErrLocked
+	}
+
+	// PHC strings (i.e. from other libraries) are verified as their native
+	// encoding, the unsupported argon2 versions are reported as such.
+	if isPHC(hashed) {
+		native, err := Reencode(hashed, FormatNative)
+		if err != nil {
+			return err
+		}
+		hashed = native
+	}
+
+	// an integrity tag without secret, verified before any parsing.
+	if hasIntegrityTag(hashed) {
+		var err error
+		hashed, err = checkIntegrityTag(nil, hashed)
+		if err != nil {
+			return err
+		}
+	}
+
+	core, _, err := splitMetadata(hashed)
 	if err != nil {
-		fmt.Printf("compare parse error: %v\n", err)
-		return ErrMismatch
+		return err
 	}
 
-	//fmt.Printf("PARAM TYPE: %T vs %T\n", params, &Argon2Params{})
-	switch v := params.(type) {
-	case *BcryptParams:
-		return v.compare(hashed, password)
-	case *ScryptParams:
-		return v.compare(hashed, password)
-	case *Argon2Params:
-		return v.compare(hashed, password)
+	params, err := parseFromHashToParams(core)
+	if err != nil {
+		return err
 	}
 
-	return ErrMismatch
+	// a transient profile handles the metadata the same way.
+	p := Profile{params: params}
+	return p.Compare(hashed, password)
 }
@@ -4,10 +4,35 @@
 package passwd
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/ermites-io/passwd/internal/argon2"
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/openpgp/s2k"
+	"golang.org/x/crypto/scrypt"
 )
 
 // TestVectors
@@ -347,9 +372,9 @@ var vectorNewCustomTestBcrypt = []struct {
 // TestFunction
 func TestNew(t *testing.T) {
 	for i, test := range vectorNewTests {
-		myprofile, err := New(test.profile)
+		_, err := New(test.profile)
 		if err != test.expected {
-			t.Fatalf("test #%d: profile: %d err: %v vs expected: %v\n", i, myprofile, err, test.expected)
+			t.Fatalf("test #%d: profile: %d err: %v vs expected: %v\n", i, test.profile, err, test.expected)
 		}
 	}
 }
@@ -365,20 +390,20 @@ func TestCompat(t *testing.T) {
 			myprofile.SetKey(test.secret)
 		}
 		if err != nil {
-			t.Fatalf("test #%d: profile: %d err: %v vs expected: %v\n", i, myprofile, err, test.want)
+			t.Fatalf("test #%d: profile: %d err: %v vs expected: %v\n", i, test.profile, err, test.want)
 		}
 		err = myprofile.Compare(test.hash, test.passwd)
 		if err != test.want {
-			t.Fatalf("test #%d: profile: %d err: %v vs expected: %v\n", i, myprofile, err, test.want)
+			t.Fatalf("test #%d: profile: %d err: %v vs expected: %v\n", i, test.profile, err, test.want)
 		}
 	}
 }
 
 func TestNewMasked(t *testing.T) {
 	for i, test := range vectorNewMaskedTests {
-		myprofile, err := NewMasked(test.profile)
+		_, err := NewMasked(test.profile)
 		if err != test.expected {
-			t.Fatalf("test #%d: profile: %d err: %v vs expected: %v\n", i, myprofile, err, test.expected)
+			t.Fatalf("test #%d: profile: %d err: %v vs expected: %v\n", i, test.profile, err, test.expected)
 		}
 	}
 }
@@ -493,6 +518,4697 @@ func TestHashCompare(t *testing.T) {
 	}
 }
 
+func TestDeriveForSubject(t *testing.T) {
+	p, err := New(ScryptDefault)
+	if err != nil {
+		t.Fatalf("could not New(): %v\n", err)
+	}
+
+	alice1, err := p.DeriveForSubject([]byte("prout"), []byte("alice"))
+	if err != nil {
+		t.Fatalf("derive alice: %v\n", err)
+	}
+	alice2, err := p.DeriveForSubject([]byte("prout"), []byte("alice"))
+	if err != nil {
+		t.Fatalf("derive alice: %v\n", err)
+	}
+	bob, err := p.DeriveForSubject([]byte("prout"), []byte("bob"))
+	if err != nil {
+		t.Fatalf("derive bob: %v\n", err)
+	}
+
+	if !bytes.Equal(alice1, alice2) {
+		t.Fatalf("same subject derived different keys\n")
+	}
+	if bytes.Equal(alice1, bob) {
+		t.Fatalf("different subjects derived the same key\n")
+	}
+
+	_, err = p.DeriveForSubject([]byte("prout"), nil)
+	if err != ErrUnsupported {
+		t.Fatalf("empty subject err: %v vs expected: %v\n", err, ErrUnsupported)
+	}
+}
+
+func TestRelief(t *testing.T) {
+	p, err := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	if err != nil {
+		t.Fatalf("could not NewCustom(): %v\n", err)
+	}
+	p.SetKey([]byte("secret"))
+
+	cp, err := p.ClientParams(nil)
+	if err != nil {
+		t.Fatalf("client params: %v\n", err)
+	}
+
+	ck, err := ClientHash(cp, []byte("prout"))
+	if err != nil {
+		t.Fatalf("client hash: %v\n", err)
+	}
+
+	hashed, err := p.Finalize(cp, ck)
+	if err != nil {
+		t.Fatalf("finalize: %v\n", err)
+	}
+
+	// login: hand back the parameters to the client
+	cp2, err := ClientParamsFromHash(hashed)
+	if err != nil {
+		t.Fatalf("client params from hash: %v\n", err)
+	}
+
+	for i, test := range []struct {
+		password []byte
+		want     error
+	}{
+		{[]byte("prout"), nil},
+		{[]byte("proutt"), ErrMismatch},
+	} {
+		ck, err := ClientHash(cp2, test.password)
+		if err != nil {
+			t.Fatalf("test #%d: client hash: %v\n", i, err)
+		}
+		err = p.CompareFinalized(hashed, ck)
+		if err != test.want {
+			t.Fatalf("test #%d: err: %v vs expected: %v\n", i, err, test.want)
+		}
+	}
+
+	// without the secret
+	np, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	if err := np.CompareFinalized(hashed, ck); err != ErrMismatch {
+		t.Fatalf("unkeyed compare err: %v vs expected: %v\n", err, ErrMismatch)
+	}
+
+	// out of bounds parameters, stored or given.
+	for i, stored := range []string{
+		"$2r$2id$c2FsdHNhbHRzYWx0$0$64$4$32$c2FsdHNhbHRzYWx0$c2FsdHNhbHRzYWx0",
+		"$2r$2id$c2FsdHNhbHRzYWx0$1$64$0$32$c2FsdHNhbHRzYWx0$c2FsdHNhbHRzYWx0",
+		"$2r$2s$c2FsdHNhbHRzYWx0$2097152$8$1$32$c2FsdHNhbHRzYWx0$c2FsdHNhbHRzYWx0",
+	} {
+		if _, err := ClientParamsFromHash([]byte(stored)); err != ErrParse {
+			t.Fatalf("test #%d: client params from hash err: %v vs expected: %v\n", i, err, ErrParse)
+		}
+	}
+	salt := []byte("saltsaltsaltsalt")
+	for i, cp := range []*ClientParams{
+		{Algorithm: idArgon2id, Salt: salt, Time: 0, Memory: 64, Thread: 1, Keylen: 32},
+		{Algorithm: idArgon2id, Salt: salt, Time: 1, Memory: 64, Thread: 0, Keylen: 32},
+		{Algorithm: idArgon2i, Salt: salt, Time: 1, Memory: 1 << 30, Thread: 1, Keylen: 32},
+		{Algorithm: idScrypt, Salt: salt, N: 1000, R: 8, P: 1, Keylen: 32},
+		{Algorithm: idScrypt, Salt: salt, N: 1 << 10, R: 8, P: 1, Keylen: 0},
+	} {
+		if _, err := ClientHash(cp, []byte("prout")); err != ErrParse {
+			t.Fatalf("test #%d: client hash err: %v vs expected: %v\n", i, err, ErrParse)
+		}
+	}
+}
+
+func TestBlinder(t *testing.T) {
+	b, err := NewHMACBlinder([]byte("appliance key"))
+	if err != nil {
+		t.Fatalf("could not NewHMACBlinder(): %v\n", err)
+	}
+
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	if err := p.SetBlinder(b); err != nil {
+		t.Fatalf("set blinder: %v\n", err)
+	}
+
+	hashed, err := p.Hash([]byte("prout"))
+	if err != nil {
+		t.Fatalf("hash: %v\n", err)
+	}
+
+	if err := p.Compare(hashed, []byte("prout")); err != nil {
+		t.Fatalf("blinded compare err: %v vs expected: %v\n", err, nil)
+	}
+	if err := p.Compare(hashed, []byte("proutt")); err != ErrMismatch {
+		t.Fatalf("blinded compare err: %v vs expected: %v\n", err, ErrMismatch)
+	}
+
+	// no blinder, no match.
+	if err := Compare(hashed, []byte("prout")); err != ErrMismatch {
+		t.Fatalf("unblinded compare err: %v vs expected: %v\n", err, ErrMismatch)
+	}
+
+	// another key, no match.
+	ob, _ := NewHMACBlinder([]byte("another key"))
+	op, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	op.SetBlinder(ob)
+	if err := op.Compare(hashed, []byte("prout")); err != ErrMismatch {
+		t.Fatalf("other blinder compare err: %v vs expected: %v\n", err, ErrMismatch)
+	}
+
+	bp, _ := New(BcryptDefault)
+	if err := bp.SetBlinder(b); err != ErrUnsupported {
+		t.Fatalf("bcrypt blinder err: %v vs expected: %v\n", err, ErrUnsupported)
+	}
+}
+
+func TestPreHash(t *testing.T) {
+	sha := func(password []byte) []byte {
+		h := sha512.Sum512(password)
+		return h[:]
+	}
+
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	p.SetPreHash(sha)
+
+	hashed, err := p.Hash([]byte("prout"))
+	if err != nil {
+		t.Fatalf("hash: %v\n", err)
+	}
+	if !bytes.Contains(hashed, []byte("$ph=1$")) {
+		t.Fatalf("pre-hash flag missing: %s\n", hashed)
+	}
+
+	if err := p.Compare(hashed, []byte("prout")); err != nil {
+		t.Fatalf("compare err: %v vs expected: %v\n", err, nil)
+	}
+	if err := p.Compare(hashed, []byte("proutt")); err != ErrMismatch {
+		t.Fatalf("compare err: %v vs expected: %v\n", err, ErrMismatch)
+	}
+	if err := Compare(hashed, []byte("prout")); err != ErrMismatch {
+		t.Fatalf("package compare err: %v vs expected: %v\n", err, ErrMismatch)
+	}
+}
+
+func TestPostHash(t *testing.T) {
+	truncate := func(digest []byte) []byte {
+		return digest[:16]
+	}
+
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32, Masked: true})
+	if err := p.SetPostHash(truncate); err != nil {
+		t.Fatalf("set post-hash: %v\n", err)
+	}
+
+	hashed, err := p.Hash([]byte("prout"))
+	if err != nil {
+		t.Fatalf("hash: %v\n", err)
+	}
+	// $2s$po=1$<22 salt>$<22 digest>
+	if len(hashed) != 4+5+22+1+22 {
+		t.Fatalf("unexpected post-hashed length: %s\n", hashed)
+	}
+
+	if err := p.Compare(hashed, []byte("prout")); err != nil {
+		t.Fatalf("compare err: %v vs expected: %v\n", err, nil)
+	}
+	if err := p.Compare(hashed, []byte("proutt")); err != ErrMismatch {
+		t.Fatalf("compare err: %v vs expected: %v\n", err, ErrMismatch)
+	}
+
+	np, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32, Masked: true})
+	if err := np.Compare(hashed, []byte("prout")); err != ErrMismatch {
+		t.Fatalf("no post-hash compare err: %v vs expected: %v\n", err, ErrMismatch)
+	}
+}
+
+func TestAssociatedData(t *testing.T) {
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+
+	hashed, err := p.WithAssociatedData([]byte("alice")).Hash([]byte("prout"))
+	if err != nil {
+		t.Fatalf("hash: %v\n", err)
+	}
+
+	for i, test := range []struct {
+		ad   []byte
+		want error
+	}{
+		{[]byte("alice"), nil},
+		{[]byte("bob"), ErrMismatch},
+		{nil, ErrMismatch},
+	} {
+		err := p.WithAssociatedData(test.ad).Compare(hashed, []byte("prout"))
+		if err != test.want {
+			t.Fatalf("test #%d: err: %v vs expected: %v\n", i, err, test.want)
+		}
+	}
+
+	// the original profile is not bound.
+	if err := p.Compare(hashed, []byte("prout")); err != ErrMismatch {
+		t.Fatalf("unbound compare err: %v vs expected: %v\n", err, ErrMismatch)
+	}
+}
+
+func TestPepperStrategy(t *testing.T) {
+	params := func() *Argon2Params {
+		return &Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32}
+	}
+
+	hashes := make(map[PepperStrategy][]byte)
+	for _, s := range []PepperStrategy{PepperPreHash, PepperNative, PepperPostHash} {
+		p, _ := NewCustom(params())
+		p.SetKey([]byte("secret"))
+		if err := p.SetPepperStrategy(s); err != nil {
+			t.Fatalf("strategy %d: %v\n", s, err)
+		}
+
+		hashed, err := p.Hash([]byte("prout"))
+		if err != nil {
+			t.Fatalf("strategy %d hash: %v\n", s, err)
+		}
+		if err := p.Compare(hashed, []byte("prout")); err != nil {
+			t.Fatalf("strategy %d compare err: %v vs expected: %v\n", s, err, nil)
+		}
+		if err := p.Compare(hashed, []byte("proutt")); err != ErrMismatch {
+			t.Fatalf("strategy %d compare err: %v vs expected: %v\n", s, err, ErrMismatch)
+		}
+		hashes[s] = hashed
+	}
+
+	// a profile using the default strategy cannot verify others.
+	p, _ := NewCustom(params())
+	p.SetKey([]byte("secret"))
+	for s, hashed := range hashes {
+		var want error = ErrMismatch
+		if s == PepperPreHash {
+			want = nil
+		}
+		if err := p.Compare(hashed, []byte("prout")); err != want {
+			t.Fatalf("strategy %d cross compare err: %v vs expected: %v\n", s, err, want)
+		}
+	}
+
+	sp, _ := New(ScryptDefault)
+	if err := sp.SetPepperStrategy(PepperNative); err != ErrUnsupported {
+		t.Fatalf("scrypt native err: %v vs expected: %v\n", err, ErrUnsupported)
+	}
+}
+
+func TestRequireSecret(t *testing.T) {
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	p.SetRequireSecret(true)
+
+	if _, err := p.Hash([]byte("prout")); err != ErrSecretRequired {
+		t.Fatalf("unkeyed hash err: %v vs expected: %v\n", err, ErrSecretRequired)
+	}
+
+	p.SetKey([]byte("secret"))
+	if _, err := p.Hash([]byte("prout")); err != nil {
+		t.Fatalf("keyed hash err: %v vs expected: %v\n", err, nil)
+	}
+}
+
+func TestSetSecret(t *testing.T) {
+	for i, test := range []struct {
+		secret []byte
+		want   error
+	}{
+		{[]byte("s"), ErrSecretTooShort},
+		{make([]byte, 32), ErrSecretWeak},
+		{[]byte("aaaaaaaaaaaaaaaaaaaaaaaab"), ErrSecretWeak},
+		{[]byte("myhashingsecret!"), nil},
+		{[]byte("0123456789abcdefghijklmnopqrstuv"), nil},
+	} {
+		p, _ := New(Argon2idDefault)
+		err := p.SetSecret(test.secret)
+		if err != test.want {
+			t.Fatalf("test #%d: err: %v vs expected: %v\n", i, err, test.want)
+		}
+	}
+
+	// bcrypt profiles are key'ed too.
+	p, _ := New(BcryptDefault)
+	if err := p.SetSecret([]byte("myhashingsecret!")); err != nil {
+		t.Fatalf("bcrypt err: %v vs expected: %v\n", err, nil)
+	}
+}
+
+func TestIntegrityTag(t *testing.T) {
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32, Masked: true})
+	if err := p.SetIntegrityTag(true); err != nil {
+		t.Fatalf("set integrity tag: %v\n", err)
+	}
+
+	hashed, err := p.Hash([]byte("prout"))
+	if err != nil {
+		t.Fatalf("hash: %v\n", err)
+	}
+
+	truncated := hashed[:len(hashed)-12]
+	flipped := append([]byte{}, hashed...)
+	flipped[10] ^= 0x01
+
+	for i, test := range []struct {
+		hashed   []byte
+		password []byte
+		want     error
+	}{
+		{hashed, []byte("prout"), nil},
+		{hashed, []byte("proutt"), ErrMismatch},
+		{truncated, []byte("prout"), ErrCorrupted},
+		{flipped, []byte("prout"), ErrCorrupted},
+	} {
+		err := p.Compare(test.hashed, test.password)
+		if err != test.want {
+			t.Fatalf("test #%d: err: %v vs expected: %v\n", i, err, test.want)
+		}
+	}
+
+	// unmasked hashes, the unkey'ed tag is checked by Compare() too.
+	for _, params := range []interface{}{
+		&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32},
+		&BcryptParams{Cost: 4},
+	} {
+		up, _ := NewCustom(params)
+		if err := up.SetIntegrityTag(true); err != nil {
+			t.Fatalf("unmasked integrity err: %v\n", err)
+		}
+		hashed, err := up.Hash([]byte("prout"))
+		if err != nil {
+			t.Fatalf("hash: %v\n", err)
+		}
+		truncated := hashed[:len(hashed)-12]
+		flipped := append([]byte{}, hashed...)
+		flipped[10] ^= 0x01
+
+		if err := Compare(hashed, []byte("prout")); err != nil {
+			t.Fatalf("%T compare: %v\n", params, err)
+		}
+		if err := Compare(flipped, []byte("prout")); err != ErrCorrupted {
+			t.Fatalf("%T compare flipped err: %v vs expected: %v\n", params, err, ErrCorrupted)
+		}
+		if err := up.Compare(truncated, []byte("prout")); err != ErrCorrupted {
+			t.Fatalf("%T profile compare truncated err: %v vs expected: %v\n", params, err, ErrCorrupted)
+		}
+	}
+}
+
+func TestRecordBinding(t *testing.T) {
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+
+	if _, err := p.WithRecord([]byte("42")).Hash([]byte("prout")); err != ErrSecretRequired {
+		t.Fatalf("unkeyed binding err: %v vs expected: %v\n", err, ErrSecretRequired)
+	}
+
+	p.SetKey([]byte("secret"))
+	hashed, err := p.WithRecord([]byte("42")).Hash([]byte("prout"))
+	if err != nil {
+		t.Fatalf("hash: %v\n", err)
+	}
+
+	for i, test := range []struct {
+		record   []byte
+		password []byte
+		want     error
+	}{
+		{[]byte("42"), []byte("prout"), nil},
+		{[]byte("42"), []byte("proutt"), ErrMismatch},
+		{[]byte("43"), []byte("prout"), ErrBinding},
+		{nil, []byte("prout"), ErrMismatch},
+	} {
+		err := p.WithRecord(test.record).Compare(hashed, test.password)
+		if err != test.want {
+			t.Fatalf("test #%d: err: %v vs expected: %v\n", i, err, test.want)
+		}
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	issued := time.Unix(1700000000, 0)
+	now = func() time.Time { return issued }
+	defer func() { now = time.Now }()
+
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	p.SetTimestamp(true)
+
+	hashed, err := p.Hash([]byte("prout"))
+	if err != nil {
+		t.Fatalf("hash: %v\n", err)
+	}
+
+	ts, err := IssuedAt(hashed)
+	if err != nil || !ts.Equal(issued) {
+		t.Fatalf("issued at: %v (%v) vs expected: %v\n", ts, err, issued)
+	}
+
+	// the timestamp does not prevent verification
+	if err := Compare(hashed, []byte("prout")); err != nil {
+		t.Fatalf("compare err: %v vs expected: %v\n", err, nil)
+	}
+
+	np, _ := New(ScryptDefault)
+	nhashed, _ := np.Hash([]byte("prout"))
+	if _, err := IssuedAt(nhashed); err != ErrUnsupported {
+		t.Fatalf("no timestamp err: %v vs expected: %v\n", err, ErrUnsupported)
+	}
+
+	info, err := Info(hashed)
+	if err != nil || !info.IssuedAt.Equal(issued) {
+		t.Fatalf("info issued at: %v (%v) vs expected: %v\n", info.IssuedAt, err, issued)
+	}
+	if info, _ := Info(nhashed); !info.IssuedAt.IsZero() {
+		t.Fatalf("info issued at: %v vs expected none\n", info.IssuedAt)
+	}
+
+	// the stale hashes need a rehash, and still verify.
+	up, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	untimed, _ := up.Hash([]byte("prout"))
+	if err := p.SetMaxAge(-time.Hour); err != ErrUnsupported {
+		t.Fatalf("max age err: %v vs expected: %v\n", err, ErrUnsupported)
+	}
+	_ = p.SetMaxAge(24 * time.Hour)
+	if p.NeedsRehash(hashed) || !p.NeedsRehash(untimed) {
+		t.Fatalf("needs rehash: fresh %v untimed %v\n", p.NeedsRehash(hashed), p.NeedsRehash(untimed))
+	}
+
+	now = func() time.Time { return issued.Add(25 * time.Hour) }
+	r, err := p.CompareEx(hashed, []byte("prout"))
+	if err != nil || !r.NeedsRehash || !p.NeedsRehash(hashed) {
+		t.Fatalf("stale compare: %+v (%v)\n", r, err)
+	}
+	rehashed, _ := p.Hash([]byte("prout"))
+	if p.NeedsRehash(rehashed) {
+		t.Fatalf("rehashed %s needs a rehash\n", rehashed)
+	}
+
+	_ = p.SetMaxAge(0)
+	if p.NeedsRehash(hashed) {
+		t.Fatalf("needs rehash without max age\n")
+	}
+}
+
+func TestReencode(t *testing.T) {
+	for i, test := range []struct {
+		phc    []byte
+		passwd []byte
+	}{
+		{ // argon2 reference CLI
+			[]byte("$argon2i$v=19$m=65536,t=2,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG"),
+			[]byte("password"),
+		},
+		{ // passlib
+			[]byte("$scrypt$ln=10,r=8,p=1$c2FsdHNhbHRzYWx0c2FsdA$BVMRKqdiVYikKAaPR1wucsKUKvw4TuPLkdEYtoSHas4"),
+			[]byte("password"),
+		},
+	} {
+		native, err := Reencode(test.phc, FormatNative)
+		if err != nil {
+			t.Fatalf("test #%d: reencode native: %v\n", i, err)
+		}
+		if err := Compare(native, test.passwd); err != nil {
+			t.Fatalf("test #%d: compare %s err: %v vs expected: %v\n", i, native, err, nil)
+		}
+
+		phc, err := Reencode(native, FormatPHC)
+		if err != nil || !bytes.Equal(phc, test.phc) {
+			t.Fatalf("test #%d: reencode phc: %s (%v) vs expected: %s\n", i, phc, err, test.phc)
+		}
+	}
+
+	for i, test := range []struct {
+		hashed []byte
+		want   error
+	}{
+		{[]byte("$2a$10$zlKoI5wrYXIa9d186fXI9OAic/y2F5YNyBXpmz5xTpl9hhBAtza6m"), ErrUnsupported},
+		{[]byte("$2id$Ubnnyt80onlzG/5MlokXmu$xvpXX5.3eZBjihHNFEVjLTtURakelLxlkrjBrzv9KA6"), ErrUnsupported},
+		{[]byte("$argon2id$v=16$m=65536,t=2,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG"), ErrIncompatibleVersion},
+		{[]byte("$argon2id$v=19$m=65536,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG"), ErrParse},
+	} {
+		_, err := Reencode(test.hashed, FormatPHC)
+		if err != test.want && !isError(err, test.want) {
+			t.Fatalf("test #%d: err: %v vs expected: %v\n", i, err, test.want)
+		}
+	}
+
+	// empty salts.
+	for i, hashed := range [][]byte{
+		[]byte("$argon2id$v=19$m=64,t=1,p=1$$aGFzaA"),
+		[]byte("$scrypt$ln=4,r=8,p=1$$aGFzaA"),
+	} {
+		if _, err := Reencode(hashed, FormatNative); !isError(err, ErrParse) {
+			t.Fatalf("test #%d: reencode err: %v vs expected: %v\n", i, err, ErrParse)
+		}
+		if err := Compare(hashed, []byte("password")); !isError(err, ErrParse) {
+			t.Fatalf("test #%d: compare err: %v vs expected: %v\n", i, err, ErrParse)
+		}
+	}
+
+	// malformed salts, keys and parameters.
+	native := func(id string, a, b, c uint32, salt, key []byte) []byte {
+		return []byte(fmt.Sprintf("$%s$%s$%d$%d$%d$%d$%s", id, base64Encode(salt), a, b, c, len(key), base64Encode(key)))
+	}
+	salt, key := []byte("saltsaltsaltsalt"), []byte("hashhashhashhash")
+	for i, hashed := range [][]byte{
+		[]byte("$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$"),
+		[]byte("$argon2id$v=19$m=64,t=0,p=1$c2FsdHNhbHQ$aGFzaGhhc2g"),
+		[]byte("$argon2id$v=19$m=64,t=1,p=0$c2FsdHNhbHQ$aGFzaGhhc2g"),
+		[]byte("$argon2id$v=19$m=64,t=1,p=256$c2FsdHNhbHQ$aGFzaGhhc2g"),
+		[]byte("$argon2id$v=19$m=4,t=1,p=1$c2FsdHNhbHQ$aGFzaGhhc2g"),
+		[]byte("$argon2d$v=19$m=2097152,t=1,p=1$c2FsdHNhbHQ$aGFzaGhhc2g"),
+		[]byte("$scrypt$ln=4,r=0,p=1$c2FsdHNhbHQ$aGFzaGhhc2g"),
+		[]byte("$scrypt$ln=4,r=8,p=0$c2FsdHNhbHQ$aGFzaGhhc2g"),
+		[]byte("$scrypt$ln=24,r=8,p=1$c2FsdHNhbHQ$aGFzaGhhc2g"),
+		native(idArgon2id, 0, 64, 1, salt, key),
+		native(idArgon2id, 1, 64, 0, salt, key),
+		native(idArgon2i, 1, 4, 1, salt, key),
+		native(idArgon2d, 1, 1<<21, 1, salt, key),
+		native(idScrypt, 3, 8, 1, salt, key),
+		native(idScrypt, 1<<10, 0, 1, salt, key),
+		native(idScrypt, 1<<24, 8, 1, salt, key),
+	} {
+		for _, target := range []Format{FormatNative, FormatPHC} {
+			if _, err := Reencode(hashed, target); !isError(err, ErrParse) {
+				t.Fatalf("test #%d: reencode %s err: %v vs expected: %v\n", i, hashed, err, ErrParse)
+			}
+		}
+	}
+}
+
+func TestSuite(t *testing.T) {
+	password := []byte("prout")
+
+	preferred, _ := NewCustom(&Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+	legacy, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	oldbcrypt, _ := bcrypt.GenerateFromPassword(password, bcrypt.MinCost)
+
+	s, err := NewSuite(preferred, NativeVerifier, PHCVerifier)
+	if err != nil {
+		t.Fatalf("suite error: %v\n", err)
+	}
+
+	current, err := s.Hash(password)
+	if err != nil {
+		t.Fatalf("suite hash error: %v\n", err)
+	}
+	old, _ := legacy.Hash(password)
+
+	// the preferred profile errors are not hidden by the verifiers.
+	_ = preferred.SetExpiry(time.Hour)
+	expired, _ := s.Hash(password)
+	_ = preferred.SetExpiry(0)
+	now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	defer func() { now = time.Now }()
+
+	for i, test := range []struct {
+		hashed   []byte
+		password []byte
+		rehash   bool
+		want     error
+	}{
+		{current, password, false, nil},
+		{old, password, true, nil},
+		{oldbcrypt, password, true, nil},
+		{[]byte("$scrypt$ln=10,r=8,p=1$c2FsdHNhbHRzYWx0c2FsdA$BVMRKqdiVYikKAaPR1wucsKUKvw4TuPLkdEYtoSHas4"), []byte("password"), true, nil},
+		{current, []byte("wrong"), false, ErrMismatch},
+		{old, []byte("wrong"), false, ErrMismatch},
+		{Lock(current), password, false, ErrLocked},
+		{expired, password, false, ErrExpired},
+	} {
+		rehash, err := s.Verify(test.hashed, test.password)
+		if rehash != test.rehash || err != test.want {
+			t.Fatalf("test #%d: verify %s: %v/%v vs expected: %v/%v\n", i, test.hashed, rehash, err, test.rehash, test.want)
+		}
+	}
+}
+
+func TestCompareEx(t *testing.T) {
+	password := []byte("prout")
+
+	current, _ := NewCustom(&ScryptParams{N: 1 << 11, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	older, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	masked, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32, Masked: true})
+	bcrypted, _ := NewCustom(&BcryptParams{Cost: bcrypt.MinCost})
+
+	for i, test := range []struct {
+		profile *Profile
+		hasher  *Profile
+		keyed   bool
+		rehash  bool
+	}{
+		{current, current, false, false},
+		{current, older, false, true},
+		{masked, masked, false, false},
+		{bcrypted, bcrypted, false, false},
+	} {
+		hashed, err := test.hasher.Hash(password)
+		if err != nil {
+			t.Fatalf("test #%d: hash error: %v\n", i, err)
+		}
+
+		r, err := test.profile.CompareEx(hashed, password)
+		if err != nil {
+			t.Fatalf("test #%d: compare %s error: %v\n", i, hashed, err)
+		}
+		if r.Keyed != test.keyed || r.NeedsRehash != test.rehash || r.Masked != test.hasher.masked() || r.Params == nil {
+			t.Fatalf("test #%d: result %+v\n", i, r)
+		}
+
+		_, err = test.profile.CompareEx(hashed, []byte("wrong"))
+		if err != ErrMismatch {
+			t.Fatalf("test #%d: compare err: %v vs expected: %v\n", i, err, ErrMismatch)
+		}
+	}
+
+	// a key'ed profile verifies older key'ed hashes.
+	current.SetKey([]byte("myshinykey"))
+	older.SetKey([]byte("myshinykey"))
+	hashed, _ := older.Hash(password)
+	r, err := current.CompareEx(hashed, password)
+	if err != nil || !r.Keyed || !r.NeedsRehash || r.Algorithm != idScrypt {
+		t.Fatalf("keyed result %+v err: %v\n", r, err)
+	}
+	if sp := r.Params.(*ScryptParams); sp.N != 1<<10 || sp.secret != nil {
+		t.Fatalf("keyed result params %+v\n", sp)
+	}
+}
+
+func TestStronger(t *testing.T) {
+	for i, test := range []struct {
+		a, b interface{}
+		want int
+	}{
+		{&argonCommonParameters, &argonParanoidParameters, -1},
+		{&scryptParanoidParameters, &scryptCommonParameters, 1},
+		{&ScryptParams{N: 1 << 15, R: 8, P: 1}, &Argon2Params{Time: 1, Memory: 64 * 1024}, 0},
+		{&BcryptParams{Cost: 10}, &BcryptParams{Cost: 10}, 0},
+		{&BcryptParams{Cost: 12}, &argonCommonParameters, -1},
+	} {
+		got, err := StrongerParams(test.a, test.b)
+		if err != nil || got != test.want {
+			t.Fatalf("test #%d: stronger %d (%v) vs expected: %d\n", i, got, err, test.want)
+		}
+	}
+
+	argon := []byte("$2id$jHPEXqOJ7PEXodl75xJd.e$1$65536$16$32$xR87mnbB548T4Sj4uSQ0mAjNtIG2D2uG.Aob28QJY2u")
+	phc := []byte("$argon2i$v=19$m=65536,t=2,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG")
+	bcrypted := []byte("$2a$10$zlKoI5wrYXIa9d186fXI9OAic/y2F5YNyBXpmz5xTpl9hhBAtza6m")
+
+	for i, test := range []struct {
+		a, b []byte
+		want int
+		err  error
+	}{
+		{argon, phc, -1, nil},
+		{argon, bcrypted, 1, nil},
+		{argon, argon, 0, nil},
+		{argon, []byte("$2id$Ubnnyt80onlzG/5MlokXmu$xvpXX5.3eZBjihHNFEVjLTtURakelLxlkrjBrzv9KA6"), 0, ErrUnsupported},
+	} {
+		got, err := Stronger(test.a, test.b)
+		if err != test.err || got != test.want {
+			t.Fatalf("test #%d: stronger %d (%v) vs expected: %d (%v)\n", i, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestRollout(t *testing.T) {
+	current, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	next, _ := NewCustom(&Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+
+	r := Rollout{Label: "argon2-2026", Current: current, Next: next}
+
+	selected := make(map[int]bool)
+	for _, percent := range []int{0, 1, 10, 100} {
+		r.Percent = percent
+
+		count := 0
+		for i := 0; i < 1000; i++ {
+			subject := []byte(fmt.Sprintf("user-%d", i))
+			if Cohort(r.Label, subject) != Cohort(r.Label, subject) {
+				t.Fatalf("cohort of %s is not deterministic\n", subject)
+			}
+
+			p := r.Profile(subject)
+			if p == next {
+				count++
+				selected[i] = true
+			} else if selected[i] {
+				t.Fatalf("%d%%: %s moved back to the current profile\n", percent, subject)
+			}
+		}
+
+		// loose bounds, the assignment is pseudo random.
+		if count < percent*10*7/10 || count > percent*10*13/10+5 {
+			t.Fatalf("%d%%: %d subjects selected out of 1000\n", percent, count)
+		}
+	}
+}
+
+func TestOnDeprecated(t *testing.T) {
+	password := []byte("prout")
+	weak, _ := NewCustom(&BcryptParams{Cost: bcrypt.MinCost})
+	strong, _ := NewCustom(&ScryptParams{N: 1 << 12, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+
+	var deprecated []interface{}
+	OnDeprecated(WeakerThan(&BcryptParams{Cost: 10}), func(params interface{}) {
+		deprecated = append(deprecated, params)
+	})
+	defer OnDeprecated(nil, nil)
+
+	weakHash, _ := weak.Hash(password)
+	strongHash, _ := strong.Hash(password)
+
+	for i, test := range []struct {
+		hashed   []byte
+		password []byte
+		count    int
+	}{
+		{weakHash, password, 1},
+		{weakHash, []byte("wrong"), 1},
+		{strongHash, password, 1},
+		{weakHash, password, 2},
+	} {
+		Compare(test.hashed, test.password)
+		if len(deprecated) != test.count {
+			t.Fatalf("test #%d: %d deprecation calls vs expected: %d\n", i, len(deprecated), test.count)
+		}
+	}
+
+	if bp, ok := deprecated[0].(*BcryptParams); !ok || bp.Cost != bcrypt.MinCost {
+		t.Fatalf("deprecated params %#v\n", deprecated[0])
+	}
+}
+
+func TestLock(t *testing.T) {
+	password := []byte("prout")
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	hashed, _ := p.Hash(password)
+
+	locked := Lock(hashed)
+	if !Locked(locked) || Locked(hashed) || !bytes.Equal(Lock(locked), locked) {
+		t.Fatalf("lock %s\n", locked)
+	}
+
+	for i, test := range []struct {
+		hashed []byte
+		unlock []byte
+		err    error
+	}{
+		{locked, hashed, nil},
+		{append([]byte("!"), hashed...), hashed, nil},
+		{[]byte("*"), nil, ErrUnsupported},
+		{[]byte("!"), nil, ErrUnsupported},
+		{[]byte("!locked!*"), nil, ErrUnsupported},
+	} {
+		if err := p.Compare(test.hashed, password); err != ErrLocked {
+			t.Fatalf("test #%d: profile compare err: %v vs expected: %v\n", i, err, ErrLocked)
+		}
+		if err := Compare(test.hashed, password); err != ErrLocked {
+			t.Fatalf("test #%d: compare err: %v vs expected: %v\n", i, err, ErrLocked)
+		}
+
+		unlocked, err := Unlock(test.hashed)
+		if err != test.err || !bytes.Equal(unlocked, test.unlock) {
+			t.Fatalf("test #%d: unlock %s (%v) vs expected: %s (%v)\n", i, unlocked, err, test.unlock, test.err)
+		}
+		if err == nil && p.Compare(unlocked, password) != nil {
+			t.Fatalf("test #%d: unlocked compare failed\n", i)
+		}
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	issued := time.Unix(1700000000, 0)
+	now = func() time.Time { return issued }
+	defer func() { now = time.Now }()
+
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	p.SetExpiry(24 * time.Hour)
+
+	hashed, err := p.Hash([]byte("prout"))
+	if err != nil {
+		t.Fatalf("hash: %v\n", err)
+	}
+
+	exp, err := ExpiresAt(hashed)
+	if err != nil || !exp.Equal(issued.Add(24*time.Hour)) {
+		t.Fatalf("expires at: %v (%v)\n", exp, err)
+	}
+
+	for i, test := range []struct {
+		at       time.Time
+		password []byte
+		want     error
+	}{
+		{issued.Add(time.Hour), []byte("prout"), nil},
+		{issued.Add(time.Hour), []byte("wrong"), ErrMismatch},
+		{issued.Add(24 * time.Hour), []byte("prout"), ErrExpired},
+		{issued.Add(48 * time.Hour), []byte("wrong"), ErrMismatch},
+	} {
+		now = func() time.Time { return test.at }
+
+		if err := p.Compare(hashed, test.password); err != test.want {
+			t.Fatalf("test #%d: profile compare err: %v vs expected: %v\n", i, err, test.want)
+		}
+		if err := Compare(hashed, test.password); err != test.want {
+			t.Fatalf("test #%d: compare err: %v vs expected: %v\n", i, err, test.want)
+		}
+	}
+
+	if err := p.SetExpiry(-time.Hour); err != ErrUnsupported {
+		t.Fatalf("negative expiry err: %v vs expected: %v\n", err, ErrUnsupported)
+	}
+}
+
+func TestPasswordLength(t *testing.T) {
+	for i, test := range []struct {
+		rejectEmpty bool
+		minLength   int
+		password    []byte
+		want        error
+	}{
+		{false, 0, []byte(""), nil},
+		{true, 0, []byte(""), ErrPasswordEmpty},
+		{false, 8, []byte(""), ErrPasswordEmpty},
+		{false, 8, []byte("prout"), ErrPasswordTooShort},
+		{false, 8, []byte("proutprout"), nil},
+		{false, 4, []byte("été"), ErrPasswordTooShort}, // 3 runes, 5 bytes
+		{false, 3, []byte("été"), nil},
+	} {
+		p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+		p.SetRejectEmpty(test.rejectEmpty)
+		p.SetMinLength(test.minLength)
+
+		_, err := p.Hash(test.password)
+		if err != test.want {
+			t.Fatalf("test #%d: hash err: %v vs expected: %v\n", i, err, test.want)
+		}
+	}
+}
+
+func TestPolicyChecker(t *testing.T) {
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	p.SetPolicyChecker(Rules{
+		LengthRule(8, 64),
+		ClassesRule(3),
+		DenyRule("Password1!"),
+	})
+
+	for i, test := range []struct {
+		password []byte
+		rules    []string
+	}{
+		{[]byte("Prout-prout-42"), nil},
+		{[]byte("prout"), []string{"length", "classes"}},
+		{[]byte("password1!"), []string{"denylist"}},
+		{bytes.Repeat([]byte("aB1"), 30), []string{"length"}},
+	} {
+		_, err := p.Hash(test.password)
+		if test.rules == nil {
+			if err != nil {
+				t.Fatalf("test #%d: hash err: %v vs expected: %v\n", i, err, nil)
+			}
+			continue
+		}
+
+		perr, ok := err.(*PolicyError)
+		if !ok || len(perr.Violations) != len(test.rules) {
+			t.Fatalf("test #%d: hash err: %v vs expected: %v\n", i, err, test.rules)
+		}
+		for j, v := range perr.Violations {
+			if v.Rule != test.rules[j] {
+				t.Fatalf("test #%d: violation %s vs expected: %s\n", i, v.Rule, test.rules[j])
+			}
+		}
+	}
+}
+
+func TestFileSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "passwd")
+	if err != nil {
+		t.Fatalf("tempdir: %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	secret := []byte("0123456789abcdefghijklmnopqrstuv")
+	write := func(name string, content []byte, perm os.FileMode) string {
+		path := filepath.Join(dir, name)
+		ioutil.WriteFile(path, content, perm)
+		os.Chmod(path, perm)
+		return path
+	}
+
+	for i, test := range []struct {
+		fs   FileSecret
+		want error
+	}{
+		{FileSecret{Path: write("raw", append(secret, '\n'), 0600)}, nil},
+		{FileSecret{Path: write("b64", []byte(base64.StdEncoding.EncodeToString(secret)+"\r\n"), 0400), Base64: true}, nil},
+		{FileSecret{Path: write("shared", secret, 0644)}, ErrSecretPermissions},
+		{FileSecret{Path: write("docker", secret, 0644), MaxPerm: 0644}, nil},
+		{FileSecret{Path: write("invalid", []byte("!!"), 0600), Base64: true}, ErrParse},
+		{FileSecret{Path: dir}, ErrSecretPermissions},
+	} {
+		p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+		err := p.SetSecretProvider(test.fs)
+		if err != test.want {
+			t.Fatalf("test #%d: %s err: %v vs expected: %v\n", i, test.fs.Path, err, test.want)
+		}
+		if err == nil && !bytes.Equal(p.key(), secret) {
+			t.Fatalf("test #%d: secret %q vs expected: %q\n", i, p.key(), secret)
+		}
+	}
+
+	os.Setenv("CREDENTIALS_DIRECTORY", dir)
+	defer os.Unsetenv("CREDENTIALS_DIRECTORY")
+	fs, err := SystemdCredential("raw", false)
+	if err != nil || fs.Path != filepath.Join(dir, "raw") {
+		t.Fatalf("systemd credential %s err: %v\n", fs.Path, err)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "passwd")
+	if err != nil {
+		t.Fatalf("tempdir: %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "secret")
+	first := []byte("0123456789abcdefghijklmnopqrstuv")
+	second := []byte("vutsrqponmlkjihgfedcba9876543210")
+	ioutil.WriteFile(path, first, 0600)
+
+	var reloaded [][]byte
+	w, err := WatchSecret(FileSecret{Path: path}, time.Hour, func(secret []byte) error {
+		reloaded = append(reloaded, secret)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("watch error: %v\n", err)
+	}
+	defer w.Close()
+
+	// unchanged
+	if changed, err := w.Check(); changed || err != nil {
+		t.Fatalf("unchanged check: %v (%v)\n", changed, err)
+	}
+
+	ioutil.WriteFile(path, second, 0600)
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Minute))
+	if changed, err := w.Check(); !changed || err != nil {
+		t.Fatalf("changed check: %v (%v)\n", changed, err)
+	}
+
+	// a failed reload keeps the previous secret.
+	ioutil.WriteFile(path, first, 0600)
+	os.Chmod(path, 0644)
+	os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute))
+	if _, err := w.Check(); err != ErrSecretPermissions || w.Err() != ErrSecretPermissions {
+		t.Fatalf("insecure check err: %v vs expected: %v\n", err, ErrSecretPermissions)
+	}
+
+	if len(reloaded) != 2 || !bytes.Equal(reloaded[0], first) || !bytes.Equal(reloaded[1], second) {
+		t.Fatalf("reloaded %q\n", reloaded)
+	}
+}
+
+func TestProfileHandle(t *testing.T) {
+	password := []byte("prout")
+	first := []byte("0123456789abcdefghijklmnopqrstuv")
+	second := []byte("vutsrqponmlkjihgfedcba9876543210")
+
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	p.SetSecret(first)
+	h := NewProfileHandle(p)
+
+	old, _ := h.Hash(password)
+	loaded := h.Load()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			h.Hash(password)
+		}
+	}()
+
+	if err := h.Update(func(p *Profile) error { return p.SetSecret(second) }); err != nil {
+		t.Fatalf("update error: %v\n", err)
+	}
+	if err := h.Update(func(p *Profile) error { return p.SetSecret([]byte("short")) }); err != ErrSecretTooShort {
+		t.Fatalf("update err: %v vs expected: %v\n", err, ErrSecretTooShort)
+	}
+	<-done
+
+	// the previous profile is untouched.
+	if err := loaded.Compare(old, password); err != nil {
+		t.Fatalf("old profile compare err: %v vs expected: %v\n", err, nil)
+	}
+	if err := h.Compare(old, password); err != ErrMismatch {
+		t.Fatalf("new profile compare err: %v vs expected: %v\n", err, ErrMismatch)
+	}
+
+	hashed, _ := h.Hash(password)
+	if !bytes.Equal(h.Load().key(), second) || h.Compare(hashed, password) != nil {
+		t.Fatalf("new profile does not hash with the new secret\n")
+	}
+}
+
+func TestCryptoMode(t *testing.T) {
+	switch mode := CryptoMode(); mode {
+	case CryptoStandard, CryptoBoringCrypto, CryptoFIPS140:
+		if FIPS() != (mode != CryptoStandard) {
+			t.Fatalf("fips %v in mode %s\n", FIPS(), mode)
+		}
+	default:
+		t.Fatalf("unknown crypto mode %s\n", mode)
+	}
+}
+
+func TestBackend(t *testing.T) {
+	password, salt := []byte("prout"), []byte("0123456789abcdef")
+
+	// the backend in use must produce the Go implementation outputs.
+	for i, test := range []struct {
+		mode    int
+		salt    []byte
+		secret  []byte
+		time    uint32
+		memory  uint32
+		threads uint8
+	}{
+		{argon2.ModeID, salt, nil, 1, 64, 1},
+		{argon2.ModeI, salt, nil, 3, 64, 1},
+		{argon2.ModeID, salt, nil, 2, 64, 4},
+		{argon2.ModeID, salt[:8], nil, 1, 64, 1},
+		{argon2.ModeID, salt, []byte("secret"), 1, 64, 1},
+	} {
+		got := argon2Key(test.mode, password, test.salt, test.secret, nil, test.time, test.memory, test.threads, 32)
+		want := argon2.DeriveKey(test.mode, password, test.salt, test.secret, nil, test.time, test.memory, test.threads, 32)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("test #%d: %s argon2 %x vs expected: %x\n", i, Backend(), got, want)
+		}
+	}
+
+	for i, test := range []struct {
+		n, r, p int
+	}{
+		{1 << 10, 8, 1},
+		{1 << 4, 1, 2},
+		{3, 8, 1}, // invalid
+	} {
+		got, err := scryptKey(password, salt, test.n, test.r, test.p, 32)
+		want, werr := scrypt.Key(password, salt, test.n, test.r, test.p, 32)
+		if !bytes.Equal(got, want) || (err == nil) != (werr == nil) {
+			t.Fatalf("test #%d: %s scrypt %x (%v) vs expected: %x (%v)\n", i, Backend(), got, err, want, werr)
+		}
+	}
+}
+
+func TestBcryptSalt(t *testing.T) {
+	salt, _ := base64Decode([]byte("XajjQvNhvvRt5GSeFk1xFe"))
+	expected := "$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga"
+
+	p, err := NewCustom(&BcryptParams{Cost: 10, Salt: salt})
+	if err != nil {
+		t.Fatalf("NewCustom: %v", err)
+	}
+
+	hashed, err := p.Hash([]byte("allmine"))
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if string(hashed) != expected {
+		t.Fatalf("Hash: got %s, expected %s", hashed, expected)
+	}
+
+	if err := bcrypt.CompareHashAndPassword(hashed, []byte("allmine")); err != nil {
+		t.Fatalf("x/crypto/bcrypt: %v", err)
+	}
+	if err := Compare(hashed, []byte("allmine")); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+
+	p, _ = NewCustom(&BcryptParams{Cost: 10, Salt: salt[:8]})
+	if _, err := p.Hash([]byte("allmine")); err != ErrUnsupported {
+		t.Fatalf("short salt: got %v, expected %v", err, ErrUnsupported)
+	}
+}
+
+func TestHashReader(t *testing.T) {
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	p.SetReaderLimit(2048)
+
+	passphrase := strings.Repeat("correct horse battery staple ", 50)
+
+	hashed, err := p.HashReader(strings.NewReader(passphrase))
+	if err != nil {
+		t.Fatalf("HashReader: %v", err)
+	}
+	if err := p.Compare(hashed, []byte(passphrase)); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	if err := p.CompareReader(hashed, strings.NewReader(passphrase)); err != nil {
+		t.Fatalf("CompareReader: %v", err)
+	}
+	if err := p.CompareReader(hashed, strings.NewReader(passphrase[1:])); err != ErrMismatch {
+		t.Fatalf("CompareReader: got %v, expected %v", err, ErrMismatch)
+	}
+
+	p.SetReaderLimit(int64(len(passphrase) - 1))
+	if _, err := p.HashReader(strings.NewReader(passphrase)); err != ErrPasswordTooLong {
+		t.Fatalf("HashReader: got %v, expected %v", err, ErrPasswordTooLong)
+	}
+	if err := p.CompareReader(hashed, strings.NewReader(passphrase)); err != ErrPasswordTooLong {
+		t.Fatalf("CompareReader: got %v, expected %v", err, ErrPasswordTooLong)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	if _, err := NewLimiter(1, 1); err != ErrUnsupported {
+		t.Fatalf("NewLimiter: got %v, expected %v", err, ErrUnsupported)
+	}
+
+	l, _ := NewLimiter(1, 0)
+	waiting := func(prio Priority) int {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return len(l.waiting[prio])
+	}
+
+	// interactive work queued after background work starts first.
+	l.acquire(PriorityInteractive)
+	started := make(chan Priority, 2)
+	go func() { l.acquire(PriorityBackground); started <- PriorityBackground }()
+	for waiting(PriorityBackground) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go func() { l.acquire(PriorityInteractive); started <- PriorityInteractive }()
+	for waiting(PriorityInteractive) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	l.release(PriorityInteractive)
+	if prio := <-started; prio != PriorityInteractive {
+		t.Fatalf("started priority %d first", prio)
+	}
+	l.release(PriorityInteractive)
+	if prio := <-started; prio != PriorityBackground {
+		t.Fatalf("started priority %d second", prio)
+	}
+	l.release(PriorityBackground)
+
+	// background work never uses the reserved slots.
+	l, _ = NewLimiter(2, 1)
+	l.acquire(PriorityBackground)
+	go func() { l.acquire(PriorityBackground); started <- PriorityBackground }()
+	for waiting(PriorityBackground) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	l.acquire(PriorityInteractive) // reserved slot is available
+	l.release(PriorityInteractive)
+	select {
+	case <-started:
+		t.Fatalf("background work used a reserved slot")
+	default:
+	}
+	l.release(PriorityBackground)
+	<-started
+	l.release(PriorityBackground)
+
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	_ = p.SetLimiter(l)
+	hashed, err := p.WithPriority(PriorityBackground).Hash([]byte("password"))
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if err := p.Compare(hashed, []byte("password")); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	if l.running != 0 || l.background != 0 {
+		t.Fatalf("slots leaked: %d running, %d background", l.running, l.background)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	clock := time.Unix(1600000000, 0)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	if _, err := NewRateLimiter(0, 1, nil); err != ErrUnsupported {
+		t.Fatalf("NewRateLimiter: got %v, expected %v", err, ErrUnsupported)
+	}
+
+	r, _ := NewRateLimiter(2, 2, nil)
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	_ = p.SetRateLimiter(r)
+
+	hashed, err := p.Hash([]byte("password"))
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if err := p.Compare(hashed, []byte("password")); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+
+	err = p.Compare(hashed, []byte("password"))
+	busy, ok := err.(*BusyError)
+	if !ok {
+		t.Fatalf("Compare: got %v, expected a *BusyError", err)
+	}
+	if busy.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("RetryAfter: got %v, expected %v", busy.RetryAfter, 500*time.Millisecond)
+	}
+	if !busy.Is(ErrBusy) || busy.Unwrap() != ErrBusy {
+		t.Fatalf("BusyError does not match ErrBusy")
+	}
+
+	clock = clock.Add(busy.RetryAfter)
+	if err := p.Compare(hashed, []byte("password")); err != nil {
+		t.Fatalf("Compare after refill: %v", err)
+	}
+
+	// weighted by work factors, the default profile costs 1 token.
+	if c := WorkCost(&argonCommonParameters); c != 1 {
+		t.Fatalf("WorkCost: got %v, expected 1", c)
+	}
+	r, _ = NewRateLimiter(1, 1, WorkCost)
+	heavy, _ := NewCustom(&Argon2Params{Version: Argon2id, Time: argonCommonParameters.Time * 2, Memory: argonCommonParameters.Memory, Thread: 1, Saltlen: 16, Keylen: 32})
+	_ = heavy.SetRateLimiter(r)
+	if _, ok := r.take(heavy.params); !ok {
+		t.Fatalf("take: a full bucket refused an oversized operation")
+	}
+	if wait, _ := r.take(heavy.params); wait != time.Second {
+		t.Fatalf("take: got %v, expected %v", wait, time.Second)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	clock := time.Unix(1600000000, 0)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	p, _ := NewCustom(&ScryptParams{N: 1 << 12, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	_ = p.SetKey([]byte("0123456789abcdef0123456789abcdef"))
+	fallback := &ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32}
+	if err := p.SetFallback(&argonCommonParameters); err != ErrUnsupported {
+		t.Fatalf("SetFallback: got %v, expected %v", err, ErrUnsupported)
+	}
+	if err := p.SetFallback(fallback); err != nil {
+		t.Fatalf("SetFallback: %v", err)
+	}
+	r, _ := NewRateLimiter(1, 1, nil)
+	_ = p.SetRateLimiter(r)
+
+	normal, err := p.Hash([]byte("password"))
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if Degraded(normal) {
+		t.Fatalf("Hash: degraded within budget: %s", normal)
+	}
+
+	degraded, err := p.Hash([]byte("password"))
+	if err != nil {
+		t.Fatalf("Hash over budget: %v", err)
+	}
+	if !Degraded(degraded) || !bytes.Contains(degraded, []byte("$1024$")) {
+		t.Fatalf("Hash over budget: not degraded: %s", degraded)
+	}
+
+	clock = clock.Add(time.Second)
+	res, err := p.CompareEx(degraded, []byte("password"))
+	if err != nil {
+		t.Fatalf("CompareEx: %v", err)
+	}
+	if !res.NeedsRehash {
+		t.Fatalf("CompareEx: degraded hash does not need rehash")
+	}
+
+	clock = clock.Add(time.Second)
+	if err := p.Compare(degraded, []byte("wrong")); err != ErrMismatch {
+		t.Fatalf("Compare: got %v, expected %v", err, ErrMismatch)
+	}
+
+	// no fallback, overload is reported.
+	_ = p.SetFallback(nil)
+	if _, err := p.Hash([]byte("password")); err == nil || !err.(*BusyError).Is(ErrBusy) {
+		t.Fatalf("Hash without fallback: got %v, expected ErrBusy", err)
+	}
+}
+
+func TestStatsHook(t *testing.T) {
+	var stats []Stats
+
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	_ = p.SetStatsHook(func(st Stats) { stats = append(stats, st) })
+
+	hashed, err := p.Hash([]byte("password"))
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if err := p.Compare(hashed, []byte("password")); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+
+	if len(stats) != 2 || stats[0].Op != "hash" || stats[1].Op != "compare" {
+		t.Fatalf("stats: %+v", stats)
+	}
+	for _, st := range stats {
+		if st.Algorithm != idScrypt || st.Wall <= 0 || st.Memory != 128*8*(1<<10+3) {
+			t.Fatalf("stats: %+v", st)
+		}
+	}
+	if mem := paramsMemory(&argonCommonParameters); mem != uint64(argonCommonParameters.Memory)*1024 {
+		t.Fatalf("paramsMemory: %d", mem)
+	}
+}
+
+func TestReliefBcryptTier(t *testing.T) {
+	p, _ := NewCustom(&argonCommonParameters)
+	p.SetKey([]byte("secret"))
+	if err := p.SetServerTier(TierBcrypt, 3); err != ErrUnsupported {
+		t.Fatalf("SetServerTier: got %v, expected %v", err, ErrUnsupported)
+	}
+	if err := p.SetServerTier(TierBcrypt, bcrypt.MinCost); err != nil {
+		t.Fatalf("SetServerTier: %v", err)
+	}
+
+	// constrained client: 4MiB and a single lane.
+	cp, err := p.NegotiateClientParams(ClientCapabilities{MaxMemory: 4096, MaxThreads: 1}, nil)
+	if err != nil {
+		t.Fatalf("NegotiateClientParams: %v", err)
+	}
+	if cp.Memory != 4096 || cp.Thread != 1 || uint64(cp.Time)*uint64(cp.Memory) < uint64(argonCommonParameters.Time)*uint64(argonCommonParameters.Memory) {
+		t.Fatalf("NegotiateClientParams: %+v", cp)
+	}
+
+	ck, err := ClientHash(cp, []byte("prout"))
+	if err != nil {
+		t.Fatalf("ClientHash: %v", err)
+	}
+	hashed, err := p.Finalize(cp, ck)
+	if err != nil {
+		t.Fatalf("Finalize: %v", err)
+	}
+	if !bytes.Contains(hashed, []byte("$2a$04$")) {
+		t.Fatalf("Finalize: %s", hashed)
+	}
+
+	cp2, err := ClientParamsFromHash(hashed)
+	if err != nil || cp2.Time != cp.Time || cp2.Memory != cp.Memory || !bytes.Equal(cp2.Salt, cp.Salt) {
+		t.Fatalf("ClientParamsFromHash: %+v, %v", cp2, err)
+	}
+
+	// the tier setting does not matter to compare.
+	_ = p.SetServerTier(TierHMAC, 0)
+	if err := p.CompareFinalized(hashed, ck); err != nil {
+		t.Fatalf("CompareFinalized: %v", err)
+	}
+	bad, _ := ClientHash(cp2, []byte("proutt"))
+	if err := p.CompareFinalized(hashed, bad); err != ErrMismatch {
+		t.Fatalf("CompareFinalized: got %v, expected %v", err, ErrMismatch)
+	}
+
+	sp, _ := NewCustom(&ScryptParams{N: 1 << 14, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	cp, err = sp.NegotiateClientParams(ClientCapabilities{MaxMemory: 4096}, nil)
+	if err != nil || cp.N != 1<<12 || cp.P != 4 {
+		t.Fatalf("NegotiateClientParams: %+v, %v", cp, err)
+	}
+	if _, err := p.NegotiateClientParams(ClientCapabilities{MaxMemory: 4, MaxThreads: 1}, nil); err != ErrUnsupported {
+		t.Fatalf("NegotiateClientParams: got %v, expected %v", err, ErrUnsupported)
+	}
+}
+
+func TestChallengeVerifier(t *testing.T) {
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+
+	v, err := p.NewChallengeVerifier([]byte("prout"))
+	if err != nil {
+		t.Fatalf("NewChallengeVerifier: %v", err)
+	}
+	stored, err := v.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText: %v", err)
+	}
+
+	var sv ChallengeVerifier
+	if err := sv.UnmarshalText(stored); err != nil {
+		t.Fatalf("UnmarshalText: %v", err)
+	}
+	cp, err := ClientParamsFromHash(stored)
+	if err != nil || !bytes.Equal(cp.Salt, v.Params.Salt) {
+		t.Fatalf("ClientParamsFromHash: %+v, %v", cp, err)
+	}
+
+	nonce, _ := NewChallenge()
+	msg := append(nonce, "user@example.com"...)
+
+	proof, expected, err := ChallengeProof(cp, []byte("prout"), msg)
+	if err != nil {
+		t.Fatalf("ChallengeProof: %v", err)
+	}
+	signature, err := sv.Verify(msg, proof)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !bytes.Equal(signature, expected) {
+		t.Fatalf("Verify: server signature mismatch")
+	}
+
+	// the proof is bound to the auth message and the password.
+	if _, err := sv.Verify(append(msg, 'x'), proof); err != ErrMismatch {
+		t.Fatalf("Verify: got %v, expected %v", err, ErrMismatch)
+	}
+	proof, _, _ = ChallengeProof(cp, []byte("proutt"), msg)
+	if _, err := sv.Verify(msg, proof); err != ErrMismatch {
+		t.Fatalf("Verify: got %v, expected %v", err, ErrMismatch)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	key := []byte("0123456789abcdef")
+
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	_ = p.SetTimestamp(true)
+	hashed, _ := p.Hash([]byte("password"))
+
+	if _, err := Redact(key[:8], hashed); err != ErrSecretTooShort {
+		t.Fatalf("Redact: got %v, expected %v", err, ErrSecretTooShort)
+	}
+
+	r, err := Redact(key, hashed)
+	if err != nil {
+		t.Fatalf("Redact: %v", err)
+	}
+	sp, ok := r.Params.(*ScryptParams)
+	if r.Algorithm != idScrypt || !ok || sp.N != 1<<10 || r.Metadata[metaTimestamp] == "" {
+		t.Fatalf("Redact: %+v", r)
+	}
+	if strings.Contains(string(hashed), r.Fingerprint) {
+		t.Fatalf("Redact: fingerprint is part of the hash")
+	}
+
+	// duplicates share a fingerprint, locking is reported.
+	dup, _ := Redact(key, hashed)
+	locked, _ := Redact(key, Lock(hashed))
+	other, _ := Redact(key, append([]byte{}, hashed...)[:len(hashed)-1])
+	if dup.Fingerprint != r.Fingerprint || other.Fingerprint == r.Fingerprint {
+		t.Fatalf("Redact: fingerprints %s %s %s", r.Fingerprint, dup.Fingerprint, other.Fingerprint)
+	}
+	if !locked.Locked || locked.Algorithm != idScrypt {
+		t.Fatalf("Redact: %+v", locked)
+	}
+
+	masked, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32, Masked: true})
+	_ = masked.SetKey(key)
+	hashed, _ = masked.Hash([]byte("password"))
+	if r, err := Redact(key, hashed); err != nil || !r.Masked || r.Params != nil {
+		t.Fatalf("Redact: %+v, %v", r, err)
+	}
+}
+
+func TestSuiteAddLegacy(t *testing.T) {
+	preferred, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	s, _ := NewSuite(preferred, PHCVerifier)
+
+	var tried []string
+	legacy := func(name string, accept bool) Verifier {
+		return Named(name, VerifierFunc(func(hashed, password []byte) error {
+			tried = append(tried, name)
+			if accept {
+				return nil
+			}
+			return ErrMismatch
+		}))
+	}
+	if err := s.AddLegacy(nil, 0); err != ErrUnsupported {
+		t.Fatalf("AddLegacy: got %v, expected %v", err, ErrUnsupported)
+	}
+	_ = s.AddLegacy(legacy("django", true), 20)
+	_ = s.AddLegacy(legacy("ntlm", false), 10)
+	_ = s.AddLegacy(legacy("phpass", false), -1)
+
+	v, err := s.VerifyEx([]byte("$P$legacy"), []byte("password"))
+	if err != nil {
+		t.Fatalf("VerifyEx: %v", err)
+	}
+	if v.VerifiedBy != "django" || !v.NeedsRehash {
+		t.Fatalf("VerifyEx: %+v", v)
+	}
+	if strings.Join(tried, ",") != "phpass,ntlm,django" {
+		t.Fatalf("tried: %v", tried)
+	}
+
+	hashed, _ := s.Hash([]byte("password"))
+	v, err = s.VerifyEx(hashed, []byte("password"))
+	if err != nil || v.VerifiedBy != VerifiedByPreferred || v.NeedsRehash {
+		t.Fatalf("VerifyEx: %+v, %v", v, err)
+	}
+
+	phc, _ := Reencode(hashed, FormatPHC)
+	s, _ = NewSuite(preferred, PHCVerifier)
+	_ = s.AddLegacy(VerifierFunc(func(hashed, password []byte) error { return ErrMismatch }), 0)
+	if v, err := s.VerifyEx(phc, []byte("password")); err != nil || v.VerifiedBy != "phc" {
+		t.Fatalf("VerifyEx: %+v, %v", v, err)
+	}
+	if v, _ := s.VerifyEx(phc, []byte("wrong")); v.VerifiedBy != "" {
+		t.Fatalf("VerifyEx: %+v", v)
+	}
+	if s.verifiers[1].name != "legacy1" {
+		t.Fatalf("unnamed verifier: %q", s.verifiers[1].name)
+	}
+}
+
+func TestDomain(t *testing.T) {
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	accounts := p.WithDomain("accounts.example.com")
+
+	hashed, err := accounts.Hash([]byte("password"))
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if !bytes.Contains(hashed, []byte(metaDomain+"="+domainTag("accounts.example.com"))) {
+		t.Fatalf("Hash: domain not recorded: %s", hashed)
+	}
+	if err := accounts.Compare(hashed, []byte("password")); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+
+	for i, v := range []Verifier{p, p.WithDomain("shop.example.com"), NativeVerifier} {
+		if err := v.Compare(hashed, []byte("password")); err != ErrMismatch {
+			t.Fatalf("test #%d: got %v, expected %v", i, err, ErrMismatch)
+		}
+	}
+
+	// the domain is folded into the derivation, not only recorded.
+	forged := bytes.Replace(hashed, []byte(domainTag("accounts.example.com")), []byte(domainTag("shop.example.com")), 1)
+	if err := p.WithDomain("shop.example.com").Compare(forged, []byte("password")); err != ErrMismatch {
+		t.Fatalf("forged: got %v, expected %v", err, ErrMismatch)
+	}
+}
+
+func TestDeployment(t *testing.T) {
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	if err := p.SetDeployment(Deployment{Environment: "production"}); err != ErrUnsupported {
+		t.Fatalf("SetDeployment: got %v, expected %v", err, ErrUnsupported)
+	}
+
+	prod := Deployment{Service: "accounts", Environment: "production"}
+	_ = p.SetDeployment(prod)
+	hashed, err := p.Hash([]byte("password"))
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if err := p.Compare(hashed, []byte("password")); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+
+	// the associated data stacks on the deployment binding.
+	if err := p.WithAssociatedData([]byte("user42")).Compare(hashed, []byte("password")); err != ErrMismatch {
+		t.Fatalf("Compare with ad: got %v, expected %v", err, ErrMismatch)
+	}
+
+	for i, d := range []Deployment{
+		{Service: "accounts", Environment: "staging"},
+		{Service: "accounts", Environment: "production", Host: "db1"},
+		{Service: "accountsproduction"},
+		{},
+	} {
+		other, _ := p.WithDeployment(d)
+		if err := other.Compare(hashed, []byte("password")); err != ErrMismatch {
+			t.Fatalf("test #%d: got %v, expected %v", i, err, ErrMismatch)
+		}
+	}
+
+	other, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	other, _ = other.WithDeployment(prod)
+	if err := other.Compare(hashed, []byte("password")); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+}
+
+type stuckReader byte
+
+func (s stuckReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = byte(s)
+	}
+	return len(b), nil
+}
+
+func TestEntropy(t *testing.T) {
+	if err := CheckEntropy(); err != nil {
+		t.Fatalf("CheckEntropy: %v", err)
+	}
+
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	bp, _ := New(BcryptDefault)
+
+	randReader = stuckReader(0)
+	defer func() { randReader = rand.Reader }()
+
+	// salts fail closed even before a check.
+	if _, err := p.Hash([]byte("password")); err != ErrEntropy {
+		t.Fatalf("Hash: got %v, expected %v", err, ErrEntropy)
+	}
+	if _, err := bp.Hash([]byte("password")); err != ErrEntropy {
+		t.Fatalf("bcrypt Hash: got %v, expected %v", err, ErrEntropy)
+	}
+
+	// a failed check keeps failing closed, even if the source recovers.
+	randReader = io.MultiReader(bytes.NewReader(make([]byte, entropySampleLen)), rand.Reader)
+	if err := CheckEntropy(); err != ErrEntropy {
+		t.Fatalf("CheckEntropy: got %v, expected %v", err, ErrEntropy)
+	}
+	if _, err := p.Hash([]byte("password")); err != ErrEntropy {
+		t.Fatalf("Hash: got %v, expected %v", err, ErrEntropy)
+	}
+
+	randReader = rand.Reader
+	if err := CheckEntropy(); err != nil {
+		t.Fatalf("CheckEntropy: %v", err)
+	}
+	if _, err := p.Hash([]byte("password")); err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+}
+
+func TestCompareDuration(t *testing.T) {
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	hashed, _ := p.Hash([]byte("password"))
+
+	if err := p.SetCompareDuration(-time.Second); err != ErrUnsupported {
+		t.Fatalf("SetCompareDuration: got %v, expected %v", err, ErrUnsupported)
+	}
+	_ = p.SetCompareDuration(50 * time.Millisecond)
+
+	for i, test := range []struct {
+		hashed []byte
+		want   error
+	}{
+		{hashed, nil},
+		{[]byte("$garbage"), ErrParse},
+		{Lock(hashed), ErrLocked},
+	} {
+		start := time.Now()
+		err := p.Compare(test.hashed, []byte("password"))
+		if err != test.want && !isError(err, test.want) {
+			t.Fatalf("test #%d: got %v, expected %v", i, err, test.want)
+		}
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Fatalf("test #%d: returned after %v", i, elapsed)
+		}
+	}
+}
+
+func TestSecretShares(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	if _, err := SplitSecret(secret, 1, 3); err != ErrUnsupported {
+		t.Fatalf("SplitSecret: got %v, expected %v", err, ErrUnsupported)
+	}
+	shares, err := SplitSecret(secret, 3, 5)
+	if err != nil {
+		t.Fatalf("SplitSecret: %v", err)
+	}
+
+	reference, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	_ = reference.SetSecret(secret)
+	hashed, _ := reference.Hash([]byte("password"))
+
+	for i, test := range []struct {
+		shares [][]byte
+		want   error
+	}{
+		{[][]byte{shares[0], shares[1], shares[2]}, nil},
+		{[][]byte{shares[4], shares[2], shares[0]}, nil},
+		{[][]byte{shares[1], shares[3], shares[4], shares[0]}, nil},
+		{[][]byte{shares[0], shares[1]}, ErrShares},
+		{[][]byte{shares[0], shares[1], shares[1]}, ErrShares},
+		{[][]byte{shares[0], shares[1], shares[2], append([]byte{3, 4}, make([]byte, len(secret))...)}, ErrShares},
+	} {
+		p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+		err := p.SetSecretShares(test.shares...)
+		if err != test.want {
+			t.Fatalf("test #%d: got %v, expected %v", i, err, test.want)
+		}
+		if err == nil {
+			if err := p.Compare(hashed, []byte("password")); err != nil {
+				t.Fatalf("test #%d: Compare: %v", i, err)
+			}
+		}
+	}
+
+	// k-1 shares say nothing: every secret byte is still possible.
+	if bytes.Equal(interpolate(shares[:2], 0), secret) {
+		t.Fatalf("2 shares reconstructed the secret")
+	}
+	if gfMul(gfDiv(0x53, 0xca), 0xca) != 0x53 || gfMul(0x53, 0xca) != 0x01 {
+		t.Fatalf("GF(2^8) arithmetic")
+	}
+}
+
+func TestProgress(t *testing.T) {
+	for i, params := range []interface{}{
+		&ScryptParams{N: 1 << 10, R: 8, P: 2, Saltlen: 16, Keylen: 32},
+		&Argon2Params{Version: Argon2id, Time: 2, Memory: 64, Thread: 2, Saltlen: 16, Keylen: 32},
+	} {
+		p, _ := NewCustom(params)
+		reference, _ := p.Hash([]byte("password"))
+
+		var steps, last, final int
+		err := p.SetProgress(func(done, total int) {
+			if done <= last || done > total {
+				t.Fatalf("test #%d: progress %d/%d after %d", i, done, total, last)
+			}
+			steps, last, final = steps+1, done, total
+		})
+		if err != nil {
+			t.Fatalf("test #%d: SetProgress: %v", i, err)
+		}
+
+		if err := p.Compare(reference, []byte("password")); err != nil {
+			t.Fatalf("test #%d: Compare: %v", i, err)
+		}
+		if last != final || steps < 8 {
+			t.Fatalf("test #%d: %d steps, ended at %d/%d", i, steps, last, final)
+		}
+	}
+
+	bp, _ := New(BcryptDefault)
+	if err := bp.SetProgress(func(int, int) {}); err != ErrUnsupported {
+		t.Fatalf("bcrypt SetProgress: got %v, expected %v", err, ErrUnsupported)
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	params := &Argon2Params{Version: Argon2id, Time: 1, Memory: 1024, Thread: 1, Saltlen: 16, Keylen: 32}
+	p, _ := NewCustom(params)
+	b := NewMemoryBudget(1536 << 10)
+	_ = p.SetMemoryBudget(b)
+
+	if err := p.CanHash(); err != nil {
+		t.Fatalf("CanHash: %v", err)
+	}
+	release, err := p.Reserve()
+	if err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if b.Available() != 512<<10 {
+		t.Fatalf("Available: %d", b.Available())
+	}
+
+	if err := p.CanHash(); err != ErrBusy {
+		t.Fatalf("CanHash: got %v, expected %v", err, ErrBusy)
+	}
+	if _, err := p.Hash([]byte("password")); err != ErrBusy {
+		t.Fatalf("Hash: got %v, expected %v", err, ErrBusy)
+	}
+
+	// the fallback fits the budget left.
+	_ = p.SetFallback(&Argon2Params{Version: Argon2id, Time: 2, Memory: 256, Thread: 1, Saltlen: 16, Keylen: 32})
+	hashed, err := p.Hash([]byte("password"))
+	if err != nil || !Degraded(hashed) {
+		t.Fatalf("Hash: %s, %v", hashed, err)
+	}
+
+	release()
+	release()
+	if b.Available() != 1536<<10 {
+		t.Fatalf("Available: %d", b.Available())
+	}
+	hashed, err = p.Hash([]byte("password"))
+	if err != nil || Degraded(hashed) {
+		t.Fatalf("Hash: %s, %v", hashed, err)
+	}
+	if err := p.Compare(hashed, []byte("password")); err != nil || b.Available() != 1536<<10 {
+		t.Fatalf("Compare: %v, %d available", err, b.Available())
+	}
+}
+
+func TestVectors(t *testing.T) {
+	profiles := []HashProfile{Argon2idDefault, ScryptDefault, BcryptDefault}
+
+	vectors, err := GenerateVectors(profiles...)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if len(vectors) != 9 {
+		t.Fatalf("generate: %d vectors, expected 9", len(vectors))
+	}
+
+	err = CheckVectors(vectors)
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+
+	again, err := GenerateVectors(profiles...)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	for i := range vectors {
+		if vectors[i] != again[i] {
+			t.Fatalf("vector %s is not reproducible", vectors[i].Name)
+		}
+	}
+
+	// a changed hash must be reported.
+	vectors[1].Hash = strings.Replace(vectors[1].Hash, "m=65536", "m=65537", 1)
+	err = CheckVectors(vectors)
+	if verr, ok := err.(*VectorError); !ok || verr.Name != vectors[1].Name {
+		t.Fatalf("check: unexpected %v", err)
+	}
+
+	_, err = GenerateVectors(BcryptCustom)
+	if err != ErrUnsupported {
+		t.Fatalf("generate custom: unexpected %v", err)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	err := SelfTest()
+	if err != nil {
+		t.Fatalf("SelfTest: %v", err)
+	}
+
+	p, err := NewCustom(&Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+	if err != nil {
+		t.Fatalf("NewCustom: %v", err)
+	}
+	hashed, err := p.Hash([]byte("password"))
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	// a broken backend.
+	defer func(f func(int, []byte, []byte, []byte, []byte, uint32, uint32, uint8, uint32) []byte) {
+		argon2Key = f
+		selfTestFailed = 0
+	}(argon2Key)
+	argon2Key = func(mode int, password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+		return make([]byte, keyLen)
+	}
+
+	err = SelfTest()
+	if err != ErrSelfTest {
+		t.Fatalf("SelfTest: unexpected %v", err)
+	}
+	if _, err = p.Hash([]byte("password")); err != ErrSelfTest {
+		t.Fatalf("Hash: unexpected %v", err)
+	}
+	if err = p.Compare(hashed, []byte("password")); err != ErrSelfTest {
+		t.Fatalf("Compare: unexpected %v", err)
+	}
+	if _, err = p.Derive([]byte("password"), make([]byte, 16)); err != ErrSelfTest {
+		t.Fatalf("Derive: unexpected %v", err)
+	}
+}
+
+func TestPinned(t *testing.T) {
+	profile, minLength := Pinned()
+	if profile != Argon2idDefault || minLength != 0 {
+		t.Fatalf("Pinned: unexpected %v %d", profile, minLength)
+	}
+
+	defer func() { pinnedProfile, pinnedMinLength = Argon2idDefault, 0 }()
+	pinnedProfile, pinnedMinLength = ScryptDefault, 8
+
+	p, err := Default()
+	if err != nil {
+		t.Fatalf("Default: %v", err)
+	}
+	if _, ok := p.params.(*ScryptParams); !ok {
+		t.Fatalf("Default: unexpected %T params", p.params)
+	}
+
+	// a lower runtime minimum does not lower the pinned one.
+	p, _ = NewCustom(&Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+	p.SetMinLength(4)
+	if _, err = p.Hash([]byte("short")); err != ErrPasswordTooShort {
+		t.Fatalf("Hash: unexpected %v", err)
+	}
+	if _, err = p.Hash(nil); err != ErrPasswordEmpty {
+		t.Fatalf("Hash: unexpected %v", err)
+	}
+	if _, err = p.Hash([]byte("longenough")); err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+}
+
+func TestRiskTier(t *testing.T) {
+	base := &Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32, Masked: true}
+	high := &Argon2Params{Version: Argon2id, Time: 2, Memory: 128, Thread: 1, Saltlen: 16, Keylen: 32, Masked: true}
+
+	p, err := NewCustom(base)
+	if err != nil {
+		t.Fatalf("NewCustom: %v", err)
+	}
+	if err = p.SetRiskTier(2, high); err != nil {
+		t.Fatalf("SetRiskTier: %v", err)
+	}
+	if err = p.SetRiskTier(0, high); err != ErrUnsupported {
+		t.Fatalf("SetRiskTier: unexpected %v", err)
+	}
+	if err = p.SetRiskTier(1, &ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32}); err != ErrUnsupported {
+		t.Fatalf("SetRiskTier: unexpected %v", err)
+	}
+
+	// tier 3 is not configured, the tier 2 parameters apply.
+	hashed, err := p.WithRiskTier(3).Hash([]byte("password"))
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if RiskTier(hashed) != 2 {
+		t.Fatalf("RiskTier: unexpected %d in %s", RiskTier(hashed), hashed)
+	}
+	if err = p.Compare(hashed, []byte("password")); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+
+	// masked, the tier parameters were used.
+	q, _ := NewCustom(base)
+	if err = q.Compare(hashed, []byte("password")); err != ErrMismatch {
+		t.Fatalf("Compare without tiers: unexpected %v", err)
+	}
+
+	low, err := p.Hash([]byte("password"))
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if RiskTier(low) != 0 {
+		t.Fatalf("RiskTier: unexpected %d", RiskTier(low))
+	}
+
+	r, err := p.WithRiskTier(2).CompareEx(low, []byte("password"))
+	if err != nil || !r.NeedsRehash {
+		t.Fatalf("CompareEx: unexpected %v %+v", err, r)
+	}
+	r, err = p.CompareEx(hashed, []byte("password"))
+	if err != nil || r.NeedsRehash || r.Params.(*Argon2Params).Time != 2 {
+		t.Fatalf("CompareEx: unexpected %v %+v", err, r)
+	}
+
+	if err = p.SetRiskTier(2, nil); err != nil {
+		t.Fatalf("SetRiskTier: %v", err)
+	}
+	if err = p.Compare(hashed, []byte("password")); err != ErrMismatch {
+		t.Fatalf("Compare removed tier: unexpected %v", err)
+	}
+}
+
+func TestCredentialRecord(t *testing.T) {
+	// cheap "paranoid" parameters.
+	defer func(v interface{}) { params[ScryptParanoid] = v }(params[ScryptParanoid])
+	params[ScryptParanoid] = ScryptParams{N: 1 << 11, R: 8, P: 1, Saltlen: 16, Keylen: 32}
+
+	p, err := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	if err != nil {
+		t.Fatalf("NewCustom: %v", err)
+	}
+
+	// the account moves to the paranoid parameters.
+	rec := CredentialRecord{}
+	if err = p.HashRecord(&rec, []byte("password")); err != nil {
+		t.Fatalf("HashRecord: %v", err)
+	}
+	rec.Profile = "scrypt-paranoid"
+
+	r, err := p.CompareRecord(&rec, []byte("password"))
+	if err != nil || !r.NeedsRehash {
+		t.Fatalf("CompareRecord: unexpected %v %+v", err, r)
+	}
+	if err = p.HashRecord(&rec, []byte("password")); err != nil {
+		t.Fatalf("HashRecord: %v", err)
+	}
+	parsed, err := parseFromHashToParams([]byte(rec.Hash))
+	if err != nil || parsed.(*ScryptParams).N != 1<<11 {
+		t.Fatalf("HashRecord: unexpected %v %s", err, rec.Hash)
+	}
+
+	r, err = p.CompareRecord(&rec, []byte("password"))
+	if err != nil || r.NeedsRehash {
+		t.Fatalf("CompareRecord: unexpected %v %+v", err, r)
+	}
+	if _, err = p.CompareRecord(&rec, []byte("wrong")); err != ErrMismatch {
+		t.Fatalf("CompareRecord: unexpected %v", err)
+	}
+
+	for _, name := range []string{"argon2id-default", "unknown"} {
+		rec.Profile = name
+		if _, err = p.CompareRecord(&rec, []byte("password")); err != ErrUnsupported {
+			t.Fatalf("CompareRecord %s: unexpected %v", name, err)
+		}
+	}
+}
+
+func TestDualWrite(t *testing.T) {
+	legacy, _ := NewCustom(&BcryptParams{Cost: 4})
+	current, _ := NewCustom(&Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+	d := DualWrite{Legacy: legacy, Current: current}
+
+	lh, ch, err := d.RehashPair([]byte("password"))
+	if err != nil {
+		t.Fatalf("RehashPair: %v", err)
+	}
+	if err = bcrypt.CompareHashAndPassword(lh, []byte("password")); err != nil {
+		t.Fatalf("legacy hash: %v", err)
+	}
+
+	for _, hashed := range [][]byte{lh, ch} {
+		if err = d.Compare(hashed, []byte("password")); err != nil {
+			t.Fatalf("Compare %s: %v", hashed, err)
+		}
+		if err = d.Compare(hashed, []byte("wrong")); err != ErrMismatch {
+			t.Fatalf("Compare %s: unexpected %v", hashed, err)
+		}
+	}
+
+	// none or both.
+	current.SetMinLength(16)
+	if lh, ch, err = d.RehashPair([]byte("password")); err != ErrPasswordTooShort || lh != nil || ch != nil {
+		t.Fatalf("RehashPair: unexpected %v", err)
+	}
+}
+
+func TestTruncationPolicy(t *testing.T) {
+	long := []byte(strings.Repeat("a", 72) + "tail")
+	other := []byte(strings.Repeat("a", 72) + "other")
+
+	p, _ := NewCustom(&BcryptParams{Cost: 4})
+	if _, err := p.Hash(long); err != ErrPasswordTooLong {
+		t.Fatalf("Hash: unexpected %v", err)
+	}
+
+	// another system truncated the password.
+	legacy, _ := bcrypt.GenerateFromPassword(long[:72], 4)
+	if err := p.Compare(legacy, long); err != ErrMismatch {
+		t.Fatalf("Compare: unexpected %v", err)
+	}
+	if err := p.SetTruncationPolicy(TruncateLegacy); err != nil {
+		t.Fatalf("SetTruncationPolicy: %v", err)
+	}
+	if err := p.Compare(legacy, long); err != nil {
+		t.Fatalf("Compare legacy: %v", err)
+	}
+
+	if err := p.SetTruncationPolicy(TruncatePreHash); err != nil {
+		t.Fatalf("SetTruncationPolicy: %v", err)
+	}
+	hashed, err := p.Hash(long)
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if err = p.Compare(hashed, long); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	if err = p.Compare(hashed, other); err != ErrMismatch {
+		t.Fatalf("Compare: unexpected %v", err)
+	}
+	if err = Compare(hashed, long); err != ErrMismatch {
+		t.Fatalf("Compare flagged: unexpected %v", err)
+	}
+
+	a, _ := NewCustom(&Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+	if err = a.SetTruncationPolicy(TruncatePreHash); err != ErrUnsupported {
+		t.Fatalf("SetTruncationPolicy: unexpected %v", err)
+	}
+}
+
+func TestScryptPresets(t *testing.T) {
+	for name, ln := range map[string]int{ScryptInteractive: 15, ScryptSensitive: 17, ScryptFileEncryption: 20} {
+		params, err := ScryptPreset(name)
+		if err != nil {
+			t.Fatalf("ScryptPreset %s: %v", name, err)
+		}
+		s, err := FormatScryptParams(params)
+		if err != nil || s != fmt.Sprintf("ln=%d,r=8,p=1", ln) {
+			t.Fatalf("FormatScryptParams %s: unexpected %q %v", name, s, err)
+		}
+		parsed, err := ParseScryptParams(s)
+		if err != nil || !sameParams(parsed, params) {
+			t.Fatalf("ParseScryptParams %s: unexpected %+v %v", s, parsed, err)
+		}
+	}
+
+	// a copy.
+	params, _ := ScryptPreset(ScryptInteractive)
+	params.N = 2
+	if params, _ = ScryptPreset(ScryptInteractive); params.N != 1<<15 {
+		t.Fatalf("ScryptPreset: modified preset")
+	}
+	if _, err := ScryptPreset("unknown"); err != ErrUnsupported {
+		t.Fatalf("ScryptPreset: unexpected %v", err)
+	}
+
+	for _, n := range []uint32{0, 1, 3, 1000} {
+		if _, err := ScryptLogN(n); err != ErrUnsupported {
+			t.Fatalf("ScryptLogN %d: unexpected %v", n, err)
+		}
+	}
+	for _, ln := range []int{0, 32} {
+		if _, err := ScryptN(ln); err != ErrUnsupported {
+			t.Fatalf("ScryptN %d: unexpected %v", ln, err)
+		}
+	}
+	for _, s := range []string{"ln=0,r=8,p=1", "n=16,r=8,p=1", "ln=32,r=8,p=1", "ln=16,r=8"} {
+		if _, err := ParseScryptParams(s); err != ErrParse {
+			t.Fatalf("ParseScryptParams %s: unexpected %v", s, err)
+		}
+	}
+}
+
+func TestTryRepair(t *testing.T) {
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	hashed, err := p.Hash([]byte("password"))
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	phc, _ := Reencode(hashed, FormatPHC)
+	bc, _ := bcrypt.GenerateFromPassword([]byte("password"), 4)
+
+	padded := append(append([]byte{}, phc...), "=="...)
+	b64 := base64.StdEncoding.EncodeToString(hashed)
+
+	for i, test := range []struct {
+		stored   []byte
+		expected []byte
+		problems []string
+	}{
+		{hashed, hashed, nil},
+		{bc, bc, nil},
+		{append(append([]byte{}, hashed...), "\r\n"...), hashed, []string{ProblemWhitespace}},
+		{[]byte(`"` + string(bc) + `"  `), bc, []string{ProblemWhitespace, ProblemQuoted}},
+		{[]byte(url.QueryEscape(string(phc))), phc, []string{ProblemURLEncoded}},
+		{[]byte(url.PathEscape(string(phc))), phc, []string{ProblemURLEncoded}},
+		{[]byte(b64), hashed, []string{ProblemBase64}},
+		{[]byte(hex.EncodeToString(bc)), bc, []string{ProblemHex}},
+		{padded, phc, []string{ProblemPadding}},
+		{[]byte(strconv.Quote(b64) + "\n"), hashed, []string{ProblemWhitespace, ProblemQuoted, ProblemBase64}},
+	} {
+		r, err := TryRepair(test.stored)
+		if err != nil {
+			t.Fatalf("test #%d: TryRepair: %v", i, err)
+		}
+		if !bytes.Equal(r.Repaired, test.expected) || fmt.Sprint(r.Problems) != fmt.Sprint(test.problems) {
+			t.Fatalf("test #%d: unexpected %s %v", i, r.Repaired, r.Problems)
+		}
+		compare := Compare
+		if isPHC(r.Repaired) {
+			compare = comparePHC
+		}
+		if err = compare(r.Repaired, []byte("password")); err != nil {
+			t.Fatalf("test #%d: Compare: %v", i, err)
+		}
+	}
+
+	for i, test := range []struct {
+		stored  []byte
+		problem string
+	}{
+		{hashed[:len(hashed)-4], ProblemTruncated},
+		{append(bc[:50:50], '\n'), ProblemTruncated},
+		{[]byte("not a hash"), ProblemUnknown},
+	} {
+		r, err := TryRepair(test.stored)
+		if err != ErrCorrupted || r.Repaired != nil || r.Problems[len(r.Problems)-1] != test.problem {
+			t.Fatalf("test #%d: unexpected %v %+v", i, err, r)
+		}
+	}
+}
+
+func TestJournal(t *testing.T) {
+	var buf bytes.Buffer
+	var events []JournalEvent
+
+	p, _ := NewCustom(&Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+	hashed, _ := p.Hash([]byte("password"))
+
+	j := MultiJournal(NewJSONJournal(&buf), JournalFunc(func(e JournalEvent) error {
+		events = append(events, e)
+		return nil
+	}))
+	if err := p.SetJournal(j); err != nil {
+		t.Fatalf("SetJournal: %v", err)
+	}
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	if err := p.SetKey(secret); err != nil {
+		t.Fatalf("SetKey: %v", err)
+	}
+	p.Compare(hashed, []byte("wrong"))
+
+	// the unkey'ed hash is upgraded.
+	p.params.(*Argon2Params).Time = 2
+	p.SetKey(nil)
+	rehashed, err := p.Rehash(hashed, []byte("password"))
+	if err != nil || rehashed == nil {
+		t.Fatalf("Rehash: unexpected %v", err)
+	}
+	if _, err = p.Hash([]byte("password")); err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	expected := []struct{ event, keyID, result string }{
+		{JournalSecretRotation, KeyID(secret), "ok"},
+		{JournalVerify, KeyID(secret), ErrMismatch.Error()},
+		{JournalSecretRotation, "", "ok"},
+		{JournalVerify, "", "ok"},
+		{JournalRehash, "", "ok"},
+		{JournalHash, "", "ok"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("journal: %d events, expected %d: %+v", len(events), len(expected), events)
+	}
+	for i, e := range expected {
+		if events[i].Event != e.event || events[i].KeyID != e.keyID || events[i].Result != e.result || events[i].Algorithm != idArgon2id {
+			t.Fatalf("event #%d: unexpected %+v", i, events[i])
+		}
+	}
+	if n := strings.Count(buf.String(), "\n"); n != len(expected) {
+		t.Fatalf("json journal: %d lines", n)
+	}
+
+	// fail closed.
+	p.SetJournal(JournalFunc(func(e JournalEvent) error { return io.ErrShortWrite }))
+	if h, err := p.Hash([]byte("password")); err != io.ErrShortWrite || h != nil {
+		t.Fatalf("Hash: unexpected %v", err)
+	}
+	if err := p.Compare(rehashed, []byte("password")); err != io.ErrShortWrite {
+		t.Fatalf("Compare: unexpected %v", err)
+	}
+}
+
+func TestShredder(t *testing.T) {
+	p, _ := NewCustom(&Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+	keys := NewMemoryKeyStore()
+	s := Shredder{Profile: p, Keys: keys}
+
+	hashed, err := s.Hash([]byte("alice"), []byte("password"))
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if err = s.Compare([]byte("alice"), hashed, []byte("password")); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	if err = s.Compare([]byte("alice"), hashed, []byte("wrong")); err != ErrMismatch {
+		t.Fatalf("Compare: unexpected %v", err)
+	}
+
+	// another user key, or none.
+	s.Hash([]byte("bob"), []byte("password"))
+	if err = s.Compare([]byte("bob"), hashed, []byte("password")); err != ErrMismatch {
+		t.Fatalf("Compare bob: unexpected %v", err)
+	}
+	if err = p.Compare(hashed, []byte("password")); err != ErrMismatch {
+		t.Fatalf("Compare without key: unexpected %v", err)
+	}
+
+	// the key is reused.
+	key, _ := keys.Get([]byte("alice"))
+	again, _ := s.Hash([]byte("alice"), []byte("password"))
+	if k, _ := keys.Get([]byte("alice")); !bytes.Equal(k, key) {
+		t.Fatalf("Hash: user key replaced")
+	}
+	if err = s.Compare([]byte("alice"), again, []byte("password")); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+
+	if err = s.Shred([]byte("alice")); err != nil {
+		t.Fatalf("Shred: %v", err)
+	}
+	if err = s.Compare([]byte("alice"), hashed, []byte("password")); err != ErrNoUserKey {
+		t.Fatalf("Compare shredded: unexpected %v", err)
+	}
+	if !bytes.Equal(key, make([]byte, UserKeyLength)) {
+		t.Fatalf("Shred: key not wiped")
+	}
+}
+
+func TestUserPepper(t *testing.T) {
+	m1 := []byte("0123456789abcdef0123456789abcdef")
+	m2 := []byte("fedcba9876543210fedcba9876543210")
+
+	p, _ := NewCustom(&Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+	if _, err := p.WithUser([]byte("alice")); err != ErrSecretRequired {
+		t.Fatalf("WithUser: unexpected %v", err)
+	}
+	if err := p.SetMasterSecret(make([]byte, 32)); err == nil {
+		t.Fatalf("SetMasterSecret: weak master accepted")
+	}
+	if err := p.SetMasterSecret(m1); err != nil {
+		t.Fatalf("SetMasterSecret: %v", err)
+	}
+
+	alice, _ := p.WithUser([]byte("alice"))
+	bob, _ := p.WithUser([]byte("bob"))
+	hashed, err := alice.Hash([]byte("password"))
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if MasterGeneration(hashed) != KeyID(m1) {
+		t.Fatalf("MasterGeneration: unexpected %q", MasterGeneration(hashed))
+	}
+	if err = alice.Compare(hashed, []byte("password")); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	if err = bob.Compare(hashed, []byte("password")); err != ErrMismatch {
+		t.Fatalf("Compare bob: unexpected %v", err)
+	}
+	// the derivation happens in the library, a profile key'ed with the
+	// master does not verify.
+	if err = p.Compare(hashed, []byte("password")); err != ErrMismatch {
+		t.Fatalf("Compare profile: unexpected %v", err)
+	}
+
+	// rotation.
+	p.SetMasterSecret(m2, m1)
+	alice, _ = p.WithUser([]byte("alice"))
+	rehashed, err := alice.Rehash(hashed, []byte("password"))
+	if err != nil || rehashed == nil {
+		t.Fatalf("Rehash: unexpected %v", err)
+	}
+	if MasterGeneration(rehashed) != KeyID(m2) {
+		t.Fatalf("MasterGeneration: unexpected %q", MasterGeneration(rehashed))
+	}
+	if again, err := alice.Rehash(rehashed, []byte("password")); err != nil || again != nil {
+		t.Fatalf("Rehash: unexpected %v", err)
+	}
+
+	// the previous master retired.
+	p.SetMasterSecret(m2)
+	alice, _ = p.WithUser([]byte("alice"))
+	if err = alice.Compare(hashed, []byte("password")); err != ErrMismatch {
+		t.Fatalf("Compare retired: unexpected %v", err)
+	}
+	if err = alice.Compare(rehashed, []byte("password")); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+}
+
+func TestReuseIndex(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	params := &Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32}
+
+	for _, bits := range []int{0, 8, 20, 512} {
+		if _, err := NewReuseIndex(key, params, bits); err != ErrUnsupported {
+			t.Fatalf("NewReuseIndex %d bits: unexpected %v", bits, err)
+		}
+	}
+	if _, err := NewReuseIndex([]byte("short"), params, 64); err != ErrSecretTooShort {
+		t.Fatalf("NewReuseIndex: unexpected %v", err)
+	}
+
+	r, err := NewReuseIndex(key, params, 64)
+	if err != nil {
+		t.Fatalf("NewReuseIndex: %v", err)
+	}
+	p, _ := NewCustom(params)
+
+	h1, i1, err := p.HashWithReuseIndex(r, []byte("acme"), []byte("password"))
+	if err != nil {
+		t.Fatalf("HashWithReuseIndex: %v", err)
+	}
+	h2, i2, _ := p.HashWithReuseIndex(r, []byte("acme"), []byte("password"))
+	if bytes.Equal(h1, h2) || i1 != i2 {
+		t.Fatalf("HashWithReuseIndex: unexpected %s %s / %s %s", h1, i1, h2, i2)
+	}
+	if len(i1) != len(base64Encode(make([]byte, 8))) {
+		t.Fatalf("Index: unexpected length %s", i1)
+	}
+
+	other, _ := r.Index([]byte("acme"), []byte("other"))
+	tenant, _ := r.Index([]byte("globex"), []byte("password"))
+	r2, _ := NewReuseIndex([]byte("fedcba9876543210fedcba9876543210"), params, 64)
+	keyed, _ := r2.Index([]byte("acme"), []byte("password"))
+	for _, i := range []string{other, tenant, keyed} {
+		if i == i1 {
+			t.Fatalf("Index: unexpected collision %s", i)
+		}
+	}
+}
+
+func TestDeriveKeypair(t *testing.T) {
+	p, _ := NewCustom(&Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+	salt := []byte("0123456789abcdef")
+
+	sk, err := p.DeriveSigningKey([]byte("correct horse"), salt)
+	if err != nil {
+		t.Fatalf("DeriveSigningKey: %v", err)
+	}
+	sk2, _ := p.DeriveSigningKey([]byte("correct horse"), salt)
+	if !bytes.Equal(sk, sk2) {
+		t.Fatalf("DeriveSigningKey: not deterministic")
+	}
+	other, _ := p.DeriveSigningKey([]byte("battery staple"), salt)
+	if bytes.Equal(sk, other) {
+		t.Fatalf("DeriveSigningKey: unexpected collision")
+	}
+
+	msg := []byte("backup manifest")
+	if !ed25519.Verify(sk.Public().(ed25519.PublicKey), msg, ed25519.Sign(sk, msg)) {
+		t.Fatalf("DeriveSigningKey: signature does not verify")
+	}
+
+	priv, pub, err := p.DeriveAgreementKey([]byte("correct horse"), salt)
+	if err != nil {
+		t.Fatalf("DeriveAgreementKey: %v", err)
+	}
+	if bytes.Equal(priv, sk.Seed()) {
+		t.Fatalf("DeriveAgreementKey: keys are not domain separated")
+	}
+	peerPriv, peerPub, _ := p.DeriveAgreementKey([]byte("battery staple"), salt)
+	s1, _ := curve25519.X25519(priv, peerPub)
+	s2, _ := curve25519.X25519(peerPriv, pub)
+	if !bytes.Equal(s1, s2) {
+		t.Fatalf("DeriveAgreementKey: shared secrets differ")
+	}
+
+	b, _ := New(BcryptDefault)
+	if _, err := b.DeriveSigningKey([]byte("correct horse"), salt); err != ErrUnsupported {
+		t.Fatalf("DeriveSigningKey bcrypt: unexpected %v", err)
+	}
+}
+
+func TestS2K(t *testing.T) {
+	password := []byte("correct horse")
+	specs := []*S2KParams{
+		{Type: S2KSimple, Hash: crypto.SHA1},
+		{Type: S2KSalted, Hash: crypto.SHA256, Salt: []byte("01234567")},
+		{Type: S2KIteratedSalted, Hash: crypto.SHA512, Salt: []byte("01234567"), Count: 1024},
+		{Type: S2KIteratedSalted, Hash: crypto.SHA1, Salt: []byte("76543210"), Count: 65536},
+	}
+
+	for i, s := range specs {
+		spec, err := s.Marshal()
+		if err != nil {
+			t.Fatalf("test #%d Marshal: %v", i, err)
+		}
+		parsed, n, err := ParseS2K(spec)
+		if err != nil || n != len(spec) {
+			t.Fatalf("test #%d ParseS2K: %d %v", i, n, err)
+		}
+
+		// cross checked with the (deprecated) x/crypto implementation,
+		// keys longer than the digest use several hash contexts.
+		f, err := s2k.Parse(bytes.NewReader(spec))
+		if err != nil {
+			t.Fatalf("test #%d s2k.Parse: %v", i, err)
+		}
+		want := make([]byte, 80)
+		f(want, password)
+
+		key, err := DeriveS2K(password, parsed, len(want))
+		if err != nil || !bytes.Equal(key, want) {
+			t.Fatalf("test #%d DeriveS2K: %x (%v) vs expected %x", i, key, err, want)
+		}
+		if err := CompareS2K(key[:32], password, parsed); err != nil {
+			t.Fatalf("test #%d CompareS2K: %v", i, err)
+		}
+		if err := CompareS2K(key[:32], []byte("battery staple"), parsed); err != ErrMismatch {
+			t.Fatalf("test #%d CompareS2K: unexpected %v", i, err)
+		}
+	}
+
+	for _, c := range []byte{0, 96, 255} {
+		if EncodeS2KCount(DecodeS2KCount(c)) != c {
+			t.Fatalf("S2K count %d does not roundtrip", c)
+		}
+	}
+	if DecodeS2KCount(255) != S2KDefaultCount {
+		t.Fatalf("S2K count: unexpected %d", DecodeS2KCount(255))
+	}
+
+	s, err := NewS2K()
+	if err != nil || s.Type != S2KIteratedSalted || len(s.Salt) != 8 {
+		t.Fatalf("NewS2K: %v %v", s, err)
+	}
+	if _, _, err := ParseS2K([]byte{S2KIteratedSalted, 8, 1, 2}); err != ErrParse {
+		t.Fatalf("ParseS2K: unexpected %v", err)
+	}
+	if _, _, err := ParseS2K([]byte{S2KSimple, 1}); err != ErrUnsupported {
+		t.Fatalf("ParseS2K MD5: unexpected %v", err)
+	}
+}
+
+func TestKerberosKey(t *testing.T) {
+	// RFC 3961 appendix A.1
+	if f := hex.EncodeToString(nfold([]byte("kerberos"), 16)); f != "6b65726265726f737b9b5b2b93132b93" {
+		t.Fatalf("nfold: unexpected %s", f)
+	}
+	if f := hex.EncodeToString(nfold([]byte("012345"), 8)); f != "be072631276b1955" {
+		t.Fatalf("nfold: unexpected %s", f)
+	}
+
+	// RFC 3962 appendix B
+	salt := KerberosSalt("ATHENA.MIT.EDU", "raeburn")
+	vectors := []struct {
+		etype      int
+		iterations int
+		key        string
+	}{
+		{KerberosAES128, 1, "42263c6e89f4fc28b8df68ee09799f15"},
+		{KerberosAES256, 1, "fe697b52bc0d3ce14432ba036a92e65bbb52280990a2fa27883998d72af30161"},
+		{KerberosAES128, 1200, "4c01cd46d632d01e6dbe230a01ed642a"},
+		{KerberosAES256, 1200, "55a6ac740ad17b4846941051e1e8b0a7548d93b0ab30a8bc3ff16280382b8c2a"},
+	}
+	for i, v := range vectors {
+		key, err := DeriveKerberosKey(v.etype, []byte("password"), salt, v.iterations)
+		if err != nil || hex.EncodeToString(key) != v.key {
+			t.Fatalf("test #%d: %x (%v) vs expected %s", i, key, err, v.key)
+		}
+	}
+
+	if _, err := DeriveKerberosKey(23, []byte("password"), salt, 4096); err != ErrUnsupported {
+		t.Fatalf("DeriveKerberosKey rc4: unexpected %v", err)
+	}
+	if n, err := KerberosIterations(nil); n != KerberosDefaultIterations || err != nil {
+		t.Fatalf("KerberosIterations: %d %v", n, err)
+	}
+	if n, err := KerberosIterations([]byte{0, 0, 4, 0xb0}); n != 1200 || err != nil {
+		t.Fatalf("KerberosIterations: %d %v", n, err)
+	}
+	if _, err := KerberosIterations([]byte{0, 0, 0, 0}); err != ErrUnsupported {
+		t.Fatalf("KerberosIterations: unexpected %v", err)
+	}
+}
+
+func TestDeriveWPA2PSK(t *testing.T) {
+	// IEEE 802.11i annex H.4.2
+	vectors := []struct {
+		passphrase, ssid, psk string
+	}{
+		{"password", "IEEE", "f42c6fc52df0ebef9ebb4b90b38a5f902e83fe1b135a70e23aed762e9710a12e"},
+		{"ThisIsAPassword", "ThisIsASSID", "0dc0d6eb90555ed6419756b9a15ec3e3209b63df707dd508d14581f8982721af"},
+	}
+	for i, v := range vectors {
+		psk, err := DeriveWPA2PSK([]byte(v.passphrase), []byte(v.ssid))
+		if err != nil || hex.EncodeToString(psk) != v.psk {
+			t.Fatalf("test #%d: %x (%v) vs expected %s", i, psk, err, v.psk)
+		}
+	}
+
+	for _, p := range []string{"short", strings.Repeat("a", 64), "pass\nword"} {
+		if _, err := DeriveWPA2PSK([]byte(p), []byte("IEEE")); err != ErrUnsupported {
+			t.Fatalf("DeriveWPA2PSK %q: unexpected %v", p, err)
+		}
+	}
+	if _, err := DeriveWPA2PSK([]byte("password"), make([]byte, 33)); err != ErrUnsupported {
+		t.Fatalf("DeriveWPA2PSK: unexpected %v", err)
+	}
+}
+
+func TestOwaspPresets(t *testing.T) {
+	p2023, err := NewOwasp(Owasp2023, Argon)
+	if err != nil {
+		t.Fatalf("NewOwasp: %v", err)
+	}
+	hashed, err := p2023.Hash([]byte("password"))
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if !strings.Contains(string(hashed), "$2$19456$1$") {
+		t.Fatalf("Hash: unexpected parameters %s", hashed)
+	}
+
+	r, err := p2023.CompareEx(hashed, []byte("password"))
+	if err != nil || r.NeedsRehash {
+		t.Fatalf("CompareEx: %v %v", r, err)
+	}
+	latest, _ := NewOwasp(OwaspLatest, Argon)
+	r, err = latest.CompareEx(hashed, []byte("password"))
+	if err != nil || !r.NeedsRehash {
+		t.Fatalf("CompareEx latest: %v %v", r, err)
+	}
+
+	for _, alg := range []int{Scrypt, Bcrypt} {
+		if _, err := NewOwasp(Owasp2023, alg); err != nil {
+			t.Fatalf("NewOwasp %d: %v", alg, err)
+		}
+	}
+	if _, err := NewOwasp("owasp-2019", Argon); err != ErrUnsupported {
+		t.Fatalf("NewOwasp: unexpected %v", err)
+	}
+}
+
+func TestParseSpec(t *testing.T) {
+	vectors := []struct {
+		spec string
+		want string
+		err  error
+	}{
+		{"argon2id:m=65536,t=3,p=4,l=32", "argon2id:m=65536,t=3,p=4,l=32,s=16", nil},
+		{"argon2i:p=2,t=1,m=1024,s=32,l=16", "argon2i:m=1024,t=1,p=2,l=16,s=32", nil},
+		{"argon2id", "argon2id:m=65536,t=1,p=16,l=32,s=16", nil},
+		{"scrypt:ln=15,r=8,p=1", "scrypt:ln=15,r=8,p=1,l=32,s=16", nil},
+		{"bcrypt:cost=12", "bcrypt:cost=12", nil},
+		{"argon2id:m=65536,m=1024", "", ErrParse},
+		{"argon2id:x=1", "", ErrParse},
+		{"argon2id:m=abc", "", ErrParse},
+		{"argon2id:m", "", ErrParse},
+		{"argon2id:p=0", "", ErrUnsupported},
+		{"argon2id:m=8,p=4", "", ErrUnsupported},
+		{"scrypt:ln=0", "", ErrUnsupported},
+		{"bcrypt:cost=3", "", ErrUnsupported},
+		{"md5:rounds=5000", "", ErrUnsupported},
+	}
+
+	for i, v := range vectors {
+		params, err := ParseSpec(v.spec)
+		if err != v.err {
+			t.Fatalf("test #%d %s: unexpected %v", i, v.spec, err)
+		}
+		if err != nil {
+			continue
+		}
+		spec, err := FormatSpec(params)
+		if err != nil || spec != v.want {
+			t.Fatalf("test #%d FormatSpec: %s (%v) vs expected %s", i, spec, err, v.want)
+		}
+		if _, err := NewCustom(params); err != nil {
+			t.Fatalf("test #%d NewCustom: %v", i, err)
+		}
+	}
+}
+
+func TestMaxEncodedLen(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	argon := func() interface{} {
+		return &Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32}
+	}
+
+	plain, _ := NewCustom(argon())
+	masked, _ := NewCustom(&Argon2Params{Version: Argon2i, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32, Masked: true})
+	scrypt, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	bcrypt, _ := NewCustom(&BcryptParams{Cost: 4})
+	truncated, _ := NewCustom(&BcryptParams{Cost: 4})
+	truncated.SetTruncationPolicy(TruncatePreHash)
+	keyed, _ := NewCustom(argon())
+	keyed.SetKey(secret)
+	keyed.SetIntegrityTag(true)
+	keyed.SetDomain("billing")
+	bound := keyed.WithRecord([]byte("user-42"))
+	stamped, _ := NewCustom(argon())
+	stamped.SetTimestamp(true)
+	stamped.SetExpiry(time.Hour)
+	encrypted, _ := NewCustom(argon())
+	encrypted.SetIntegrityTag(true)
+	encrypted.SetEncryptionKey(make([]byte, 32))
+	defaultEncrypted, _ := New(Argon2idDefault)
+	defaultEncrypted.SetEncryptionKey(make([]byte, 32))
+
+	for i, p := range []*Profile{plain, masked, scrypt, bcrypt, truncated, keyed, bound, stamped, encrypted, defaultEncrypted} {
+		max, err := p.MaxEncodedLen()
+		if err != nil {
+			t.Fatalf("test #%d MaxEncodedLen: %v", i, err)
+		}
+		hashed, err := p.Hash([]byte("password"))
+		if err != nil {
+			t.Fatalf("test #%d Hash: %v", i, err)
+		}
+		// the time fields are the only variable ones.
+		if len(hashed) > max || (p != stamped && len(hashed) != max) {
+			t.Fatalf("test #%d: %d (%s) vs max %d", i, len(hashed), hashed, max)
+		}
+	}
+}
+
+func TestPuzzle(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	params := &Argon2Params{Time: 1, Memory: 64, Thread: 1}
+
+	if _, err := NewPuzzleIssuer(key, params, 0, time.Minute); err != ErrUnsupported {
+		t.Fatalf("NewPuzzleIssuer: unexpected %v", err)
+	}
+	pi, err := NewPuzzleIssuer(key, params, 6, time.Minute)
+	if err != nil {
+		t.Fatalf("NewPuzzleIssuer: %v", err)
+	}
+
+	issued, err := pi.Issue()
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	// over the wire.
+	pz, err := ParsePuzzle(issued.String())
+	if err != nil {
+		t.Fatalf("ParsePuzzle: %v", err)
+	}
+	solution, err := pz.Solve()
+	if err != nil {
+		t.Fatalf("Solve: %v", err)
+	}
+	if err := pi.Verify(pz, solution); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	wrong := solution + 1
+	for pz.solves(pz.digest(wrong)) {
+		wrong++
+	}
+	if err := pi.Verify(pz, wrong); err != ErrMismatch {
+		t.Fatalf("Verify wrong solution: unexpected %v", err)
+	}
+
+	easier := *pz
+	easier.Difficulty = 1
+	if err := pi.Verify(&easier, solution); err != ErrCorrupted {
+		t.Fatalf("Verify tampered: unexpected %v", err)
+	}
+
+	now = func() time.Time { return time.Now().Add(time.Hour) }
+	defer func() { now = time.Now }()
+	if err := pi.Verify(pz, solution); err != ErrExpired {
+		t.Fatalf("Verify expired: unexpected %v", err)
+	}
+
+	if _, err := ParsePuzzle("$2p$AAAA$1$2$3"); err != ErrParse {
+		t.Fatalf("ParsePuzzle: unexpected %v", err)
+	}
+}
+
+func TestAdvertisement(t *testing.T) {
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	params := Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32}
+
+	p, _ := NewCustom(&params)
+	p.SetKey([]byte("0123456789abcdef0123456789abcdef"))
+	hashed, _ := p.Hash([]byte("password"))
+
+	a, err := p.Advertise(key, hashed, time.Minute)
+	if err != nil {
+		t.Fatalf("Advertise: %v", err)
+	}
+	if strings.Contains(a.String(), "0123456789abcdef") {
+		t.Fatalf("Advertise: secret leaked %s", a)
+	}
+	parsed, err := ParseAdvertisement(pub, a.String())
+	if err != nil {
+		t.Fatalf("ParseAdvertisement: %v", err)
+	}
+	salt, _ := parseFromHashToSalt(hashed)
+	cp := parsed.Params
+	if cp.Algorithm != idArgon2id || cp.Time != 1 || cp.Memory != 64 || cp.Thread != 1 || cp.Keylen != 32 || !bytes.Equal(cp.Salt, salt) {
+		t.Fatalf("ParseAdvertisement: unexpected %+v", cp)
+	}
+	if parsed.Version != ParamsVersion(cp) {
+		t.Fatalf("ParseAdvertisement: version %s vs %s", parsed.Version, ParamsVersion(cp))
+	}
+
+	// downgrade attempt.
+	tampered := strings.Replace(a.String(), "$1$64$1$32$", "$1$8$1$32$", 1)
+	if _, err := ParseAdvertisement(pub, tampered); err != ErrCorrupted {
+		t.Fatalf("ParseAdvertisement tampered: unexpected %v", err)
+	}
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err := ParseAdvertisement(otherPub, a.String()); err != ErrCorrupted {
+		t.Fatalf("ParseAdvertisement other key: unexpected %v", err)
+	}
+
+	// masked: only the version.
+	params.Masked = true
+	m, _ := NewCustom(&params)
+	mhashed, _ := m.Hash([]byte("password"))
+	ma, err := m.Advertise(key, mhashed, time.Minute)
+	if err != nil {
+		t.Fatalf("Advertise masked: %v", err)
+	}
+	mparsed, err := ParseAdvertisement(pub, ma.String())
+	if err != nil || mparsed.Params.Memory != 0 || mparsed.Version != a.Version {
+		t.Fatalf("ParseAdvertisement masked: %+v %v", mparsed, err)
+	}
+
+	now = func() time.Time { return time.Now().Add(time.Hour) }
+	defer func() { now = time.Now }()
+	if _, err := ParseAdvertisement(pub, a.String()); err != ErrExpired {
+		t.Fatalf("ParseAdvertisement expired: unexpected %v", err)
+	}
+}
+
+func TestVerificationTokens(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	p, _ := NewCustom(&BcryptParams{Cost: 4})
+	hashed, _ := p.Hash([]byte("password"))
+	subject := []byte("alice")
+
+	if _, err := NewVerificationTokens(key, 0, nil); err != ErrUnsupported {
+		t.Fatalf("NewVerificationTokens: unexpected %v", err)
+	}
+	vt, err := NewVerificationTokens(key, time.Minute, NewMemoryTokenRevoker())
+	if err != nil {
+		t.Fatalf("NewVerificationTokens: %v", err)
+	}
+
+	if _, err := vt.Compare(p, subject, hashed, []byte("wrong")); err != ErrMismatch {
+		t.Fatalf("Compare: unexpected %v", err)
+	}
+	token, err := vt.Compare(p, subject, hashed, []byte("password"))
+	if err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	if err := vt.Redeem(token, subject, hashed); err != nil {
+		t.Fatalf("Redeem: %v", err)
+	}
+
+	rehashed, _ := p.Hash([]byte("password"))
+	for i, test := range []struct {
+		token           string
+		subject, hashed []byte
+		err             error
+	}{
+		{token, []byte("bob"), hashed, ErrMismatch},
+		{token, subject, rehashed, ErrMismatch},
+		{strings.Replace(token, "$2t$", "$2x$", 1), subject, hashed, ErrParse},
+	} {
+		if err := vt.Redeem(test.token, test.subject, test.hashed); err != test.err {
+			t.Fatalf("test #%d Redeem: unexpected %v", i, err)
+		}
+	}
+
+	if err := vt.Revoke(token, subject, hashed); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if err := vt.Redeem(token, subject, hashed); err != ErrRevoked {
+		t.Fatalf("Redeem revoked: unexpected %v", err)
+	}
+
+	other, _ := vt.Compare(p, subject, hashed, []byte("password"))
+	now = func() time.Time { return time.Now().Add(time.Hour) }
+	defer func() { now = time.Now }()
+	if err := vt.Redeem(other, subject, hashed); err != ErrExpired {
+		t.Fatalf("Redeem expired: unexpected %v", err)
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	r := Doctor(BcryptDefault)
+	if r.CPUs < 1 || r.GOMAXPROCS < 1 || r.Backend == "" {
+		t.Fatalf("Doctor: unexpected %+v", r)
+	}
+	if len(r.Benchmarks) != 1 || r.Benchmarks[0].Profile != "bcrypt-default" || r.Benchmarks[0].Duration == 0 {
+		t.Fatalf("Doctor: unexpected benchmarks %+v", r.Benchmarks)
+	}
+
+	// a limit below the profile memory skips its benchmark.
+	r = &DoctorReport{GOMAXPROCS: 1, CgroupLimit: 1 << 20}
+	r.benchmark(Argon2idParanoid)
+	if !r.Benchmarks[0].Skipped || len(r.Warnings) != 2 || !strings.Contains(r.Warnings[0], "cgroup") {
+		t.Fatalf("benchmark: unexpected %+v", r)
+	}
+}
+
+func TestLegacyDigest(t *testing.T) {
+	sum := sha256.Sum256([]byte("alicepassword"))
+	stored := []byte(hex.EncodeToString(sum[:]))
+
+	l := &LegacyDigest{Hash: crypto.SHA256, LowerIdentity: true}
+	if err := l.CompareIdentity([]byte("Alice"), stored, []byte("password")); err != nil {
+		t.Fatalf("CompareIdentity: %v", err)
+	}
+	if err := l.CompareIdentity([]byte("bob"), stored, []byte("password")); err != ErrMismatch {
+		t.Fatalf("CompareIdentity: unexpected %v", err)
+	}
+	if err := l.CompareIdentity([]byte("alice"), []byte("zz"), []byte("password")); err != ErrMismatch {
+		t.Fatalf("CompareIdentity: unexpected %v", err)
+	}
+
+	sum1 := sha1.Sum([]byte("password:alice"))
+	b64 := []byte(base64.StdEncoding.EncodeToString(sum1[:]))
+	l1 := &LegacyDigest{Hash: crypto.SHA1, Template: "{password}:{identity}", Encoding: DigestBase64}
+	if err := l1.CompareIdentity([]byte("alice"), b64, []byte("password")); err != nil {
+		t.Fatalf("CompareIdentity base64: %v", err)
+	}
+
+	// verify then upgrade.
+	p, _ := NewCustom(&BcryptParams{Cost: 4})
+	s, _ := NewSuite(p, l.Verifier([]byte("alice")))
+	needsRehash, err := s.Verify(stored, []byte("password"))
+	if err != nil || !needsRehash {
+		t.Fatalf("Suite.Verify: %v %v", needsRehash, err)
+	}
+
+	md4 := &LegacyDigest{Hash: crypto.MD4}
+	if err := md4.CompareIdentity([]byte("alice"), stored, []byte("password")); err != ErrUnsupported {
+		t.Fatalf("CompareIdentity md4: unexpected %v", err)
+	}
+}
+
+func TestKDFImplementation(t *testing.T) {
+	defer SetKDFImplementation(KDFImplementation())
+
+	p, _ := NewCustom(&Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+	salt := []byte("0123456789abcdef")
+
+	var first []byte
+	for _, impl := range KDFImplementations() {
+		if err := SetKDFImplementation(impl); err != nil || KDFImplementation() != impl {
+			t.Fatalf("SetKDFImplementation %s: %v", impl, err)
+		}
+		key, _ := p.Derive([]byte("password"), salt)
+		if first == nil {
+			first = key
+		}
+		if !bytes.Equal(key, first) {
+			t.Fatalf("%s: outputs differ", impl)
+		}
+	}
+	if err := SetKDFImplementation("quantum"); err != ErrUnsupported {
+		t.Fatalf("SetKDFImplementation: unexpected %v", err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a, _ := New(Argon2idDefault)
+	b, _ := New(Argon2idDefault)
+	if a.Fingerprint() != b.Fingerprint() || len(a.Fingerprint()) != 16 {
+		t.Fatalf("Fingerprint: %s vs %s", a.Fingerprint(), b.Fingerprint())
+	}
+
+	a.SetTimestamp(true)
+	b.SetTimestamp(true)
+	fp := a.Fingerprint()
+	if b.Fingerprint() != fp {
+		t.Fatalf("Fingerprint: timestamp not stable")
+	}
+
+	drifts := []func(p *Profile){
+		func(p *Profile) { p.SetKey([]byte("0123456789abcdef0123456789abcdef")) },
+		func(p *Profile) { p.SetMinLength(12) },
+		func(p *Profile) { p.SetIntegrityTag(true) },
+		func(p *Profile) { p.SetDomain("billing") },
+		func(p *Profile) { p.params.(*Argon2Params).Time++ },
+	}
+	seen := map[string]bool{fp: true}
+	for i, drift := range drifts {
+		c, _ := New(Argon2idDefault)
+		c.SetTimestamp(true)
+		drift(c)
+		if seen[c.Fingerprint()] {
+			t.Fatalf("test #%d: drift not detected", i)
+		}
+		seen[c.Fingerprint()] = true
+	}
+
+	// secrets are identified, not exposed.
+	k1, _ := New(Argon2idDefault)
+	k1.SetKey([]byte("0123456789abcdef0123456789abcdef"))
+	k2, _ := New(Argon2idDefault)
+	k2.SetKey([]byte("fedcba9876543210fedcba9876543210"))
+	if k1.Fingerprint() == k2.Fingerprint() {
+		t.Fatalf("Fingerprint: secret rotation not detected")
+	}
+}
+
+func TestSpring(t *testing.T) {
+	// Spring Security reference documentation examples of "password".
+	for i, hashed := range []string{
+		"{bcrypt}$2a$10$dXJ3SW6G7P50lGmMkkmwe.20cQQubK3.HZWzG3YB1tlRy.fqvM/BG",
+		"{pbkdf2}5d923b44a6d129f3ddf3e3c8d29412723dcbde72445e8ef6bf3b508fbf17fa4ed4d6b99ca763d8dc",
+		"{scrypt}$e0801$8bWJaSu2IKSn9Z9kM+TPXfOc/9bdYSrN1oD9qfVThWEwdRTnO7re7Ei+fUZRJ68k9lTyuTeUp4of4g24hHnazw==$OAOec05+bXxvuu/1qZ6NUR+xQYvYv7BeL1QxwRpY5Pc=",
+	} {
+		if err := CompareSpring([]byte(hashed), []byte("password")); err != nil {
+			t.Fatalf("test #%d CompareSpring: %v", i, err)
+		}
+		if err := CompareSpring([]byte(hashed), []byte("wrong")); err != ErrMismatch {
+			t.Fatalf("test #%d CompareSpring: unexpected %v", i, err)
+		}
+	}
+
+	for i, params := range []interface{}{
+		&BcryptParams{Cost: 4},
+		&Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32},
+		&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32},
+	} {
+		p, _ := NewCustom(params)
+		hashed, err := p.HashSpring([]byte("password"))
+		if err != nil {
+			t.Fatalf("test #%d HashSpring: %v", i, err)
+		}
+		if err := CompareSpring(hashed, []byte("password")); err != nil {
+			t.Fatalf("test #%d CompareSpring %s: %v", i, hashed, err)
+		}
+	}
+
+	keyed, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	keyed.SetKey([]byte("0123456789abcdef0123456789abcdef"))
+	if _, err := keyed.HashSpring([]byte("password")); err != ErrUnsupported {
+		t.Fatalf("HashSpring keyed: unexpected %v", err)
+	}
+	if err := CompareSpring([]byte("{noop}password"), []byte("password")); err != ErrUnsupported {
+		t.Fatalf("CompareSpring noop: unexpected %v", err)
+	}
+}
+
+func TestASPNETIdentity(t *testing.T) {
+	// python hashlib.pbkdf2_hmac() encodings of "password".
+	for i, hashed := range []string{
+		"AAABAgMEBQYHCAkKCwwNDg8DCeL+Tgvf59D+SCjUHCNEFuLZv7Yc3Y9kOhHPv9/BGQ==",
+		"AQAAAAEAACcQAAAAEAABAgMEBQYHCAkKCwwNDg/rbIFTVZIgPAkrFY+NOQlnI2Km9dvQDZgoBEy6qLJS6Q==",
+		"AQAAAAIAAYagAAAAEAABAgMEBQYHCAkKCwwNDg/73hTTOMxvghBX8/SnisILxwGxHjepOzeQw1EOAZRz8w==",
+	} {
+		if err := CompareASPNETIdentity([]byte(hashed), []byte("password")); err != nil {
+			t.Fatalf("test #%d CompareASPNETIdentity: %v", i, err)
+		}
+		if err := CompareASPNETIdentity([]byte(hashed), []byte("wrong")); err != ErrMismatch {
+			t.Fatalf("test #%d CompareASPNETIdentity: unexpected %v", i, err)
+		}
+	}
+
+	for i, hashed := range []string{
+		"",
+		"not base64",
+		"AAABAgMEBQYHCAkKCwwNDg8=",     // v2 truncated
+		"AQAAAAEAACcQAAAAEAABAgMEBQY=", // v3 truncated
+	} {
+		if err := CompareASPNETIdentity([]byte(hashed), []byte("password")); err != ErrMismatch {
+			t.Fatalf("test #%d CompareASPNETIdentity: unexpected %v", i, err)
+		}
+	}
+	if err := CompareASPNETIdentity([]byte("AgAAAAA="), []byte("password")); err != ErrUnsupported {
+		t.Fatalf("CompareASPNETIdentity version: unexpected %v", err)
+	}
+
+	// migration
+	p, _ := NewCustom(&Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+	s, _ := NewSuite(p, ASPNETIdentity)
+	needsRehash, err := s.Verify([]byte("AAABAgMEBQYHCAkKCwwNDg8DCeL+Tgvf59D+SCjUHCNEFuLZv7Yc3Y9kOhHPv9/BGQ=="), []byte("password"))
+	if err != nil || !needsRehash {
+		t.Fatalf("Suite.Verify: %t %v", needsRehash, err)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	_ = p.SetNamespace("staging")
+
+	hashed, err := p.Hash([]byte("password"))
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if !bytes.Contains(hashed, []byte(metaNamespace+"="+namespaceTag("staging"))) {
+		t.Fatalf("Hash: namespace not recorded: %s", hashed)
+	}
+	if err := p.Compare(hashed, []byte("password")); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+
+	for i, v := range []Verifier{p.WithNamespace("prod"), p.WithNamespace(""), p.WithDomain("staging"), NativeVerifier} {
+		if err := v.Compare(hashed, []byte("password")); err != ErrMismatch {
+			t.Fatalf("test #%d: got %v, expected %v", i, err, ErrMismatch)
+		}
+	}
+
+	// the namespace is folded into the derivation, not only recorded.
+	forged := bytes.Replace(hashed, []byte(namespaceTag("staging")), []byte(namespaceTag("prod")), 1)
+	if err := p.WithNamespace("prod").Compare(forged, []byte("password")); err != ErrMismatch {
+		t.Fatalf("forged: got %v, expected %v", err, ErrMismatch)
+	}
+
+	if p.Fingerprint() == p.WithNamespace("prod").Fingerprint() {
+		t.Fatalf("Fingerprint: namespace ignored")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	weak := &Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32}
+	strong := &Argon2Params{Version: Argon2id, Time: 2, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32}
+
+	p, _ := NewCustom(weak)
+	hashed, _ := p.Hash([]byte("password"))
+	q, _ := NewCustom(strong)
+	upgraded, _ := q.Hash([]byte("password"))
+	s, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	scrypted, _ := s.Hash([]byte("password"))
+	m, _ := NewCustom(&Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32, Masked: true})
+	masked, _ := m.Hash([]byte("password"))
+
+	for i, tc := range []struct {
+		p        *Profile
+		hashed   []byte
+		expected bool
+	}{
+		{p, hashed, false},
+		{q, hashed, true},
+		{q, upgraded, false},
+		{q, scrypted, true},
+		{s, scrypted, false},
+		{m, masked, false},
+		{s, masked, true},
+		{p, []byte("garbage"), true},
+	} {
+		if v := tc.p.NeedsRehash(tc.hashed); v != tc.expected {
+			t.Fatalf("test #%d Profile.NeedsRehash: got %t, expected %t", i, v, tc.expected)
+		}
+	}
+
+	for i, tc := range []struct {
+		hashed   []byte
+		min      interface{}
+		expected bool
+	}{
+		{hashed, weak, false},
+		{hashed, strong, true},
+		{upgraded, weak, false},
+		{upgraded, strong, false},
+		{scrypted, strong, true},
+		{masked, weak, true},
+		{[]byte("garbage"), weak, true},
+	} {
+		if v := NeedsRehash(tc.hashed, tc.min); v != tc.expected {
+			t.Fatalf("test #%d NeedsRehash: got %t, expected %t", i, v, tc.expected)
+		}
+	}
+}
+
+// toyHasher is an iterated sha256 external algorithm:
+// $toy$ITER$b64(SALT)$b64(HASH)
+type toyHasher struct {
+	iter int
+}
+
+func (h *toyHasher) digest(password, salt []byte) []byte {
+	d := append(append([]byte{}, salt...), password...)
+	for i := 0; i < h.iter; i++ {
+		s := sha256.Sum256(d)
+		d = s[:]
+	}
+	return d
+}
+
+func (h *toyHasher) GenerateFromPassword(password []byte) ([]byte, error) {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	return h.encode(salt, h.digest(password, salt)), nil
+}
+
+func (h *toyHasher) encode(salt, digest []byte) []byte {
+	return []byte(fmt.Sprintf("$toy$%d$%s$%s", h.iter, base64Encode(salt), base64Encode(digest)))
+}
+
+func (h *toyHasher) Compare(hashed, password []byte) error {
+	fields := strings.Split(string(hashed), "$")
+	if len(fields) != 5 {
+		return ErrMismatch
+	}
+	salt, err := base64Decode([]byte(fields[3]))
+	if err != nil {
+		return ErrMismatch
+	}
+	if !bytes.Equal(h.encode(salt, h.digest(password, salt)), hashed) {
+		return ErrMismatch
+	}
+	return nil
+}
+
+func (h *toyHasher) DeriveFromPassword(password, salt []byte) ([]byte, error) {
+	return h.digest(password, salt), nil
+}
+
+func (h *toyHasher) MarshalParams() ([]byte, error) {
+	return []byte(strconv.Itoa(h.iter)), nil
+}
+
+func (h *toyHasher) UnmarshalParams(hashed []byte) error {
+	fields := strings.Split(string(hashed), "$")
+	if len(fields) != 5 {
+		return ErrParse
+	}
+	iter, err := strconv.Atoi(fields[2])
+	if err != nil || iter < 1 {
+		return ErrParse
+	}
+	h.iter = iter
+	return nil
+}
+
+var toyProfile, toyErr = Register("toy", func() Hasher { return &toyHasher{iter: 1000} })
+
+func TestRegister(t *testing.T) {
+	if toyErr != nil {
+		t.Fatalf("Register: %v", toyErr)
+	}
+	for i, id := range []string{"toy", "", "2id", "Toy", "to$y", "argon2id"} {
+		if _, err := Register(id, func() Hasher { return &toyHasher{} }); err != ErrUnsupported {
+			t.Fatalf("test #%d Register(%q): got %v, expected %v", i, id, err, ErrUnsupported)
+		}
+	}
+
+	p, err := New(toyProfile)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	hashed, err := p.Hash([]byte("password"))
+	if err != nil || !bytes.HasPrefix(hashed, []byte("$toy$1000$")) {
+		t.Fatalf("Hash: %s %v", hashed, err)
+	}
+	for i, v := range []Verifier{p, NativeVerifier} {
+		if err := v.Compare(hashed, []byte("password")); err != nil {
+			t.Fatalf("test #%d Compare: %v", i, err)
+		}
+		if err := v.Compare(hashed, []byte("wrong")); err != ErrMismatch {
+			t.Fatalf("test #%d Compare: unexpected %v", i, err)
+		}
+	}
+	if p.NeedsRehash(hashed) {
+		t.Fatalf("NeedsRehash: hash of the profile")
+	}
+
+	// the parameters are parsed from the hash.
+	weak := &toyHasher{iter: 10}
+	whashed, _ := weak.GenerateFromPassword([]byte("password"))
+	r, err := p.CompareEx(whashed, []byte("password"))
+	if err != nil || !r.NeedsRehash || r.Algorithm != "toy" || r.Params.(*toyHasher).iter != 10 {
+		t.Fatalf("CompareEx: %+v %v", r, err)
+	}
+
+	// the package features apply.
+	p.SetAssociatedData([]byte("user42"))
+	hashed, _ = p.Hash([]byte("password"))
+	if err := p.Compare(hashed, []byte("password")); err != nil {
+		t.Fatalf("Compare ad: %v", err)
+	}
+	if err := Compare(hashed, []byte("password")); err != ErrMismatch {
+		t.Fatalf("Compare ad: unexpected %v", err)
+	}
+
+	// the other algorithms do not verify the external hashes.
+	s, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	if err := s.Compare(whashed, []byte("password")); !isError(err, ErrUnsupportedAlgo) {
+		t.Fatalf("scrypt Compare: unexpected %v", err)
+	}
+
+	key, err := p.Derive([]byte("password"), []byte("salt"))
+	if err != nil || len(key) != sha256.Size {
+		t.Fatalf("Derive: %v", err)
+	}
+}
+
+func TestPbkdf2(t *testing.T) {
+	salt := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+	// python hashlib.pbkdf2_hmac() outputs.
+	for i, tc := range []struct {
+		params   *Pbkdf2Params
+		id       string
+		expected string
+	}{
+		{&Pbkdf2Params{PRF: Pbkdf2SHA256, Iterations: 1000, Saltlen: 16, Keylen: 32}, "2k", "25eb86acc76e43018f18b9a8f90c2fed462d1c799e83d48ae3d7c69046a60b67"},
+		{&Pbkdf2Params{PRF: Pbkdf2SHA512, Iterations: 1000, Saltlen: 16, Keylen: 64}, "2k5", "c74e4080d0fbb41fee5868c0ff60fd75acae2638215987e5ff54f8eae211339b5ad1af6e387bc12dd3a70bb6e5a90108141c5f08e353a2e984439a4333c42d6e"},
+	} {
+		key, _ := hex.DecodeString(tc.expected)
+		expected := fmt.Sprintf("$%s$%s$%d$%d$%s", tc.id, base64Encode(salt), tc.params.Iterations, tc.params.Keylen, base64Encode(key))
+
+		hashed, err := tc.params.generateFromParams(salt, []byte("password"))
+		if err != nil || string(hashed) != expected {
+			t.Fatalf("test #%d: got %s %v, expected %s", i, hashed, err, expected)
+		}
+		if err := Compare(hashed, []byte("password")); err != nil {
+			t.Fatalf("test #%d Compare: %v", i, err)
+		}
+		if err := Compare(hashed, []byte("wrong")); err != ErrMismatch {
+			t.Fatalf("test #%d Compare: unexpected %v", i, err)
+		}
+		if report, err := TryRepair(hashed); err != nil || len(report.Problems) != 0 {
+			t.Fatalf("test #%d TryRepair: %v %v", i, report, err)
+		}
+	}
+
+	for _, profile := range []HashProfile{Pbkdf2Default, Pbkdf2Paranoid} {
+		if _, err := New(profile); err != nil {
+			t.Fatalf("New(%d): %v", profile, err)
+		}
+	}
+
+	fast := &Pbkdf2Params{PRF: Pbkdf2SHA256, Iterations: 1000, Saltlen: 16, Keylen: 32}
+	masked := *fast
+	masked.Masked = true
+	keyed, _ := NewCustom(&Pbkdf2Params{PRF: Pbkdf2SHA512, Iterations: 1000, Saltlen: 16, Keylen: 32})
+	_ = keyed.SetSecret([]byte("0123456789abcdef0123456789abcdef"))
+	plain, _ := NewCustom(fast)
+	hidden, _ := NewCustom(&masked)
+
+	for i, p := range []*Profile{plain, hidden, keyed} {
+		hashed, err := p.Hash([]byte("password"))
+		if err != nil {
+			t.Fatalf("test #%d Hash: %v", i, err)
+		}
+		if err := p.Compare(hashed, []byte("password")); err != nil {
+			t.Fatalf("test #%d Compare: %v", i, err)
+		}
+		if err := p.Compare(hashed, []byte("wrong")); err != ErrMismatch {
+			t.Fatalf("test #%d Compare: unexpected %v", i, err)
+		}
+		if n, err := p.MaxEncodedLen(); err != nil || len(hashed) > n {
+			t.Fatalf("test #%d MaxEncodedLen: %d < %d %v", i, n, len(hashed), err)
+		}
+	}
+	if hashed, _ := hidden.Hash([]byte("password")); len(strings.Split(string(hashed), "$")) != 4 {
+		t.Fatalf("masked: parameters leaked: %s", hashed)
+	}
+
+	weak, _ := NewCustom(&Pbkdf2Params{Iterations: 100, Saltlen: 16, Keylen: 32})
+	if _, err := weak.Hash([]byte("password")); err != ErrUnsupported {
+		t.Fatalf("weak Hash: unexpected %v", err)
+	}
+
+	key, err := plain.Derive([]byte("password"), salt)
+	if err != nil || hex.EncodeToString(key) != "25eb86acc76e43018f18b9a8f90c2fed462d1c799e83d48ae3d7c69046a60b67" {
+		t.Fatalf("Derive: %x %v", key, err)
+	}
+
+	spec, err := FormatSpec(fast)
+	if err != nil || spec != "pbkdf2-sha256:i=1000,l=32,s=16" {
+		t.Fatalf("FormatSpec: %s %v", spec, err)
+	}
+	parsed, err := ParseSpec("pbkdf2-sha512:i=210000")
+	if err != nil || !sameParams(parsed, &Pbkdf2Params{PRF: Pbkdf2SHA512, Iterations: 210000, Saltlen: 16, Keylen: 32}) {
+		t.Fatalf("ParseSpec: %+v %v", parsed, err)
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	// passlib
+	foreign := []byte("$scrypt$ln=10,r=8,p=1$c2FsdHNhbHRzYWx0c2FsdA$BVMRKqdiVYikKAaPR1wucsKUKvw4TuPLkdEYtoSHas4")
+
+	s, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	a, _ := NewCustom(&Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+	native, _ := s.Hash([]byte("password"))
+
+	// native profiles leave the PHC strings to PHCVerifier.
+	if err := s.Compare(foreign, []byte("password")); !isError(err, ErrUnsupportedAlgo) || !s.NeedsRehash(foreign) {
+		t.Fatalf("native Compare: unexpected %v", err)
+	}
+
+	for i, p := range []*Profile{s, a} {
+		if err := p.SetEncoding(FormatPHC); err != nil {
+			t.Fatalf("test #%d SetEncoding: %v", i, err)
+		}
+	}
+	if err := s.Compare(foreign, []byte("password")); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	if err := s.Compare(foreign, []byte("wrong")); err != ErrMismatch {
+		t.Fatalf("Compare: unexpected %v", err)
+	}
+	if err := s.Compare(native, []byte("password")); err != nil || !s.NeedsRehash(native) {
+		t.Fatalf("Compare native: %v", err)
+	}
+	if r, err := a.CompareEx(foreign, []byte("password")); err != ErrMismatch {
+		t.Fatalf("argon2 CompareEx: unexpected %+v %v", r, err)
+	}
+	stronger, _ := NewCustom(&ScryptParams{N: 1 << 11, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	_ = stronger.SetEncoding(FormatPHC)
+	if r, err := stronger.CompareEx(foreign, []byte("password")); err != nil || !r.NeedsRehash || r.Algorithm != idScrypt {
+		t.Fatalf("CompareEx: %+v %v", r, err)
+	}
+
+	for i, p := range []*Profile{s, a} {
+		hashed, err := p.Hash([]byte("password"))
+		if err != nil || !isPHC(hashed) {
+			t.Fatalf("test #%d Hash: %s %v", i, hashed, err)
+		}
+		if err := p.Compare(hashed, []byte("password")); err != nil {
+			t.Fatalf("test #%d Compare: %v", i, err)
+		}
+		if err := PHCVerifier.Compare(hashed, []byte("password")); err != nil {
+			t.Fatalf("test #%d PHCVerifier: %v", i, err)
+		}
+		if n, err := p.MaxEncodedLen(); err != nil || n != len(hashed) {
+			t.Fatalf("test #%d MaxEncodedLen: %d vs %d %v", i, n, len(hashed), err)
+		}
+		if p.NeedsRehash(hashed) {
+			t.Fatalf("test #%d NeedsRehash: hash of the profile", i)
+		}
+
+		// metadata cannot be represented.
+		_ = p.SetTimestamp(true)
+		if _, err := p.Hash([]byte("password")); err != ErrUnsupported {
+			t.Fatalf("test #%d Hash timestamp: unexpected %v", i, err)
+		}
+	}
+
+	bp, _ := NewCustom(&BcryptParams{Cost: 4})
+	mp, _ := NewMasked(ScryptDefault)
+	for i, p := range []*Profile{bp, mp} {
+		if err := p.SetEncoding(FormatPHC); err != ErrUnsupported {
+			t.Fatalf("test #%d SetEncoding: unexpected %v", i, err)
+		}
+	}
+}
+
+func TestCompareAny(t *testing.T) {
+	// SHA-crypt specification test vectors.
+	for i, tc := range []struct {
+		hashed   string
+		password string
+	}{
+		{"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1", "Hello world!"},
+		{"$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.", "Hello world!"},
+		{"$6$rounds=1000$roundstoolow$kUMsbe306n21p9R.FRkW3IGn.S9NPN0x50YhH1xhLsPuWGsUSklZt58jaTfF4ZEQpyUNGc0dqbpBYYBaHHrsX.", "the minimum number is still observed"},
+		{"$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5", "Hello world!"},
+		{"$5$rounds=5000$toolongsaltstrin$Un/5jzAHMgOGZ5.mWJpuVolil07guHPvOW8mGRcvxa5", "This is just a test"},
+		{"pbkdf2_sha256$1000$saltsalt$E196ZhRPzw+wA84EjzHwJO1cv/MFJdO6C/sxmUeTYqY=", "password"},
+		{"$2y$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga", "allmine"},
+		{"$scrypt$ln=10,r=8,p=1$c2FsdHNhbHRzYWx0c2FsdA$BVMRKqdiVYikKAaPR1wucsKUKvw4TuPLkdEYtoSHas4", "password"},
+		{"$2s$EPw6OOA5FeC1ftygG847/e$1024$8$1$32$XKCg1vYBIRKMApZL/0MLDIqEUwYMU/VXSySu6Y2B5Oy", "password"},
+	} {
+		if err := CompareAny([]byte(tc.hashed), []byte(tc.password)); err != nil {
+			t.Fatalf("test #%d CompareAny: %v", i, err)
+		}
+		if err := CompareAny([]byte(tc.hashed), []byte(tc.password+"x")); err != ErrMismatch {
+			t.Fatalf("test #%d CompareAny: unexpected %v", i, err)
+		}
+	}
+
+	for i, hashed := range []string{
+		"$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/",
+		"md5$salt$hash",
+		"",
+	} {
+		if err := CompareAny([]byte(hashed), []byte("password")); err != ErrUnsupported {
+			t.Fatalf("test #%d CompareAny: unexpected %v", i, err)
+		}
+	}
+
+	// costs out of the parsing bounds, refused before any work.
+	for i, hashed := range []string{
+		"$6$rounds=999999999$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+		"$5$rounds=8388609$saltstringsaltst$Un/5jzAHMgOGZ5.mWJpuVolil07guHPvOW8mGRcvxa5",
+		"pbkdf2_sha256$2147483647$saltsalt$E196ZhRPzw+wA84EjzHwJO1cv/MFJdO6C/sxmUeTYqY=",
+		"pbkdf2_sha1$1000$saltsalt$" + base64.StdEncoding.EncodeToString(make([]byte, 2048)),
+	} {
+		start := time.Now()
+		if err := CompareAny([]byte(hashed), []byte("password")); err != ErrParse {
+			t.Fatalf("test #%d CompareAny: unexpected %v", i, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("test #%d CompareAny: took %v", i, elapsed)
+		}
+	}
+
+	// migration
+	p, _ := NewCustom(&Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+	s, _ := NewSuite(p, InteropVerifier)
+	v, err := s.VerifyEx([]byte("pbkdf2_sha256$1000$saltsalt$E196ZhRPzw+wA84EjzHwJO1cv/MFJdO6C/sxmUeTYqY="), []byte("password"))
+	if err != nil || !v.NeedsRehash || v.VerifiedBy != "interop" {
+		t.Fatalf("Suite.VerifyEx: %+v %v", v, err)
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	for i, tc := range []struct {
+		profile   HashProfile
+		maxMemory uint32
+	}{
+		{Argon2idDefault, 1024},
+		{Argon2Custom, 64},
+		{ScryptParanoid, 1024},
+		{BcryptDefault, 0},
+		{Pbkdf2Custom, 0},
+	} {
+		p, err := Calibrate(tc.profile, 10*time.Millisecond, tc.maxMemory)
+		if err != nil {
+			t.Fatalf("test #%d Calibrate: %v", i, err)
+		}
+		if tc.maxMemory > 0 && paramsMemory(p.params) > uint64(tc.maxMemory)*1024+128*8*3 {
+			t.Fatalf("test #%d Calibrate: %d bytes over budget", i, paramsMemory(p.params))
+		}
+		hashed, err := p.Hash([]byte("password"))
+		if err != nil {
+			t.Fatalf("test #%d Hash: %v", i, err)
+		}
+		if err := p.Compare(hashed, []byte("password")); err != nil {
+			t.Fatalf("test #%d Compare: %v", i, err)
+		}
+	}
+
+	if v, _ := Calibrate(Argon2Custom, 10*time.Millisecond, 64); v.params.(*Argon2Params).Thread != 8 {
+		t.Fatalf("Calibrate: %+v lanes do not fit the memory", v.params)
+	}
+	if _, err := Calibrate(Argon2idDefault, 0, 0); err != ErrUnsupported {
+		t.Fatalf("Calibrate: unexpected %v", err)
+	}
+	if _, err := Calibrate(HashProfile(-1), time.Millisecond, 0); err != ErrUnsupported {
+		t.Fatalf("Calibrate: unexpected %v", err)
+	}
+}
+
+func TestConcurrentProfile(t *testing.T) {
+	for i, params := range []interface{}{
+		&Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32},
+		&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32},
+		&Pbkdf2Params{PRF: Pbkdf2SHA256, Iterations: 1000, Saltlen: 16, Keylen: 32},
+	} {
+		p, err := NewCustom(params)
+		if err != nil {
+			t.Fatalf("test #%d NewCustom: %v", i, err)
+		}
+
+		// the keys derived one by one.
+		salts := make([][]byte, 8)
+		keys := make([][]byte, len(salts))
+		for j := range salts {
+			salts[j] = bytes.Repeat([]byte{byte(j)}, 16)
+			keys[j], err = p.Derive([]byte("password"), salts[j])
+			if err != nil {
+				t.Fatalf("test #%d Derive: %v", i, err)
+			}
+		}
+
+		errs := make(chan error, 3*len(salts))
+		var wg sync.WaitGroup
+		for j := range salts {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				for n := 0; n < 3; n++ {
+					key, err := p.Derive([]byte("password"), salts[j])
+					if err != nil || !bytes.Equal(key, keys[j]) {
+						errs <- fmt.Errorf("salt #%d: derived %x (%v)", j, key, err)
+						return
+					}
+					hashed, err := p.Hash([]byte("password"))
+					if err != nil {
+						errs <- err
+						return
+					}
+					if err := p.Compare(hashed, []byte("password")); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}(j)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatalf("test #%d concurrent use: %v", i, err)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	for i, params := range []interface{}{
+		&Argon2Params{Version: Argon2id, Time: 4, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32},
+		&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32},
+		&BcryptParams{Cost: 4},
+		&Pbkdf2Params{PRF: Pbkdf2SHA256, Iterations: 1000, Saltlen: 16, Keylen: 32},
+	} {
+		p, err := NewCustom(params)
+		if err != nil {
+			t.Fatalf("test #%d NewCustom: %v", i, err)
+		}
+
+		ctx := context.Background()
+		hashed, err := p.HashContext(ctx, []byte("password"))
+		if err != nil {
+			t.Fatalf("test #%d HashContext: %v", i, err)
+		}
+		if err := p.CompareContext(ctx, hashed, []byte("password")); err != nil {
+			t.Fatalf("test #%d CompareContext: %v", i, err)
+		}
+		if err := p.CompareContext(ctx, hashed, []byte("wrong")); err != ErrMismatch {
+			t.Fatalf("test #%d CompareContext: unexpected %v", i, err)
+		}
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		if _, err := p.HashContext(cancelled, []byte("password")); err != context.Canceled {
+			t.Fatalf("test #%d HashContext: unexpected %v", i, err)
+		}
+		if err := p.CompareContext(cancelled, hashed, []byte("password")); err != context.Canceled {
+			t.Fatalf("test #%d CompareContext: unexpected %v", i, err)
+		}
+	}
+
+	// the derivations stop at the first check after cancellation.
+	for i, params := range []interface{}{
+		&Argon2Params{Version: Argon2id, Time: 4, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32},
+		&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32},
+	} {
+		p, _ := NewCustom(params)
+		salt := bytes.Repeat([]byte{1}, 16)
+		key, err := p.Derive([]byte("password"), salt)
+		if err != nil {
+			t.Fatalf("test #%d Derive: %v", i, err)
+		}
+		dk, err := p.DeriveContext(context.Background(), []byte("password"), salt)
+		if err != nil || !bytes.Equal(dk, key) {
+			t.Fatalf("test #%d DeriveContext: %x (%v) expected %x", i, dk, err, key)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		steps := 0
+		_ = p.SetProgress(func(done, total int) {
+			steps++
+			cancel()
+		})
+		if _, err := p.DeriveContext(ctx, []byte("password"), salt); err != context.Canceled {
+			t.Fatalf("test #%d DeriveContext: unexpected %v", i, err)
+		}
+		if steps != 1 {
+			t.Fatalf("test #%d DeriveContext: %d progress steps after cancellation", i, steps-1)
+		}
+		_ = p.SetProgress(nil)
+		if _, err := p.HashContext(ctx, []byte("password")); err != context.Canceled {
+			t.Fatalf("test #%d HashContext: unexpected %v", i, err)
+		}
+	}
+
+	// waiting for the limiter gives up, the slot is not leaked.
+	l, _ := NewLimiter(1, 0)
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	_ = p.SetLimiter(l)
+	l.acquire(PriorityInteractive)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.HashContext(ctx, []byte("password")); err != context.DeadlineExceeded {
+		t.Fatalf("HashContext: unexpected %v", err)
+	}
+	l.release(PriorityInteractive)
+	if _, err := p.HashContext(context.Background(), []byte("password")); err != nil {
+		t.Fatalf("HashContext: %v", err)
+	}
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	if err := p.SetMaxConcurrency(-1, 0); err != ErrUnsupported {
+		t.Fatalf("SetMaxConcurrency: unexpected %v", err)
+	}
+	if err := p.SetMaxConcurrency(1, 1); err != nil {
+		t.Fatalf("SetMaxConcurrency: %v", err)
+	}
+	l := p.Limiter()
+
+	// one running, one waiting, the next is refused.
+	l.acquire(PriorityInteractive)
+	hashed := make(chan error, 1)
+	go func() {
+		_, err := p.Hash([]byte("password"))
+		hashed <- err
+	}()
+	for l.Stats().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := p.Hash([]byte("password")); err != ErrBusy {
+		t.Fatalf("Hash: got %v, expected %v", err, ErrBusy)
+	}
+	l.release(PriorityInteractive)
+	if err := <-hashed; err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	s := l.Stats()
+	if s.Running != 0 || s.Waiting != 0 || s.Started != 2 || s.Rejected != 1 {
+		t.Fatalf("Stats: %+v", s)
+	}
+
+	if err := p.SetMaxConcurrency(0, 0); err != nil || p.Limiter() != nil {
+		t.Fatalf("SetMaxConcurrency: limiter not detached (%v)", err)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	hashed, _ := p.Hash([]byte("password"))
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+
+	for i, test := range []struct {
+		hashed []byte
+		want   error
+		cause  bool
+	}{
+		{hashed, nil, false},
+		{[]byte("$garbage"), ErrParse, false},
+		{[]byte("$2s$!!!!$16$1$1$32$AAAA"), ErrParse, true},
+		{[]byte("$2s$AAAA$x$1$1$32$AAAA"), ErrParse, true},
+		{[]byte("$9z$AAAA$16$1$1$32$AAAA"), ErrUnsupportedAlgo, false},
+		{append([]byte("$2z"), legacy[3:]...), ErrUnsupportedAlgo, false},
+		{append([]byte("$2a$xx"), legacy[6:]...), ErrParse, true},
+	} {
+		err := Compare(test.hashed, []byte("password"))
+		if test.want == nil {
+			if err != nil {
+				t.Fatalf("test #%d: unexpected %v", i, err)
+			}
+			continue
+		}
+		if !isError(err, test.want) || isError(err, ErrMismatch) {
+			t.Fatalf("test #%d: got %v, expected %v", i, err, test.want)
+		}
+		if pe, ok := err.(*ParseError); test.cause && (!ok || pe.Unwrap() == nil) {
+			t.Fatalf("test #%d: %v does not wrap its cause", i, err)
+		}
+	}
+
+	phc := []byte("$argon2id$v=16$m=65536,t=2,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG")
+	if err := CompareAny(phc, []byte("password")); !isError(err, ErrIncompatibleVersion) {
+		t.Fatalf("CompareAny: unexpected %v", err)
+	}
+
+	// profiles too, a wrong password is still a mismatch.
+	if err := p.Compare([]byte("$2s$!!!!$16$1$1$32$AAAA"), []byte("password")); !isError(err, ErrParse) {
+		t.Fatalf("Compare: unexpected %v", err)
+	}
+	if err := p.Compare(hashed, []byte("wrong")); err != ErrMismatch {
+		t.Fatalf("Compare: unexpected %v", err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	p, err := NewArgon2(WithMemory(32<<10), WithTime(2), WithParallelism(2), WithSaltLen(24), WithKeyLen(32))
+	if err != nil {
+		t.Fatalf("NewArgon2: %v", err)
+	}
+	if v := p.params.(*Argon2Params); v.Version != Argon2id || v.Time != 2 || v.Memory != 32<<10 ||
+		v.Thread != 2 || v.Saltlen != 24 || v.Keylen != 32 || p.t != Argon2Custom {
+		t.Fatalf("NewArgon2: %+v", v)
+	}
+	hashed, err := p.Hash([]byte("password"))
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if err := Compare(hashed, []byte("password")); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+
+	for i, test := range []struct {
+		new  func(...Option) (*Profile, error)
+		opts []Option
+		want error
+	}{
+		{NewScrypt, []Option{WithN(1 << 17), WithBlockSize(8), WithParallelism(2)}, nil},
+		{NewBcrypt, []Option{WithCost(11)}, nil},
+		{NewPbkdf2, []Option{WithPRF(Pbkdf2SHA512), WithIterations(210000)}, nil},
+		{NewArgon2, []Option{WithMemory(1024)}, ErrUnsafe},
+		{NewArgon2, []Option{WithTime(0)}, ErrUnsafe},
+		{NewArgon2, []Option{WithParallelism(0)}, ErrUnsupported},
+		{NewArgon2, []Option{WithSaltLen(8)}, ErrUnsafe},
+		{NewArgon2, []Option{WithCost(12)}, ErrUnsupported},
+		{NewScrypt, []Option{WithN(1000)}, ErrUnsupported},
+		{NewScrypt, []Option{WithN(1 << 10)}, ErrUnsafe},
+		{NewScrypt, []Option{WithKeyLen(16)}, ErrUnsafe},
+		{NewScrypt, []Option{WithMemory(1 << 20)}, ErrUnsupported},
+		{NewBcrypt, []Option{WithCost(4)}, ErrUnsafe},
+		{NewBcrypt, []Option{WithCost(32)}, ErrUnsupported},
+		{NewBcrypt, []Option{WithSaltLen(16)}, ErrUnsupported},
+		{NewPbkdf2, []Option{WithIterations(10)}, ErrUnsafe},
+		{NewPbkdf2, []Option{WithPRF(7)}, ErrUnsupported},
+	} {
+		_, err := test.new(test.opts...)
+		if test.want == nil {
+			if err != nil {
+				t.Fatalf("test #%d: unexpected %v", i, err)
+			}
+			continue
+		}
+		oe, ok := err.(*OptionError)
+		if !ok || !isError(err, test.want) || oe.Option == "" {
+			t.Fatalf("test #%d: got %v, expected %v", i, err, test.want)
+		}
+	}
+
+	// the descriptive error.
+	_, err = NewArgon2(WithMemory(1024))
+	if err.Error() != "unsafe parameters: memory 1024 KiB, minimum 16384 KiB" {
+		t.Fatalf("NewArgon2: %v", err)
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	password := []byte("password")
+	legacy := []byte("0123456789abcdefghijklmnopqrstuv")
+	first := []byte("vutsrqponmlkjihgfedcba9876543210")
+	second := []byte("abcdefghijklmnopqrstuv0123456789")
+
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	_ = p.SetSecret(legacy)
+	old, _ := p.Hash(password)
+
+	for i, test := range []struct {
+		secrets map[string][]byte
+		active  string
+		want    error
+	}{
+		{map[string][]byte{"k1": first}, "k2", ErrUnsupported},
+		{map[string][]byte{"": legacy}, "", ErrUnsupported},
+		{map[string][]byte{"k,1": first}, "k,1", ErrUnsupported},
+		{map[string][]byte{"k1": first, "k0": []byte("short")}, "k1", ErrSecretTooShort},
+	} {
+		if err := p.SetSecrets(test.secrets, test.active); err != test.want {
+			t.Fatalf("test #%d: got %v, expected %v", i, err, test.want)
+		}
+	}
+
+	if err := p.SetSecrets(map[string][]byte{"": legacy, "k1": first}, "k1"); err != nil {
+		t.Fatalf("SetSecrets: %v", err)
+	}
+	h1, _ := p.Hash(password)
+	if id := SecretID(h1); id != "k1" {
+		t.Fatalf("SecretID: %q", id)
+	}
+
+	// rotation to k2, the k1 and legacy hashes are still verified.
+	if err := p.SetSecrets(map[string][]byte{"": legacy, "k1": first, "k2": second}, "k2"); err != nil {
+		t.Fatalf("SetSecrets: %v", err)
+	}
+	h2, _ := p.Hash(password)
+	for i, hashed := range [][]byte{old, h1, h2} {
+		if err := p.Compare(hashed, password); err != nil {
+			t.Fatalf("test #%d Compare: %v", i, err)
+		}
+		if err := p.Compare(hashed, []byte("wrong")); err != ErrMismatch {
+			t.Fatalf("test #%d Compare: unexpected %v", i, err)
+		}
+		r, err := p.CompareEx(hashed, password)
+		if err != nil || r.NeedsRehash != (i < 2) {
+			t.Fatalf("test #%d CompareEx: %+v (%v)", i, r, err)
+		}
+
+		rehashed, err := p.RehashWithActiveSecret(hashed, password)
+		if err != nil || SecretID(rehashed) != "k2" || (i == 2) != bytes.Equal(rehashed, hashed) {
+			t.Fatalf("test #%d RehashWithActiveSecret: %s (%v)", i, rehashed, err)
+		}
+		if err := p.Compare(rehashed, password); err != nil {
+			t.Fatalf("test #%d Compare: %v", i, err)
+		}
+	}
+	if _, err := p.RehashWithActiveSecret(h1, []byte("wrong")); err != ErrMismatch {
+		t.Fatalf("RehashWithActiveSecret: unexpected %v", err)
+	}
+
+	// k1 retired.
+	_ = p.SetSecrets(map[string][]byte{"k2": second}, "k2")
+	if err := p.Compare(h1, password); err != ErrMismatch {
+		t.Fatalf("Compare: unexpected %v", err)
+	}
+	if err := p.Compare(h2, password); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+
+	// locked hashes refused as such, unknown IDs padded.
+	if err := p.Compare(Lock(h2), password); err != ErrLocked {
+		t.Fatalf("Compare locked: got %v, expected %v", err, ErrLocked)
+	}
+	_ = p.SetCompareDuration(20 * time.Millisecond)
+	start := time.Now()
+	if err := p.Compare(h1, password); err != ErrMismatch {
+		t.Fatalf("Compare: unexpected %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("Compare unknown ID: returned after %v", elapsed)
+	}
+
+	b, _ := NewCustom(&BcryptParams{Cost: bcrypt.MinCost})
+	if err := b.SetSecrets(map[string][]byte{"k1": first}, "k1"); err != nil {
+		t.Fatalf("SetSecrets: %v", err)
+	}
+	hb, _ := b.Hash(password)
+	if SecretID(hb) != "k1" {
+		t.Fatalf("SecretID: %q", SecretID(hb))
+	}
+	if err := b.Compare(hb, password); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+}
+
+func TestBcryptPepper(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	long := bytes.Repeat([]byte("a"), 100)
+
+	p, _ := NewCustom(&BcryptParams{Cost: bcrypt.MinCost})
+	if err := p.SetKey(secret); err != nil {
+		t.Fatalf("SetKey: %v", err)
+	}
+
+	hashed, err := p.Hash(long)
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if !bytes.Contains(hashed, []byte(metaBcryptKeyed+"=1")) {
+		t.Fatalf("missing marker: %s", hashed)
+	}
+	if err := p.Compare(hashed, long); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	// no more truncation, the 72 bytes prefix is another password.
+	if err := p.Compare(hashed, long[:bcryptMaxPassword]); err != ErrMismatch {
+		t.Fatalf("Compare truncated: unexpected %v", err)
+	}
+
+	// the secret is needed.
+	if err := Compare(hashed, long); err == nil {
+		t.Fatalf("Compare without secret succeeded")
+	}
+	other, _ := NewCustom(&BcryptParams{Cost: bcrypt.MinCost})
+	_ = other.SetKey([]byte("fedcba9876543210fedcba9876543210"))
+	if err := other.Compare(hashed, long); err != ErrMismatch {
+		t.Fatalf("Compare other secret: unexpected %v", err)
+	}
+
+	// plain bcrypt hashes are not verified by key'ed profiles.
+	plain, _ := NewCustom(&BcryptParams{Cost: bcrypt.MinCost})
+	hp, _ := plain.Hash([]byte("password"))
+	if err := p.Compare(hp, []byte("password")); err != ErrMismatch {
+		t.Fatalf("Compare plain: unexpected %v", err)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	password := []byte("password")
+	argon := &Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32}
+
+	a, _ := NewCustom(argon)
+	ha, _ := a.Hash(password)
+	info, err := Info(ha)
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	ap, ok := info.Params.(*Argon2Params)
+	if info.ID != idArgon2id || info.Algorithm != "argon2id" || info.Version != 0x13 ||
+		info.Saltlen != 16 || info.Masked || info.Keyed || !ok || ap.Memory != 64 || ap.Time != 1 {
+		t.Fatalf("argon2 info: %+v", info)
+	}
+
+	b, _ := NewCustom(&BcryptParams{Cost: bcrypt.MinCost})
+	hb, _ := b.Hash(password)
+	info, err = Info(hb)
+	if bp, ok := info.Params.(*BcryptParams); err != nil || info.Algorithm != "bcrypt" || !ok || bp.Cost != bcrypt.MinCost {
+		t.Fatalf("bcrypt info: %+v %v", info, err)
+	}
+
+	// PHC encoded.
+	phc, _ := Reencode(ha, FormatPHC)
+	if info, err := Info(phc); err != nil || info.ID != idArgon2id || info.Saltlen != 16 {
+		t.Fatalf("phc info: %+v %v", info, err)
+	}
+
+	// masked and key'ed.
+	m, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32, Masked: true})
+	_ = m.SetSecrets(map[string][]byte{"k1": []byte("0123456789abcdef0123456789abcdef")}, "k1")
+	hm, _ := m.Hash(password)
+	info, err = Info(Lock(hm))
+	if err != nil || info.Algorithm != "scrypt" || !info.Masked || !info.Keyed || !info.Locked ||
+		info.Params != nil || info.Saltlen != 16 {
+		t.Fatalf("masked info: %+v %v", info, err)
+	}
+
+	for _, test := range []struct {
+		hashed string
+		want   error
+	}{
+		{"$garbage", ErrParse},
+		{"$9z$c2FsdA$aGFzaA", ErrUnsupportedAlgo},
+		{"", ErrParse},
+	} {
+		if _, err := Info([]byte(test.hashed)); !isError(err, test.want) {
+			t.Fatalf("Info(%q): %v vs expected %v", test.hashed, err, test.want)
+		}
+	}
+}
+
+func TestMaskedRegistry(t *testing.T) {
+	password := []byte("password")
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	v1 := &ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32}
+	v2 := &ScryptParams{N: 1 << 11, R: 8, P: 1, Saltlen: 16, Keylen: 32}
+
+	r := NewMaskedRegistry()
+	for i, test := range []struct {
+		tag    string
+		params interface{}
+		want   error
+	}{
+		{"v1", v1, nil},
+		{"v2", v2, nil},
+		{"v1", v2, ErrUnsupported},
+		{"bad tag", v1, ErrUnsupported},
+		{"v3", &BcryptParams{Cost: bcrypt.MinCost}, ErrUnsupported},
+	} {
+		if err := r.Register(test.tag, test.params); err != test.want {
+			t.Fatalf("test #%d: Register: %v vs expected %v", i, err, test.want)
+		}
+	}
+
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32, Masked: true})
+	_ = p.SetKey(secret)
+	if err := p.SetMaskedRegistry(r, "v9"); err != ErrUnsupported {
+		t.Fatalf("SetMaskedRegistry: unexpected %v", err)
+	}
+	if err := p.SetMaskedRegistry(r, "v1"); err != nil {
+		t.Fatalf("SetMaskedRegistry: %v", err)
+	}
+	h1, _ := p.Hash(password)
+	if MaskedTag(h1) != "v1" || bytes.Contains(h1, []byte("$1024$")) {
+		t.Fatalf("hash: %s", h1)
+	}
+	if info, err := Info(h1); err != nil || !info.Masked {
+		t.Fatalf("Info: %+v %v", info, err)
+	}
+
+	// tuned parameters.
+	if err := p.SetMaskedRegistry(r, "v2"); err != nil {
+		t.Fatalf("SetMaskedRegistry: %v", err)
+	}
+	h2, _ := p.Hash(password)
+	if MaskedTag(h2) != "v2" {
+		t.Fatalf("hash: %s", h2)
+	}
+	for _, h := range [][]byte{h1, h2} {
+		if err := p.Compare(h, password); err != nil {
+			t.Fatalf("Compare(%s): %v", h, err)
+		}
+	}
+	res, err := p.CompareEx(h1, password)
+	if sp, ok := res.Params.(*ScryptParams); err != nil || !res.NeedsRehash || !ok || sp.N != 1<<10 {
+		t.Fatalf("CompareEx: %+v %v", res, err)
+	}
+	if p.NeedsRehash(h2) {
+		t.Fatalf("NeedsRehash: current tag")
+	}
+
+	// the tag selects the parameters, not the recorded one.
+	forged := bytes.Replace(h1, []byte("mv=v1"), []byte("mv=v2"), 1)
+	if err := p.Compare(forged, password); err != ErrMismatch {
+		t.Fatalf("Compare forged: unexpected %v", err)
+	}
+	unknown := bytes.Replace(h1, []byte("mv=v1"), []byte("mv=v7"), 1)
+	if err := p.Compare(unknown, password); err != ErrMismatch {
+		t.Fatalf("Compare unknown: unexpected %v", err)
+	}
+}
+
+func TestDummyCompare(t *testing.T) {
+	password := []byte("password")
+	for _, params := range []interface{}{
+		&Argon2Params{Version: Argon2id, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32},
+		&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32, Masked: true},
+		&BcryptParams{Cost: bcrypt.MinCost},
+		&Pbkdf2Params{PRF: Pbkdf2SHA256, Iterations: 1000, Saltlen: 16, Keylen: 32},
+	} {
+		p, _ := NewCustom(params)
+		var ops []Stats
+		_ = p.SetStatsHook(func(st Stats) { ops = append(ops, st) })
+
+		hashed, _ := p.Hash(password)
+		ops = ops[:0]
+		_ = p.Compare(hashed, password)
+		if err := p.DummyCompare(password); err != ErrMismatch {
+			t.Fatalf("%T: DummyCompare: unexpected %v", params, err)
+		}
+		if len(ops) != 2 || ops[1].Op != "compare" || ops[1].Algorithm != ops[0].Algorithm || ops[1].Memory != ops[0].Memory {
+			t.Fatalf("%T: stats: %+v", params, ops)
+		}
+	}
+
+	p, _ := NewCustom(&Pbkdf2Params{PRF: Pbkdf2SHA256, Iterations: 1000, Saltlen: 16, Keylen: 32})
+	_ = p.SetCompareDuration(20 * time.Millisecond)
+	start := time.Now()
+	if err := p.DummyCompare(nil); err != ErrMismatch {
+		t.Fatalf("DummyCompare: unexpected %v", err)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Fatalf("DummyCompare: not padded")
+	}
+}
+
+func TestParseBounds(t *testing.T) {
+	salt := "sT/eXtwSAJHP6rsglmolxe"
+	hash := "LIFT/xDaVv1XcFRLY/XBLjIztaJoK9BLtjFIiLnaXvW"
+	for i, test := range []struct {
+		hashed string
+		want   error
+	}{
+		{"$2s$" + salt + "$65536$8$1$32$" + hash, nil},
+		{"", ErrParse},
+		{"$", ErrParse},
+		{"2s$" + salt + "$65536$8$1$32$" + hash, ErrParse},
+		{"$2s$$" + salt + "$65536$8$1$32$" + hash, ErrParse},
+		{"$2s$" + salt + "$65536$8$1$32$" + hash + "$x", ErrParse},
+		{"$2s$" + salt + "$65535$8$1$32$" + hash, ErrParse},           // N not a power of 2
+		{"$2s$" + salt + "$-65536$8$1$32$" + hash, ErrParse},          // negative
+		{"$2s$" + salt + "$1073741824$8$1$32$" + hash, ErrParse},      // 1 TiB
+		{"$2s$" + salt + "$65536$1073741823$2$32$" + hash, ErrParse},  // r * p
+		{"$2s$" + salt + "$65536$8$1$4096$" + hash, ErrParse},         // key length
+		{"$2s$sT/eXtwSAJHP6rsglmolxf$65536$8$1$32$" + hash, ErrParse}, // non canonical salt
+		{"$2s$sT/eXtwSAJHP6rsgl\nmolxe$65536$8$1$32$" + hash, ErrParse},
+		{"$2id$" + salt + "$1$4294967295$8$32$" + hash, ErrParse},
+		{"$2id$" + salt + "$1$65536$256$32$" + hash, ErrParse},
+		{"$2id$" + salt + "$0$65536$8$32$" + hash, ErrParse},
+		{"$2id$" + salt + "$1$16$8$32$" + hash, ErrParse}, // 8 KiB per lane
+		{"$2k$" + salt + "$0$32$" + hash, ErrParse},
+		{"$2s$" + strings.Repeat("a", maxHashLength) + "$65536$8$1$32$" + hash, ErrParse},
+	} {
+		_, err := parseFromHashToParams([]byte(test.hashed))
+		if test.want == nil && err != nil || test.want != nil && !isError(err, test.want) {
+			t.Fatalf("test #%d: err: %v vs expected: %v", i, err, test.want)
+		}
+	}
+}
+
+func TestDeriveKeys(t *testing.T) {
+	password, salt := []byte("password"), []byte("0123456789abcdef")
+	p, _ := NewCustom(&Pbkdf2Params{PRF: Pbkdf2SHA256, Iterations: 1000, Saltlen: 16, Keylen: 32})
+
+	// vectors: HKDF-SHA3-256 (no salt) of the PBKDF2-HMAC-SHA256 key
+	// 8514638175a45bc45eb1f22f04ff7d27f4f8be480498c455ff4b494ce8d1e7d2.
+	keys, err := p.DeriveKeys(password, salt, []byte("encryption"), []byte("mac"))
+	if err != nil {
+		t.Fatalf("DeriveKeys: %v", err)
+	}
+	for i, want := range []string{
+		"617d5d1e4fa9de03b63958e9090524e76b0364f6571c31d0aad7c5b7822de058",
+		"87e93767beaddde8c58fe842b8110ff7f5585c668c2144e555f2c231ec8261a0",
+	} {
+		if got := hex.EncodeToString(keys[i]); got != want {
+			t.Fatalf("key #%d: %s vs expected %s", i, got, want)
+		}
+	}
+
+	// a single KDF run.
+	var runs int
+	_ = p.SetStatsHook(func(Stats) { runs++ })
+	if _, err := p.DeriveKeys(password, salt, []byte("a"), []byte("b"), []byte("c")); err != nil || runs != 1 {
+		t.Fatalf("DeriveKeys: %d runs, %v", runs, err)
+	}
+
+	for i, infos := range [][][]byte{
+		nil,
+		{[]byte("mac"), []byte("mac")},
+	} {
+		if _, err := p.DeriveKeys(password, salt, infos...); err != ErrUnsupported {
+			t.Fatalf("test #%d: unexpected %v", i, err)
+		}
+	}
+	b, _ := NewCustom(&BcryptParams{Cost: bcrypt.MinCost})
+	if _, err := b.DeriveKeys(password, salt, []byte("mac")); err != ErrUnsupported {
+		t.Fatalf("bcrypt: unexpected %v", err)
+	}
+}
+
+func TestBufferPool(t *testing.T) {
+	password := []byte("password")
+	params := &Argon2Params{Version: Argon2id, Time: 1, Memory: 8 << 10, Thread: 2, Saltlen: 16, Keylen: 32}
+	plain, _ := NewCustom(params)
+	p, _ := NewCustom(&Argon2Params{Version: Argon2id, Time: 1, Memory: 8 << 10, Thread: 2, Saltlen: 16, Keylen: 32})
+	if err := p.SetBufferPool(2); err != nil {
+		t.Fatalf("SetBufferPool: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hashed, err := p.Hash(password)
+			if err != nil {
+				t.Errorf("Hash: %v", err)
+				return
+			}
+			if err := plain.Compare(hashed, password); err != nil {
+				t.Errorf("Compare: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if idle := p.params.(*Argon2Params).pool.Idle(); idle == 0 || idle > 2 {
+		t.Fatalf("idle buffers: %d", idle)
+	}
+
+	// the 8 MiB working memory is reused.
+	hashed, _ := plain.Hash(password)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if err := p.Compare(hashed, password); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Fatalf("Compare allocated %d bytes", n)
+	}
+
+	b, _ := NewCustom(&BcryptParams{Cost: bcrypt.MinCost})
+	if err := b.SetBufferPool(2); err != ErrUnsupported {
+		t.Fatalf("bcrypt: unexpected %v", err)
+	}
+	if err := p.SetBufferPool(-1); err != ErrUnsupported {
+		t.Fatalf("SetBufferPool(-1): unexpected %v", err)
+	}
+}
+
+func TestWipeInput(t *testing.T) {
+	zero := func(b []byte) bool { return bytes.Equal(b, make([]byte, len(b))) }
+
+	b := []byte("secret")
+	WipeBytes(b)
+	if !zero(b) {
+		t.Fatalf("WipeBytes: %q", b)
+	}
+
+	params := &Pbkdf2Params{PRF: Pbkdf2SHA256, Iterations: 1000, Saltlen: 16, Keylen: 32}
+	p, _ := NewCustom(params)
+	_ = p.SetKey([]byte("0123456789abcdef0123456789abcdef"))
+	_ = p.SetPepperStrategy(PepperPreHash)
+	hashed, _ := p.Hash([]byte("password"))
+
+	_ = p.SetWipeInput(true)
+	for i, f := range []func(pw []byte) error{
+		func(pw []byte) error { _, err := p.Hash(pw); return err },
+		func(pw []byte) error { return p.Compare(hashed, pw) },
+		func(pw []byte) error { _, err := p.CompareEx(hashed, pw); return err },
+		func(pw []byte) error { _, err := p.Derive(pw, []byte("0123456789abcdef")); return err },
+		func(pw []byte) error { return p.DummyCompare(pw) },
+	} {
+		pw := []byte("password")
+		if err := f(pw); err != nil && err != ErrMismatch {
+			t.Fatalf("test #%d: %v", i, err)
+		}
+		if !zero(pw) {
+			t.Fatalf("test #%d: password not wiped: %q", i, pw)
+		}
+	}
+
+	// methods using the password twice.
+	older, _ := NewCustom(&Pbkdf2Params{PRF: Pbkdf2SHA256, Iterations: 1000, Saltlen: 16, Keylen: 16})
+	stale, _ := older.Hash([]byte("password"))
+	q, _ := NewCustom(&Pbkdf2Params{PRF: Pbkdf2SHA256, Iterations: 1000, Saltlen: 16, Keylen: 32})
+	_ = q.SetWipeInput(true)
+	pw := []byte("password")
+	rehashed, err := q.Rehash(stale, pw)
+	if err != nil || rehashed == nil || !zero(pw) {
+		t.Fatalf("Rehash: %v %q", err, pw)
+	}
+	if err := Compare(rehashed, []byte("password")); err != nil {
+		t.Fatalf("Compare rehashed: %v", err)
+	}
+
+	d := DualWrite{Legacy: older, Current: q}
+	pw = []byte("password")
+	if err := d.Compare(stale, pw); err != nil || !zero(pw) {
+		t.Fatalf("DualWrite.Compare: %v %q", err, pw)
+	}
+
+	// off by default.
+	pw = []byte("password")
+	_, _ = older.Hash(pw)
+	if zero(pw) {
+		t.Fatalf("password wiped")
+	}
+}
+
+func TestCompareBatch(t *testing.T) {
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+
+	var pairs []HashPasswordPair
+	for i := 0; i < 16; i++ {
+		pw := []byte(fmt.Sprintf("password-%d", i))
+		hashed, err := p.Hash(pw)
+		if err != nil {
+			t.Fatalf("Hash: %v", err)
+		}
+		if i%3 == 0 {
+			pw = []byte("wrong")
+		}
+		pairs = append(pairs, HashPasswordPair{Hashed: hashed, Password: pw})
+	}
+	pairs = append(pairs, HashPasswordPair{Hashed: []byte("$garbage"), Password: []byte("x")})
+
+	check := func(name string, errs []error) {
+		if len(errs) != len(pairs) {
+			t.Fatalf("%s: %d results", name, len(errs))
+		}
+		for i, err := range errs[:16] {
+			if i%3 == 0 && err != ErrMismatch || i%3 != 0 && err != nil {
+				t.Fatalf("%s: pair #%d: %v", name, i, err)
+			}
+		}
+		if errs[16] == nil {
+			t.Fatalf("%s: garbage hash matched", name)
+		}
+	}
+
+	check("default", p.CompareBatch(pairs, 0))
+	check("single", p.CompareBatch(pairs, 1))
+
+	// the budget fits 2 computations, the others wait.
+	m := paramsMemory(p.params)
+	_ = p.SetMemoryBudget(NewMemoryBudget(2 * m))
+	if n := p.batchWorkers(8); n != 2 {
+		t.Fatalf("batchWorkers: %d", n)
+	}
+	check("budget", p.CompareBatch(pairs, 8))
+
+	// budget taken by someone else for a while.
+	release, _ := p.Reserve()
+	release2, _ := p.Reserve()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		release()
+		release2()
+	}()
+	check("busy", p.CompareBatch(pairs, 8))
+
+	// cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i, err := range p.CompareBatchContext(ctx, pairs, 4) {
+		if err != context.Canceled {
+			t.Fatalf("cancelled: pair #%d: %v", i, err)
+		}
+	}
+
+	if errs := p.CompareBatch(nil, 4); len(errs) != 0 {
+		t.Fatalf("empty batch: %v", errs)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	// parameters (un)marshaling.
+	type settings struct {
+		Argon  Argon2Params  `json:"argon"`
+		Scrypt *ScryptParams `json:"scrypt"`
+		Bcrypt BcryptParams  `json:"bcrypt"`
+		Pbkdf2 Pbkdf2Params  `json:"pbkdf2"`
+	}
+	in := settings{
+		Argon:  Argon2Params{Version: Argon2id, Time: 3, Memory: 65536, Thread: 4, Saltlen: 16, Keylen: 32},
+		Scrypt: &ScryptParams{N: 1 << 15, R: 8, P: 1, Saltlen: 16, Keylen: 32},
+		Bcrypt: BcryptParams{Cost: 12},
+		Pbkdf2: Pbkdf2Params{PRF: Pbkdf2SHA512, Iterations: 210000, Saltlen: 16, Keylen: 64},
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want := `{"argon":"argon2id:m=65536,t=3,p=4,l=32,s=16","scrypt":"scrypt:ln=15,r=8,p=1,l=32,s=16","bcrypt":"bcrypt:cost=12","pbkdf2":"pbkdf2-sha512:i=210000,l=64,s=16"}`
+	if string(data) != want {
+		t.Fatalf("Marshal: %s", data)
+	}
+	var out settings
+	err = json.Unmarshal(data, &out)
+	again, _ := json.Marshal(out)
+	if err != nil || string(again) != want {
+		t.Fatalf("Unmarshal: %v %s", err, again)
+	}
+	var a Argon2Params
+	if err := json.Unmarshal([]byte(`"scrypt:ln=15"`), &a); err == nil {
+		t.Fatalf("Unmarshal: scrypt into argon2")
+	}
+	if err := json.Unmarshal([]byte(`"argon2id:m=65536,x=1"`), &a); err == nil {
+		t.Fatalf("Unmarshal: unknown key")
+	}
+
+	// profiles.
+	tests := []struct {
+		config string
+		want   error
+	}{
+		{`{"profile": "argon2id-default"}`, nil},
+		{`{"profile": "scrypt-default", "masked": true}`, nil},
+		{`{"params": "argon2id:m=64,t=1,p=1,l=32,s=16"}`, ErrUnsafe},
+		{`{"params": "pbkdf2-sha256:i=100,l=32,s=16"}`, ErrUnsupported},
+		{`{"params": "pbkdf2-sha256:i=600000,l=32,s=16", "masked": true}`, nil},
+		{`{"params": "bcrypt:cost=10", "masked": true}`, ErrUnsupported},
+		{`{"params": "bcrypt:cost=4"}`, ErrUnsafe},
+		{`{"params": "bcrypt:cost=10", "profile": "bcrypt-default"}`, ErrUnsupported},
+		{`{"params": "md5:r=1"}`, ErrUnsupported},
+		{`{"profile": "md5"}`, ErrUnsupported},
+		{`{}`, ErrUnsupported},
+		{`{"parms": "bcrypt:cost=10"}`, ErrParse},
+	}
+	for i, test := range tests {
+		cfg, err := ParseConfig([]byte(test.config))
+		if err == nil {
+			var p *Profile
+			p, err = NewFromConfig(cfg)
+			if err == nil && p.params == nil {
+				t.Fatalf("test #%d: no parameters", i)
+			}
+		}
+		if test.want == nil && err != nil || test.want != nil && !isError(err, test.want) {
+			t.Fatalf("test #%d: %v, want %v", i, err, test.want)
+		}
+	}
+
+	cfg, _ := ParseConfig([]byte(`{"params": "pbkdf2-sha256:i=600000,l=32,s=16", "masked": true}`))
+	p, _ := NewFromConfig(cfg)
+	if v, ok := p.params.(*Pbkdf2Params); !ok || !v.Masked || v.Iterations != 600000 {
+		t.Fatalf("NewFromConfig: %+v", p.params)
+	}
+}
+
+func TestEncryptionKey(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	params := &ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32}
+
+	p, _ := NewCustom(params)
+	if err := p.SetEncryptionKey([]byte("short")); err != ErrUnsupported {
+		t.Fatalf("SetEncryptionKey: %v", err)
+	}
+	_ = p.SetIntegrityTag(true)
+	plain, _ := p.Hash([]byte("password"))
+	_ = p.SetEncryptionKey(key)
+
+	hashed, err := p.Hash([]byte("password"))
+	if err != nil || !bytes.HasPrefix(hashed, []byte("$2e$")) || bytes.Contains(hashed, []byte("$2s$")) {
+		t.Fatalf("Hash: %v %s", err, hashed)
+	}
+	if err := p.Compare(hashed, []byte("password")); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	if err := p.Compare(hashed, []byte("wrong")); err != ErrMismatch {
+		t.Fatalf("Compare wrong: %v", err)
+	}
+	r, err := p.CompareEx(hashed, []byte("password"))
+	if err != nil || r.NeedsRehash || r.Algorithm != idScrypt || p.NeedsRehash(hashed) {
+		t.Fatalf("CompareEx: %v %+v", err, r)
+	}
+
+	// the plain hashes still verify and need a rehash.
+	r, err = p.CompareEx(plain, []byte("password"))
+	if err != nil || !r.NeedsRehash || !p.NeedsRehash(plain) {
+		t.Fatalf("CompareEx plain: %v %+v", err, r)
+	}
+	converted, err := p.EncryptHash(plain)
+	if err != nil || !isEncrypted(converted) || p.NeedsRehash(converted) {
+		t.Fatalf("EncryptHash: %v %s", err, converted)
+	}
+	if err := p.Compare(converted, []byte("password")); err != nil {
+		t.Fatalf("Compare converted: %v", err)
+	}
+	if again, _ := p.EncryptHash(converted); !bytes.Equal(again, converted) {
+		t.Fatalf("EncryptHash: encrypted twice")
+	}
+	decrypted, err := p.DecryptHash(converted)
+	if err != nil || !bytes.Equal(decrypted, plain) {
+		t.Fatalf("DecryptHash: %v %s", err, decrypted)
+	}
+
+	// tampered, another key, no key.
+	tampered := append([]byte{}, hashed...)
+	tampered[10] ^= 1
+	if err := p.Compare(tampered, []byte("password")); err != ErrCorrupted {
+		t.Fatalf("Compare tampered: %v", err)
+	}
+	q, _ := NewCustom(params)
+	_ = q.SetEncryptionKey(bytes.Repeat([]byte{0x43}, 32))
+	if err := q.Compare(hashed, []byte("password")); err != ErrCorrupted {
+		t.Fatalf("Compare other key: %v", err)
+	}
+	if _, err := q.DecryptHash(hashed); err != ErrCorrupted {
+		t.Fatalf("DecryptHash other key: %v", err)
+	}
+	_ = q.SetEncryptionKey(nil)
+	if err := q.Compare(hashed, []byte("password")); err != ErrMismatch {
+		t.Fatalf("Compare no key: %v", err)
+	}
+	if err := Compare(hashed, []byte("password")); err == nil {
+		t.Fatalf("package Compare: matched")
+	}
+
+	// lock markers wrap the encrypted value.
+	if err := p.Compare(Lock(hashed), []byte("password")); err != ErrLocked {
+		t.Fatalf("Compare locked: %v", err)
+	}
+
+	// the refused ciphertexts are padded.
+	_ = p.SetCompareDuration(20 * time.Millisecond)
+	_ = q.SetCompareDuration(20 * time.Millisecond)
+	for i, test := range []struct {
+		p    *Profile
+		want error
+	}{
+		{p, ErrCorrupted},
+		{q, ErrMismatch},
+	} {
+		start := time.Now()
+		if err := test.p.Compare(tampered, []byte("password")); err != test.want {
+			t.Fatalf("test #%d Compare: %v, want %v", i, err, test.want)
+		}
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+			t.Fatalf("test #%d Compare: returned after %v", i, elapsed)
+		}
+	}
+}
+
+func TestArgon2Variants(t *testing.T) {
+	// x/crypto/argon2 vectors, password "password", salt "somesalt".
+	vectors := []string{
+		"$argon2i$v=19$m=64,t=1,p=1$c29tZXNhbHQ$ucQB0YRKZ9UOrjln3CiHCyLlCAkuhho3",
+		"$argon2d$v=19$m=64,t=1,p=1$c29tZXNhbHQ$hydAX9B8MseNZPVH8kFQ0/LnA6ifmBoZ",
+		"$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7",
+		"$argon2i$v=19$m=64,t=2,p=1$c29tZXNhbHQ$jPPY92pmF6/jX6xI6wt0M6mmcMpKB+1k",
+		"$argon2d$v=19$m=64,t=2,p=1$c29tZXNhbHQ$O+nseaabddN1KstZofu4spWkZSnEj7t1",
+		"$argon2id$v=19$m=64,t=2,p=1$c29tZXNhbHQ$Bo1ismRVk2qm6+YAYLCmWHDb+j3fjUH3",
+	}
+	versions := []int{Argon2i, Argon2d, Argon2id}
+	for i, vector := range vectors {
+		if err := Compare([]byte(vector), []byte("password")); err != nil {
+			t.Fatalf("vector #%d: %v", i, err)
+		}
+		if err := Compare([]byte(vector), []byte("passwort")); err != ErrMismatch {
+			t.Fatalf("vector #%d wrong password: %v", i, err)
+		}
+		info, err := Info([]byte(vector))
+		if err != nil || info.Version != 0x13 || info.Params.(*Argon2Params).Version != versions[i%3] {
+			t.Fatalf("vector #%d Info: %v %+v", i, err, info)
+		}
+		native, _ := Reencode([]byte(vector), FormatNative)
+		phc, _ := Reencode(native, FormatPHC)
+		if string(phc) != vector {
+			t.Fatalf("vector #%d Reencode: %s", i, phc)
+		}
+	}
+
+	// the other argon2 versions.
+	for i, vector := range []string{
+		"$argon2i$m=65536,t=2,p=1$c29tZXNhbHQ$9sTbSlTio3Biev89thdrlKKiCaYsjjYVJxGAL3swxpQ",
+		"$argon2id$v=16$m=64,t=1,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7",
+		"$argon2d$v=20$m=64,t=1,p=1$c29tZXNhbHQ$hydAX9B8MseNZPVH8kFQ0/LnA6ifmBoZ",
+	} {
+		if err := Compare([]byte(vector), []byte("password")); !isError(err, ErrIncompatibleVersion) {
+			t.Fatalf("version #%d Compare: %v", i, err)
+		}
+		if _, err := Info([]byte(vector)); !isError(err, ErrIncompatibleVersion) {
+			t.Fatalf("version #%d Info: %v", i, err)
+		}
+		p, _ := New(Argon2idDefault)
+		_ = p.SetEncoding(FormatPHC)
+		if err := p.Compare([]byte(vector), []byte("password")); !isError(err, ErrIncompatibleVersion) {
+			t.Fatalf("version #%d profile Compare: %v", i, err)
+		}
+	}
+
+	// profiles.
+	p, err := New(Argon2iDefault)
+	if err != nil {
+		t.Fatalf("New(Argon2iDefault): %v", err)
+	}
+	if v := p.params.(*Argon2Params); v.Version != Argon2i || v.Time < 3 {
+		t.Fatalf("Argon2iDefault: %+v", v)
+	}
+	if _, err := NewMasked(Argon2iParanoid); err != nil {
+		t.Fatalf("NewMasked(Argon2iParanoid): %v", err)
+	}
+	if profile, ok := profileByName("argon2i-default"); !ok || profile != Argon2iDefault {
+		t.Fatalf("profileByName: %v", profile)
+	}
+
+	for _, version := range []int{Argon2i, Argon2d} {
+		q, _ := NewCustom(&Argon2Params{Version: version, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+		hashed, err := q.Hash([]byte("password"))
+		if err != nil {
+			t.Fatalf("Hash: %v", err)
+		}
+		id, _ := q.params.(*Argon2Params).variant()
+		if !bytes.HasPrefix(hashed, []byte("$"+id+"$")) {
+			t.Fatalf("Hash: %s", hashed)
+		}
+		if err := Compare(hashed, []byte("password")); err != nil {
+			t.Fatalf("Compare %s: %v", hashed, err)
+		}
+		// the variants do not verify each other.
+		other := bytes.Replace(hashed, []byte("$"+id+"$"), []byte("$2id$"), 1)
+		if err := Compare(other, []byte("password")); err != ErrMismatch {
+			t.Fatalf("Compare as argon2id: %v", err)
+		}
+		r, err := q.CompareEx(hashed, []byte("password"))
+		if err != nil || r.Algorithm != id || r.NeedsRehash {
+			t.Fatalf("CompareEx: %v %+v", err, r)
+		}
+	}
+
+	// specifications.
+	params, err := ParseSpec("argon2d:m=65536,t=3,p=4")
+	if err != nil || params.(*Argon2Params).Version != Argon2d {
+		t.Fatalf("ParseSpec: %v %+v", err, params)
+	}
+	if spec, _ := FormatSpec(params); spec != "argon2d:m=65536,t=3,p=4,l=32,s=16" {
+		t.Fatalf("FormatSpec: %s", spec)
+	}
+	params, _ = ParseSpec("argon2i")
+	if v := params.(*Argon2Params); v.Version != Argon2i || v.Time != argon2iCommonParameters.Time {
+		t.Fatalf("ParseSpec(argon2i): %+v", v)
+	}
+
+	// argon2d is not run on clients.
+	d, _ := NewCustom(&Argon2Params{Version: Argon2d, Time: 1, Memory: 64, Thread: 1, Saltlen: 16, Keylen: 32})
+	if _, err := d.ClientParams(nil); err != ErrUnsupported {
+		t.Fatalf("ClientParams: %v", err)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	p, _ := NewCustom(&ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+	long := bytes.Repeat([]byte("a"), 2048)
+	hashed, _ := p.Hash(long)
+
+	for i, policy := range []Policy{
+		{MinLength: -1},
+		{MaxLength: -1},
+		{MinLength: 12, MaxLength: 8},
+	} {
+		if err := p.SetPolicy(policy); err != ErrUnsupported {
+			t.Fatalf("test #%d SetPolicy: %v", i, err)
+		}
+	}
+
+	checker := Rules{ClassesRule(2)}
+	err := p.SetPolicy(Policy{MinLength: 8, MaxLength: 1024, RejectCommon: true, Checker: checker})
+	if err != nil {
+		t.Fatalf("SetPolicy: %v", err)
+	}
+
+	tests := []struct {
+		password string
+		want     error
+	}{
+		{"", ErrPasswordEmpty},
+		{"Short1", ErrPasswordTooShort},
+		{string(long), ErrPasswordTooLong},
+		{"PASSWORD123", ErrWeakPassword},
+		{"Qwertyuiop", ErrWeakPassword},
+		{"alllowercase", ErrWeakPassword}, // the checker *PolicyError
+		{"correct Horse battery staple", nil},
+	}
+	for i, test := range tests {
+		_, err := p.Hash([]byte(test.password))
+		if test.want == nil && err != nil || test.want != nil && !isError(err, test.want) {
+			t.Fatalf("test #%d: %v, want %v", i, err, test.want)
+		}
+	}
+	if _, err := p.Hash([]byte("alllowercase")); err == ErrWeakPassword {
+		t.Fatalf("checker error replaced")
+	}
+
+	// oversized passwords are not derived on Compare(), but padded.
+	if err := p.Compare(hashed, long); err != ErrMismatch {
+		t.Fatalf("Compare oversized: %v", err)
+	}
+	_ = p.SetCompareDuration(20 * time.Millisecond)
+	start := time.Now()
+	if err := p.Compare(hashed, long); err != ErrMismatch {
+		t.Fatalf("Compare oversized: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("Compare oversized: returned after %v", elapsed)
+	}
+	_ = p.SetPolicy(Policy{})
+	if err := p.Compare(hashed, long); err != nil {
+		t.Fatalf("Compare without policy: %v", err)
+	}
+	if _, err := p.Hash([]byte("password")); err != nil {
+		t.Fatalf("Hash without policy: %v", err)
+	}
+}
+
 //
 //
 // Examples for documentation
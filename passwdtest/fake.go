@@ -0,0 +1,36 @@
+//go:build go1.12
+// +build go1.12
+
+package passwdtest
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+
+	"github.com/ermites-io/passwd"
+)
+
+// fakePrefix identifies the values of the Fake hasher.
+const fakePrefix = "$fake$"
+
+// Fake is an instant and deterministic hasher for tests asserting on
+// stored values: Hash(password) is always "$fake$" || hex(sha256(password)).
+// Fake is a passwd.Verifier, it is NOT a password hash.
+type Fake struct{}
+
+// Hash returns the deterministic fake hash of password.
+func (Fake) Hash(password []byte) ([]byte, error) {
+	sum := sha256.Sum256(password)
+	return []byte(fakePrefix + hex.EncodeToString(sum[:])), nil
+}
+
+// Compare returns passwd.ErrMismatch unless hashed is the fake hash of
+// password.
+func (f Fake) Compare(hashed, password []byte) error {
+	expected, _ := f.Hash(password)
+	if subtle.ConstantTimeCompare(expected, hashed) != 1 {
+		return passwd.ErrMismatch
+	}
+	return nil
+}
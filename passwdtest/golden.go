@@ -0,0 +1,46 @@
+//go:build go1.12
+// +build go1.12
+
+package passwdtest
+
+// Vector is a stored hash of a known password.
+type Vector struct {
+	Name     string
+	Password string
+	Hash     string
+}
+
+// GoldenVectors returns native format hashes produced by this package with
+// test parameters, passwd.Compare() must accept them whatever the version
+// of the package, they are NOT SAFE parameters.
+func GoldenVectors() []Vector {
+	return []Vector{
+		{"argon2id", "password", "$2id$Ol5WCQu9bPhpTEicl3iXE.$1$64$1$32$Ua6FbqATxqRUu7B2JQrDRTLu0Lu4Q9zERwiROHWxI8i"},
+		{"argon2i", "password", "$2i$yiylYVvDGNYFyNywfHxQ6u$2$64$1$32$vREcy821Ow4WmhfIeLDFgcUI5444.IzJHUD1DWs7Miy"},
+		{"scrypt", "password", "$2s$EPw6OOA5FeC1ftygG847/e$1024$8$1$32$XKCg1vYBIRKMApZL/0MLDIqEUwYMU/VXSySu6Y2B5Oy"},
+		{"bcrypt", "password", "$2a$04$Zh5sr0Kn8oz6TeH2Bfe9auDAD0cxblMu4AJasgJARp0AxKGPe5ZnK"},
+	}
+}
+
+// Fixture is a hash in a foreign format of a known password.
+type Fixture struct {
+	Format   string
+	Password string
+	Hash     string
+}
+
+// Fixtures returns hashes in formats produced by other systems, to test
+// migration and legacy verification paths.
+func Fixtures() []Fixture {
+	return []Fixture{
+		{"phc-argon2id", "password", "$argon2id$v=19$m=64,t=1,p=1$Qn7YESw/dRjrVGken5kZGA$Wc8HdsCVzsTWw9D4LStFTVNw2Nw6S/1GTykTQJYzK+k"},
+		{"phc-argon2i", "password", "$argon2i$v=19$m=64,t=2,p=1$0k0naXxFIPaH0P0yhJzS8w$xTGe0+43Qy6YojhKgNFHieWK7666AK1LJWF3FYu9Ok0"},
+		{"phc-scrypt", "password", "$scrypt$ln=10,r=8,p=1$GRy8QQC7HgE3hv0iI+69Bg$ZMEi3xaDKTMOCrbNB2ONFKsGWyaOWBXZU0Uw8a4D7Q0"},
+		{"bcrypt-2a", "allmine", "$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga"},
+		{"bcrypt-2y", "allmine", "$2y$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga"},
+		{"sha512-crypt", "Hello world!", "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"},
+		{"sha256-crypt", "Hello world!", "$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5"},
+		{"md5-crypt", "password", "$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/"},
+		{"django-pbkdf2_sha256", "password", "pbkdf2_sha256$1000$saltsalt$E196ZhRPzw+wA84EjzHwJO1cv/MFJdO6C/sxmUeTYqY="},
+	}
+}
@@ -0,0 +1,38 @@
+//go:build go1.12
+// +build go1.12
+
+// Package passwdtest provides helpers for the tests of applications using
+// the passwd package.
+package passwdtest
+
+import (
+	"testing"
+
+	"github.com/ermites-io/passwd"
+)
+
+// fastParameters are the cheapest argon2id parameters, they are NOT SAFE
+// for anything but tests.
+var fastParameters = passwd.Argon2Params{
+	Version: passwd.Argon2id,
+	Time:    1,
+	Memory:  8,
+	Thread:  1,
+	Saltlen: 16,
+	Keylen:  16,
+}
+
+// FastProfile returns a profile hashing nearly instantly, so test suites
+// creating many users do not spend their time in the KDF.
+// it requires a testing.TB to make sure it is only used from tests, the
+// produced hashes are NOT SAFE.
+func FastProfile(tb testing.TB) *passwd.Profile {
+	tb.Helper()
+
+	params := fastParameters
+	p, err := passwd.NewCustom(&params)
+	if err != nil {
+		tb.Fatalf("passwdtest: fast profile: %v", err)
+	}
+	return p
+}
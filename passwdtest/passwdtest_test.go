@@ -0,0 +1,58 @@
+package passwdtest
+
+import (
+	"testing"
+
+	"github.com/ermites-io/passwd"
+)
+
+func TestFastProfile(t *testing.T) {
+	p := FastProfile(t)
+
+	for i := 0; i < 100; i++ {
+		hashed, err := p.Hash([]byte("prout"))
+		if err != nil {
+			t.Fatalf("hash error: %v\n", err)
+		}
+		if err := p.Compare(hashed, []byte("prout")); err != nil {
+			t.Fatalf("compare err: %v vs expected: %v\n", err, nil)
+		}
+	}
+}
+
+func TestGoldenVectors(t *testing.T) {
+	for _, v := range GoldenVectors() {
+		RequireVerifies(t, passwd.NativeVerifier, []byte(v.Hash), []byte(v.Password))
+		RequireMismatch(t, passwd.NativeVerifier, []byte(v.Hash), []byte(v.Password+"x"))
+	}
+
+	for _, f := range Fixtures() {
+		if f.Format[:4] == "phc-" {
+			RequireVerifies(t, passwd.PHCVerifier, []byte(f.Hash), []byte(f.Password))
+		}
+		if f.Format != "md5-crypt" {
+			RequireVerifies(t, passwd.InteropVerifier, []byte(f.Hash), []byte(f.Password))
+			RequireMismatch(t, passwd.InteropVerifier, []byte(f.Hash), []byte(f.Password+"x"))
+		}
+	}
+}
+
+func TestFake(t *testing.T) {
+	var f Fake
+
+	hashed, _ := f.Hash([]byte("prout"))
+	again, _ := f.Hash([]byte("prout"))
+	if string(hashed) != string(again) {
+		t.Fatalf("fake hash is not deterministic: %s vs %s", hashed, again)
+	}
+	RequireVerifies(t, f, hashed, []byte("prout"))
+	RequireMismatch(t, f, hashed, []byte("proutt"))
+}
+
+func TestRequireNeedsRehash(t *testing.T) {
+	p := FastProfile(t)
+	weak, _ := passwd.NewCustom(&passwd.Argon2Params{Version: passwd.Argon2id, Time: 2, Memory: 8, Thread: 1, Saltlen: 16, Keylen: 16})
+
+	hashed, _ := weak.Hash([]byte("prout"))
+	RequireNeedsRehash(t, p, hashed, []byte("prout"))
+}
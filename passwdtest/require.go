@@ -0,0 +1,43 @@
+//go:build go1.12
+// +build go1.12
+
+package passwdtest
+
+import (
+	"testing"
+
+	"github.com/ermites-io/passwd"
+)
+
+// RequireVerifies fails the test unless v accepts password for hashed.
+func RequireVerifies(tb testing.TB, v passwd.Verifier, hashed, password []byte) {
+	tb.Helper()
+
+	if err := v.Compare(hashed, password); err != nil {
+		tb.Fatalf("passwdtest: %q does not verify %s: %v", password, hashed, err)
+	}
+}
+
+// RequireMismatch fails the test unless v rejects password for hashed with
+// passwd.ErrMismatch.
+func RequireMismatch(tb testing.TB, v passwd.Verifier, hashed, password []byte) {
+	tb.Helper()
+
+	if err := v.Compare(hashed, password); err != passwd.ErrMismatch {
+		tb.Fatalf("passwdtest: %q vs %s: got %v, expected %v", password, hashed, err, passwd.ErrMismatch)
+	}
+}
+
+// RequireNeedsRehash fails the test unless p verifies password for hashed
+// and reports it needs to be rehashed.
+func RequireNeedsRehash(tb testing.TB, p *passwd.Profile, hashed, password []byte) {
+	tb.Helper()
+
+	r, err := p.CompareEx(hashed, password)
+	if err != nil {
+		tb.Fatalf("passwdtest: %q does not verify %s: %v", password, hashed, err)
+	}
+	if !r.NeedsRehash {
+		tb.Fatalf("passwdtest: %s does not need a rehash", hashed)
+	}
+}
@@ -0,0 +1,252 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"fmt"
+	"hash"
+	"strconv"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// Pbkdf2SHA256 constant is to select the PBKDF2-HMAC-SHA256 PRF in
+	// Pbkdf2Params PRF field
+	Pbkdf2SHA256 = iota // default
+	// Pbkdf2SHA512 constant is to select the PBKDF2-HMAC-SHA512 PRF in
+	// Pbkdf2Params PRF field
+	Pbkdf2SHA512
+)
+
+const (
+	idPbkdf2SHA256 = "2k"
+	idPbkdf2SHA512 = "2k5"
+)
+
+var (
+	/*
+		PBKDF2 (RFC 8018) with an HMAC-SHA-2 PRF is the password hashing
+		approved by NIST SP 800-132, for deployments restricted to FIPS
+		approved primitives.
+		it is neither memory hard nor sequential memory hard, the cost is
+		the iteration count only.
+
+		NIST SP 800-132:
+		- salt of at least 128 bits
+		- key of at least 112 bits
+
+		https://cheatsheetseries.owasp.org/cheatsheets/Password_Storage_Cheat_Sheet.html
+		- PBKDF2-HMAC-SHA256: 600,000 iterations
+		- PBKDF2-HMAC-SHA512: 210,000 iterations
+	*/
+	pbkdf2MinParameters = Pbkdf2Params{
+		PRF:        Pbkdf2SHA256,
+		Iterations: 1000,
+		Saltlen:    16,
+		Keylen:     16,
+	}
+
+	pbkdf2CommonParameters = Pbkdf2Params{
+		PRF:        Pbkdf2SHA256,
+		Iterations: 600000,
+		Saltlen:    16,
+		Keylen:     32,
+	}
+
+	pbkdf2ParanoidParameters = Pbkdf2Params{
+		PRF:        Pbkdf2SHA512,
+		Iterations: 1000000,
+		Saltlen:    32,
+		Keylen:     64,
+	}
+)
+
+// Pbkdf2Params are the parameters for the PBKDF2 key derivation.
+type Pbkdf2Params struct {
+	PRF        int    // Pbkdf2SHA256 or Pbkdf2SHA512
+	Iterations uint32 //
+	Saltlen    uint32 // 128 bits min.
+	Keylen     uint32 // 128 bits min.
+	Masked     bool   // are parameters private
+	secret     []byte // secret for key'ed hashes..
+
+	pepper PepperStrategy               // how the secret is applied
+	post   func([]byte) ([]byte, error) // digest post processing
+}
+
+// $ID$b64(SALT)$ITER$KEYLEN$b64(HASH)
+func newPbkdf2ParamsFromFields(fields []string) (*Pbkdf2Params, error) {
+	if len(fields) != 4 {
+		return nil, ErrParse
+	}
+
+	salt, err := base64Decode([]byte(fields[0]))
+	if err != nil {
+		return nil, parseError(ErrParse, err)
+	}
+
+	iter, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return nil, parseError(ErrParse, err)
+	}
+
+	keylen, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return nil, parseError(ErrParse, err)
+	}
+
+	// bounds, before anything is computed.
+	switch {
+	case iter == 0, iter > maxParsePbkdf2Iterations, len(salt) == 0:
+		return nil, ErrParse
+	case keylen == 0, keylen > maxParseKeylen:
+		return nil, ErrParse
+	}
+
+	kp := Pbkdf2Params{
+		PRF:        Pbkdf2SHA256,
+		Iterations: uint32(iter),
+		Saltlen:    uint32(len(salt)),
+		Keylen:     uint32(keylen),
+	}
+	return &kp, nil
+}
+
+// function that validate custom parameters and minimal security is ok.
+func (p *Pbkdf2Params) validate(min *Pbkdf2Params) error {
+	if p.Iterations < min.Iterations || p.Saltlen < min.Saltlen || p.Keylen < min.Keylen {
+		return ErrUnsupported
+	}
+	if _, _, err := p.prf(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *Pbkdf2Params) prf() (string, func() hash.Hash, error) {
+	switch p.PRF {
+	case Pbkdf2SHA256:
+		return idPbkdf2SHA256, sha256.New, nil
+	case Pbkdf2SHA512:
+		return idPbkdf2SHA512, sha512.New, nil
+	}
+	return "", nil, ErrUnsupported
+}
+
+func (p *Pbkdf2Params) key(password, salt []byte) ([]byte, error) {
+	_, h, err := p.prf()
+	if err != nil {
+		return nil, err
+	}
+	return pbkdf2.Key(password, salt, int(p.Iterations), int(p.Keylen), h), nil
+}
+
+func (p *Pbkdf2Params) deriveFromPassword(password, salt []byte) ([]byte, error) {
+	err := p.validate(&pbkdf2MinParameters)
+	if err != nil {
+		return nil, err
+	}
+	return p.key(password, salt)
+}
+
+func (p *Pbkdf2Params) generateFromParams(salt, password []byte) (out []byte, err error) {
+	var hash bytes.Buffer
+	var params string
+	var data []byte
+
+	id, _, err := p.prf()
+	if err != nil {
+		return nil, err
+	}
+
+	// the profile dictactes
+	psalt := make([]byte, p.Saltlen)
+	copy(psalt, salt)
+	defer wipe(psalt)
+
+	data = password
+
+	// we want to hmac a secret to have the resulting hash
+	if len(p.secret) > 0 && p.pepper == PepperPreHash {
+		data, err = hmacKeyHash(p.secret, psalt, password)
+		if err != nil {
+			return nil, err
+		}
+		defer wipe(data)
+	}
+
+	key, err := p.key(data, psalt)
+	if err != nil {
+		return nil, err
+	}
+
+	// or hmac the resulting digest
+	if len(p.secret) > 0 && p.pepper == PepperPostHash {
+		raw := key
+		key, err = hmacKeyHash(p.secret, psalt, raw)
+		wipe(raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// digest post processing (i.e. blinding)
+	if p.post != nil {
+		key, err = p.post(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// params
+	if !p.Masked {
+		params = fmt.Sprintf("%c%d%c%d",
+			separatorRune, p.Iterations,
+			separatorRune, p.Keylen)
+	}
+
+	_, err = fmt.Fprintf(&hash, "%c%s%c%s%s%c%s",
+		separatorRune, id,
+		separatorRune, base64Encode(psalt),
+		params,
+		separatorRune, base64Encode(key))
+	if err != nil {
+		return nil, err
+	}
+
+	out = hash.Bytes()
+	return out, nil
+}
+
+func (p *Pbkdf2Params) generateFromPassword(password []byte) ([]byte, error) {
+	salt, err := getSalt(p.Saltlen)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.generateFromParams(salt, password)
+}
+
+func (p *Pbkdf2Params) compare(hashed, password []byte) error {
+	salt, err := parseFromHashToSalt(hashed)
+	if err != nil {
+		return err
+	}
+
+	compared, err := p.generateFromParams(salt, password)
+	if err != nil {
+		return ErrMismatch
+	}
+
+	if subtle.ConstantTimeCompare(compared, hashed) == 1 {
+		return nil
+	}
+
+	return ErrMismatch
+}
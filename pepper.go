@@ -0,0 +1,78 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+// PepperStrategy defines how the profile secret (pepper) is applied when
+// hashing, different compliance and rotation requirements favor different
+// constructions.
+type PepperStrategy int
+
+const (
+	// PepperPreHash applies the secret as an HMAC pre-hash of the password
+	// before the derivation (default, the historical construction).
+	PepperPreHash PepperStrategy = iota
+	// PepperNative hands the secret to the KDF native secret input (argon2
+	// K input only).
+	PepperNative
+	// PepperPostHash applies the secret as an HMAC of the derived digest.
+	PepperPostHash
+)
+
+// metadata values of the pepper strategies, the default is not recorded.
+var pepperTags = map[PepperStrategy]string{
+	PepperNative:   "n",
+	PepperPostHash: "o",
+}
+
+// SetPepperStrategy selects how the secret setup with SetKey() is applied,
+// the strategy is recorded in produced key'ed hashes.
+func (p *Profile) SetPepperStrategy(s PepperStrategy) error {
+	switch v := p.params.(type) {
+	case *ScryptParams:
+		if s != PepperPreHash && s != PepperPostHash {
+			return ErrUnsupported
+		}
+		v.pepper = s
+		return nil
+	case *Argon2Params:
+		if s != PepperPreHash && s != PepperNative && s != PepperPostHash {
+			return ErrUnsupported
+		}
+		v.pepper = s
+		return nil
+	case *Pbkdf2Params:
+		if s != PepperPreHash && s != PepperPostHash {
+			return ErrUnsupported
+		}
+		v.pepper = s
+		return nil
+	}
+	return ErrUnsupported
+}
+
+// pepperTag returns the metadata value of the strategy in use, if the
+// hash is key'ed.
+func (p *Profile) pepperTag() string {
+	if len(p.key()) == 0 {
+		return ""
+	}
+
+	switch v := p.params.(type) {
+	case *ScryptParams:
+		return pepperTags[v.pepper]
+	case *Argon2Params:
+		return pepperTags[v.pepper]
+	case *Pbkdf2Params:
+		return pepperTags[v.pepper]
+	}
+	return ""
+}
+
+// SetRequireSecret makes Hash() fail fast with ErrSecretRequired if no
+// secret has been setup, protecting deployments mandating key'ed hashing
+// from silently producing unkey'ed hashes (i.e. after a bad deploy).
+func (p *Profile) SetRequireSecret(required bool) error {
+	p.requireSecret = required
+	return nil
+}
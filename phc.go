@@ -0,0 +1,373 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//
+// PHC string format.
+//
+// https://github.com/P-H-C/phc-string-format/blob/master/phc-sf-spec.md
+//
+// argon2 (libsodium, argon2 reference CLI, passlib..):
+// $argon2id$v=19$m=65536,t=1,p=16$b64(SALT)$b64(HASH)
+//
+// scrypt (passlib):
+// $scrypt$ln=16,r=8,p=1$b64(SALT)$b64(HASH)
+//
+// b64 being the standard base64 alphabet without padding, the key length
+// is implied by the hash length.
+//
+
+const (
+	phcArgon2i  = "argon2i"
+	phcArgon2id = "argon2id"
+	phcArgon2d  = "argon2d"
+	phcScrypt   = "scrypt"
+
+	// the argon2 version implemented (0x13), the strings of the previous
+	// one (0x10) have no v field.
+	phcArgon2Version = 19
+)
+
+// phcArgon2IDs maps the argon2 PHC identifiers to the native ones.
+var phcArgon2IDs = map[string]string{
+	phcArgon2i:  idArgon2i,
+	phcArgon2id: idArgon2id,
+	phcArgon2d:  idArgon2d,
+}
+
+// Format defines the encoding of the stored hashes.
+type Format int
+
+const (
+	// FormatNative is this package historical `$` fields encoding.
+	FormatNative Format = iota
+	// FormatPHC is the PHC string format.
+	FormatPHC
+)
+
+// encodedHash is the syntactic content of an argon2/scrypt hash.
+type encodedHash struct {
+	id   string // native identifier
+	a    uint32 // argon2: time    / scrypt: N
+	b    uint32 // argon2: memory  / scrypt: r
+	c    uint32 // argon2: threads / scrypt: p
+	salt []byte
+	key  []byte
+}
+
+func decodeNative(hashed []byte) (*encodedHash, error) {
+	fields := strings.FieldsFunc(string(hashed), token)
+	if len(fields) == 0 {
+		return nil, ErrParse
+	}
+
+	switch fields[0] {
+	case idArgon2i, idArgon2id, idArgon2d, idScrypt:
+	default:
+		return nil, ErrUnsupported
+	}
+
+	switch len(fields) {
+	case 7:
+	case 3: // masked
+		return nil, ErrUnsupported
+	default:
+		return nil, ErrParse
+	}
+
+	var values [4]uint32
+	for i := range values {
+		v, err := strconv.ParseUint(fields[2+i], 10, 32)
+		if err != nil {
+			return nil, ErrParse
+		}
+		values[i] = uint32(v)
+	}
+
+	salt, err := base64Decode([]byte(fields[1]))
+	if err != nil {
+		return nil, ErrParse
+	}
+
+	key, err := base64Decode([]byte(fields[6]))
+	if err != nil || uint32(len(key)) != values[3] {
+		return nil, ErrParse
+	}
+
+	eh := encodedHash{
+		id:   fields[0],
+		a:    values[0],
+		b:    values[1],
+		c:    values[2],
+		salt: salt,
+		key:  key,
+	}
+	err = eh.check()
+	if err != nil {
+		return nil, err
+	}
+	return &eh, nil
+}
+
+// check refuses the hashes the parser would refuse: empty salt or key and
+// parameters out of the parsing bounds.
+func (eh *encodedHash) check() error {
+	if len(eh.salt) == 0 || len(eh.key) == 0 || len(eh.key) > maxParseKeylen {
+		return ErrParse
+	}
+	return checkParams(eh.id, eh.a, eh.b, eh.c)
+}
+
+// checkParams refuses the argon2 (time, memory, threads) and scrypt (N, r,
+// p) parameters out of the parsing bounds.
+func checkParams(id string, ua, ub, uc uint32) error {
+	a, b, c := uint64(ua), uint64(ub), uint64(uc)
+	switch id {
+	case idArgon2i, idArgon2id, idArgon2d:
+		// time, memory, threads
+		switch {
+		case a == 0, c == 0, c > 255:
+			return ErrParse
+		case b < 8*c, b > maxParseArgon2Memory, a*b > maxParseArgon2Work:
+			return ErrParse
+		}
+	case idScrypt:
+		// N, r, p
+		switch {
+		case a <= 1, a&(a-1) != 0, b == 0, c == 0:
+			return ErrParse
+		case b*c >= 1<<30, a > maxParseScryptMemory/(128*b):
+			return ErrParse
+		}
+	default:
+		return ErrUnsupported
+	}
+	return nil
+}
+
+func (eh *encodedHash) encodeNative() []byte {
+	var hash bytes.Buffer
+
+	fmt.Fprintf(&hash, "%c%s%c%s%c%d%c%d%c%d%c%d%c%s",
+		separatorRune, eh.id,
+		separatorRune, base64Encode(eh.salt),
+		separatorRune, eh.a,
+		separatorRune, eh.b,
+		separatorRune, eh.c,
+		separatorRune, len(eh.key),
+		separatorRune, base64Encode(eh.key))
+	return hash.Bytes()
+}
+
+func decodePHC(hashed []byte) (*encodedHash, error) {
+	var eh encodedHash
+	var err error
+
+	fields := strings.Split(string(hashed), string(separatorRune))
+	if len(fields) < 5 || len(fields[0]) != 0 {
+		return nil, ErrParse
+	}
+	fields = fields[1:]
+
+	switch fields[0] {
+	case phcArgon2i, phcArgon2id, phcArgon2d:
+		// $argon2id$v=19$m=..,t=..,p=..$salt$hash
+		switch {
+		case len(fields) == 4 && strings.HasPrefix(fields[1], "m="):
+			return nil, parseError(ErrIncompatibleVersion, fmt.Errorf("argon2 version 16"))
+		case len(fields) != 5:
+			return nil, ErrParse
+		case fields[1] != "v="+strconv.Itoa(phcArgon2Version):
+			return nil, parseError(ErrIncompatibleVersion, fmt.Errorf("argon2 %.16q", fields[1]))
+		}
+
+		eh.id = phcArgon2IDs[fields[0]]
+
+		params, err := parsePHCParams(fields[2], "m", "t", "p")
+		if err != nil {
+			return nil, err
+		}
+		eh.a, eh.b, eh.c = params[1], params[0], params[2]
+		fields = fields[3:]
+	case phcScrypt:
+		// $scrypt$ln=..,r=..,p=..$salt$hash
+		if len(fields) != 4 {
+			return nil, ErrParse
+		}
+
+		params, err := ParseScryptParams(fields[1])
+		if err != nil {
+			return nil, ErrParse
+		}
+		eh.id = idScrypt
+		eh.a, eh.b, eh.c = params.N, params.R, params.P
+		fields = fields[2:]
+	default:
+		return nil, ErrUnsupported
+	}
+
+	eh.salt, err = base64.RawStdEncoding.DecodeString(fields[0])
+	if err != nil || len(eh.salt) == 0 {
+		return nil, ErrParse
+	}
+
+	eh.key, err = base64.RawStdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, ErrParse
+	}
+
+	err = eh.check()
+	if err != nil {
+		return nil, err
+	}
+	return &eh, nil
+}
+
+// parsePHCParams parses the "k=v,k=v" parameters expecting exactly keys,
+// in order.
+func parsePHCParams(field string, keys ...string) ([]uint32, error) {
+	pairs := strings.Split(field, ",")
+	if len(pairs) != len(keys) {
+		return nil, ErrParse
+	}
+
+	values := make([]uint32, len(keys))
+	for i, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] != keys[i] {
+			return nil, ErrParse
+		}
+
+		v, err := strconv.ParseUint(kv[1], 10, 32)
+		if err != nil {
+			return nil, ErrParse
+		}
+		values[i] = uint32(v)
+	}
+	return values, nil
+}
+
+func (eh *encodedHash) encodePHC() ([]byte, error) {
+	var hash bytes.Buffer
+
+	salt64 := base64.RawStdEncoding.EncodeToString(eh.salt)
+	key64 := base64.RawStdEncoding.EncodeToString(eh.key)
+
+	switch eh.id {
+	case idArgon2i, idArgon2id, idArgon2d:
+		var id string
+		for phc, native := range phcArgon2IDs {
+			if native == eh.id {
+				id = phc
+			}
+		}
+		fmt.Fprintf(&hash, "$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			id, phcArgon2Version, eh.b, eh.a, eh.c, salt64, key64)
+	case idScrypt:
+		params, err := FormatScryptParams(&ScryptParams{N: eh.a, R: eh.b, P: eh.c})
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&hash, "$%s$%s$%s$%s",
+			phcScrypt, params, salt64, key64)
+	default:
+		return nil, ErrUnsupported
+	}
+
+	return hash.Bytes(), nil
+}
+
+// isPHC returns true if hashed looks like a PHC string this package knows.
+func isPHC(hashed []byte) bool {
+	for _, id := range []string{phcArgon2i, phcArgon2id, phcArgon2d, phcScrypt} {
+		if bytes.HasPrefix(hashed, []byte("$"+id+"$")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reencode converts hashed between this package native `$` fields
+// encoding and the PHC string format, purely syntactically: no password
+// is needed, enabling bulk storage format migrations.
+// Masked, key'ed or flagged hashes (carrying metadata) cannot be
+// re-encoded and ErrUnsupported is returned.
+func Reencode(hashed []byte, target Format) ([]byte, error) {
+	var eh *encodedHash
+	var err error
+
+	if isPHC(hashed) {
+		eh, err = decodePHC(hashed)
+	} else {
+		_, md, merr := splitMetadata(hashed)
+		if merr != nil {
+			return nil, merr
+		}
+		if len(md) > 0 {
+			return nil, ErrUnsupported
+		}
+		eh, err = decodeNative(hashed)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch target {
+	case FormatNative:
+		return eh.encodeNative(), nil
+	case FormatPHC:
+		return eh.encodePHC()
+	}
+	return nil, ErrUnsupported
+}
+
+// SetEncoding selects the encoding of the produced hashes, FormatPHC is
+// supported by the non-masked argon2 and scrypt profiles.
+// the PHC string format has no room for the metadata nor the integrity
+// tag: Hash() returns ErrUnsupported when the hash would carry them (i.e.
+// timestamps, risk tiers, associated data, degraded hashes..), the secret
+// of key'ed profiles is not recorded.
+// a FormatPHC profile Compare() verifies both encodings (i.e. the PHC
+// strings of other libraries), NeedsRehash() reports the hashes of the
+// other encoding.
+func (p *Profile) SetEncoding(f Format) error {
+	switch f {
+	case FormatNative:
+	case FormatPHC:
+		switch v := p.params.(type) {
+		case *Argon2Params:
+			if v.Masked {
+				return ErrUnsupported
+			}
+		case *ScryptParams:
+			if v.Masked {
+				return ErrUnsupported
+			}
+		default:
+			return ErrUnsupported
+		}
+	default:
+		return ErrUnsupported
+	}
+
+	p.encoding = f
+	return nil
+}
+
+// encodePHC returns the PHC string of the native hash produced by the
+// profile.
+func (p *Profile) encodePHC(hashed []byte, md metadata) ([]byte, error) {
+	if len(md) > 0 || p.integrity || len(p.record) > 0 {
+		return nil, ErrUnsupported
+	}
+	return Reencode(hashed, FormatPHC)
+}
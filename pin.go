@@ -0,0 +1,93 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"strconv"
+)
+
+//
+// the default profile and the minimum password length can be pinned at
+// build time, security teams enforce organization-wide settings from the
+// build pipeline instead of trusting the runtime configuration:
+//
+// go build -ldflags "-X github.com/ermites-io/passwd.defaultProfile=argon2id-paranoid -X github.com/ermites-io/passwd.minimumLength=12"
+//
+// an invalid pinned value makes the program panic at initialization.
+//
+
+var (
+	defaultProfile string // profile name returned by Default()
+	minimumLength  string // minimum password length of every profile
+)
+
+var (
+	pinnedProfile   = Argon2idDefault
+	pinnedMinLength int
+)
+
+var profileNames = []struct {
+	name    string
+	profile HashProfile
+}{
+	{"argon2id-default", Argon2idDefault},
+	{"argon2id-paranoid", Argon2idParanoid},
+	{"scrypt-default", ScryptDefault},
+	{"scrypt-paranoid", ScryptParanoid},
+	{"bcrypt-default", BcryptDefault},
+	{"bcrypt-paranoid", BcryptParanoid},
+	{"pbkdf2-default", Pbkdf2Default},
+	{"pbkdf2-paranoid", Pbkdf2Paranoid},
+	{"argon2i-default", Argon2iDefault},
+	{"argon2i-paranoid", Argon2iParanoid},
+}
+
+func profileName(profile HashProfile) (string, bool) {
+	for _, pn := range profileNames {
+		if pn.profile == profile {
+			return pn.name, true
+		}
+	}
+	return "", false
+}
+
+func profileByName(name string) (HashProfile, bool) {
+	for _, pn := range profileNames {
+		if pn.name == name {
+			return pn.profile, true
+		}
+	}
+	return 0, false
+}
+
+func init() {
+	if len(defaultProfile) > 0 {
+		profile, ok := profileByName(defaultProfile)
+		if !ok {
+			panic("passwd: invalid pinned default profile " + strconv.Quote(defaultProfile))
+		}
+		pinnedProfile = profile
+	}
+
+	if len(minimumLength) > 0 {
+		n, err := strconv.Atoi(minimumLength)
+		if err != nil || n < 0 {
+			panic("passwd: invalid pinned minimum length " + strconv.Quote(minimumLength))
+		}
+		pinnedMinLength = n
+	}
+}
+
+// Default instanciates the default Profile: Argon2idDefault unless another
+// one was pinned at build time.
+func Default() (*Profile, error) {
+	return New(pinnedProfile)
+}
+
+// Pinned returns the build time pinned default profile and minimum
+// password length, a profile minimum length below the pinned one is
+// ignored.
+func Pinned() (profile HashProfile, minLength int) {
+	return pinnedProfile, pinnedMinLength
+}
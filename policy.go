@@ -0,0 +1,229 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SetMinLength makes Hash() reject passwords shorter than n characters
+// (runes) with ErrPasswordTooShort, a n > 0 minimum also rejects empty
+// passwords, 0 disables the check.
+// a minimum length pinned at build time (see Pinned()) always applies.
+func (p *Profile) SetMinLength(n int) error {
+	if n < 0 {
+		return ErrUnsupported
+	}
+	p.minLength = n
+	return nil
+}
+
+// SetRejectEmpty makes Hash() reject empty passwords with ErrPasswordEmpty.
+func (p *Profile) SetRejectEmpty(enabled bool) error {
+	p.rejectEmpty = enabled
+	return nil
+}
+
+func (p *Profile) checkLength(password []byte) error {
+	minLength := p.minLength
+	if minLength < pinnedMinLength {
+		minLength = pinnedMinLength
+	}
+
+	switch {
+	case len(password) == 0 && (p.rejectEmpty || minLength > 0):
+		return ErrPasswordEmpty
+	case p.maxLength > 0 && len(password) > p.maxLength:
+		return ErrPasswordTooLong
+	case utf8.RuneCount(password) < minLength:
+		return ErrPasswordTooShort
+	}
+	return nil
+}
+
+// Policy groups the password checks Hash() runs before any KDF work.
+type Policy struct {
+	MinLength    int           // minimum length in characters (runes), 0 is none
+	MaxLength    int           // maximum length in bytes, 0 is none
+	RejectCommon bool          // refuse the most common passwords
+	Checker      PolicyChecker // additional checker (i.e. strength estimator), nil if none
+}
+
+// SetPolicy sets the password policy of the profile, it replaces the
+// SetMinLength() and SetPolicyChecker() settings.
+// Hash() returns ErrPasswordTooShort, ErrPasswordTooLong, ErrWeakPassword
+// for a common password or the Checker error, Compare() returns
+// ErrMismatch for passwords over MaxLength without any KDF work, bounding
+// the cost of multi-megabyte inputs.
+func (p *Profile) SetPolicy(policy Policy) error {
+	if policy.MinLength < 0 || policy.MaxLength < 0 ||
+		policy.MaxLength > 0 && policy.MaxLength < policy.MinLength {
+		return ErrUnsupported
+	}
+
+	p.minLength = policy.MinLength
+	p.maxLength = policy.MaxLength
+	p.rejectCommon = policy.RejectCommon
+	p.policy = policy.Checker
+	return nil
+}
+
+// commonPasswords are the most frequent passwords of the public breach
+// compilations, the denylist package filters larger lists.
+var commonPasswords = map[string]struct{}{}
+
+func init() {
+	for _, pw := range strings.Fields(`
+		123456 password 123456789 12345678 12345 qwerty 1234567 111111
+		1234567890 123123 abc123 1234 password1 iloveyou 1q2w3e4r 000000
+		qwerty123 zaq12wsx dragon sunshine princess letmein 654321 monkey
+		1qaz2wsx 123321 qwertyuiop superman asdfghjkl 666666
+		121212 football baseball welcome master shadow michael trustno1
+		passw0rd login admin starwars hello freedom whatever qazwsx
+		password123 azerty 555555 7777777 888888 123qwe aa123456 159753
+		charlie donald mustang access flower batman loveme lovely
+		solo hottie jordan23 ninja killer pokemon computer secret
+		changeme test test123 root toor guest default p@ssw0rd
+	`) {
+		commonPasswords[pw] = struct{}{}
+	}
+}
+
+// commonPassword returns true if password (case insensitive) is a common
+// password.
+func commonPassword(password []byte) bool {
+	if len(password) > 32 {
+		return false
+	}
+	_, ok := commonPasswords[strings.ToLower(string(password))]
+	return ok
+}
+
+// PolicyChecker is consulted by Hash() before any KDF work, a non nil error
+// rejects the password, the provided Rules return a *PolicyError.
+type PolicyChecker interface {
+	Check(password []byte) error
+}
+
+// SetPolicyChecker attaches the password policy checked by Hash(), nil
+// removes it.
+func (p *Profile) SetPolicyChecker(c PolicyChecker) error {
+	p.policy = c
+	return nil
+}
+
+// Violation describes a password policy rule that failed.
+type Violation struct {
+	Rule   string // rule name (i.e. "length")
+	Reason string // human readable reason
+}
+
+// PolicyError is the error reporting every violated rule.
+type PolicyError struct {
+	Violations []Violation
+}
+
+// Is reports whether target is ErrWeakPassword.
+func (e *PolicyError) Is(target error) bool { return target == ErrWeakPassword }
+
+func (e *PolicyError) Error() string {
+	reasons := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		reasons = append(reasons, v.Reason)
+	}
+	return "password policy: " + strings.Join(reasons, ", ")
+}
+
+// Rule is a named password rule, Check returns the reason of the violation
+// or an empty string.
+type Rule struct {
+	Name  string
+	Check func(password []byte) string
+}
+
+// Rules is a PolicyChecker evaluating all the rules and reporting all the
+// violations at once.
+type Rules []Rule
+
+// Check returns a *PolicyError listing the violated rules, if any.
+func (r Rules) Check(password []byte) error {
+	var violations []Violation
+
+	for _, rule := range r {
+		if reason := rule.Check(password); reason != "" {
+			violations = append(violations, Violation{Rule: rule.Name, Reason: reason})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// LengthRule requires between min and max characters (runes), max 0 means
+// no maximum.
+func LengthRule(min, max int) Rule {
+	return Rule{
+		Name: "length",
+		Check: func(password []byte) string {
+			n := utf8.RuneCount(password)
+			switch {
+			case n < min:
+				return fmt.Sprintf("less than %d characters", min)
+			case max > 0 && n > max:
+				return fmt.Sprintf("more than %d characters", max)
+			}
+			return ""
+		},
+	}
+}
+
+// ClassesRule requires characters from at least min of the classes: lower
+// case, upper case, digit and other.
+func ClassesRule(min int) Rule {
+	return Rule{
+		Name: "classes",
+		Check: func(password []byte) string {
+			var lower, upper, digit, other int
+			for _, r := range string(password) {
+				switch {
+				case unicode.IsLower(r):
+					lower = 1
+				case unicode.IsUpper(r):
+					upper = 1
+				case unicode.IsDigit(r):
+					digit = 1
+				default:
+					other = 1
+				}
+			}
+			if lower+upper+digit+other < min {
+				return fmt.Sprintf("less than %d character classes", min)
+			}
+			return ""
+		},
+	}
+}
+
+// DenyRule rejects the listed passwords (case insensitive).
+func DenyRule(denied ...string) Rule {
+	set := make(map[string]struct{}, len(denied))
+	for _, d := range denied {
+		set[strings.ToLower(d)] = struct{}{}
+	}
+
+	return Rule{
+		Name: "denylist",
+		Check: func(password []byte) string {
+			if _, ok := set[strings.ToLower(string(password))]; ok {
+				return "denied password"
+			}
+			return ""
+		},
+	}
+}
@@ -0,0 +1,129 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+//
+// named parameter presets matching widely used reference recommendations,
+// to use with NewCustom() when porting configurations from other
+// ecosystems.
+//
+
+// scrypt presets.
+const (
+	// ScryptInteractive is N=2^15, r=8, p=1 (32 MiB), the x/crypto/scrypt
+	// recommendation for interactive logins.
+	ScryptInteractive = "interactive"
+	// ScryptSensitive is N=2^17, r=8, p=1 (128 MiB), the OWASP password
+	// storage recommendation.
+	ScryptSensitive = "sensitive"
+	// ScryptFileEncryption is N=2^20, r=8, p=1 (1 GiB), the scrypt(1) file
+	// encryption recommendation.
+	ScryptFileEncryption = "file-encryption"
+)
+
+var scryptPresets = map[string]ScryptParams{
+	ScryptInteractive:    {N: 1 << 15, R: 8, P: 1, Saltlen: 16, Keylen: 32},
+	ScryptSensitive:      {N: 1 << 17, R: 8, P: 1, Saltlen: 16, Keylen: 32},
+	ScryptFileEncryption: {N: 1 << 20, R: 8, P: 1, Saltlen: 16, Keylen: 32},
+}
+
+// ScryptPreset returns a copy of the named scrypt preset parameters.
+func ScryptPreset(name string) (*ScryptParams, error) {
+	params, ok := scryptPresets[name]
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return &params, nil
+}
+
+// OWASP Password Storage Cheat Sheet generations, each one is an
+// externally auditable baseline, hashes of a previous generation report
+// NeedsRehash when compared with a profile of the next one.
+const (
+	// Owasp2023 is argon2id m=19MiB, t=2, p=1, scrypt N=2^17, r=8, p=1 and
+	// bcrypt cost 10.
+	Owasp2023 = "owasp-2023"
+	// Owasp2025 is argon2id m=46MiB, t=1, p=1, scrypt and bcrypt are
+	// unchanged.
+	Owasp2025 = "owasp-2025"
+
+	// OwaspLatest is the most recent generation.
+	OwaspLatest = Owasp2025
+)
+
+var owaspPresets = map[string]map[int]interface{}{
+	Owasp2023: {
+		Argon:  Argon2Params{Version: Argon2id, Time: 2, Memory: 19 * 1024, Thread: 1, Saltlen: 16, Keylen: 32},
+		Scrypt: ScryptParams{N: 1 << 17, R: 8, P: 1, Saltlen: 16, Keylen: 32},
+		Bcrypt: BcryptParams{Cost: 10},
+	},
+	Owasp2025: {
+		Argon:  Argon2Params{Version: Argon2id, Time: 1, Memory: 46 * 1024, Thread: 1, Saltlen: 16, Keylen: 32},
+		Scrypt: ScryptParams{N: 1 << 17, R: 8, P: 1, Saltlen: 16, Keylen: 32},
+		Bcrypt: BcryptParams{Cost: 10},
+	},
+}
+
+// NewOwasp instanciates a Profile with the parameters of the OWASP
+// generation for algorithm (Argon, Scrypt or Bcrypt).
+func NewOwasp(generation string, algorithm int) (*Profile, error) {
+	switch v := owaspPresets[generation][algorithm].(type) {
+	case Argon2Params:
+		return NewCustom(&v)
+	case ScryptParams:
+		return NewCustom(&v)
+	case BcryptParams:
+		return NewCustom(&v)
+	}
+	return nil, ErrUnsupported
+}
+
+// ScryptLogN returns log2(n), the "ln" notation of the scrypt cost used by
+// PHC strings and passlib, n must be a power of 2 greater than 1.
+func ScryptLogN(n uint32) (int, error) {
+	if n < 2 || n&(n-1) != 0 {
+		return 0, ErrUnsupported
+	}
+	return bits.TrailingZeros32(n), nil
+}
+
+// ScryptN returns the scrypt cost N of the "ln" notation, ln in [1, 31].
+func ScryptN(ln int) (uint32, error) {
+	if ln < 1 || ln > 31 {
+		return 0, ErrUnsupported
+	}
+	return 1 << uint(ln), nil
+}
+
+// ParseScryptParams parses the "ln=15,r=8,p=1" notation, the salt and key
+// lengths are the ScryptDefault ones.
+func ParseScryptParams(s string) (*ScryptParams, error) {
+	values, err := parsePHCParams(s, "ln", "r", "p")
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := ScryptN(int(values[0]))
+	if err != nil {
+		return nil, ErrParse
+	}
+
+	params := scryptCommonParameters
+	params.N, params.R, params.P = n, values[1], values[2]
+	return &params, nil
+}
+
+// FormatScryptParams returns the "ln=15,r=8,p=1" notation of params.
+func FormatScryptParams(params *ScryptParams) (string, error) {
+	ln, err := ScryptLogN(params.N)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("ln=%d,r=%d,p=%d", ln, params.R, params.P), nil
+}
@@ -0,0 +1,22 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+// SetProgress sets a hook receiving the progress of the argon2 (after
+// every synchronization point, 4 per pass) and scrypt (every 1/16th of the
+// mixing loops) derivations as done out of total steps, nil removes it.
+// the Go implementation is used while a hook is set, bcrypt does not
+// report progress and returns ErrUnsupported.
+// the hook is called from the deriving goroutine.
+func (p *Profile) SetProgress(f func(done, total int)) error {
+	switch v := p.params.(type) {
+	case *ScryptParams:
+		v.progress = f
+		return nil
+	case *Argon2Params:
+		v.progress = f
+		return nil
+	}
+	return ErrUnsupported
+}
@@ -0,0 +1,115 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// SecretProvider supplies the secret (pepper) of a profile.
+type SecretProvider interface {
+	Secret() ([]byte, error)
+}
+
+// SetSecretProvider loads the secret from sp and sets it with SetSecret().
+func (p *Profile) SetSecretProvider(sp SecretProvider) error {
+	secret, err := sp.Secret()
+	if err != nil {
+		return err
+	}
+	return p.SetSecret(secret)
+}
+
+const (
+	// default directory of the docker (swarm) secrets
+	dockerSecretsDir = "/run/secrets"
+
+	// default maximum permissions of a secret file
+	secretFilePerm = os.FileMode(0600)
+)
+
+// FileSecret is a SecretProvider reading the secret from a file, a single
+// trailing newline is removed.
+type FileSecret struct {
+	Path   string
+	Base64 bool // content is standard base64 encoded
+
+	// MaxPerm is the maximum permission bits the file may have
+	// (0600 if 0), it is not checked on windows.
+	MaxPerm os.FileMode
+}
+
+// Secret reads the secret file after checking its permissions,
+// ErrSecretPermissions is returned for files with excessive permissions.
+func (f FileSecret) Secret() ([]byte, error) {
+	fi, err := os.Stat(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, ErrSecretPermissions
+	}
+
+	perm := f.MaxPerm
+	if perm == 0 {
+		perm = secretFilePerm
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&^perm != 0 {
+		return nil, ErrSecretPermissions
+	}
+
+	content, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasSuffix(content, []byte("\r\n")):
+		content = content[:len(content)-2]
+	case bytes.HasSuffix(content, []byte("\n")):
+		content = content[:len(content)-1]
+	}
+
+	if f.Base64 {
+		secret := make([]byte, base64.StdEncoding.DecodedLen(len(content)))
+		n, err := base64.StdEncoding.Decode(secret, content)
+		if err != nil {
+			return nil, ErrParse
+		}
+		return secret[:n], nil
+	}
+	return content, nil
+}
+
+// SystemdCredential returns the FileSecret of the systemd credential name
+// (LoadCredential=/SetCredential=) found in $CREDENTIALS_DIRECTORY.
+func SystemdCredential(name string, b64 bool) (FileSecret, error) {
+	dir := os.Getenv("CREDENTIALS_DIRECTORY")
+	if dir == "" {
+		return FileSecret{}, ErrUnsupported
+	}
+
+	fs := FileSecret{
+		Path:   filepath.Join(dir, name),
+		Base64: b64,
+	}
+	return fs, nil
+}
+
+// DockerSecret returns the FileSecret of the docker secret name mounted in
+// /run/secrets, kubernetes secret volumes can use FileSecret with the mount
+// path, both default to world readable files (0444/0644), so they are
+// accepted.
+func DockerSecret(name string, b64 bool) FileSecret {
+	return FileSecret{
+		Path:    filepath.Join(dockerSecretsDir, name),
+		Base64:  b64,
+		MaxPerm: 0644,
+	}
+}
@@ -0,0 +1,238 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ermites-io/passwd/internal/argon2"
+)
+
+//
+// memory-hard client puzzles.
+//
+// during credential stuffing waves the login and signup endpoints hand
+// out puzzles the clients must solve before their request is processed,
+// each attempt costs the attacker memory-hard work:
+//
+// find solution such that
+// argon2id(label || solution, nonce, params) has difficulty leading zero bits
+//
+// about 2^difficulty derivations for the client, one for the server.
+// puzzles are stateless, the issuer authenticates them:
+//
+// $2p$b64(NONCE)$EXPIRES$T$M$P$DIFFICULTY$b64(hmac_sha3-256(...))
+//
+// a solved puzzle can be replayed until it expires, callers needing single
+// use puzzles keep the verified nonces until then.
+//
+
+const (
+	idPuzzle = "2p"
+
+	labelPuzzle = "passwd/puzzle/v1"
+
+	puzzleNoncelen = 16
+	puzzleMaclen   = 16
+
+	// PuzzleMaxDifficulty bounds the puzzles difficulty (leading zero bits).
+	PuzzleMaxDifficulty = 32
+)
+
+// puzzle derivations default parameters, 4 MiB.
+var puzzleParameters = Argon2Params{Version: Argon2id, Time: 1, Memory: 4 * 1024, Thread: 1, Keylen: 32}
+
+// Puzzle is a client puzzle, sent to the client as its String() encoding.
+type Puzzle struct {
+	Nonce      []byte
+	Expires    int64 // unix seconds
+	Time       uint32
+	Memory     uint32
+	Thread     uint8
+	Difficulty int
+	MAC        []byte
+}
+
+func (pz *Puzzle) fields() string {
+	return fmt.Sprintf("%c%s%c%s%c%d%c%d%c%d%c%d%c%d",
+		separatorRune, idPuzzle,
+		separatorRune, base64Encode(pz.Nonce),
+		separatorRune, pz.Expires,
+		separatorRune, pz.Time,
+		separatorRune, pz.Memory,
+		separatorRune, pz.Thread,
+		separatorRune, pz.Difficulty)
+}
+
+// String returns the puzzle encoding.
+func (pz *Puzzle) String() string {
+	return fmt.Sprintf("%s%c%s", pz.fields(), separatorRune, base64Encode(pz.MAC))
+}
+
+// ParsePuzzle parses a puzzle String() encoding, it is authenticated by
+// PuzzleIssuer.Verify().
+func ParsePuzzle(s string) (*Puzzle, error) {
+	fields := strings.Split(s, string(separatorRune))
+	if len(fields) != 9 || fields[0] != "" || fields[1] != idPuzzle {
+		return nil, ErrParse
+	}
+
+	expires, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return nil, ErrParse
+	}
+	var values [4]uint64
+	for i, f := range fields[4:8] {
+		v, err := strconv.ParseUint(f, 10, 32)
+		if err != nil {
+			return nil, ErrParse
+		}
+		values[i] = v
+	}
+
+	nonce, err := base64Decode([]byte(fields[2]))
+	if err != nil {
+		return nil, ErrParse
+	}
+	mac, err := base64Decode([]byte(fields[8]))
+	if err != nil {
+		return nil, ErrParse
+	}
+	if values[2] > 255 || values[3] > PuzzleMaxDifficulty {
+		return nil, ErrParse
+	}
+
+	return &Puzzle{
+		Nonce:      nonce,
+		Expires:    expires,
+		Time:       uint32(values[0]),
+		Memory:     uint32(values[1]),
+		Thread:     uint8(values[2]),
+		Difficulty: int(values[3]),
+		MAC:        mac,
+	}, nil
+}
+
+// digest is the derivation of a solution attempt.
+func (pz *Puzzle) digest(solution uint64) []byte {
+	var input [len(labelPuzzle) + 8]byte
+	copy(input[:], labelPuzzle)
+	binary.BigEndian.PutUint64(input[len(labelPuzzle):], solution)
+
+	return argon2Key(argon2.ModeID, input[:], pz.Nonce, nil, nil, pz.Time, pz.Memory, pz.Thread, puzzleParameters.Keylen)
+}
+
+// solves returns true if digest has the puzzle difficulty leading zero bits.
+func (pz *Puzzle) solves(digest []byte) bool {
+	bits := pz.Difficulty
+	for _, b := range digest {
+		switch {
+		case bits <= 0:
+			return true
+		case bits < 8:
+			return b>>uint(8-bits) == 0
+		case b != 0:
+			return false
+		}
+		bits -= 8
+	}
+	return bits <= 0
+}
+
+// Solve searches the puzzle solution, for Go clients and tests.
+func (pz *Puzzle) Solve() (uint64, error) {
+	if pz.Difficulty < 1 || pz.Difficulty > PuzzleMaxDifficulty || pz.Time < 1 || pz.Thread < 1 {
+		return 0, ErrUnsupported
+	}
+	for solution := uint64(0); ; solution++ {
+		if pz.solves(pz.digest(solution)) {
+			return solution, nil
+		}
+	}
+}
+
+// PuzzleIssuer issues and verifies client puzzles.
+type PuzzleIssuer struct {
+	key        []byte
+	params     Argon2Params
+	difficulty int
+	ttl        time.Duration
+}
+
+// NewPuzzleIssuer returns a PuzzleIssuer authenticating its puzzles with
+// key (validated like SetSecret()), the derivations use the argon2id
+// params time, memory and threads (4 MiB if nil), difficulty is in [1,
+// PuzzleMaxDifficulty] and the puzzles expire after ttl.
+func NewPuzzleIssuer(key []byte, params *Argon2Params, difficulty int, ttl time.Duration) (*PuzzleIssuer, error) {
+	err := validateSecret(key)
+	if err != nil {
+		return nil, err
+	}
+	if difficulty < 1 || difficulty > PuzzleMaxDifficulty || ttl <= 0 {
+		return nil, ErrUnsupported
+	}
+
+	pi := PuzzleIssuer{
+		key:        key,
+		params:     puzzleParameters,
+		difficulty: difficulty,
+		ttl:        ttl,
+	}
+	if params != nil {
+		if params.Time < 1 || params.Thread < 1 {
+			return nil, ErrUnsupported
+		}
+		pi.params.Time, pi.params.Memory, pi.params.Thread = params.Time, params.Memory, params.Thread
+	}
+	return &pi, nil
+}
+
+func (pi *PuzzleIssuer) mac(pz *Puzzle) []byte {
+	h := hmac.New(newSHA3256, pi.key)
+	h.Write([]byte(labelPuzzle))
+	h.Write([]byte{0x00})
+	h.Write([]byte(pz.fields()))
+	return h.Sum(nil)[:puzzleMaclen]
+}
+
+// Issue returns a new puzzle.
+func (pi *PuzzleIssuer) Issue() (*Puzzle, error) {
+	nonce := make([]byte, puzzleNoncelen)
+	err := readRandom(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	pz := Puzzle{
+		Nonce:      nonce,
+		Expires:    now().Add(pi.ttl).Unix(),
+		Time:       pi.params.Time,
+		Memory:     pi.params.Memory,
+		Thread:     pi.params.Thread,
+		Difficulty: pi.difficulty,
+	}
+	pz.MAC = pi.mac(&pz)
+	return &pz, nil
+}
+
+// Verify verifies solution solves the puzzle, it returns ErrCorrupted if
+// the puzzle was not issued by pi (or tampered with), ErrExpired if it
+// expired and ErrMismatch if solution is wrong.
+func (pi *PuzzleIssuer) Verify(pz *Puzzle, solution uint64) error {
+	if !hmac.Equal(pz.MAC, pi.mac(pz)) {
+		return ErrCorrupted
+	}
+	if now().Unix() >= pz.Expires {
+		return ErrExpired
+	}
+	if !pz.solves(pz.digest(solution)) {
+		return ErrMismatch
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+//
+// hashing rate limiting.
+//
+// a RateLimiter is a token bucket capping the aggregate hashing work of
+// the profiles it is attached to, work over the budget is refused with a
+// *BusyError (ErrBusy) carrying the delay after which it would be
+// accepted, instead of queueing and starving the rest of the process.
+//
+
+// BusyError is returned when the hashing work is refused by a rate
+// limiter.
+type BusyError struct {
+	RetryAfter time.Duration // delay before the work would be accepted
+}
+
+func (e *BusyError) Error() string {
+	return string(ErrBusy) + ", retry after " + e.RetryAfter.String()
+}
+
+// Unwrap returns ErrBusy.
+func (e *BusyError) Unwrap() error { return ErrBusy }
+
+// Is reports whether target is ErrBusy.
+func (e *BusyError) Is(target error) bool { return target == ErrBusy }
+
+// RateLimiter is a token bucket shared by profiles.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64 // bucket size
+	cost   func(params interface{}) float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a full bucket of burst tokens refilled at rate
+// tokens per second. cost returns the tokens an operation with the given
+// parameters consumes, nil counts operations (1 token each), WorkCost
+// weights them by their work factors.
+func NewRateLimiter(rate, burst float64, cost func(params interface{}) float64) (*RateLimiter, error) {
+	if rate <= 0 || burst < 1 {
+		return nil, ErrUnsupported
+	}
+	return &RateLimiter{rate: rate, burst: burst, cost: cost, tokens: burst, last: now()}, nil
+}
+
+// WorkCost returns the work factors of params in units of the
+// Argon2idDefault profile, a rough estimate of their relative CPU time.
+func WorkCost(params interface{}) float64 {
+	c, err := paramsCost(params)
+	if err != nil {
+		return 1
+	}
+	ref, _ := paramsCost(&argonCommonParameters)
+	return float64(c) / float64(ref)
+}
+
+// take consumes the tokens of an operation, or returns the delay before
+// they are available.
+func (r *RateLimiter) take(params interface{}) (time.Duration, bool) {
+	n := 1.0
+	if r.cost != nil {
+		n = r.cost(params)
+	}
+	// an operation larger than the bucket would never be accepted.
+	n = math.Min(n, r.burst)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := now()
+	if elapsed := t.Sub(r.last).Seconds(); elapsed > 0 {
+		r.tokens = math.Min(r.burst, r.tokens+elapsed*r.rate)
+		r.last = t
+	}
+
+	if r.tokens >= n {
+		r.tokens -= n
+		return 0, true
+	}
+
+	wait := (n - r.tokens) / r.rate
+	return time.Duration(math.Ceil(wait * float64(time.Second))), false
+}
+
+// SetRateLimiter attaches the profile hashing work to r, nil detaches it.
+func (p *Profile) SetRateLimiter(r *RateLimiter) error {
+	p.rateLimiter = r
+	return nil
+}
+
+// admit checks the profile rate limiter (if any).
+func (p *Profile) admit() error {
+	if p.rateLimiter == nil {
+		return nil
+	}
+	if wait, ok := p.rateLimiter.take(p.params); !ok {
+		return &BusyError{RetryAfter: wait}
+	}
+	return nil
+}
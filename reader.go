@@ -0,0 +1,87 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"io"
+)
+
+//
+// reader input.
+//
+// key files and piped passphrases are read once into a single buffer
+// capped to the profile limit, the buffer is wiped once hashed/compared.
+//
+
+// DefaultReaderLimit is the maximum number of bytes HashReader() and
+// CompareReader() consume unless SetReaderLimit() is used.
+const DefaultReaderLimit = 64 << 10
+
+// SetReaderLimit sets the maximum number of bytes HashReader() and
+// CompareReader() read, 0 restores DefaultReaderLimit.
+func (p *Profile) SetReaderLimit(n int64) error {
+	if n < 0 {
+		return ErrUnsupported
+	}
+	p.readerLimit = n
+	return nil
+}
+
+func (p *Profile) readAll(r io.Reader) ([]byte, error) {
+	limit := p.readerLimit
+	if limit == 0 {
+		limit = DefaultReaderLimit
+	}
+
+	// read one extra byte to detect oversized input.
+	buf := make([]byte, 0, 512)
+	lr := io.LimitReader(r, limit+1)
+	for {
+		if len(buf) == cap(buf) {
+			grown := make([]byte, len(buf), 2*cap(buf))
+			copy(grown, buf)
+			wipe(buf)
+			buf = grown
+		}
+		n, err := lr.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			wipe(buf)
+			return nil, err
+		}
+	}
+
+	if int64(len(buf)) > limit {
+		wipe(buf)
+		return nil, ErrPasswordTooLong
+	}
+	return buf, nil
+}
+
+// HashReader is Hash() on the content read from r, up to the profile
+// reader limit (SetReaderLimit()), larger inputs return ErrPasswordTooLong.
+func (p *Profile) HashReader(r io.Reader) ([]byte, error) {
+	password, err := p.readAll(r)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(password)
+
+	return p.Hash(password)
+}
+
+// CompareReader is Compare() on the content read from r, up to the
+// profile reader limit (SetReaderLimit()).
+func (p *Profile) CompareReader(hashed []byte, r io.Reader) error {
+	password, err := p.readAll(r)
+	if err != nil {
+		return err
+	}
+	defer wipe(password)
+
+	return p.Compare(hashed, password)
+}
@@ -0,0 +1,94 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+)
+
+//
+// row binding.
+//
+// the stored value carries a key'ed binding of the hash to a caller
+// supplied record identifier (i.e. the row primary key):
+//
+// $ID$rb=b64(BINDING)$b64(SALT)$...$b64(HASH)
+//
+// BINDING = hmac_sha3-256(len(record) || record || hash, hmac_sha3-256(label, secret))[:16]
+//
+// an attacker with UPDATE access cannot copy his own hash into a victim's
+// row, the binding is verified before any derivation happens.
+//
+
+const (
+	labelRecord = "passwd/record/v1"
+
+	recordBindingLen = 16
+)
+
+func recordBinding(secret, record, hashed []byte) []byte {
+	var length [8]byte
+
+	binary.BigEndian.PutUint64(length[:], uint64(len(record)))
+
+	k := hmac.New(newSHA3256, secret)
+	k.Write([]byte(labelRecord))
+
+	h := hmac.New(newSHA3256, k.Sum(nil))
+	h.Write(length[:])
+	h.Write(record)
+	h.Write(hashed)
+	return h.Sum(nil)[:recordBindingLen]
+}
+
+// WithRecord returns a copy of the profile binding produced hashes to the
+// record identifier, Compare() on the copy verifies the binding and
+// returns ErrBinding if the stored value belongs to another record.
+// The binding is key'ed, the profile requires a secret.
+func (p *Profile) WithRecord(record []byte) *Profile {
+	c := p.clone()
+	c.record = record
+	return c
+}
+
+func (p *Profile) bindRecord(hashed []byte, md metadata) error {
+	if len(p.record) == 0 {
+		return nil
+	}
+
+	secret := p.key()
+	if len(secret) == 0 {
+		return ErrSecretRequired
+	}
+
+	md[metaRecord] = string(base64Encode(recordBinding(secret, p.record, hashed)))
+	return nil
+}
+
+func (p *Profile) checkRecord(hashed []byte, md metadata) error {
+	stored, bound := md[metaRecord]
+
+	switch {
+	case len(p.record) == 0 && !bound:
+		return nil
+	case len(p.record) == 0 || !bound:
+		return ErrMismatch
+	}
+
+	secret := p.key()
+	if len(secret) == 0 {
+		return ErrMismatch
+	}
+
+	binding, err := base64Decode([]byte(stored))
+	if err != nil {
+		return ErrMismatch
+	}
+
+	if !hmac.Equal(binding, recordBinding(secret, p.record, hashed)) {
+		return ErrBinding
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"crypto/hmac"
+	"strings"
+)
+
+//
+// redacted export.
+//
+// analytics pipelines get the parameters and metadata of the stored
+// hashes with a key'ed, truncated fingerprint instead of the hash:
+//
+// fingerprint = b64(hmac_sha3-256(hashed, key)[:12])
+//
+// identical stored values share a fingerprint (duplicates, copied
+// records), nothing verifiable is exported and without the key the
+// fingerprints cannot be matched against other dumps.
+//
+
+const redactedFingerprintlen = 12
+
+// Redacted describes a stored hash without its verifiable material.
+type Redacted struct {
+	Algorithm   string            `json:"alg"`              // hash identifier (i.e. "2id", "2s", "2a")
+	Params      interface{}       `json:"params,omitempty"` // *Argon2Params, *ScryptParams or *BcryptParams
+	Masked      bool              `json:"masked,omitempty"` // parameters are not stored in the hash
+	Locked      bool              `json:"locked,omitempty"` // the hash carries a lock marker
+	Metadata    map[string]string `json:"meta,omitempty"`   // metadata field
+	Fingerprint string            `json:"fp"`
+}
+
+// Redact returns the redacted form of hashed, key must be a random secret
+// of at least SecretMinLength bytes dedicated to the export.
+func Redact(key, hashed []byte) (*Redacted, error) {
+	if len(key) < SecretMinLength {
+		return nil, ErrSecretTooShort
+	}
+
+	h := hmac.New(newSHA3256, key)
+	h.Write(hashed)
+	r := Redacted{
+		Fingerprint: string(base64Encode(h.Sum(nil)[:redactedFingerprintlen])),
+	}
+
+	if Locked(hashed) {
+		r.Locked = true
+		unlocked, err := Unlock(hashed)
+		if err != nil {
+			return &r, nil // disabled account, nothing to describe
+		}
+		hashed = unlocked
+	}
+
+	if isPHC(hashed) {
+		native, err := Reencode(hashed, FormatNative)
+		if err != nil {
+			return nil, ErrParse
+		}
+		hashed = native
+	}
+
+	_, md, err := splitMetadata(hashed)
+	if err != nil {
+		return nil, ErrParse
+	}
+	if len(md) > 0 {
+		r.Metadata = md
+	}
+
+	core, _ := coreHash(hashed)
+	fields := strings.FieldsFunc(string(core), token)
+	if len(fields) == 0 {
+		return nil, ErrParse
+	}
+	r.Algorithm = fields[0]
+
+	if maskedFields(fields) {
+		r.Masked = true
+		return &r, nil
+	}
+
+	// other formats (relief, challenge verifiers..) are described by
+	// their identifier only.
+	params, err := parseFromHashToParams(core)
+	if err == nil {
+		r.Params = publicParams(params)
+	}
+
+	return &r, nil
+}
@@ -0,0 +1,191 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"sync"
+)
+
+//
+// external algorithms.
+//
+// third party implementations (i.e. yescrypt, balloon hashing) implement
+// Hasher and are registered under their hash identifier:
+//
+// $ID$...
+//
+// the registered HashProfile instantiates them with New(), Compare() and
+// the parser dispatch their hashes on the identifier, the package
+// features layered on the hash string (metadata, integrity tags, locks,
+// associated data..) apply, the algorithm secret and masking do not.
+//
+
+// Hasher is an external password hashing algorithm, carrying its
+// parameters.
+type Hasher interface {
+	// GenerateFromPassword returns the hash of password, "$ID$..." with
+	// ID the registered identifier, the field following the identifier
+	// must not contain '='.
+	GenerateFromPassword(password []byte) ([]byte, error)
+	// Compare compares hashed against password, ErrMismatch if they do not
+	// match.
+	Compare(hashed, password []byte) error
+	// DeriveFromPassword derives a key from password and salt,
+	// ErrUnsupported if the algorithm is not a KDF.
+	DeriveFromPassword(password, salt []byte) ([]byte, error)
+	// MarshalParams returns the text encoding of the parameters (i.e.
+	// "N=4096,r=32"), it must be stable.
+	MarshalParams() ([]byte, error)
+	// UnmarshalParams loads the parameters stored in hashed.
+	UnmarshalParams(hashed []byte) error
+}
+
+// registered profiles are numbered after the package ones.
+const registeredProfileBase HashProfile = 1 << 16
+
+type registration struct {
+	id      string
+	factory func() Hasher
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []registration
+)
+
+// hasherParams are the parameters of a Profile using a Hasher.
+type hasherParams struct {
+	id string
+	h  Hasher
+}
+
+// validHasherID returns true for the identifiers an external algorithm
+// can register: lowercase alphanumerics and '-', starting with a letter,
+// the package own identifiers start with a digit.
+func validHasherID(id string) bool {
+	if len(id) == 0 || len(id) > 32 || id[0] < 'a' || id[0] > 'z' {
+		return false
+	}
+	for _, c := range []byte(id) {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	switch id {
+	case phcArgon2i, phcArgon2id, phcArgon2d, phcScrypt:
+		return false
+	}
+	return true
+}
+
+// Register registers the external algorithm id, factory returns a Hasher
+// with the default parameters, it is called by New() with the returned
+// HashProfile and by the parser before UnmarshalParams().
+// Register returns ErrUnsupported for invalid (see Hasher) or already
+// registered identifiers, it is meant to be called at init time.
+func Register(id string, factory func() Hasher) (HashProfile, error) {
+	if !validHasherID(id) || factory == nil {
+		return 0, ErrUnsupported
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for _, r := range registry {
+		if r.id == id {
+			return 0, ErrUnsupported
+		}
+	}
+	registry = append(registry, registration{id: id, factory: factory})
+	return registeredProfileBase + HashProfile(len(registry)-1), nil
+}
+
+// registeredProfile returns the registration of profile.
+func registeredProfile(profile HashProfile) (registration, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	i := int(profile - registeredProfileBase)
+	if profile < registeredProfileBase || i >= len(registry) {
+		return registration{}, false
+	}
+	return registry[i], true
+}
+
+// registeredID returns the registration of the identifier id.
+func registeredID(id string) (registration, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	for _, r := range registry {
+		if r.id == id {
+			return r, true
+		}
+	}
+	return registration{}, false
+}
+
+// parseRegistered returns the parameters of a hash of an external
+// algorithm.
+func parseRegistered(r registration, hashed []byte) (*hasherParams, error) {
+	h := r.factory()
+	err := h.UnmarshalParams(hashed)
+	if err != nil {
+		return nil, ErrParse
+	}
+	return &hasherParams{id: r.id, h: h}, nil
+}
+
+// prefix returns the "$ID$" prefix of the hashes.
+func (hp *hasherParams) prefix() []byte {
+	return []byte(string(separatorRune) + hp.id + string(separatorRune))
+}
+
+func (hp *hasherParams) generateFromPassword(password []byte) ([]byte, error) {
+	hashed, err := hp.h.GenerateFromPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	// the hash must be framed like the package ones to carry metadata.
+	if !bytes.HasPrefix(hashed, hp.prefix()) {
+		return nil, ErrParse
+	}
+	if _, md, err := splitMetadata(hashed); err != nil || md != nil {
+		return nil, ErrParse
+	}
+	return hashed, nil
+}
+
+func (hp *hasherParams) compare(hashed, password []byte) error {
+	if !bytes.HasPrefix(hashed, hp.prefix()) {
+		return ErrMismatch
+	}
+	return hp.h.Compare(hashed, password)
+}
+
+// sameParams returns true if both parameters are of the same algorithm and
+// marshal identically.
+func (hp *hasherParams) sameParams(o *hasherParams) bool {
+	if hp.id != o.id {
+		return false
+	}
+	a, err := hp.h.MarshalParams()
+	if err != nil {
+		return false
+	}
+	b, err := o.h.MarshalParams()
+	return err == nil && bytes.Equal(a, b)
+}
+
+// maskedFields returns true if the fields of a hash are the ones of a
+// masked hash of the package algorithms.
+func maskedFields(fields []string) bool {
+	if len(fields) != 3 || fields[0] == idBcrypt {
+		return false
+	}
+	_, ok := registeredID(fields[0])
+	return !ok
+}
@@ -0,0 +1,461 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ermites-io/passwd/internal/bcrypt"
+)
+
+//
+// "server relief" mode.
+//
+// the expensive KDF runs on the client (browser/mobile) using the public
+// parameters exported by the server, the client sends the resulting key
+// and the server only applies a cheap (key'ed if a secret is set)
+// finalization before storage:
+//
+// client: ck = KDF(password, salt, params)
+// server: tag = hmac_sha3-384(hmac_sha3-256(ck, serversalt), secret)
+//
+// the stored value keeps everything needed to hand the parameters back to
+// the client at login time:
+//
+// $2r$ALGID$b64(SALT)$P0$P1$P2$KEYLEN$b64(SERVERSALT)$b64(TAG)
+//
+// with the bcrypt server tier (SetServerTier()) the finalization is a
+// bcrypt of the key'ed digest instead, adding a work factor on the server
+// side, the combined value embeds the bcrypt hash:
+//
+// server: tag = bcrypt(hmac_sha3-384(hmac_sha3-256(ck, salt), secret), cost)
+//
+// $2r$ALGID$b64(SALT)$P0$P1$P2$KEYLEN$2a$COST$BCRYPTSALTHASH
+//
+// NegotiateClientParams() adapts the exported parameters to the client
+// capabilities (memory, threads) at enrollment, keeping their cost.
+//
+
+// ServerTier is the server side finalization of the relief mode.
+type ServerTier int
+
+const (
+	// TierHMAC is the default key'ed HMAC finalization.
+	TierHMAC ServerTier = iota
+	// TierBcrypt is a bcrypt of the key'ed digest.
+	TierBcrypt
+)
+
+const (
+	idRelief = "2r"
+
+	// server side salt length used for the finalization
+	reliefSaltlen = 16
+)
+
+// ClientParams are the public parameters a client needs to run the
+// expensive part of the derivation on its side.
+type ClientParams struct {
+	Algorithm string `json:"alg"`               // idArgon2id, idArgon2i or idScrypt
+	Salt      []byte `json:"salt"`              // per-user client salt
+	Time      uint32 `json:"t,omitempty"`       // argon2 only
+	Memory    uint32 `json:"m,omitempty"`       // argon2 only
+	Thread    uint8  `json:"threads,omitempty"` // argon2 only
+	N         uint32 `json:"n,omitempty"`       // scrypt only
+	R         uint32 `json:"r,omitempty"`       // scrypt only
+	P         uint32 `json:"p,omitempty"`       // scrypt only
+	Keylen    uint32 `json:"keylen"`
+}
+
+// ClientParams exports the public parameters of the profile for a client
+// side derivation using salt, if salt is nil a new random salt is generated
+// (i.e. at enrollment).
+func (p *Profile) ClientParams(salt []byte) (*ClientParams, error) {
+	var err error
+	var cp ClientParams
+
+	switch v := p.params.(type) {
+	case *ScryptParams:
+		cp = ClientParams{
+			Algorithm: idScrypt,
+			N:         v.N,
+			R:         v.R,
+			P:         v.P,
+			Keylen:    v.Keylen,
+		}
+		if salt == nil {
+			salt, err = getSalt(v.Saltlen)
+		}
+	case *Argon2Params:
+		// the client may be observed, no data dependent accesses.
+		if v.Version == Argon2d {
+			return nil, ErrUnsupported
+		}
+		cp = ClientParams{
+			Algorithm: idArgon2id,
+			Time:      v.Time,
+			Memory:    v.Memory,
+			Thread:    v.Thread,
+			Keylen:    v.Keylen,
+		}
+		if v.Version == Argon2i {
+			cp.Algorithm = idArgon2i
+		}
+		if salt == nil {
+			salt, err = getSalt(v.Saltlen)
+		}
+	default:
+		return nil, ErrUnsupported
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	cp.Salt = salt
+
+	return &cp, nil
+}
+
+// ClientParamsFromHash extracts the client parameters from a stored relief
+// hash or challenge verifier, so they can be handed back to the client at
+// login time.
+func ClientParamsFromHash(hashed []byte) (*ClientParams, error) {
+	id := idRelief
+	if bytes.HasPrefix(hashed, []byte(string(separatorRune)+idChallenge+string(separatorRune))) {
+		id = idChallenge
+	}
+	cp, _, _, err := parseRelief(id, hashed)
+	return cp, err
+}
+
+// ClientHash is the client half of the relief mode, it runs the expensive
+// derivation of password using the server provided parameters.
+func ClientHash(cp *ClientParams, password []byte) ([]byte, error) {
+	if cp == nil || len(cp.Salt) == 0 {
+		return nil, ErrUnsupported
+	}
+	err := cp.check()
+	if err != nil {
+		return nil, err
+	}
+
+	switch cp.Algorithm {
+	case idScrypt:
+		sp := ScryptParams{
+			N:       cp.N,
+			R:       cp.R,
+			P:       cp.P,
+			Saltlen: uint32(len(cp.Salt)),
+			Keylen:  cp.Keylen,
+		}
+		return sp.deriveFromPassword(password, cp.Salt)
+	case idArgon2i, idArgon2id:
+		ap := Argon2Params{
+			Version: Argon2id,
+			Time:    cp.Time,
+			Memory:  cp.Memory,
+			Thread:  cp.Thread,
+			Saltlen: uint32(len(cp.Salt)),
+			Keylen:  cp.Keylen,
+		}
+		if cp.Algorithm == idArgon2i {
+			ap.Version = Argon2i
+		}
+		return ap.deriveFromPassword(password, cp.Salt)
+	}
+
+	return nil, ErrUnsupported
+}
+
+func reliefTag(secret, serverSalt, clientKey []byte) ([]byte, error) {
+	return hmacKeyHash(secret, serverSalt, clientKey)
+}
+
+// SetServerTier selects the relief finalization applied by Finalize(),
+// cost is the bcrypt cost of TierBcrypt (0 is the bcrypt default).
+// CompareFinalized() handles both tiers whatever the setting.
+func (p *Profile) SetServerTier(tier ServerTier, cost int) error {
+	switch tier {
+	case TierHMAC:
+		cost = 0
+	case TierBcrypt:
+		if cost == 0 {
+			cost = bcryptCommonParameters.Cost
+		}
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return ErrUnsupported
+		}
+	default:
+		return ErrUnsupported
+	}
+
+	p.reliefTier, p.reliefCost = tier, cost
+	return nil
+}
+
+// reliefBcryptInput is the key'ed digest of the client key the bcrypt tier
+// works on, it fits the 72 bytes bcrypt limit whatever the key length.
+func reliefBcryptInput(secret []byte, cp *ClientParams, clientKey []byte) ([]byte, error) {
+	return hmacKeyHash(secret, cp.Salt, clientKey)
+}
+
+func encodeRelief(id string, cp *ClientParams, serverSalt, tag []byte) ([]byte, error) {
+	var p0, p1, p2 uint32
+	var hash bytes.Buffer
+
+	switch cp.Algorithm {
+	case idScrypt:
+		p0, p1, p2 = cp.N, cp.R, cp.P
+	case idArgon2i, idArgon2id:
+		p0, p1, p2 = cp.Time, cp.Memory, uint32(cp.Thread)
+	default:
+		return nil, ErrUnsupported
+	}
+
+	// $ID$ALGID$b64(SALT)$P0$P1$P2$KEYLEN$b64(SERVERSALT)$b64(TAG)
+	_, err := fmt.Fprintf(&hash, "%c%s%c%s%c%s%c%d%c%d%c%d%c%d",
+		separatorRune, id,
+		separatorRune, cp.Algorithm,
+		separatorRune, base64Encode(cp.Salt),
+		separatorRune, p0,
+		separatorRune, p1,
+		separatorRune, p2,
+		separatorRune, cp.Keylen)
+	if err != nil {
+		return nil, err
+	}
+
+	// bcrypt tier: the tag is the bcrypt hash itself.
+	if serverSalt == nil {
+		hash.Write(tag)
+		return hash.Bytes(), nil
+	}
+
+	_, err = fmt.Fprintf(&hash, "%c%s%c%s",
+		separatorRune, base64Encode(serverSalt),
+		separatorRune, base64Encode(tag))
+	if err != nil {
+		return nil, err
+	}
+
+	return hash.Bytes(), nil
+}
+
+// parseRelief returns the client parameters, the server salt and the tag
+// of a stored relief value, for the bcrypt tier serverSalt is nil and tag
+// is the bcrypt hash.
+func parseRelief(id string, hashed []byte) (cp *ClientParams, serverSalt, tag []byte, err error) {
+	fields := strings.FieldsFunc(string(hashed), token)
+	bcryptTier := len(fields) == 10 && fields[7] == idBcrypt
+	if (len(fields) != 9 && !bcryptTier) || fields[0] != id {
+		return nil, nil, nil, ErrParse
+	}
+
+	cp, err = parseClientParams(fields[1:7])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	err = cp.check()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if bcryptTier {
+		// the bcrypt hash is the tail starting at its identifier.
+		i := strings.Index(string(hashed), string(separatorRune)+idBcrypt+string(separatorRune))
+		if i < 0 {
+			return nil, nil, nil, ErrParse
+		}
+		tag = hashed[i:]
+	} else {
+		serverSalt, err = base64Decode([]byte(fields[7]))
+		if err != nil {
+			return nil, nil, nil, ErrParse
+		}
+
+		tag, err = base64Decode([]byte(fields[8]))
+		if err != nil {
+			return nil, nil, nil, ErrParse
+		}
+	}
+
+	return cp, serverSalt, tag, nil
+}
+
+// parseClientParams parses the ALGID$b64(SALT)$P0$P1$P2$KEYLEN fields.
+func parseClientParams(fields []string) (*ClientParams, error) {
+	var values [4]uint32
+	for i := range values {
+		v, err := strconv.ParseUint(fields[2+i], 10, 32)
+		if err != nil {
+			return nil, ErrParse
+		}
+		values[i] = uint32(v)
+	}
+
+	salt, err := base64Decode([]byte(fields[1]))
+	if err != nil {
+		return nil, ErrParse
+	}
+
+	cp := ClientParams{
+		Algorithm: fields[0],
+		Salt:      salt,
+		Keylen:    values[3],
+	}
+
+	switch cp.Algorithm {
+	case idScrypt:
+		cp.N, cp.R, cp.P = values[0], values[1], values[2]
+	case idArgon2i, idArgon2id:
+		if values[2] > 255 {
+			return nil, ErrParse
+		}
+		cp.Time, cp.Memory, cp.Thread = values[0], values[1], uint8(values[2])
+	default:
+		return nil, ErrParse
+	}
+	return &cp, nil
+}
+
+// check refuses the client parameters out of the parsing bounds, before
+// any derivation.
+func (cp *ClientParams) check() error {
+	if len(cp.Salt) == 0 || cp.Keylen == 0 || cp.Keylen > maxParseKeylen {
+		return ErrParse
+	}
+
+	switch cp.Algorithm {
+	case idScrypt:
+		return checkParams(cp.Algorithm, cp.N, cp.R, cp.P)
+	case idArgon2i, idArgon2id:
+		return checkParams(cp.Algorithm, cp.Time, cp.Memory, uint32(cp.Thread))
+	}
+	return ErrUnsupported
+}
+
+// Finalize is the server half of the relief mode, it applies the cheap
+// finalization to the clientKey computed by the client with cp and
+// returns the combined value ready for storage.
+// if the profile has a secret (SetKey()) the finalization is key'ed.
+func (p *Profile) Finalize(cp *ClientParams, clientKey []byte) ([]byte, error) {
+	if cp == nil || uint32(len(clientKey)) != cp.Keylen {
+		return nil, ErrHash
+	}
+
+	if p.reliefTier == TierBcrypt {
+		input, err := reliefBcryptInput(p.key(), cp, clientKey)
+		if err != nil {
+			return nil, err
+		}
+		bp := BcryptParams{Cost: p.reliefCost}
+		tag, err := bp.generateFromPassword(input)
+		if err != nil {
+			return nil, err
+		}
+		return encodeRelief(idRelief, cp, nil, tag)
+	}
+
+	serverSalt, err := getSalt(reliefSaltlen)
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := reliefTag(p.key(), serverSalt, clientKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeRelief(idRelief, cp, serverSalt, tag)
+}
+
+// CompareFinalized verifies a clientKey sent by the client against a value
+// stored by Finalize().
+func (p *Profile) CompareFinalized(hashed, clientKey []byte) error {
+	if p.compareDuration > 0 {
+		defer pad(time.Now(), p.compareDuration)
+	}
+
+	cp, serverSalt, tag, err := parseRelief(idRelief, hashed)
+	if err != nil {
+		return ErrMismatch
+	}
+
+	if uint32(len(clientKey)) != cp.Keylen {
+		return ErrMismatch
+	}
+
+	if serverSalt == nil {
+		input, err := reliefBcryptInput(p.key(), cp, clientKey)
+		if err != nil {
+			return ErrMismatch
+		}
+		bp, err := newBcryptParamsFromHash(tag)
+		if err != nil {
+			return ErrMismatch
+		}
+		return bp.compare(tag, input)
+	}
+
+	compared, err := reliefTag(p.key(), serverSalt, clientKey)
+	if err != nil {
+		return ErrMismatch
+	}
+
+	if subtle.ConstantTimeCompare(compared, tag) == 1 {
+		return nil
+	}
+
+	return ErrMismatch
+}
+
+// ClientCapabilities describes what a client is able to run for the
+// relief mode derivation.
+type ClientCapabilities struct {
+	MaxMemory  uint32 // KiB, 0 is unlimited
+	MaxThreads uint8  // argon2 lanes, 0 is unlimited
+}
+
+// NegotiateClientParams is ClientParams() adapted to the client
+// capabilities: memory is traded for passes (argon2) or parallel lanes
+// (scrypt) so the cost of the derivation does not decrease.
+// ErrUnsupported is returned if the parameters cannot fit.
+func (p *Profile) NegotiateClientParams(caps ClientCapabilities, salt []byte) (*ClientParams, error) {
+	cp, err := p.ClientParams(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cp.Algorithm {
+	case idArgon2i, idArgon2id:
+		if caps.MaxThreads > 0 && cp.Thread > caps.MaxThreads {
+			cp.Thread = caps.MaxThreads
+		}
+		if caps.MaxMemory > 0 && cp.Memory > caps.MaxMemory {
+			// argon2 needs 8KiB per lane.
+			if caps.MaxMemory < 8*uint32(cp.Thread) {
+				return nil, ErrUnsupported
+			}
+			cost := uint64(cp.Time) * uint64(cp.Memory)
+			cp.Memory = caps.MaxMemory
+			cp.Time = uint32((cost + uint64(cp.Memory) - 1) / uint64(cp.Memory))
+		}
+	case idScrypt:
+		// 128 * R * N bytes, N halved and P doubled keep P * N * R
+		for caps.MaxMemory > 0 && uint64(cp.R)*uint64(cp.N)/8 > uint64(caps.MaxMemory) {
+			if cp.N <= 2 || cp.P > 1<<29 {
+				return nil, ErrUnsupported
+			}
+			cp.N /= 2
+			cp.P *= 2
+		}
+	}
+
+	return cp, nil
+}
@@ -0,0 +1,225 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+//
+// salvage mode.
+//
+// stored hashes get mangled on their way through exports, ORMs and
+// support tooling, TryRepair() undoes the common manglings and reports
+// them, for the engineers triaging "my password suddenly doesn't work"
+// tickets. it is a diagnostic, repaired values should be reviewed before
+// being written back.
+//
+
+// Problems reported by TryRepair().
+const (
+	ProblemWhitespace = "whitespace"     // leading/trailing spaces, newlines or NUL bytes
+	ProblemQuoted     = "quoted"         // wrapped in (escaped) quotes
+	ProblemURLEncoded = "url-encoded"    // percent encoded
+	ProblemBase64     = "base64-encoded" // the hash string was base64 encoded
+	ProblemHex        = "hex-encoded"    // the hash string was hex encoded
+	ProblemPadding    = "padding"        // base64 padding added to unpadded fields
+	ProblemTruncated  = "truncated"      // the last field is truncated, not repairable
+	ProblemUnknown    = "unknown"        // not a hash format of this package
+)
+
+// RepairReport describes what TryRepair() found.
+type RepairReport struct {
+	Repaired []byte   // the repaired value, nil if it cannot be repaired
+	Problems []string // found problems, in the order they were fixed
+}
+
+// TryRepair detects and fixes the common manglings of a stored hash, it
+// returns ErrCorrupted if the value cannot be repaired.
+// a well formed hash is returned as is, without problems.
+func TryRepair(hashed []byte) (*RepairReport, error) {
+	r := RepairReport{}
+
+	// encodings may be nested (i.e. quoted then padded with spaces), a
+	// bounded number of layers are unwrapped.
+	h := hashed
+	for i := 0; i < 8 && wellFormed(h) != nil; i++ {
+		fixed, problem := unwrap(h)
+		if problem == "" {
+			break
+		}
+		r.Problems = append(r.Problems, problem)
+		h = fixed
+	}
+
+	if fixed, ok := stripPadding(h); ok && wellFormed(fixed) == nil {
+		r.Problems = append(r.Problems, ProblemPadding)
+		h = fixed
+	}
+
+	err := wellFormed(h)
+	switch {
+	case err == nil:
+		r.Repaired = h
+		return &r, nil
+	case truncated(h):
+		r.Problems = append(r.Problems, ProblemTruncated)
+	default:
+		r.Problems = append(r.Problems, ProblemUnknown)
+	}
+	return &r, ErrCorrupted
+}
+
+// unwrap removes one layer of mangling.
+func unwrap(h []byte) ([]byte, string) {
+	if trimmed := bytes.Trim(h, " \t\r\n\x00"); len(trimmed) != len(h) {
+		return trimmed, ProblemWhitespace
+	}
+
+	if len(h) >= 2 {
+		first, last := h[0], h[len(h)-1]
+		switch {
+		case first == '"' && last == '"':
+			if s, err := strconv.Unquote(string(h)); err == nil {
+				return []byte(s), ProblemQuoted
+			}
+		case first == '\'' && last == '\'':
+			return h[1 : len(h)-1], ProblemQuoted
+		}
+	}
+
+	// '%' is not part of any hash alphabet.
+	if bytes.IndexByte(h, '%') >= 0 {
+		if s, err := url.PathUnescape(string(h)); err == nil {
+			return []byte(s), ProblemURLEncoded
+		}
+	}
+
+	if len(h) > 0 && h[0] != byte(separatorRune) {
+		for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+			if d, err := enc.DecodeString(string(h)); err == nil && len(d) > 0 && d[0] == byte(separatorRune) {
+				return d, ProblemBase64
+			}
+		}
+		if d, err := hex.DecodeString(string(h)); err == nil && len(d) > 0 && d[0] == byte(separatorRune) {
+			return d, ProblemHex
+		}
+	}
+
+	return h, ""
+}
+
+// stripPadding removes the trailing '=' of the base64 fields, metadata,
+// PHC parameters and integrity tag fields are left untouched.
+func stripPadding(h []byte) ([]byte, bool) {
+	fields := strings.Split(string(h), string(separatorRune))
+
+	stripped := false
+	for i, f := range fields {
+		t := strings.TrimRight(f, "=")
+		if len(t) != len(f) && !strings.ContainsRune(t, metaAssign) {
+			fields[i] = t
+			stripped = true
+		}
+	}
+	return []byte(strings.Join(fields, string(separatorRune))), stripped
+}
+
+// wellFormed checks the structure of hashed, no password involved.
+func wellFormed(hashed []byte) error {
+	if isPHC(hashed) {
+		_, err := decodePHC(hashed)
+		return err
+	}
+
+	core, err := coreHash(hashed)
+	if err != nil {
+		return err
+	}
+
+	fields := strings.FieldsFunc(string(core), token)
+	if len(fields) == 0 || core[0] != byte(separatorRune) {
+		return ErrParse
+	}
+
+	switch fields[0] {
+	case idBcrypt:
+		if len(core) != bcryptHashLen {
+			return ErrParse
+		}
+		_, err = parseFromHashToParams(core)
+		return err
+	case idArgon2i, idArgon2id, idArgon2d, idScrypt, idPbkdf2SHA256, idPbkdf2SHA512:
+		switch {
+		case len(fields) == 3:
+		case fields[0] == idPbkdf2SHA256 || fields[0] == idPbkdf2SHA512:
+			kp, err := newPbkdf2ParamsFromFields(fields[1:])
+			if err != nil {
+				return err
+			}
+			key, err := base64Decode([]byte(fields[4]))
+			if err != nil || uint32(len(key)) != kp.Keylen {
+				return ErrParse
+			}
+			return nil
+		default:
+			_, err = decodeNative(core)
+			return err
+		}
+		// masked
+		for _, f := range fields[1:] {
+			if _, err := base64Decode([]byte(f)); err != nil {
+				return ErrParse
+			}
+		}
+		return nil
+	}
+	return ErrUnsupported
+}
+
+// bcrypt hashes are 60 characters.
+const bcryptHashLen = 60
+
+// truncated returns true if the hash last field is shorter than its
+// parameters imply.
+func truncated(hashed []byte) bool {
+	core, err := coreHash(hashed)
+	if err != nil {
+		return false
+	}
+
+	fields := strings.FieldsFunc(string(core), token)
+	if len(fields) == 0 {
+		return false
+	}
+
+	switch fields[0] {
+	case idBcrypt:
+		return len(core) < bcryptHashLen
+	case idArgon2i, idArgon2id, idArgon2d, idScrypt:
+		if len(fields) != 7 {
+			return false
+		}
+		keylen, err := strconv.ParseUint(fields[5], 10, 32)
+		if err != nil || keylen > 1<<16 {
+			return false
+		}
+		return len(fields[6]) < len(base64Encode(make([]byte, keylen)))
+	case idPbkdf2SHA256, idPbkdf2SHA512:
+		if len(fields) != 5 {
+			return false
+		}
+		keylen, err := strconv.ParseUint(fields[3], 10, 32)
+		if err != nil || keylen > 1<<16 {
+			return false
+		}
+		return len(fields[4]) < len(base64Encode(make([]byte, keylen)))
+	}
+	return false
+}
@@ -0,0 +1,257 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"strings"
+	"time"
+)
+
+// Result describes a hash verified by CompareEx().
+type Result struct {
+	Algorithm   string        // hash identifier (i.e. "2id", "2s", "2a")
+	Params      interface{}   // effective *Argon2Params, *ScryptParams or *BcryptParams
+	Masked      bool          // parameters are not stored in the hash
+	Keyed       bool          // the hash depends on the profile secret
+	Elapsed     time.Duration // time spent verifying
+	NeedsRehash bool          // the parameters differ from the profile ones
+}
+
+// CompareEx compares hashed against password like Compare() and describes
+// the verified hash.
+// unlike Compare(), a non-masked hash produced with other parameters of the
+// profile algorithm is verified using its own parameters and reported with
+// NeedsRehash set.
+// on error only Elapsed is set.
+func (p *Profile) CompareEx(hashed, password []byte) (Result, error) {
+	defer p.wipePassword(password)
+	start := time.Now()
+
+	r, v := p.inspect(hashed)
+	err := v.Compare(hashed, password)
+	if err != nil {
+		return Result{Elapsed: time.Since(start)}, err
+	}
+
+	r.Elapsed = time.Since(start)
+	return r, nil
+}
+
+// NeedsRehash parses hashed, no password involved, and returns true if it
+// should be replaced by a hash of the profile: another algorithm, other
+// parameters (see CompareEx()), another encoding (see SetEncoding()), a
+// degraded hash, a lower risk tier or a previous master generation.
+// a hash that cannot be parsed needs a rehash.
+func (p *Profile) NeedsRehash(hashed []byte) bool {
+	r, _ := p.inspect(hashed)
+	if plain, err := p.DecryptHash(hashed); err == nil {
+		hashed = plain
+	}
+	return r.NeedsRehash || r.Params == nil || r.Algorithm != paramsAlgorithm(p.params) ||
+		isPHC(hashed) != (p.encoding == FormatPHC)
+}
+
+// NeedsRehash parses the non-masked (native or PHC) hash hashed and returns
+// true if it uses another algorithm than min (*Argon2Params, *ScryptParams
+// or *BcryptParams) or a lower work factor (see StrongerParams()).
+// a hash that cannot be parsed needs a rehash.
+func NeedsRehash(hashed []byte, min interface{}) bool {
+	params, err := hashParams(hashed)
+	if err != nil || paramsAlgorithm(params) != paramsAlgorithm(min) {
+		return true
+	}
+	cmp, err := StrongerParams(params, min)
+	return err != nil || cmp < 0
+}
+
+// inspect describes hashed and returns the profile able to verify it.
+func (p *Profile) inspect(hashed []byte) (Result, *Profile) {
+	var r Result
+
+	encrypted := isEncrypted(hashed)
+	if encrypted {
+		plain, err := p.DecryptHash(hashed)
+		if err != nil {
+			return r, p
+		}
+		hashed = plain
+	}
+
+	if isPHC(hashed) {
+		native, err := Reencode(hashed, FormatNative)
+		if err != nil {
+			return r, p
+		}
+		hashed = native
+	}
+
+	core, err := coreHash(hashed)
+	if err != nil {
+		return r, p
+	}
+	_, md, _ := splitMetadata(hashed)
+
+	fields := strings.FieldsFunc(string(core), token)
+	if len(fields) == 0 {
+		return r, p
+	}
+	r.Algorithm = fields[0]
+	r.Keyed = len(p.key()) > 0
+
+	if Degraded(hashed) {
+		r.NeedsRehash = true
+		r.Masked = maskedFields(fields)
+		r.Params = publicParams(p.fallback)
+		return r, p
+	}
+
+	// the parameters of the tier the hash was produced at.
+	tier := RiskTier(hashed)
+	t, err := p.atTier(tier)
+	if err != nil {
+		return r, p
+	}
+	r.NeedsRehash = tier < p.riskTier ||
+		len(p.user) > 0 && MasterGeneration(hashed) != p.masterGen ||
+		len(p.keyring) > 0 && SecretID(hashed) != p.secretID ||
+		p.maskedRegistry != nil && MaskedTag(hashed) != p.maskedTag ||
+		p.aead != nil && !encrypted ||
+		p.stale(md)
+
+	if maskedFields(fields) {
+		r.Masked = true
+		r.Params = publicParams(t.params)
+		if q, err := p.forMaskedTag(hashed); err == nil && tier == 0 {
+			r.Params = publicParams(q.params)
+		}
+		return r, p
+	}
+
+	parsed, err := parseFromHashToParams(core)
+	if err != nil {
+		return r, p
+	}
+	r.Params = publicParams(parsed)
+
+	if sameParams(parsed, t.params) {
+		return r, p
+	}
+	r.NeedsRehash = true
+
+	v := p.clone()
+	v.params = p.inheritParams(parsed)
+	if tier > 0 {
+		// verify with the stored parameters, not the tier ones.
+		v.riskTiers = map[int]interface{}{tier: v.params}
+	}
+	return r, v
+}
+
+// coreHash strips the (unverified) integrity tag and the metadata from
+// hashed.
+func coreHash(hashed []byte) ([]byte, error) {
+	if hasIntegrityTag(hashed) {
+		hashed = hashed[:bytes.LastIndexByte(hashed, byte(separatorRune))]
+	}
+	core, _, err := splitMetadata(hashed)
+	return core, err
+}
+
+// inheritParams returns parsed carrying the profile secret and digest
+// transforms, if the algorithms differ or the profile is masked the profile
+// parameters are returned.
+func (p *Profile) inheritParams(parsed interface{}) interface{} {
+	switch v := p.params.(type) {
+	case *ScryptParams:
+		if v.Masked {
+			return p.params
+		}
+	case *Argon2Params:
+		if v.Masked {
+			return p.params
+		}
+	case *Pbkdf2Params:
+		if v.Masked {
+			return p.params
+		}
+	}
+	return p.carryParams(parsed)
+}
+
+// carryParams returns params carrying the profile secret and digest
+// transforms, if the algorithms differ the profile parameters are returned.
+func (p *Profile) carryParams(params interface{}) interface{} {
+	switch v := params.(type) {
+	case *BcryptParams:
+		if pv, ok := p.params.(*BcryptParams); ok {
+			v.secret = pv.secret
+			return v
+		}
+	case *ScryptParams:
+		if pv, ok := p.params.(*ScryptParams); ok {
+			v.secret, v.pepper, v.post, v.progress, v.ctx = pv.secret, pv.pepper, pv.post, pv.progress, pv.ctx
+			return v
+		}
+	case *Argon2Params:
+		if pv, ok := p.params.(*Argon2Params); ok {
+			v.secret, v.pepper, v.post, v.progress, v.ctx = pv.secret, pv.pepper, pv.post, pv.progress, pv.ctx
+			v.pool = pv.pool
+			return v
+		}
+	case *Pbkdf2Params:
+		if pv, ok := p.params.(*Pbkdf2Params); ok {
+			v.secret, v.pepper, v.post = pv.secret, pv.pepper, pv.post
+			return v
+		}
+	case *hasherParams:
+		if _, ok := p.params.(*hasherParams); ok {
+			return v
+		}
+	}
+	return p.params
+}
+
+// publicParams returns a copy of the exported parameters.
+func publicParams(params interface{}) interface{} {
+	switch v := params.(type) {
+	case *BcryptParams:
+		return &BcryptParams{Cost: v.Cost, Masked: v.Masked}
+	case *ScryptParams:
+		return &ScryptParams{N: v.N, R: v.R, P: v.P, Saltlen: v.Saltlen, Keylen: v.Keylen, Masked: v.Masked}
+	case *Argon2Params:
+		return &Argon2Params{Version: v.Version, Time: v.Time, Memory: v.Memory, Thread: v.Thread, Saltlen: v.Saltlen, Keylen: v.Keylen, Masked: v.Masked}
+	case *Pbkdf2Params:
+		return &Pbkdf2Params{PRF: v.PRF, Iterations: v.Iterations, Saltlen: v.Saltlen, Keylen: v.Keylen, Masked: v.Masked}
+	case *hasherParams:
+		return v.h
+	}
+	return nil
+}
+
+// sameParams returns true if a and b define the same work factors.
+func sameParams(a, b interface{}) bool {
+	switch x := a.(type) {
+	case *BcryptParams:
+		y, ok := b.(*BcryptParams)
+		return ok && x.Cost == y.Cost
+	case *ScryptParams:
+		y, ok := b.(*ScryptParams)
+		return ok && x.N == y.N && x.R == y.R && x.P == y.P &&
+			x.Saltlen == y.Saltlen && x.Keylen == y.Keylen
+	case *Argon2Params:
+		y, ok := b.(*Argon2Params)
+		return ok && x.Version == y.Version && x.Time == y.Time &&
+			x.Memory == y.Memory && x.Thread == y.Thread &&
+			x.Saltlen == y.Saltlen && x.Keylen == y.Keylen
+	case *Pbkdf2Params:
+		y, ok := b.(*Pbkdf2Params)
+		return ok && x.PRF == y.PRF && x.Iterations == y.Iterations &&
+			x.Saltlen == y.Saltlen && x.Keylen == y.Keylen
+	case *hasherParams:
+		y, ok := b.(*hasherParams)
+		return ok && x.sameParams(y)
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"crypto/hmac"
+
+	"github.com/ermites-io/passwd/internal/argon2"
+)
+
+//
+// password reuse blind index.
+//
+// besides its hash, a password gets a deterministic index stored with the
+// account, equal indexes within a tenant reveal accounts sharing a
+// password (shared credentials, mass created accounts..):
+//
+// salt  = hmac_sha3-256(label || 0x00 || tenant, key)
+// index = b64(hmac_sha3-256(argon2id(password, salt, params), key)[:bits/8])
+//
+// the trade-offs:
+// - the index is key'ed: a database only breach learns nothing but
+//   equalities, the key must be kept like a pepper.
+// - the salt is per tenant, not per account: with the key, one guess costs
+//   one (heavy, see params) derivation per tenant instead of per account.
+// - bits truncates the index: fewer bits means false positives (to be
+//   confirmed by comparing the hashes) and less information for an
+//   attacker holding the key.
+//
+
+const (
+	labelReuse = "passwd/reuse/v1"
+
+	// ReuseIndexMinBits and ReuseIndexMaxBits bound the index truncation.
+	ReuseIndexMinBits = 16
+	ReuseIndexMaxBits = 256
+)
+
+// ReuseIndex computes the password reuse blind indexes.
+type ReuseIndex struct {
+	key    []byte
+	params Argon2Params
+	bits   int
+}
+
+// NewReuseIndex returns a ReuseIndex key'ed with key (validated like
+// SetSecret()), stretching passwords with the argon2id params (the
+// Argon2idDefault ones if nil) and truncating indexes to bits, a multiple of
+// 8 in [ReuseIndexMinBits, ReuseIndexMaxBits].
+func NewReuseIndex(key []byte, params *Argon2Params, bits int) (*ReuseIndex, error) {
+	err := validateSecret(key)
+	if err != nil {
+		return nil, err
+	}
+	if bits < ReuseIndexMinBits || bits > ReuseIndexMaxBits || bits%8 != 0 {
+		return nil, ErrUnsupported
+	}
+
+	r := ReuseIndex{
+		key:    key,
+		params: argonCommonParameters,
+		bits:   bits,
+	}
+	if params != nil {
+		if params.Time < 1 || params.Thread < 1 || params.Keylen < 16 {
+			return nil, ErrUnsupported
+		}
+		r.params = *params
+	}
+	return &r, nil
+}
+
+// Index returns the blind index of password within tenant.
+func (r *ReuseIndex) Index(tenant, password []byte) (string, error) {
+	s := hmac.New(newSHA3256, r.key)
+	s.Write([]byte(labelReuse))
+	s.Write([]byte{0x00})
+	s.Write(tenant)
+
+	p := r.params
+	stretched := argon2Key(argon2.ModeID, password, s.Sum(nil), nil, nil, p.Time, p.Memory, p.Thread, p.Keylen)
+
+	h := hmac.New(newSHA3256, r.key)
+	h.Write(stretched)
+	return string(base64Encode(h.Sum(nil)[:r.bits/8])), nil
+}
+
+// HashWithReuseIndex returns the hash of password and its blind index
+// within tenant.
+func (p *Profile) HashWithReuseIndex(r *ReuseIndex, tenant, password []byte) ([]byte, string, error) {
+	defer p.wipePassword(password)
+
+	hashed, err := p.keep().Hash(password)
+	if err != nil {
+		return nil, "", err
+	}
+
+	index, err := r.Index(tenant, password)
+	if err != nil {
+		return nil, "", err
+	}
+	return hashed, index, nil
+}
@@ -0,0 +1,153 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"strconv"
+)
+
+//
+// risk tiers.
+//
+// the caller evaluates the risk of the operation (new device, admin role..)
+// and passes a tier with the hash call, the profile maps tiers to
+// parameter sets configured once, the chosen tier is recorded:
+//
+// $ID$rk=TIER$b64(SALT)$...
+//
+// Compare() verifies with the recorded tier parameters (masked hashes
+// included), CompareEx() reports NeedsRehash for a hash recorded at a lower
+// tier than the verify call one, so accounts are hardened consistently.
+//
+
+const metaRisk = "rk" // risk tier the hash was produced at
+
+// SetRiskTier maps tier (> 0) to params, tier 0 uses the profile
+// parameters, nil params removes the tier.
+// params must use the profile algorithm, the profile secret and digest
+// transforms apply, and tiers must stay configured to verify the hashes
+// produced with them.
+func (p *Profile) SetRiskTier(tier int, params interface{}) error {
+	if tier <= 0 {
+		return ErrUnsupported
+	}
+
+	var tp interface{}
+	switch v := params.(type) {
+	case nil:
+	case *ScryptParams:
+		if _, ok := p.params.(*ScryptParams); ok {
+			c := *v
+			tp = &c
+		}
+	case *Argon2Params:
+		if _, ok := p.params.(*Argon2Params); ok {
+			c := *v
+			tp = &c
+		}
+	case *BcryptParams:
+		if _, ok := p.params.(*BcryptParams); ok {
+			c := *v
+			tp = &c
+		}
+	case *Pbkdf2Params:
+		if _, ok := p.params.(*Pbkdf2Params); ok {
+			c := *v
+			tp = &c
+		}
+	}
+	if tp == nil && params != nil {
+		return ErrUnsupported
+	}
+
+	// copy on write, clones keep their table.
+	tiers := make(map[int]interface{}, len(p.riskTiers)+1)
+	for t, v := range p.riskTiers {
+		tiers[t] = v
+	}
+	if tp == nil {
+		delete(tiers, tier)
+	} else {
+		tiers[tier] = tp
+	}
+	p.riskTiers = tiers
+	return nil
+}
+
+// WithRiskTier returns a copy of the profile hashing at tier, the highest
+// configured tier not above it is used.
+func (p *Profile) WithRiskTier(tier int) *Profile {
+	c := p.clone()
+	c.riskTier = p.effectiveTier(tier)
+	return c
+}
+
+// effectiveTier returns the highest configured tier up to tier.
+func (p *Profile) effectiveTier(tier int) int {
+	effective := 0
+	for t := range p.riskTiers {
+		if t <= tier && t > effective {
+			effective = t
+		}
+	}
+	return effective
+}
+
+// atTier returns a copy of the profile using the tier parameters.
+func (p *Profile) atTier(tier int) (*Profile, error) {
+	if tier == 0 {
+		return p, nil
+	}
+
+	tp, ok := p.riskTiers[tier]
+	if !ok {
+		return nil, ErrMismatch
+	}
+
+	var params interface{}
+	switch v := tp.(type) {
+	case *ScryptParams:
+		c := *v
+		params = &c
+	case *Argon2Params:
+		c := *v
+		params = &c
+	case *BcryptParams:
+		c := *v
+		params = &c
+	case *Pbkdf2Params:
+		c := *v
+		params = &c
+	}
+
+	r := p.clone()
+	r.params = p.carryParams(params)
+	return r, nil
+}
+
+// storedTier returns the tier a hash was recorded at.
+func storedTier(md metadata) (int, error) {
+	v, ok := md[metaRisk]
+	if !ok {
+		return 0, nil
+	}
+	tier, err := strconv.Atoi(v)
+	if err != nil || tier <= 0 {
+		return 0, ErrParse
+	}
+	return tier, nil
+}
+
+// RiskTier returns the tier hashed was produced at, 0 if none.
+func RiskTier(hashed []byte) int {
+	_, md, err := splitMetadata(hashed)
+	if err != nil {
+		return 0
+	}
+	tier, err := storedTier(md)
+	if err != nil {
+		return 0
+	}
+	return tier
+}
@@ -0,0 +1,53 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"encoding/binary"
+)
+
+const (
+	labelCohort = "passwd/cohort/v1"
+)
+
+// Cohort deterministically assigns subject (i.e. a user ID) to a cohort in
+// [0, 100) for the rollout identified by label:
+//
+// cohort = uint64(SHA3-256("passwd/cohort/v1" || 0x00 || label || 0x00 || subject)[:8]) % 100
+//
+// a different label reshuffles the cohorts.
+func Cohort(label string, subject []byte) int {
+	h := newSHA3256()
+	h.Write([]byte(labelCohort))
+	h.Write([]byte{0x00})
+	h.Write([]byte(label))
+	h.Write([]byte{0x00})
+	h.Write(subject)
+	sum := h.Sum(nil)
+
+	return int(binary.BigEndian.Uint64(sum[:8]) % 100)
+}
+
+// Rollout progressively moves subjects from the Current profile to the Next
+// one, Percent can be raised over time (1, 10, 100..) while monitoring
+// latency, subjects already moved to Next stay there.
+type Rollout struct {
+	Label   string   // identifies the rollout
+	Current *Profile // profile in use
+	Next    *Profile // profile being rolled out
+	Percent int      // share of subjects using Next [0, 100]
+}
+
+// Selected returns true if subject belongs to the rolled out cohorts.
+func (r *Rollout) Selected(subject []byte) bool {
+	return Cohort(r.Label, subject) < r.Percent
+}
+
+// Profile returns the profile subject must hash with.
+func (r *Rollout) Profile(subject []byte) *Profile {
+	if r.Next != nil && r.Selected(subject) {
+		return r.Next
+	}
+	return r.Current
+}
@@ -0,0 +1,231 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"crypto"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"hash"
+)
+
+//
+// OpenPGP string-to-key (RFC 4880 section 3.7).
+//
+// the S2K specifiers protect the GnuPG secret keys and symmetrically
+// encrypted messages, DeriveS2K() computes the session/unlock key of a
+// specifier parsed with ParseS2K() and S2KParams.Marshal() serializes the
+// ones produced with NewS2K().
+//
+
+// S2K specifier types.
+const (
+	S2KSimple         = 0
+	S2KSalted         = 1
+	S2KIteratedSalted = 3
+)
+
+const (
+	s2kSaltLen = 8
+
+	// S2KDefaultCount is the iterated count used by NewS2K(), GnuPG's
+	// default (octet 0xff).
+	S2KDefaultCount = 65011712
+)
+
+// OpenPGP hash algorithm identifiers (RFC 4880 section 9.4).
+var s2kHashes = []struct {
+	id   byte
+	hash crypto.Hash
+	new  func() hash.Hash
+}{
+	{2, crypto.SHA1, sha1.New},
+	{8, crypto.SHA256, sha256.New},
+	{9, crypto.SHA384, sha512.New384},
+	{10, crypto.SHA512, sha512.New},
+	{11, crypto.SHA224, sha256.New224},
+}
+
+// S2KParams is an OpenPGP string-to-key specifier.
+type S2KParams struct {
+	Type  int         // S2KSimple, S2KSalted or S2KIteratedSalted
+	Hash  crypto.Hash // SHA1, SHA224, SHA256, SHA384 or SHA512
+	Salt  []byte      // 8 bytes, salted types only
+	Count int         // octets hashed, iterated type only
+}
+
+// NewS2K returns an iterated and salted SHA256 specifier with a random
+// salt and the default count.
+func NewS2K() (*S2KParams, error) {
+	salt, err := getSalt(s2kSaltLen)
+	if err != nil {
+		return nil, err
+	}
+	return &S2KParams{Type: S2KIteratedSalted, Hash: crypto.SHA256, Salt: salt, Count: S2KDefaultCount}, nil
+}
+
+// DecodeS2KCount returns the octets count of the coded count c.
+func DecodeS2KCount(c byte) int {
+	return (16 + int(c&15)) << (uint(c>>4) + 6)
+}
+
+// EncodeS2KCount returns the coded count of the smallest octets count
+// greater or equal to count, saturating at S2KDefaultCount.
+func EncodeS2KCount(count int) byte {
+	for c := 0; c < 255; c++ {
+		if DecodeS2KCount(byte(c)) >= count {
+			return byte(c)
+		}
+	}
+	return 255
+}
+
+func s2kHashByID(id byte) (crypto.Hash, func() hash.Hash, bool) {
+	for _, h := range s2kHashes {
+		if h.id == id {
+			return h.hash, h.new, true
+		}
+	}
+	return 0, nil, false
+}
+
+func s2kHash(hh crypto.Hash) (byte, func() hash.Hash, bool) {
+	for _, h := range s2kHashes {
+		if h.hash == hh {
+			return h.id, h.new, true
+		}
+	}
+	return 0, nil, false
+}
+
+// ParseS2K parses the specifier at the start of spec and returns it with
+// the number of bytes consumed.
+func ParseS2K(spec []byte) (*S2KParams, int, error) {
+	if len(spec) < 2 {
+		return nil, 0, ErrParse
+	}
+
+	hh, _, ok := s2kHashByID(spec[1])
+	if !ok {
+		return nil, 0, ErrUnsupported
+	}
+	s := S2KParams{Type: int(spec[0]), Hash: hh}
+
+	switch s.Type {
+	case S2KSimple:
+		return &s, 2, nil
+	case S2KSalted:
+		if len(spec) < 2+s2kSaltLen {
+			return nil, 0, ErrParse
+		}
+		s.Salt = append([]byte{}, spec[2:2+s2kSaltLen]...)
+		return &s, 2 + s2kSaltLen, nil
+	case S2KIteratedSalted:
+		if len(spec) < 3+s2kSaltLen {
+			return nil, 0, ErrParse
+		}
+		s.Salt = append([]byte{}, spec[2:2+s2kSaltLen]...)
+		s.Count = DecodeS2KCount(spec[2+s2kSaltLen])
+		return &s, 3 + s2kSaltLen, nil
+	}
+	return nil, 0, ErrUnsupported
+}
+
+func (s *S2KParams) validate() (byte, func() hash.Hash, error) {
+	id, h, ok := s2kHash(s.Hash)
+	if !ok {
+		return 0, nil, ErrUnsupported
+	}
+
+	switch s.Type {
+	case S2KSimple:
+	case S2KSalted, S2KIteratedSalted:
+		if len(s.Salt) != s2kSaltLen {
+			return 0, nil, ErrParse
+		}
+	default:
+		return 0, nil, ErrUnsupported
+	}
+	return id, h, nil
+}
+
+// Marshal returns the serialized specifier, the iterated count is rounded
+// up to an encodable one.
+func (s *S2KParams) Marshal() ([]byte, error) {
+	id, _, err := s.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	spec := []byte{byte(s.Type), id}
+	switch s.Type {
+	case S2KSalted:
+		spec = append(spec, s.Salt...)
+	case S2KIteratedSalted:
+		spec = append(spec, s.Salt...)
+		spec = append(spec, EncodeS2KCount(s.Count))
+	}
+	return spec, nil
+}
+
+// DeriveS2K derives a keyLen bytes key from password with the specifier s.
+func DeriveS2K(password []byte, s *S2KParams, keyLen int) ([]byte, error) {
+	_, newHash, err := s.validate()
+	if err != nil {
+		return nil, err
+	}
+	if keyLen <= 0 {
+		return nil, ErrUnsupported
+	}
+
+	var data []byte
+	switch s.Type {
+	case S2KSimple:
+		data = password
+	default:
+		data = make([]byte, 0, len(s.Salt)+len(password))
+		data = append(data, s.Salt...)
+		data = append(data, password...)
+		defer wipe(data)
+	}
+
+	count := len(data)
+	if s.Type == S2KIteratedSalted && s.Count > count {
+		count = s.Count
+	}
+
+	// the key is the concatenation of hash contexts, the n-th one preloaded
+	// with n zero octets.
+	key := make([]byte, 0, keyLen)
+	for n := 0; len(key) < keyLen; n++ {
+		h := newHash()
+		h.Write(make([]byte, n))
+		for left := count; left > 0; left -= len(data) {
+			if left < len(data) {
+				h.Write(data[:left])
+				break
+			}
+			h.Write(data)
+		}
+		key = h.Sum(key)
+	}
+	return key[:keyLen], nil
+}
+
+// CompareS2K compares key against the key derived from password with the
+// specifier s, in constant time, it returns ErrMismatch if they differ.
+func CompareS2K(key, password []byte, s *S2KParams) error {
+	derived, err := DeriveS2K(password, s, len(key))
+	if err != nil {
+		return err
+	}
+	defer wipe(derived)
+
+	if subtle.ConstantTimeCompare(key, derived) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
@@ -5,11 +5,10 @@ package passwd
 
 import (
 	"bytes"
+	"context"
 	"crypto/subtle"
 	"fmt"
 	"strconv"
-
-	"golang.org/x/crypto/scrypt"
 )
 
 const (
@@ -90,8 +89,12 @@ type ScryptParams struct {
 	Saltlen uint32 // 128 bits min.
 	Keylen  uint32 // 128 bits min.
 	Masked  bool   // are parameters private
-	salt    []byte // my salt..
 	secret  []byte // secret for key'ed hashes..
+
+	pepper   PepperStrategy               // how the secret is applied
+	post     func([]byte) ([]byte, error) // digest post processing
+	progress func(done, total int)        // progress hook
+	ctx      context.Context              // cancellation of the derivation
 }
 
 // TODO must return salt
@@ -103,40 +106,46 @@ func newScryptParamsFromFields(fields []string) (*ScryptParams, error) {
 	// salt
 	salt, err := base64Decode([]byte(fields[0])) // process the salt
 	if err != nil {
-		return nil, ErrParse
+		return nil, parseError(ErrParse, err)
 	}
 	saltlen := uint32(len(salt))
 
-	nint, err := strconv.ParseInt(fields[1], 10, 32)
+	n, err := strconv.ParseUint(fields[1], 10, 32)
 	if err != nil {
-		return nil, ErrParse
+		return nil, parseError(ErrParse, err)
 	}
-	n := uint32(nint)
 
-	rint, err := strconv.ParseInt(fields[2], 10, 32)
+	r, err := strconv.ParseUint(fields[2], 10, 32)
 	if err != nil {
-		return nil, ErrParse
+		return nil, parseError(ErrParse, err)
 	}
-	r := uint32(rint)
 
-	pint, err := strconv.ParseInt(fields[3], 10, 32)
+	p, err := strconv.ParseUint(fields[3], 10, 32)
 	if err != nil {
-		return nil, ErrParse
+		return nil, parseError(ErrParse, err)
 	}
-	p := uint32(pint)
 
-	keylenint, err := strconv.ParseInt(fields[4], 10, 32)
+	keylen, err := strconv.ParseUint(fields[4], 10, 32)
 	if err != nil {
+		return nil, parseError(ErrParse, err)
+	}
+
+	// bounds, before anything is allocated.
+	switch {
+	case n <= 1, n&(n-1) != 0, r == 0, p == 0, saltlen == 0:
+		return nil, ErrParse
+	case r*p >= 1<<30, n > maxParseScryptMemory/(128*r):
+		return nil, ErrParse
+	case keylen == 0, keylen > maxParseKeylen:
 		return nil, ErrParse
 	}
-	keylen := uint32(keylenint)
 
 	sp := ScryptParams{
-		N:       n,
-		R:       r,
-		P:       p,
+		N:       uint32(n),
+		R:       uint32(r),
+		P:       uint32(p),
 		Saltlen: saltlen,
-		Keylen:  keylen,
+		Keylen:  uint32(keylen),
 		//salt:    salt,
 	}
 
@@ -151,8 +160,8 @@ func (p *ScryptParams) validate(min *ScryptParams) error {
 	return nil
 }
 
-func (p *ScryptParams) deriveFromPassword(password []byte) ([]byte, error) {
-	key, err := scrypt.Key(password, p.salt, int(p.N), int(p.R), int(p.P), int(p.Keylen))
+func (p *ScryptParams) deriveFromPassword(password, salt []byte) ([]byte, error) {
+	key, err := p.key(password, salt)
 	if err != nil {
 		return nil, err
 	}
@@ -169,23 +178,43 @@ func (p *ScryptParams) generateFromParams(salt, password []byte) (out []byte, er
 	// the profile dictactes
 	psalt := make([]byte, p.Saltlen)
 	copy(psalt, salt)
+	defer wipe(psalt)
 
 	// password
 	data = password
 
 	// we want to hmac a secret to have the resulting hash
-	if len(p.secret) > 0 {
+	if len(p.secret) > 0 && p.pepper == PepperPreHash {
 		data, err = hmacKeyHash(p.secret, psalt, password)
 		if err != nil {
 			return nil, err
 		}
+		defer wipe(data)
 	}
 
-	key, err := scrypt.Key(data, psalt, int(p.N), int(p.R), int(p.P), int(p.Keylen))
+	key, err := p.key(data, psalt)
 	if err != nil {
 		return nil, err
 	}
 
+	// or hmac the resulting digest
+	if len(p.secret) > 0 && p.pepper == PepperPostHash {
+		raw := key
+		key, err = hmacKeyHash(p.secret, psalt, raw)
+		wipe(raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// digest post processing (i.e. blinding)
+	if p.post != nil {
+		key, err = p.post(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// need to b64.
 	salt64 := base64Encode(psalt)
 
@@ -229,8 +258,7 @@ func (p *ScryptParams) generateFromPassword(password []byte) ([]byte, error) {
 func (p *ScryptParams) compare(hashed, password []byte) error {
 	salt, err := parseFromHashToSalt(hashed)
 	if err != nil {
-		fmt.Printf("compare parse error: %v\n", err)
-		return ErrMismatch
+		return err
 	}
 
 	// generate the string to compare
@@ -0,0 +1,18 @@
+//go:build go1.12
+// +build go1.12
+
+// Package scryptkdf exposes the scrypt core used by the passwd package
+// (RFC 7914), for building custom formats on the same implementation.
+//
+// the API is stable and matches golang.org/x/crypto/scrypt.
+package scryptkdf
+
+import (
+	"golang.org/x/crypto/scrypt"
+)
+
+// Key derives a key from password and salt, N must be a power of two
+// greater than 1, r*p < 2^30.
+func Key(password, salt []byte, N, r, p, keyLen int) ([]byte, error) {
+	return scrypt.Key(password, salt, N, r, p, keyLen)
+}
@@ -0,0 +1,19 @@
+package scryptkdf
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// RFC 7914 section 12 test vector.
+func TestKey(t *testing.T) {
+	key, err := Key([]byte("password"), []byte("NaCl"), 1024, 8, 16, 64)
+	want := "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"
+	if err != nil || hex.EncodeToString(key) != want {
+		t.Fatalf("key %x (%v) vs expected: %s\n", key, err, want)
+	}
+
+	if _, err := Key([]byte("password"), []byte("NaCl"), 1000, 8, 16, 64); err == nil {
+		t.Fatalf("invalid N accepted\n")
+	}
+}
@@ -0,0 +1,76 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"math"
+)
+
+const (
+	// SecretMinLength is the minimum length (in bytes) of a secret accepted
+	// by SetSecret().
+	SecretMinLength = 16
+
+	// minimum estimated entropy (in bits) of a secret accepted by
+	// SetSecret(), this is a simple heuristic, not a proof of quality.
+	secretMinEntropy = 48
+)
+
+// estimateEntropy returns the (empirical) Shannon entropy estimate of b in
+// bits.
+func estimateEntropy(b []byte) float64 {
+	var counts [256]int
+
+	for _, c := range b {
+		counts[c]++
+	}
+
+	var h float64
+	n := float64(len(b))
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		f := float64(c) / n
+		h -= f * math.Log2(f)
+	}
+	return h * n
+}
+
+// validateSecret verifies the minimal strength of a secret.
+func validateSecret(secret []byte) error {
+	if len(secret) < SecretMinLength {
+		return ErrSecretTooShort
+	}
+
+	zero := true
+	for _, c := range secret {
+		if c != 0x00 {
+			zero = false
+			break
+		}
+	}
+	if zero {
+		return ErrSecretWeak
+	}
+
+	if estimateEntropy(secret) < secretMinEntropy {
+		return ErrSecretWeak
+	}
+
+	return nil
+}
+
+// SetSecret setup a secret (pepper) associated with the profile after
+// validating its strength (minimum length, not all-zero, entropy heuristic),
+// misconfigured secrets are reported with ErrSecretTooShort or
+// ErrSecretWeak.
+// SetKey() is the unsafe override: it accepts any secret.
+func (p *Profile) SetSecret(secret []byte) error {
+	err := validateSecret(secret)
+	if err != nil {
+		return err
+	}
+	return p.SetKey(secret)
+}
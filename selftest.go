@@ -0,0 +1,120 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ermites-io/passwd/internal/argon2"
+	"github.com/ermites-io/passwd/internal/bcrypt"
+)
+
+//
+// the self-test runs known-answer tests for every compiled-in algorithm
+// through the KDF backend in use (go, libsodium, openssl..), as required
+// by several certification regimes.
+// a failure is sticky: the package refuses to hash, compare or derive
+// with ErrSelfTest until the process restarts.
+//
+
+var (
+	selfTestRequired int32 // RequireSelfTest() called
+	selfTestFailed   int32 // a self-test failed
+	selfTestOnce     sync.Once
+)
+
+// a known-answer test.
+type kat struct {
+	name     string
+	run      func() ([]byte, error)
+	expected string // hex encoded
+}
+
+func repeat(b byte, n int) []byte {
+	return bytes.Repeat([]byte{b}, n)
+}
+
+var kats = []kat{
+	// RFC 9106 5.2
+	{
+		name: "argon2i",
+		run: func() ([]byte, error) {
+			return argon2Key(argon2.ModeI, repeat(1, 32), repeat(2, 16), repeat(3, 8), repeat(4, 12), 3, 32, 4, 32), nil
+		},
+		expected: "c814d9d1dc7f37aa13f0d77f2494bda1c8de6b016dd388d29952a4c4672b6ce8",
+	},
+	// RFC 9106 5.3
+	{
+		name: "argon2id",
+		run: func() ([]byte, error) {
+			return argon2Key(argon2.ModeID, repeat(1, 32), repeat(2, 16), repeat(3, 8), repeat(4, 12), 3, 32, 4, 32), nil
+		},
+		expected: "0d640df58d78766c08c037a34a8b53c9d01ef0452d75b65eb52520e96b01e659",
+	},
+	// RFC 7914 12
+	{
+		name: "scrypt",
+		run: func() ([]byte, error) {
+			return scryptKey([]byte("password"), []byte("NaCl"), 1024, 8, 16, 64)
+		},
+		expected: "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640",
+	},
+	// crypt_blowfish test vector
+	{
+		name: "bcrypt",
+		run: func() ([]byte, error) {
+			salt, err := base64Decode([]byte("CCCCCCCCCCCCCCCCCCCCC."))
+			if err != nil {
+				return nil, err
+			}
+			return bcrypt.GenerateFromPasswordSalt([]byte("U*U"), salt, 5)
+		},
+		expected: hex.EncodeToString([]byte("$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW")),
+	},
+	// the pepper construction
+	{
+		name: "hmac-sha3",
+		run: func() ([]byte, error) {
+			return hmacKeyHash([]byte("secret"), []byte("salt"), []byte("password"))
+		},
+		expected: "162d2b7250b393da2e507b85c8fa5aca2e766eec733300209640ef18880f1aa0386f0c8b72d94d1e8c8e36bae2127b89",
+	},
+}
+
+// SelfTest runs the known-answer tests of every algorithm, it returns
+// ErrSelfTest if any of them fails, after which the package refuses to
+// operate.
+func SelfTest() error {
+	for _, t := range kats {
+		out, err := t.run()
+		if err != nil || hex.EncodeToString(out) != t.expected {
+			atomic.StoreInt32(&selfTestFailed, 1)
+			return ErrSelfTest
+		}
+	}
+	return nil
+}
+
+// RequireSelfTest enables the compliance mode: the self-test runs on the
+// first hash, compare or derive operation, which fail with ErrSelfTest
+// if it does not pass. it is implied when running with a FIPS validated
+// module.
+func RequireSelfTest() {
+	atomic.StoreInt32(&selfTestRequired, 1)
+}
+
+// selfTestGate runs the self-test once if required and reports a
+// previous failure.
+func selfTestGate() error {
+	if atomic.LoadInt32(&selfTestRequired) == 1 || FIPS() {
+		selfTestOnce.Do(func() { SelfTest() })
+	}
+	if atomic.LoadInt32(&selfTestFailed) == 1 {
+		return ErrSelfTest
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"crypto/subtle"
+)
+
+//
+// threshold split secrets.
+//
+// the secret (pepper) is split with Shamir's secret sharing over GF(2^8)
+// (AES polynomial x^8 + x^4 + x^3 + x + 1), every byte of the secret is
+// the constant term of its own random polynomial of degree k-1.
+// a share is:
+//
+// k (1 byte) || x (1 byte, 1..255) || y (len(secret) bytes)
+//
+// any k shares reconstruct the secret, fewer reveal nothing about it.
+// extra shares given to SetSecretShares() are checked against the
+// reconstructed polynomials.
+//
+
+var gfExp, gfLog [256]byte
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfLog[x] = byte(i)
+		// x *= 3
+		x ^= gfDouble(x)
+	}
+	gfExp[255] = gfExp[0]
+}
+
+func gfDouble(x byte) byte {
+	if x&0x80 != 0 {
+		return x<<1 ^ 0x1b
+	}
+	return x << 1
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])+int(gfLog[b]))%255]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])+255-int(gfLog[b]))%255]
+}
+
+// SplitSecret splits secret into n shares, any k of them reconstruct it
+// (2 <= k <= n <= 255).
+func SplitSecret(secret []byte, k, n int) ([][]byte, error) {
+	if len(secret) == 0 || k < 2 || n < k || n > 255 {
+		return nil, ErrUnsupported
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, 2+len(secret))
+		shares[i][0], shares[i][1] = byte(k), byte(i+1)
+	}
+
+	// the random coefficients of all the polynomials.
+	random := make([]byte, len(secret)*(k-1))
+	defer wipe(random)
+	err := readRandom(random)
+	if err != nil {
+		return nil, err
+	}
+
+	coeffs := make([]byte, k)
+	defer wipe(coeffs)
+	for j, s := range secret {
+		coeffs[0] = s
+		copy(coeffs[1:], random[j*(k-1):])
+
+		for _, share := range shares {
+			// horner evaluation at x.
+			x, y := share[1], byte(0)
+			for c := k - 1; c >= 0; c-- {
+				y = gfMul(y, x) ^ coeffs[c]
+			}
+			share[2+j] = y
+		}
+	}
+
+	return shares, nil
+}
+
+// combineShares reconstructs the secret from the shares.
+func combineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 || len(shares[0]) < 3 {
+		return nil, ErrShares
+	}
+	k, size := int(shares[0][0]), len(shares[0])-2
+	if k < 2 || len(shares) < k {
+		return nil, ErrShares
+	}
+
+	seen := make(map[byte]bool)
+	for _, share := range shares {
+		if len(share) != size+2 || int(share[0]) != k || share[1] == 0 || seen[share[1]] {
+			return nil, ErrShares
+		}
+		seen[share[1]] = true
+	}
+
+	secret := interpolate(shares[:k], 0)
+
+	// extra shares must lie on the same polynomials.
+	for _, share := range shares[k:] {
+		y := interpolate(shares[:k], share[1])
+		ok := subtle.ConstantTimeCompare(y, share[2:]) == 1
+		wipe(y)
+		if !ok {
+			wipe(secret)
+			return nil, ErrShares
+		}
+	}
+
+	return secret, nil
+}
+
+// interpolate evaluates at x the polynomials going through the shares.
+func interpolate(shares [][]byte, x byte) []byte {
+	out := make([]byte, len(shares[0])-2)
+
+	for i, si := range shares {
+		// lagrange basis l_i(x) = prod (x - x_j) / (x_i - x_j)
+		l := byte(1)
+		for j, sj := range shares {
+			if i != j {
+				l = gfMul(l, gfDiv(x^sj[1], si[1]^sj[1]))
+			}
+		}
+		for b := range out {
+			out[b] ^= gfMul(l, si[2+b])
+		}
+	}
+	return out
+}
+
+// SetSecretShares reconstructs the secret from k (or more) shares produced
+// by SplitSecret() and sets it like SetSecret(), the shares can then be
+// wiped by the caller.
+// ErrShares is returned if the shares are insufficient or inconsistent.
+func (p *Profile) SetSecretShares(shares ...[]byte) error {
+	secret, err := combineShares(shares)
+	if err != nil {
+		return err
+	}
+
+	err = p.SetSecret(secret)
+	if err != nil {
+		wipe(secret)
+		return err
+	}
+	return nil
+}
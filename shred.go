@@ -0,0 +1,152 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"crypto/hmac"
+	"sync"
+)
+
+//
+// crypto-shredding.
+//
+// every credential is key'ed with a random per user key kept in a
+// separate KeyStore, the password is folded with it before the
+// derivation:
+//
+// data = b64(hmac_sha3-256(label || 0x00 || password, userkey))
+//
+// and the produced hashes are flagged:
+//
+// $ID$uk=1$b64(SALT)$...
+//
+// deleting the user key renders the hash permanently unverifiable (the key
+// is 256 bits of randomness, there is nothing to bruteforce), which gives
+// erasure semantics without touching the credentials table or its
+// backups.
+//
+
+const (
+	labelUserKey = "passwd/userkey/v1"
+
+	metaUserKey = "uk" // key'ed with a per user key
+
+	// UserKeyLength is the length of the per user keys.
+	UserKeyLength = 32
+)
+
+func foldUserKey(key, password []byte) []byte {
+	h := hmac.New(newSHA3256, key)
+	h.Write([]byte(labelUserKey))
+	h.Write([]byte{0x00})
+	h.Write(password)
+	return base64Encode(h.Sum(nil))
+}
+
+// KeyStore stores the per user keys, apart from the credentials.
+// Get returns ErrNoUserKey for unknown (or deleted) subjects.
+type KeyStore interface {
+	Get(subject []byte) ([]byte, error)
+	Put(subject, key []byte) error
+	Delete(subject []byte) error
+}
+
+// MemoryKeyStore is an in memory KeyStore, for tests and as a cache.
+type MemoryKeyStore struct {
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+// NewMemoryKeyStore returns an empty MemoryKeyStore.
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: make(map[string][]byte)}
+}
+
+// Get returns the key of subject.
+func (m *MemoryKeyStore) Get(subject []byte) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.keys[string(subject)]
+	if !ok {
+		return nil, ErrNoUserKey
+	}
+	return key, nil
+}
+
+// Put stores the key of subject.
+func (m *MemoryKeyStore) Put(subject, key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.keys[string(subject)] = append([]byte{}, key...)
+	return nil
+}
+
+// Delete wipes and removes the key of subject.
+func (m *MemoryKeyStore) Delete(subject []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if key, ok := m.keys[string(subject)]; ok {
+		wipe(key)
+		delete(m.keys, string(subject))
+	}
+	return nil
+}
+
+// NewUserKey returns a random per user key.
+func NewUserKey() ([]byte, error) {
+	key := make([]byte, UserKeyLength)
+	err := readRandom(key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Shredder hashes and verifies credentials key'ed with per user keys.
+type Shredder struct {
+	Profile *Profile
+	Keys    KeyStore
+}
+
+// withUserKey returns a copy of the profile key'ed with key.
+func (p *Profile) withUserKey(key []byte) *Profile {
+	c := p.clone()
+	c.userKey = key
+	return c
+}
+
+// Hash hashes password for subject, a user key is created and stored if
+// subject has none.
+func (s *Shredder) Hash(subject, password []byte) ([]byte, error) {
+	key, err := s.Keys.Get(subject)
+	if err == ErrNoUserKey {
+		key, err = NewUserKey()
+		if err != nil {
+			return nil, err
+		}
+		err = s.Keys.Put(subject, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.Profile.withUserKey(key).Hash(password)
+}
+
+// Compare compares the hash of subject against password, it returns
+// ErrNoUserKey if the subject key was shredded.
+func (s *Shredder) Compare(subject, hashed, password []byte) error {
+	key, err := s.Keys.Get(subject)
+	if err != nil {
+		return err
+	}
+	return s.Profile.withUserKey(key).Compare(hashed, password)
+}
+
+// Shred deletes the subject key, its hashes can no longer be verified.
+func (s *Shredder) Shred(subject []byte) error {
+	return s.Keys.Delete(subject)
+}
@@ -0,0 +1,175 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+//
+// parameters specifications.
+//
+// a one line notation of custom parameters for CLI flags, Helm values and
+// environment variables:
+//
+// argon2id:m=65536,t=3,p=4,l=32,s=16
+// argon2i:m=65536,t=3,p=4
+// argon2d:m=65536,t=3,p=4
+// scrypt:ln=15,r=8,p=1,l=32,s=16
+// bcrypt:cost=12
+// pbkdf2-sha256:i=600000,l=32,s=16
+//
+// keys may appear in any order, missing keys are the default profile ones
+// (Argon2idDefault, ScryptDefault, BcryptDefault, Pbkdf2Default), m is in
+// KiB, i the iteration count, l is the key length and s the salt length.
+//
+
+const (
+	specArgon2id = "argon2id"
+	specArgon2i  = "argon2i"
+	specArgon2d  = "argon2d"
+	specScrypt   = "scrypt"
+	specBcrypt   = "bcrypt"
+
+	specPbkdf2SHA256 = "pbkdf2-sha256"
+	specPbkdf2SHA512 = "pbkdf2-sha512"
+)
+
+// ParseSpec parses a parameters specification and returns the validated
+// *Argon2Params, *ScryptParams, *BcryptParams or *Pbkdf2Params to use with
+// NewCustom().
+func ParseSpec(spec string) (interface{}, error) {
+	alg, list := spec, ""
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		alg, list = spec[:i], spec[i+1:]
+	}
+
+	values := make(map[string]uint32)
+	if len(list) > 0 {
+		for _, pair := range strings.Split(list, ",") {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				return nil, ErrParse
+			}
+			if _, dup := values[kv[0]]; dup {
+				return nil, ErrParse
+			}
+			v, err := strconv.ParseUint(kv[1], 10, 32)
+			if err != nil {
+				return nil, ErrParse
+			}
+			values[kv[0]] = uint32(v)
+		}
+	}
+
+	// take returns the value of key, def if it is missing.
+	take := func(key string, def uint32) uint32 {
+		v, ok := values[key]
+		if !ok {
+			return def
+		}
+		delete(values, key)
+		return v
+	}
+
+	var params interface{}
+	switch alg {
+	case specArgon2id, specArgon2i, specArgon2d:
+		p := argonCommonParameters
+		switch alg {
+		case specArgon2i:
+			p = argon2iCommonParameters
+		case specArgon2d:
+			p.Version = Argon2d
+		}
+		p.Memory = take("m", p.Memory)
+		p.Time = take("t", p.Time)
+		t := take("p", uint32(p.Thread))
+		p.Keylen = take("l", p.Keylen)
+		p.Saltlen = take("s", p.Saltlen)
+		if t == 0 || t > 255 || p.Time == 0 || p.Memory < 8*t || p.Keylen < 4 || p.Saltlen < 8 {
+			return nil, ErrUnsupported
+		}
+		p.Thread = uint8(t)
+		params = &p
+	case specScrypt:
+		p := scryptCommonParameters
+		ln, _ := ScryptLogN(p.N)
+		n, err := ScryptN(int(take("ln", uint32(ln))))
+		if err != nil {
+			return nil, err
+		}
+		p.N = n
+		p.R = take("r", p.R)
+		p.P = take("p", p.P)
+		p.Keylen = take("l", p.Keylen)
+		p.Saltlen = take("s", p.Saltlen)
+		if p.R == 0 || p.P == 0 || uint64(p.R)*uint64(p.P) >= 1<<30 || p.Keylen == 0 || p.Saltlen < 8 {
+			return nil, ErrUnsupported
+		}
+		params = &p
+	case specBcrypt:
+		p := bcryptCommonParameters
+		p.Cost = int(take("cost", uint32(p.Cost)))
+		if p.Cost < bcrypt.MinCost || p.Cost > bcrypt.MaxCost {
+			return nil, ErrUnsupported
+		}
+		params = &p
+	case specPbkdf2SHA256, specPbkdf2SHA512:
+		p := pbkdf2CommonParameters
+		if alg == specPbkdf2SHA512 {
+			p.PRF = Pbkdf2SHA512
+		}
+		p.Iterations = take("i", p.Iterations)
+		p.Keylen = take("l", p.Keylen)
+		p.Saltlen = take("s", p.Saltlen)
+		if p.validate(&pbkdf2MinParameters) != nil {
+			return nil, ErrUnsupported
+		}
+		params = &p
+	default:
+		return nil, ErrUnsupported
+	}
+
+	// unknown keys.
+	if len(values) > 0 {
+		return nil, ErrParse
+	}
+	return params, nil
+}
+
+// FormatSpec returns the parameters specification of params, with every
+// key.
+func FormatSpec(params interface{}) (string, error) {
+	switch v := params.(type) {
+	case *Argon2Params:
+		alg := specArgon2id
+		switch v.Version {
+		case Argon2i:
+			alg = specArgon2i
+		case Argon2d:
+			alg = specArgon2d
+		}
+		return fmt.Sprintf("%s:m=%d,t=%d,p=%d,l=%d,s=%d", alg, v.Memory, v.Time, v.Thread, v.Keylen, v.Saltlen), nil
+	case *ScryptParams:
+		ln, err := ScryptLogN(v.N)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s:ln=%d,r=%d,p=%d,l=%d,s=%d", specScrypt, ln, v.R, v.P, v.Keylen, v.Saltlen), nil
+	case *BcryptParams:
+		return fmt.Sprintf("%s:cost=%d", specBcrypt, v.Cost), nil
+	case *Pbkdf2Params:
+		alg := specPbkdf2SHA256
+		if v.PRF == Pbkdf2SHA512 {
+			alg = specPbkdf2SHA512
+		}
+		return fmt.Sprintf("%s:i=%d,l=%d,s=%d", alg, v.Iterations, v.Keylen, v.Saltlen), nil
+	}
+	return "", ErrUnsupported
+}
@@ -0,0 +1,187 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+//
+// Spring Security DelegatingPasswordEncoder interop.
+//
+// Java services share credential stores using the {id} prefixed encodings:
+//
+// {bcrypt}$2a$10$...
+// {argon2}$argon2id$v=19$m=16384,t=2,p=1$b64(SALT)$b64(HASH)  (PHC string format)
+// {scrypt}$hex(log2(N) << 16 | r << 8 | p)$b64(SALT)$b64(HASH) (padded base64)
+// {pbkdf2}hex(SALT || HASH)
+//
+// the pbkdf2 encoding does not carry its parameters, they are the
+// SpringPBKDF2 ones.
+//
+
+const (
+	springBcrypt = "{bcrypt}"
+	springArgon2 = "{argon2}"
+	springScrypt = "{scrypt}"
+	springPBKDF2 = "{pbkdf2}"
+)
+
+// SpringPBKDF2 are the Pbkdf2PasswordEncoder parameters.
+type SpringPBKDF2 struct {
+	Secret     []byte           // appended to the salt, empty by default
+	SaltLen    int              // bytes
+	Iterations int              //
+	KeyLen     int              // bytes
+	Hash       func() hash.Hash // HMAC PRF
+	Base64     bool             // base64 instead of hex encoded
+}
+
+var (
+	// SpringPBKDF2v58 are the Spring Security 5.8+ defaults
+	// (PBKDF2WithHmacSHA256, 310000 iterations).
+	SpringPBKDF2v58 = SpringPBKDF2{SaltLen: 16, Iterations: 310000, KeyLen: 32, Hash: sha256.New}
+	// SpringPBKDF2v5 are the Spring Security 5 legacy defaults
+	// (PBKDF2WithHmacSHA1, 185000 iterations).
+	SpringPBKDF2v5 = SpringPBKDF2{SaltLen: 8, Iterations: 185000, KeyLen: 32, Hash: sha1.New}
+)
+
+// Compare compares the {pbkdf2} encoding hashed (with or without its
+// prefix) against password.
+func (s *SpringPBKDF2) Compare(hashed, password []byte) error {
+	encoded := strings.TrimPrefix(string(hashed), springPBKDF2)
+
+	var raw []byte
+	var err error
+	if s.Base64 {
+		raw, err = base64.StdEncoding.DecodeString(encoded)
+	} else {
+		raw, err = hex.DecodeString(encoded)
+	}
+	if err != nil || len(raw) != s.SaltLen+s.KeyLen || s.Iterations < 1 {
+		return ErrMismatch
+	}
+
+	salt := append(append([]byte{}, raw[:s.SaltLen]...), s.Secret...)
+	key := pbkdf2.Key(password, salt, s.Iterations, s.KeyLen, s.Hash)
+	if subtle.ConstantTimeCompare(key, raw[s.SaltLen:]) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
+
+// decodeSpringScrypt decodes the {scrypt} encoding.
+func decodeSpringScrypt(encoded string) (*encodedHash, error) {
+	fields := strings.Split(encoded, string(separatorRune))
+	if len(fields) != 4 || fields[0] != "" {
+		return nil, ErrParse
+	}
+
+	params, err := strconv.ParseUint(fields[1], 16, 64)
+	if err != nil {
+		return nil, ErrParse
+	}
+	salt, err := base64.StdEncoding.DecodeString(fields[2])
+	if err != nil {
+		return nil, ErrParse
+	}
+	key, err := base64.StdEncoding.DecodeString(fields[3])
+	if err != nil {
+		return nil, ErrParse
+	}
+
+	n, err := ScryptN(int(params >> 16))
+	if err != nil {
+		return nil, ErrParse
+	}
+	return &encodedHash{
+		id:   idScrypt,
+		a:    n,
+		b:    uint32(params>>8) & 0xff,
+		c:    uint32(params) & 0xff,
+		salt: salt,
+		key:  key,
+	}, nil
+}
+
+// CompareSpring compares a DelegatingPasswordEncoder encoding against
+// password, {pbkdf2} hashes are tried with the SpringPBKDF2v58 and
+// SpringPBKDF2v5 defaults (distinguished by their salt length).
+func CompareSpring(hashed, password []byte) error {
+	s := string(hashed)
+
+	switch {
+	case strings.HasPrefix(s, springBcrypt):
+		return Compare(hashed[len(springBcrypt):], password)
+	case strings.HasPrefix(s, springArgon2):
+		return comparePHC(hashed[len(springArgon2):], password)
+	case strings.HasPrefix(s, springScrypt):
+		eh, err := decodeSpringScrypt(s[len(springScrypt):])
+		if err != nil {
+			return ErrMismatch
+		}
+		return Compare(eh.encodeNative(), password)
+	case strings.HasPrefix(s, springPBKDF2):
+		for _, d := range []*SpringPBKDF2{&SpringPBKDF2v58, &SpringPBKDF2v5} {
+			if hex.DecodedLen(len(s)-len(springPBKDF2)) == d.SaltLen+d.KeyLen {
+				return d.Compare(hashed, password)
+			}
+		}
+		return ErrMismatch
+	}
+	return ErrUnsupported
+}
+
+// HashSpring returns the DelegatingPasswordEncoder encoding of the hash of
+// password, the masked, key'ed or flagged (metadata) profiles cannot be
+// represented and ErrUnsupported is returned.
+func (p *Profile) HashSpring(password []byte) ([]byte, error) {
+	if p.masked() || len(p.key()) > 0 || len(p.metadata()) > 0 || p.integrity || len(p.record) > 0 {
+		return nil, ErrUnsupported
+	}
+
+	hashed, err := p.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.params.(type) {
+	case *BcryptParams:
+		return append([]byte(springBcrypt), hashed...), nil
+	case *Argon2Params:
+		phc, err := Reencode(hashed, FormatPHC)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(springArgon2), phc...), nil
+	case *ScryptParams:
+		eh, err := decodeNative(hashed)
+		if err != nil {
+			return nil, err
+		}
+		ln, err := ScryptLogN(eh.a)
+		if err != nil || eh.b > 0xff || eh.c > 0xff {
+			return nil, ErrUnsupported
+		}
+
+		var out bytes.Buffer
+		fmt.Fprintf(&out, "%s%c%x%c%s%c%s", springScrypt,
+			separatorRune, uint64(ln)<<16|uint64(eh.b)<<8|uint64(eh.c),
+			separatorRune, base64.StdEncoding.EncodeToString(eh.salt),
+			separatorRune, base64.StdEncoding.EncodeToString(eh.key))
+		return out.Bytes(), nil
+	}
+	return nil, ErrUnsupported
+}
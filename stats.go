@@ -0,0 +1,103 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"runtime"
+	"time"
+)
+
+//
+// per operation statistics.
+//
+// when a stats hook is set, every KDF computation of the profile reports
+// its measured costs once done, for capacity planning.
+// the CPU time is the one of the calling OS thread (the operation is
+// locked to it), it is only available on linux and does not account for
+// additional argon2 threads.
+//
+
+// Stats describes the cost of a hashing operation.
+type Stats struct {
+	Op        string        // "hash", "compare" or "derive"
+	Algorithm string        // hash identifier (i.e. "2id", "2s", "2a")
+	Wall      time.Duration // wall time of the computation
+	CPU       time.Duration // CPU time of the computation, 0 if unavailable
+	Wait      time.Duration // time spent waiting for the limiter
+	Memory    uint64        // estimated peak memory of the KDF (bytes)
+}
+
+// SetStatsHook sets the function receiving the Stats of every hashing
+// operation of the profile, nil removes it.
+// the hook is called synchronously and must be cheap.
+func (p *Profile) SetStatsHook(f func(Stats)) error {
+	p.stats = f
+	return nil
+}
+
+// paramsMemory estimates the peak memory used by the KDF in bytes.
+func paramsMemory(params interface{}) uint64 {
+	switch v := params.(type) {
+	case *Argon2Params:
+		return uint64(v.Memory) * 1024
+	case *ScryptParams:
+		// V (N blocks), B (P blocks) and XY (2 blocks) of 128 * R bytes
+		return 128 * uint64(v.R) * (uint64(v.N) + uint64(v.P) + 2)
+	case *BcryptParams:
+		// blowfish state: 4 S-boxes of 256 words and the P-array
+		return 4*256*4 + 18*4
+	case *Pbkdf2Params:
+		// HMAC inner and outer states
+		return 2 * 512
+	}
+	return 0
+}
+
+func paramsAlgorithm(params interface{}) string {
+	switch v := params.(type) {
+	case *Argon2Params:
+		id, _ := v.variant()
+		return id
+	case *ScryptParams:
+		return idScrypt
+	case *BcryptParams:
+		return idBcrypt
+	case *Pbkdf2Params:
+		if v.PRF == Pbkdf2SHA512 {
+			return idPbkdf2SHA512
+		}
+		return idPbkdf2SHA256
+	case *hasherParams:
+		return v.id
+	}
+	return ""
+}
+
+// measure starts measuring an operation after wait, the returned function
+// stops it and reports the Stats to the hook.
+func (p *Profile) measure(op string, wait time.Duration) func() {
+	hook := p.stats
+
+	runtime.LockOSThread()
+	cpu, _ := threadCPU()
+	start := time.Now()
+
+	return func() {
+		wall := time.Since(start)
+		end, ok := threadCPU()
+		runtime.UnlockOSThread()
+
+		st := Stats{
+			Op:        op,
+			Algorithm: paramsAlgorithm(p.params),
+			Wall:      wall,
+			Wait:      wait,
+			Memory:    paramsMemory(p.params),
+		}
+		if ok {
+			st.CPU = end - cpu
+		}
+		hook(st)
+	}
+}
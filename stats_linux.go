@@ -0,0 +1,18 @@
+//go:build go1.12 && linux
+// +build go1.12,linux
+
+package passwd
+
+import (
+	"syscall"
+	"time"
+)
+
+// threadCPU returns the CPU time consumed by the calling thread.
+func threadCPU() (time.Duration, bool) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_THREAD, &ru); err != nil {
+		return 0, false
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano()), true
+}
@@ -0,0 +1,13 @@
+//go:build go1.12 && !linux
+// +build go1.12,!linux
+
+package passwd
+
+import (
+	"time"
+)
+
+// threadCPU is not available on this platform.
+func threadCPU() (time.Duration, bool) {
+	return 0, false
+}
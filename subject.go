@@ -0,0 +1,59 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"encoding/binary"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// domain separation label for subject bound derivations, bump the
+	// version if the construction ever changes.
+	labelSubject = "passwd/subject/v1"
+)
+
+// subjectSalt derives a deterministic salt of sz bytes from the subject
+// identifier using SHAKE256 over a length prefixed, labelled input:
+//
+// salt = SHAKE256(label || 0x00 || len(subject) || subject)[:sz]
+//
+// the length prefix avoids ambiguities between label and subject.
+func subjectSalt(subject []byte, sz uint32) []byte {
+	var length [8]byte
+
+	binary.BigEndian.PutUint64(length[:], uint64(len(subject)))
+
+	h := sha3.NewShake256()
+	h.Write([]byte(labelSubject))
+	h.Write([]byte{0x00})
+	h.Write(length[:])
+	h.Write(subject)
+
+	salt := make([]byte, sz)
+	h.Read(salt)
+	return salt
+}
+
+// DeriveForSubject is the Profile's method for computing a cryptographic key
+// bound to a caller provided subject identifier (i.e. a user ID).
+// The salt is derived from the subject with proper domain separation, so
+// each subject ends up with its own key even if a global salt strategy is
+// used by the application.
+func (p *Profile) DeriveForSubject(password, subject []byte) ([]byte, error) {
+	if len(subject) == 0 {
+		return nil, ErrUnsupported
+	}
+
+	switch v := p.params.(type) {
+	case *ScryptParams:
+		return p.Derive(password, subjectSalt(subject, v.Saltlen))
+	case *Argon2Params:
+		return p.Derive(password, subjectSalt(subject, v.Saltlen))
+	case *Pbkdf2Params:
+		return p.Derive(password, subjectSalt(subject, v.Saltlen))
+	}
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,177 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"sort"
+	"strconv"
+)
+
+//
+// a Suite bundles the profile used for new hashes with the verifiers still
+// accepted for existing ones, the usual migration path is:
+//
+// hashed is verified by the preferred profile -> nothing to do
+// hashed is verified by a legacy verifier     -> rehash with Suite.Hash()
+//
+
+// Verifier is implemented by anything able to verify a stored hash against
+// a plaintext password, *Profile is a Verifier.
+type Verifier interface {
+	Compare(hashed, password []byte) error
+}
+
+// VerifierFunc adapts an ordinary function to the Verifier interface.
+type VerifierFunc func(hashed, password []byte) error
+
+// Compare calls f(hashed, password).
+func (f VerifierFunc) Compare(hashed, password []byte) error {
+	return f(hashed, password)
+}
+
+// Named returns v reported as name by Suite.VerifyEx().
+func Named(name string, v Verifier) Verifier {
+	return &namedVerifier{name: name, Verifier: v}
+}
+
+type namedVerifier struct {
+	name string
+	Verifier
+}
+
+func (n *namedVerifier) Name() string { return n.name }
+
+var (
+	// NativeVerifier verifies non-key'd & non-mask'd hashes in the native
+	// format whatever their parameters (see Compare()).
+	NativeVerifier = Named("native", VerifierFunc(Compare))
+
+	// PHCVerifier verifies argon2 and scrypt hashes in the PHC string
+	// format.
+	PHCVerifier = Named("phc", VerifierFunc(comparePHC))
+)
+
+func comparePHC(hashed, password []byte) error {
+	native, err := Reencode(hashed, FormatNative)
+	if err != nil {
+		return err
+	}
+	return Compare(native, password)
+}
+
+// Suite is a preferred Profile and an ordered list of accepted verifiers.
+type Suite struct {
+	preferred *Profile
+	verifiers []legacyVerifier
+}
+
+type legacyVerifier struct {
+	Verifier
+	name     string
+	priority int
+}
+
+// NewSuite instantiates a Suite hashing with preferred and accepting hashes
+// verified by preferred or any of the verifiers, tried in order.
+func NewSuite(preferred *Profile, verifiers ...Verifier) (*Suite, error) {
+	if preferred == nil {
+		return nil, ErrUnsupported
+	}
+
+	s := Suite{preferred: preferred}
+	for _, v := range verifiers {
+		s.add(v, 0)
+	}
+	return &s, nil
+}
+
+func (s *Suite) add(v Verifier, priority int) {
+	name := "legacy" + strconv.Itoa(len(s.verifiers))
+	if n, ok := v.(interface{ Name() string }); ok {
+		name = n.Name()
+	}
+
+	s.verifiers = append(s.verifiers, legacyVerifier{Verifier: v, name: name, priority: priority})
+	sort.SliceStable(s.verifiers, func(i, j int) bool {
+		return s.verifiers[i].priority < s.verifiers[j].priority
+	})
+}
+
+// AddLegacy registers an accepted verifier, verifiers are tried by
+// increasing priority then registration order, the ones given to NewSuite()
+// have priority 0.
+// verifiers implementing Name() string (see Named()) are reported under
+// that name by VerifyEx().
+// AddLegacy must not be called concurrently with the other methods.
+func (s *Suite) AddLegacy(v Verifier, priority int) error {
+	if v == nil {
+		return ErrUnsupported
+	}
+	s.add(v, priority)
+	return nil
+}
+
+// Hash computes the hash value of password using the preferred profile.
+func (s *Suite) Hash(password []byte) ([]byte, error) {
+	return s.preferred.Hash(password)
+}
+
+// Verify compares hashed against password, needsRehash is true when the hash
+// was verified by one of the accepted verifiers and not the preferred
+// profile, the caller should then store the output of Hash(password).
+func (s *Suite) Verify(hashed, password []byte) (needsRehash bool, err error) {
+	v, err := s.VerifyEx(hashed, password)
+	return v.NeedsRehash, err
+}
+
+// DummyVerify is the DummyCompare() of the preferred profile, it takes a
+// Verify() time for the unknown users and returns ErrMismatch.
+func (s *Suite) DummyVerify(password []byte) error {
+	return s.preferred.DummyCompare(password)
+}
+
+// VerifiedByPreferred is the Verification.VerifiedBy of hashes verified
+// by the preferred profile.
+const VerifiedByPreferred = "preferred"
+
+// Verification describes how a hash was verified by a Suite.
+type Verification struct {
+	VerifiedBy  string // VerifiedByPreferred or the verifier name
+	NeedsRehash bool   // not verified by the preferred profile
+}
+
+// VerifyEx is Verify() reporting the verifier that accepted hashed.
+// the verifiers are tried when the preferred profile reports a mismatch or
+// a hash it does not verify (unsupported, unparsable), its other errors
+// (i.e. ErrLocked, ErrExpired, ErrBusy) are returned as is.
+func (s *Suite) VerifyEx(hashed, password []byte) (Verification, error) {
+	defer s.preferred.wipePassword(password)
+
+	err := s.preferred.keep().Compare(hashed, password)
+	switch {
+	case err == nil:
+		return Verification{VerifiedBy: VerifiedByPreferred}, nil
+	case !foreignHash(err):
+		return Verification{}, err
+	}
+
+	for _, v := range s.verifiers {
+		if v.Compare(hashed, password) == nil {
+			return Verification{VerifiedBy: v.name, NeedsRehash: true}, nil
+		}
+	}
+
+	return Verification{}, ErrMismatch
+}
+
+// foreignHash returns true if err is a mismatch or tells a hash of another
+// profile, algorithm or format.
+func foreignHash(err error) bool {
+	for _, target := range []error{ErrMismatch, ErrUnsupported, ErrUnsupportedAlgo, ErrIncompatibleVersion, ErrParse} {
+		if isError(err, target) {
+			return true
+		}
+	}
+	return false
+}
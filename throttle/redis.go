@@ -0,0 +1,322 @@
+//go:build go1.12
+// +build go1.12
+
+package throttle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Error is the type helping defining errors as constants.
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+const (
+	// ErrConfig when the configuration is incomplete
+	ErrConfig = Error("invalid redis configuration")
+	// ErrResponse when redis returns an unexpected response
+	ErrResponse = Error("invalid redis response")
+)
+
+const (
+	defaultPrefix  = "throttle:"
+	defaultTimeout = 5 * time.Second
+
+	// the replies of the store commands are counters and small arrays,
+	// larger ones are refused before anything is allocated.
+	maxBulk  = 1 << 20 // bytes
+	maxArray = 1 << 10 // elements
+)
+
+// RedisConfig is the Redis store configuration.
+type RedisConfig struct {
+	Address  string        // host:port
+	Password string        // optional AUTH password
+	DB       int           // database index
+	Prefix   string        // keys prefix ("throttle:" if empty)
+	Timeout  time.Duration // dial and commands timeout (5s if 0)
+
+	// Dial opens the connections (i.e. tls.Dial), net.Dial if nil.
+	Dial func(network, address string) (net.Conn, error)
+}
+
+// RedisStore is a Store shared through Redis, a failure is counted with a
+// MULTI/EXEC transaction and the keys expire with their State.
+// commands are serialized on a single connection, reopened after network
+// errors.
+type RedisStore struct {
+	cfg RedisConfig
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// NewRedisStore returns a RedisStore, the connection is opened on first
+// use.
+func NewRedisStore(cfg RedisConfig) (*RedisStore, error) {
+	if cfg.Address == "" || cfg.DB < 0 {
+		return nil, ErrConfig
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = defaultPrefix
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Dial == nil {
+		d := net.Dialer{Timeout: cfg.Timeout}
+		cfg.Dial = d.Dial
+	}
+	return &RedisStore{cfg: cfg}, nil
+}
+
+// redisError is an error reply.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// Close closes the connection.
+func (s *RedisStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// the failures counter and last failure keys, the hash tag keeps them on
+// the same cluster slot.
+func (s *RedisStore) keys(key string) (string, string) {
+	k := s.cfg.Prefix + "{" + key + "}"
+	return k + ":f", k + ":t"
+}
+
+// Get returns the State of key.
+func (s *RedisStore) Get(key string) (State, error) {
+	kf, kt := s.keys(key)
+	replies, err := s.pipeline([]string{"MGET", kf, kt})
+	if err != nil {
+		return State{}, err
+	}
+
+	values, ok := replies[0].([]interface{})
+	if !ok || len(values) != 2 {
+		return State{}, ErrResponse
+	}
+	return parseState(values[0], values[1])
+}
+
+// Fail records a failure of key.
+func (s *RedisStore) Fail(key string, t time.Time, ttl time.Duration) (State, error) {
+	kf, kt := s.keys(key)
+	px := strconv.FormatInt(int64(ttl/time.Millisecond), 10)
+
+	replies, err := s.pipeline(
+		[]string{"MULTI"},
+		[]string{"INCR", kf},
+		[]string{"PEXPIRE", kf, px},
+		[]string{"SET", kt, strconv.FormatInt(t.UnixNano(), 10), "PX", px},
+		[]string{"EXEC"},
+	)
+	if err != nil {
+		return State{}, err
+	}
+
+	exec, ok := replies[4].([]interface{})
+	if !ok || len(exec) != 3 {
+		return State{}, ErrResponse
+	}
+	failures, ok := exec[0].(int64)
+	if !ok {
+		return State{}, ErrResponse
+	}
+	return State{Failures: int(failures), Last: t}, nil
+}
+
+// Reset forgets the failures of key.
+func (s *RedisStore) Reset(key string) error {
+	kf, kt := s.keys(key)
+	_, err := s.pipeline([]string{"DEL", kf, kt})
+	return err
+}
+
+func parseState(f, t interface{}) (State, error) {
+	if f == nil || t == nil {
+		return State{}, nil
+	}
+
+	fb, ok1 := f.([]byte)
+	tb, ok2 := t.([]byte)
+	if !ok1 || !ok2 {
+		return State{}, ErrResponse
+	}
+	failures, err1 := strconv.Atoi(string(fb))
+	last, err2 := strconv.ParseInt(string(tb), 10, 64)
+	if err1 != nil || err2 != nil {
+		return State{}, ErrResponse
+	}
+	return State{Failures: failures, Last: time.Unix(0, last)}, nil
+}
+
+// connect opens the connection, authenticates and selects the database.
+func (s *RedisStore) connect() error {
+	conn, err := s.cfg.Dial("tcp", s.cfg.Address)
+	if err != nil {
+		return err
+	}
+	s.conn, s.rd = conn, bufio.NewReader(conn)
+
+	var setup [][]string
+	if s.cfg.Password != "" {
+		setup = append(setup, []string{"AUTH", s.cfg.Password})
+	}
+	if s.cfg.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.cfg.DB)})
+	}
+	if len(setup) > 0 {
+		_, err = s.exchange(setup)
+	}
+	return err
+}
+
+// pipeline sends the commands and returns their replies, an error reply
+// fails the pipeline.
+func (s *RedisStore) pipeline(cmds ...[]string) ([]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		err := s.connect()
+		if err != nil {
+			s.drop()
+			return nil, err
+		}
+	}
+
+	replies, err := s.exchange(cmds)
+	if err != nil {
+		if _, ok := err.(redisError); !ok {
+			s.drop()
+		}
+		return nil, err
+	}
+	return replies, nil
+}
+
+// drop closes a connection in an unknown state.
+func (s *RedisStore) drop() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+func (s *RedisStore) exchange(cmds [][]string) ([]interface{}, error) {
+	s.conn.SetDeadline(time.Now().Add(s.cfg.Timeout))
+
+	w := bufio.NewWriter(s.conn)
+	for _, cmd := range cmds {
+		fmt.Fprintf(w, "*%d\r\n", len(cmd))
+		for _, arg := range cmd {
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	err := w.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	// every reply is read to keep the connection in sync.
+	replies := make([]interface{}, len(cmds))
+	var rerr error
+	for i := range cmds {
+		replies[i], err = readReply(s.rd)
+		switch e := err.(type) {
+		case nil:
+		case redisError:
+			if rerr == nil {
+				rerr = e
+			}
+		default:
+			return nil, err
+		}
+	}
+	if rerr != nil {
+		return nil, rerr
+	}
+	return replies, nil
+}
+
+// readReply reads a RESP reply: string, []byte, int64, nil or
+// []interface{} (error elements are redisError values).
+func readReply(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, ErrResponse
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		n, err := strconv.ParseInt(body, 10, 64)
+		if err != nil {
+			return nil, ErrResponse
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < -1 || n > maxBulk {
+			return nil, ErrResponse
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		_, err = io.ReadFull(rd, b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < -1 || n > maxArray {
+			return nil, ErrResponse
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			values[i], err = readReply(rd)
+			if e, ok := err.(redisError); ok {
+				// i.e. a failed command of a transaction.
+				values[i] = e
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, ErrResponse
+}
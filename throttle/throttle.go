@@ -0,0 +1,228 @@
+//go:build go1.12
+// +build go1.12
+
+// Package throttle provides login throttling keyed by identifiers
+// (usernames, client addresses..): failed attempts are counted per key and
+// keys over the threshold are locked out for an exponentially growing
+// delay.
+//
+//	t := throttle.New(throttle.NewMemoryStore(), throttle.Config{})
+//	err := t.Compare(profile, hashed, password, "user:"+username, "ip:"+addr)
+//
+// the lockout is checked before the KDF work, locked out attempts do not
+// cost the server a derivation.
+package throttle
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ermites-io/passwd"
+)
+
+var now = time.Now
+
+// defaults of the Config zero values.
+const (
+	defaultThreshold = 5
+	defaultBase      = time.Second
+	defaultMax       = 15 * time.Minute
+	defaultWindow    = 24 * time.Hour
+)
+
+// Config is the throttling policy.
+type Config struct {
+	Threshold int           // failures before the first lockout (5 if 0)
+	Base      time.Duration // first lockout (1s if 0), doubled after each failure
+	Max       time.Duration // lockout cap (15m if 0)
+	Window    time.Duration // failures are forgotten after Window without failure (24h if 0)
+}
+
+// State is the failures record of a key.
+type State struct {
+	Failures int
+	Last     time.Time // last failure
+}
+
+// Store keeps the keys State, shared by the processes throttling the same
+// keys.
+type Store interface {
+	// Get returns the State of key, the zero State if it has none.
+	Get(key string) (State, error)
+	// Fail records a failure of key at t, the State expires after ttl.
+	Fail(key string, t time.Time, ttl time.Duration) (State, error)
+	// Reset forgets the failures of key.
+	Reset(key string) error
+}
+
+// LockedError is returned for the attempts of a locked out key.
+type LockedError struct {
+	Key        string
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return string(passwd.ErrLocked) + " " + e.Key + ", retry after " + e.RetryAfter.String()
+}
+
+// Unwrap returns passwd.ErrLocked.
+func (e *LockedError) Unwrap() error { return passwd.ErrLocked }
+
+// Is reports whether target is passwd.ErrLocked.
+func (e *LockedError) Is(target error) bool { return target == passwd.ErrLocked }
+
+// Throttler applies a Config on a Store.
+type Throttler struct {
+	store Store
+	cfg   Config
+}
+
+// New returns a Throttler of store, zero Config fields are the defaults.
+func New(store Store, cfg Config) *Throttler {
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = defaultThreshold
+	}
+	if cfg.Base <= 0 {
+		cfg.Base = defaultBase
+	}
+	if cfg.Max <= 0 {
+		cfg.Max = defaultMax
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = defaultWindow
+	}
+	return &Throttler{store: store, cfg: cfg}
+}
+
+// lockout returns the lockout of s.
+func (t *Throttler) lockout(s State) time.Duration {
+	over := s.Failures - t.cfg.Threshold
+	if over < 0 {
+		return 0
+	}
+
+	d := t.cfg.Base
+	for i := 0; i < over && d < t.cfg.Max; i++ {
+		d *= 2
+	}
+	if d > t.cfg.Max {
+		d = t.cfg.Max
+	}
+	return d
+}
+
+// Check returns a *LockedError if one of the keys is locked out, empty keys
+// are ignored.
+func (t *Throttler) Check(keys ...string) error {
+	at := now()
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		s, err := t.store.Get(key)
+		if err != nil {
+			return err
+		}
+		if left := s.Last.Add(t.lockout(s)).Sub(at); left > 0 {
+			return &LockedError{Key: key, RetryAfter: left}
+		}
+	}
+	return nil
+}
+
+// Fail records a failed attempt of the keys.
+func (t *Throttler) Fail(keys ...string) error {
+	at := now()
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		_, err := t.store.Fail(key, at, t.cfg.Window+t.cfg.Max)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compare checks the keys lockout then compares hashed against password
+// with p. a mismatch counts a failure for every key, a success resets the
+// first one (the account) only: an attacker holding one account cannot
+// clear the lockout of its other keys (i.e. its address).
+func (t *Throttler) Compare(p *passwd.Profile, hashed, password []byte, keys ...string) error {
+	err := t.Check(keys...)
+	if err != nil {
+		return err
+	}
+
+	err = p.Compare(hashed, password)
+	switch {
+	case err == passwd.ErrMismatch:
+		if ferr := t.Fail(keys...); ferr != nil {
+			return ferr
+		}
+		return err
+	case err != nil:
+		return err
+	}
+
+	if len(keys) > 0 && keys[0] != "" {
+		return t.store.Reset(keys[0])
+	}
+	return nil
+}
+
+type memoryEntry struct {
+	state   State
+	expires time.Time
+}
+
+// MemoryStore is an in memory Store, for single process deployments and
+// tests.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+// Get returns the State of key.
+func (m *MemoryStore) Get(key string) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if !ok || !now().Before(e.expires) {
+		delete(m.entries, key)
+		return State{}, nil
+	}
+	return e.state, nil
+}
+
+// Fail records a failure of key.
+func (m *MemoryStore) Fail(key string, t time.Time, ttl time.Duration) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if !ok || !t.Before(e.expires) {
+		e = memoryEntry{}
+	}
+	e.state.Failures++
+	e.state.Last = t
+	e.expires = t.Add(ttl)
+	m.entries[key] = e
+	return e.state, nil
+}
+
+// Reset forgets the failures of key.
+func (m *MemoryStore) Reset(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
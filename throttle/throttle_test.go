@@ -0,0 +1,242 @@
+package throttle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ermites-io/passwd"
+)
+
+func testStore(t *testing.T, store Store) {
+	clock := time.Unix(1700000000, 0)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	p, _ := passwd.NewCustom(&passwd.BcryptParams{Cost: 4})
+	hashed, _ := p.Hash([]byte("password"))
+
+	th := New(store, Config{Threshold: 2, Base: time.Second, Max: 4 * time.Second})
+
+	for i := 0; i < 2; i++ {
+		if err := th.Compare(p, hashed, []byte("wrong"), "user:alice", "ip:10.0.0.1"); err != passwd.ErrMismatch {
+			t.Fatalf("attempt #%d: unexpected %v\n", i, err)
+		}
+	}
+
+	// 2 failures: 1 second lockout, no verification.
+	err := th.Compare(p, hashed, []byte("password"), "user:alice", "ip:10.0.0.1")
+	le, ok := err.(*LockedError)
+	if !ok || le.Key != "user:alice" || le.RetryAfter != time.Second || !le.Is(passwd.ErrLocked) {
+		t.Fatalf("locked out: unexpected %v\n", err)
+	}
+	if err := th.Check("user:bob"); err != nil {
+		t.Fatalf("other key: unexpected %v\n", err)
+	}
+
+	// lockouts double up to Max.
+	for i, want := range []time.Duration{2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		clock = clock.Add(time.Minute)
+		th.Compare(p, hashed, []byte("wrong"), "user:alice", "ip:10.0.0.1")
+		err := th.Check("ip:10.0.0.1")
+		if le, ok := err.(*LockedError); !ok || le.RetryAfter != want {
+			t.Fatalf("lockout #%d: %v vs expected %v\n", i, err, want)
+		}
+	}
+
+	// success resets the account only.
+	clock = clock.Add(time.Minute)
+	if err := th.Compare(p, hashed, []byte("password"), "user:alice", "ip:10.0.0.1"); err != nil {
+		t.Fatalf("success: unexpected %v\n", err)
+	}
+	if s, _ := store.Get("user:alice"); s.Failures != 0 {
+		t.Fatalf("success: account not reset %v\n", s)
+	}
+	if s, _ := store.Get("ip:10.0.0.1"); s.Failures != 5 {
+		t.Fatalf("success: address reset %v\n", s)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+
+	m := NewMemoryStore()
+	at := time.Now()
+	m.Fail("k", at, time.Hour)
+	now = func() time.Time { return at.Add(2 * time.Hour) }
+	defer func() { now = time.Now }()
+	if s, _ := m.Get("k"); s.Failures != 0 {
+		t.Fatalf("expired state: %v\n", s)
+	}
+}
+
+// fakeRedis implements the commands used by RedisStore, without expiry.
+type fakeRedis struct {
+	mu   sync.Mutex
+	data map[string]string
+	auth string
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+
+	var queued [][]string
+	multi, authed := false, f.auth == ""
+	for {
+		cmd, err := readCommand(rd)
+		if err != nil {
+			return
+		}
+
+		switch {
+		case cmd[0] == "AUTH":
+			authed = cmd[1] == f.auth
+			if !authed {
+				fmt.Fprintf(conn, "-WRONGPASS invalid password\r\n")
+				continue
+			}
+			fmt.Fprintf(conn, "+OK\r\n")
+		case !authed:
+			fmt.Fprintf(conn, "-NOAUTH authentication required\r\n")
+		case cmd[0] == "MULTI":
+			multi = true
+			fmt.Fprintf(conn, "+OK\r\n")
+		case cmd[0] == "EXEC":
+			fmt.Fprintf(conn, "*%d\r\n", len(queued))
+			for _, q := range queued {
+				f.exec(conn, q)
+			}
+			multi, queued = false, nil
+		case multi:
+			queued = append(queued, cmd)
+			fmt.Fprintf(conn, "+QUEUED\r\n")
+		default:
+			f.exec(conn, cmd)
+		}
+	}
+}
+
+func (f *fakeRedis) exec(w io.Writer, cmd []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch cmd[0] {
+	case "INCR":
+		n, _ := strconv.Atoi(f.data[cmd[1]])
+		f.data[cmd[1]] = strconv.Itoa(n + 1)
+		fmt.Fprintf(w, ":%d\r\n", n+1)
+	case "PEXPIRE":
+		fmt.Fprintf(w, ":1\r\n")
+	case "SET":
+		f.data[cmd[1]] = cmd[2]
+		fmt.Fprintf(w, "+OK\r\n")
+	case "DEL":
+		for _, k := range cmd[1:] {
+			delete(f.data, k)
+		}
+		fmt.Fprintf(w, ":%d\r\n", len(cmd)-1)
+	case "MGET":
+		fmt.Fprintf(w, "*%d\r\n", len(cmd)-1)
+		for _, k := range cmd[1:] {
+			v, ok := f.data[k]
+			if !ok {
+				fmt.Fprintf(w, "$-1\r\n")
+				continue
+			}
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+		}
+	default:
+		fmt.Fprintf(w, "-ERR unknown command\r\n")
+	}
+}
+
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	cmd := make([]string, n)
+	for i := range cmd {
+		if _, err := rd.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		cmd[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return cmd, nil
+}
+
+func TestRedisStore(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v\n", err)
+	}
+	defer ln.Close()
+
+	f := &fakeRedis{data: make(map[string]string), auth: "secret"}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+
+	if _, err := NewRedisStore(RedisConfig{}); err != ErrConfig {
+		t.Fatalf("empty config: unexpected %v\n", err)
+	}
+
+	bad, _ := NewRedisStore(RedisConfig{Address: ln.Addr().String(), Password: "wrong"})
+	if _, err := bad.Get("k"); err == nil {
+		t.Fatalf("wrong password: no error\n")
+	}
+
+	store, err := NewRedisStore(RedisConfig{Address: ln.Addr().String(), Password: "secret"})
+	if err != nil {
+		t.Fatalf("NewRedisStore: %v\n", err)
+	}
+	defer store.Close()
+
+	testStore(t, store)
+	if _, ok := f.data["throttle:{ip:10.0.0.1}:f"]; !ok {
+		t.Fatalf("unexpected keys %v\n", f.data)
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	for i, test := range []struct {
+		reply string
+		want  interface{}
+		err   error
+	}{
+		{"$5\r\nhello\r\n", "hello", nil},
+		{"$-1\r\n", nil, nil},
+		{":42\r\n", int64(42), nil},
+		{"$-2\r\n", nil, ErrResponse},
+		{"$" + strconv.Itoa(maxBulk+1) + "\r\n", nil, ErrResponse},
+		{"$9223372036854775807\r\n", nil, ErrResponse},
+		{"*-2\r\n", nil, ErrResponse},
+		{"*" + strconv.Itoa(maxArray+1) + "\r\n", nil, ErrResponse},
+	} {
+		v, err := readReply(bufio.NewReader(strings.NewReader(test.reply)))
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		if err != test.err || v != test.want {
+			t.Fatalf("test #%d: %v (%v) vs expected: %v (%v)\n", i, v, err, test.want, test.err)
+		}
+	}
+}
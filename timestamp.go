@@ -0,0 +1,108 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"strconv"
+	"time"
+)
+
+// now is the clock used for timestamps, overridable for tests.
+var now = time.Now
+
+// SetTimestamp enables embedding the creation time (unix seconds) in the
+// hashes produced by the profile, so the freshness of a stored hash can be
+// evaluated without a separate column, see IssuedAt().
+func (p *Profile) SetTimestamp(enabled bool) error {
+	p.timestamp = enabled
+	return nil
+}
+
+// IssuedAt returns the creation time embedded in hashed, ErrUnsupported
+// is returned if the hash has no timestamp.
+func IssuedAt(hashed []byte) (time.Time, error) {
+	return metaTime(hashed, metaTimestamp)
+}
+
+// SetMaxAge makes NeedsRehash() and CompareEx() report the hashes issued
+// more than d ago, or without a creation time, as needing a rehash, it
+// enables the timestamps (see SetTimestamp()), a zero duration disables
+// it.
+// unlike SetExpiry(), stale hashes still verify: they are replaced at the
+// next login.
+func (p *Profile) SetMaxAge(d time.Duration) error {
+	if d < 0 {
+		return ErrUnsupported
+	}
+	p.maxAge = d
+	if d > 0 {
+		p.timestamp = true
+	}
+	return nil
+}
+
+// stale returns true if the hash of metadata md is older than the profile
+// max age.
+func (p *Profile) stale(md metadata) bool {
+	if p.maxAge == 0 {
+		return false
+	}
+	issued, err := mdTime(md, metaTimestamp)
+	return err != nil || now().Sub(issued) > p.maxAge
+}
+
+// SetExpiry makes the hashes produced by the profile expire after d, once
+// expired Compare() still verifies the password but returns ErrExpired
+// instead of nil, a zero duration disables the expiry.
+func (p *Profile) SetExpiry(d time.Duration) error {
+	if d < 0 {
+		return ErrUnsupported
+	}
+	p.expiry = d
+	return nil
+}
+
+// ExpiresAt returns the expiry time embedded in hashed, ErrUnsupported is
+// returned if the hash does not expire.
+func ExpiresAt(hashed []byte) (time.Time, error) {
+	return metaTime(hashed, metaExpiry)
+}
+
+func metaTime(hashed []byte, key string) (time.Time, error) {
+	_, md, err := splitMetadata(hashed)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return mdTime(md, key)
+}
+
+func mdTime(md metadata, key string) (time.Time, error) {
+	ts, ok := md[key]
+	if !ok {
+		return time.Time{}, ErrUnsupported
+	}
+
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrParse
+	}
+	return time.Unix(sec, 0), nil
+}
+
+// checkExpiry returns ErrExpired if the stored hash is past its expiry.
+func checkExpiry(md metadata) error {
+	exp, ok := md[metaExpiry]
+	if !ok {
+		return nil
+	}
+
+	sec, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return ErrMismatch
+	}
+	if !now().Before(time.Unix(sec, 0)) {
+		return ErrExpired
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+// SetPreHash setup a transform applied to the password before it is handed
+// to the hashing algorithm (i.e. SHA-512, unicode normalization, site
+// specific salting..), it is applied identically in Hash() and Compare().
+// Produced hashes are flagged, comparing a flagged hash requires a profile
+// with a pre-hash transform and vice versa.
+func (p *Profile) SetPreHash(f func([]byte) []byte) error {
+	p.prehash = f
+	return nil
+}
+
+// input returns the data actually handed to the hashing algorithm.
+func (p *Profile) input(password []byte) []byte {
+	if p.prehash != nil {
+		password = p.prehash(password)
+	}
+	if len(p.deployment) > 0 {
+		password = foldAssociatedData(p.deployment, password)
+	}
+	if p.namespace != "" {
+		password = foldAssociatedData(namespaceAD(p.namespace), password)
+	}
+	if len(p.ad) > 0 {
+		password = foldAssociatedData(p.ad, password)
+	}
+	if p.domain != "" {
+		password = foldDomain(p.domain, password)
+	}
+	if len(p.userKey) > 0 {
+		password = foldUserKey(p.userKey, password)
+	}
+	return password
+}
+
+// SetPostHash setup a transform applied to the computed digest before it is
+// encoded (i.e. HMAC with a pepper, truncation to a fixed length for legacy
+// storage..), if a Blinder is also setup, the digest is transformed first
+// then blinded.
+// Produced hashes are flagged, comparing a flagged hash requires a profile
+// with a post-hash transform and vice versa.
+func (p *Profile) SetPostHash(f func([]byte) []byte) error {
+	err := p.setPost(f, p.blinder)
+	if err != nil {
+		return err
+	}
+
+	p.posthash = f
+	return nil
+}
+
+// setPost composes the digest post processing of the parameters.
+func (p *Profile) setPost(f func([]byte) []byte, b Blinder) error {
+	var post func([]byte) ([]byte, error)
+
+	switch {
+	case f != nil && b != nil:
+		post = func(digest []byte) ([]byte, error) {
+			return b.Blind(f(digest))
+		}
+	case f != nil:
+		post = func(digest []byte) ([]byte, error) {
+			return f(digest), nil
+		}
+	case b != nil:
+		post = b.Blind
+	}
+
+	switch v := p.params.(type) {
+	case *ScryptParams:
+		v.post = post
+	case *Argon2Params:
+		v.post = post
+	case *Pbkdf2Params:
+		v.post = post
+	default:
+		return ErrUnsupported
+	}
+	return nil
+}
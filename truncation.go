@@ -0,0 +1,90 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+)
+
+// bcrypt only uses the first 72 bytes of the password.
+const bcryptMaxPassword = 72
+
+// TruncationPolicy defines how bcrypt profiles handle passwords longer than
+// bcrypt 72 bytes limit.
+type TruncationPolicy int
+
+const (
+	// TruncateError rejects long passwords: Hash() returns
+	// ErrPasswordTooLong and Compare() returns ErrMismatch (default).
+	TruncateError TruncationPolicy = iota
+	// TruncatePreHash hashes every password with SHA-256 before bcrypt,
+	// the produced hashes are flagged.
+	TruncatePreHash
+	// TruncateLegacy silently truncates long passwords to 72 bytes, only
+	// meant to verify hashes produced by other systems.
+	TruncateLegacy
+)
+
+const (
+	metaBcryptPreHash = "bp" // bcrypt SHA-256 pre-hash mode
+	metaBcryptKeyed   = "bk" // bcrypt HMAC-SHA-512 key'ed pre-hash
+)
+
+// SetTruncationPolicy sets the bcrypt profile long passwords policy.
+func (p *Profile) SetTruncationPolicy(policy TruncationPolicy) error {
+	if _, ok := p.params.(*BcryptParams); !ok {
+		return ErrUnsupported
+	}
+
+	switch policy {
+	case TruncateError, TruncatePreHash, TruncateLegacy:
+		p.truncation = policy
+		return nil
+	}
+	return ErrUnsupported
+}
+
+// bcryptPreHash returns true if the profile produces pre-hashed bcrypt
+// hashes.
+func (p *Profile) bcryptPreHash() bool {
+	_, ok := p.params.(*BcryptParams)
+	return ok && p.truncation == TruncatePreHash && !p.bcryptKeyed()
+}
+
+// bcryptKeyed returns true if the profile produces key'ed bcrypt hashes.
+func (p *Profile) bcryptKeyed() bool {
+	v, ok := p.params.(*BcryptParams)
+	return ok && len(v.secret) > 0
+}
+
+// bcryptInput applies the truncation policy to the bcrypt input.
+// key'ed profiles HMAC-SHA-512 the password with the secret instead, the
+// truncation policy does not apply: bcrypt keeps the first 72 bytes of the
+// base64 encoded digest (432 bits).
+func (p *Profile) bcryptInput(password []byte) ([]byte, error) {
+	if p.bcryptKeyed() {
+		mac := hmac.New(sha512.New, p.key())
+		mac.Write(password)
+		// base64 encoded, bcrypt stops at NUL bytes.
+		return base64Encode(mac.Sum(nil))[:bcryptMaxPassword], nil
+	}
+
+	switch p.truncation {
+	case TruncatePreHash:
+		sum := sha256.Sum256(password)
+		// base64 encoded, bcrypt stops at NUL bytes.
+		return base64Encode(sum[:]), nil
+	case TruncateLegacy:
+		if len(password) > bcryptMaxPassword {
+			return password[:bcryptMaxPassword], nil
+		}
+	default:
+		if len(password) > bcryptMaxPassword {
+			return nil, ErrPasswordTooLong
+		}
+	}
+	return password, nil
+}
@@ -0,0 +1,132 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+//
+// per user peppers.
+//
+// only a master secret is stored, each user's hashes are key'ed with its
+// own pepper derived inside the library:
+//
+// pepper = HKDF-SHA3-256(master, info = label || 0x00 || userID)
+//
+// a leaked pepper only exposes its user. the produced hashes record the
+// master generation (see KeyID()):
+//
+// $ID$mk=KEYID$b64(SALT)$...
+//
+// rotation: SetMasterSecret(next, current) verifies the hashes of both
+// generations, CompareEx() reports NeedsRehash for the previous ones and
+// Rehash() upgrades them at login, MasterGeneration() counts the hashes
+// left behind.
+//
+
+const (
+	labelUserPepper = "passwd/userpepper/v1"
+
+	metaMaster = "mk" // master secret generation of the per user pepper
+)
+
+func userPepper(master, userID []byte) ([]byte, error) {
+	info := make([]byte, 0, len(labelUserPepper)+1+len(userID))
+	info = append(info, labelUserPepper...)
+	info = append(info, 0x00)
+	info = append(info, userID...)
+
+	pepper := make([]byte, SecretMinLength)
+	_, err := io.ReadFull(hkdf.New(newSHA3256, master, nil, info), pepper)
+	if err != nil {
+		return nil, err
+	}
+	return pepper, nil
+}
+
+// SetMasterSecret enables the per user peppers derived from master, the
+// previous masters are only used to verify the hashes of their generation.
+// the masters are validated like SetSecret(), the profile is used through
+// WithUser().
+func (p *Profile) SetMasterSecret(master []byte, previous ...[]byte) error {
+	switch p.params.(type) {
+	case *ScryptParams, *Argon2Params, *Pbkdf2Params:
+	default:
+		return ErrUnsupported
+	}
+
+	masters := make([][]byte, 0, 1+len(previous))
+	for _, m := range append([][]byte{master}, previous...) {
+		err := validateSecret(m)
+		if err != nil {
+			return err
+		}
+		masters = append(masters, m)
+	}
+
+	p.masters = masters
+	return nil
+}
+
+// WithUser returns a copy of the profile key'ed with the pepper of
+// userID, to hash and compare userID's passwords.
+func (p *Profile) WithUser(userID []byte) (*Profile, error) {
+	if len(p.masters) == 0 {
+		return nil, ErrSecretRequired
+	}
+	return p.withMaster(userID, p.masters[0])
+}
+
+func (p *Profile) withMaster(userID, master []byte) (*Profile, error) {
+	pepper, err := userPepper(master, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	c := p.copy()
+	switch v := c.params.(type) {
+	case *ScryptParams:
+		v.secret = pepper
+	case *Argon2Params:
+		v.secret = pepper
+	case *Pbkdf2Params:
+		v.secret = pepper
+	}
+	c.user = userID
+	c.masterGen = KeyID(master)
+	return c, nil
+}
+
+// forMaster returns the profile verifying hashed, key'ed with the pepper of
+// the generation it was produced with.
+func (p *Profile) forMaster(hashed []byte) (*Profile, error) {
+	gen := MasterGeneration(hashed)
+	if gen == p.masterGen {
+		return p, nil
+	}
+
+	for _, m := range p.masters[1:] {
+		if KeyID(m) == gen {
+			return p.withMaster(p.user, m)
+		}
+	}
+	return nil, ErrMismatch
+}
+
+// MasterGeneration returns the KeyID() of the master secret hashed was
+// produced with, empty if it is not key'ed with a per user pepper.
+func MasterGeneration(hashed []byte) string {
+	if hasIntegrityTag(hashed) {
+		hashed = hashed[:bytes.LastIndexByte(hashed, byte(separatorRune))]
+	}
+	_, md, err := splitMetadata(hashed)
+	if err != nil {
+		return ""
+	}
+	return md[metaMaster]
+}
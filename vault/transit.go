@@ -0,0 +1,320 @@
+//go:build go1.12
+// +build go1.12
+
+// Package vault provides a passwd.Blinder backed by the HashiCorp Vault
+// Transit secrets engine, the HMAC key never leaves Vault.
+//
+//	t, err := vault.New(vault.Config{Address: "https://vault:8200", Token: token, Key: "passwd", KeyVersion: 1})
+//	err = profile.SetBlinder(t)
+package vault
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ermites-io/passwd"
+)
+
+// Error is the type helping defining errors as constants.
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+const (
+	// ErrConfig when the configuration is incomplete
+	ErrConfig = Error("invalid vault configuration")
+	// ErrResponse when vault returns an unexpected response
+	ErrResponse = Error("invalid vault response")
+)
+
+const (
+	defaultMount     = "transit"
+	defaultAlgorithm = "sha2-256"
+	defaultBatchSize = 64
+)
+
+// Config is the Transit blinder configuration.
+type Config struct {
+	Address   string // vault address, i.e. https://vault:8200
+	Token     string // vault token
+	Namespace string // optional enterprise namespace
+	Mount     string // transit mount path ("transit" if empty)
+	Key       string // transit key name
+	Algorithm string // hmac algorithm ("sha2-256" if empty)
+
+	// KeyVersion pins the key version used, leaving it to 0 (latest)
+	// breaks the verification of the existing hashes on key rotation.
+	KeyVersion int
+
+	Client *http.Client // http.DefaultClient if nil
+
+	// BatchWindow is the time concurrent requests are collected in a
+	// single batch_input request, 0 disables batching.
+	BatchWindow time.Duration
+	BatchSize   int // maximum batch size (64 if 0)
+
+	// CacheSize bounds the number of cached results (0 disables the
+	// cache), cached results expire after CacheTTL (no expiry if 0).
+	CacheSize int
+	CacheTTL  time.Duration
+}
+
+type result struct {
+	hmac []byte
+	err  error
+}
+
+type request struct {
+	input []byte
+	out   chan result
+}
+
+type entry struct {
+	key     string
+	hmac    []byte
+	expires time.Time
+}
+
+// Transit is a passwd.Blinder computing the HMAC of the digests with a
+// Vault Transit key.
+type Transit struct {
+	cfg Config
+	url string
+
+	mu      sync.Mutex
+	pending []*request
+
+	cacheMu sync.Mutex
+	lru     *list.List
+	cache   map[string]*list.Element
+}
+
+// New returns a Transit blinder.
+func New(cfg Config) (*Transit, error) {
+	if cfg.Address == "" || cfg.Token == "" || cfg.Key == "" {
+		return nil, ErrConfig
+	}
+	if cfg.Mount == "" {
+		cfg.Mount = defaultMount
+	}
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = defaultAlgorithm
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+
+	t := Transit{
+		cfg:   cfg,
+		url:   fmt.Sprintf("%s/v1/%s/hmac/%s/%s", strings.TrimRight(cfg.Address, "/"), strings.Trim(cfg.Mount, "/"), cfg.Key, cfg.Algorithm),
+		lru:   list.New(),
+		cache: make(map[string]*list.Element),
+	}
+	return &t, nil
+}
+
+// Blind implements the passwd.Blinder interface.
+func (t *Transit) Blind(digest []byte) ([]byte, error) {
+	if hmac, ok := t.cached(digest); ok {
+		return hmac, nil
+	}
+
+	var res result
+	if t.cfg.BatchWindow <= 0 {
+		res = t.send([][]byte{digest})[0]
+	} else {
+		res = t.queue(digest)
+	}
+
+	if res.err != nil {
+		return nil, res.err
+	}
+	t.store(digest, res.hmac)
+	return res.hmac, nil
+}
+
+// queue adds digest to the pending batch and waits for its result.
+func (t *Transit) queue(digest []byte) result {
+	r := request{input: digest, out: make(chan result, 1)}
+
+	t.mu.Lock()
+	t.pending = append(t.pending, &r)
+	switch len(t.pending) {
+	case t.cfg.BatchSize:
+		go t.flush()
+	case 1:
+		time.AfterFunc(t.cfg.BatchWindow, t.flush)
+	}
+	t.mu.Unlock()
+
+	return <-r.out
+}
+
+func (t *Transit) flush() {
+	t.mu.Lock()
+	batch := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	inputs := make([][]byte, len(batch))
+	for i, r := range batch {
+		inputs[i] = r.input
+	}
+	for i, res := range t.send(inputs) {
+		batch[i].out <- res
+	}
+}
+
+type batchItem struct {
+	Input string `json:"input"`
+	HMAC  string `json:"hmac,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type hmacRequest struct {
+	KeyVersion int         `json:"key_version,omitempty"`
+	BatchInput []batchItem `json:"batch_input"`
+}
+
+type hmacResponse struct {
+	Data struct {
+		BatchResults []batchItem `json:"batch_results"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+// send requests the hmac of inputs in a single batch request.
+func (t *Transit) send(inputs [][]byte) []result {
+	results := make([]result, len(inputs))
+	fail := func(err error) []result {
+		for i := range results {
+			results[i].err = err
+		}
+		return results
+	}
+
+	req := hmacRequest{KeyVersion: t.cfg.KeyVersion}
+	for _, in := range inputs {
+		req.BatchInput = append(req.BatchInput, batchItem{Input: base64.StdEncoding.EncodeToString(in)})
+	}
+
+	body, err := json.Marshal(&req)
+	if err != nil {
+		return fail(err)
+	}
+
+	hreq, err := http.NewRequest(http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return fail(err)
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	hreq.Header.Set("X-Vault-Token", t.cfg.Token)
+	if t.cfg.Namespace != "" {
+		hreq.Header.Set("X-Vault-Namespace", t.cfg.Namespace)
+	}
+
+	hresp, err := t.cfg.Client.Do(hreq)
+	if err != nil {
+		return fail(err)
+	}
+	defer hresp.Body.Close()
+
+	var resp hmacResponse
+	err = json.NewDecoder(hresp.Body).Decode(&resp)
+	if err != nil || hresp.StatusCode != http.StatusOK {
+		return fail(ErrResponse)
+	}
+	if len(resp.Data.BatchResults) != len(inputs) {
+		return fail(ErrResponse)
+	}
+
+	for i, item := range resp.Data.BatchResults {
+		results[i].hmac, results[i].err = decodeHMAC(item)
+	}
+	return results
+}
+
+// decodeHMAC decodes the "vault:vN:base64" hmac value.
+func decodeHMAC(item batchItem) ([]byte, error) {
+	if item.Error != "" {
+		return nil, ErrResponse
+	}
+
+	parts := strings.SplitN(item.HMAC, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" {
+		return nil, ErrResponse
+	}
+
+	hmac, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrResponse
+	}
+	return hmac, nil
+}
+
+func (t *Transit) cached(digest []byte) ([]byte, bool) {
+	if t.cfg.CacheSize <= 0 {
+		return nil, false
+	}
+
+	t.cacheMu.Lock()
+	defer t.cacheMu.Unlock()
+
+	e, ok := t.cache[string(digest)]
+	if !ok {
+		return nil, false
+	}
+
+	ent := e.Value.(*entry)
+	if !ent.expires.IsZero() && time.Now().After(ent.expires) {
+		t.lru.Remove(e)
+		delete(t.cache, ent.key)
+		return nil, false
+	}
+
+	t.lru.MoveToFront(e)
+	return ent.hmac, true
+}
+
+func (t *Transit) store(digest, hmac []byte) {
+	if t.cfg.CacheSize <= 0 {
+		return
+	}
+
+	t.cacheMu.Lock()
+	defer t.cacheMu.Unlock()
+
+	ent := entry{key: string(digest), hmac: hmac}
+	if t.cfg.CacheTTL > 0 {
+		ent.expires = time.Now().Add(t.cfg.CacheTTL)
+	}
+
+	if e, ok := t.cache[ent.key]; ok {
+		e.Value = &ent
+		t.lru.MoveToFront(e)
+		return
+	}
+
+	t.cache[ent.key] = t.lru.PushFront(&ent)
+	for t.lru.Len() > t.cfg.CacheSize {
+		last := t.lru.Back()
+		t.lru.Remove(last)
+		delete(t.cache, last.Value.(*entry).key)
+	}
+}
+
+var _ passwd.Blinder = (*Transit)(nil)
@@ -0,0 +1,99 @@
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ermites-io/passwd"
+)
+
+// fakeTransit emulates the hmac endpoint of the transit engine.
+func fakeTransit(calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		if r.URL.Path != "/v1/transit/hmac/passwd/sha2-256" || r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+
+		var req hmacRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		var resp hmacResponse
+		for _, item := range req.BatchInput {
+			in, _ := base64.StdEncoding.DecodeString(item.Input)
+			h := hmac.New(sha256.New, []byte("vault-key"))
+			h.Write(in)
+			resp.Data.BatchResults = append(resp.Data.BatchResults, batchItem{HMAC: "vault:v1:" + base64.StdEncoding.EncodeToString(h.Sum(nil))})
+		}
+		json.NewEncoder(w).Encode(&resp)
+	}))
+}
+
+func TestTransit(t *testing.T) {
+	var calls int32
+	srv := fakeTransit(&calls)
+	defer srv.Close()
+
+	password := []byte("prout")
+
+	for i, cfg := range []Config{
+		{Address: srv.URL, Token: "token", Key: "passwd", KeyVersion: 1},
+		{Address: srv.URL, Token: "token", Key: "passwd", KeyVersion: 1, BatchWindow: 10 * time.Millisecond, CacheSize: 16, CacheTTL: time.Minute},
+	} {
+		tr, err := New(cfg)
+		if err != nil {
+			t.Fatalf("test #%d: new error: %v\n", i, err)
+		}
+
+		p, _ := passwd.NewCustom(&passwd.ScryptParams{N: 1 << 10, R: 8, P: 1, Saltlen: 16, Keylen: 32})
+		p.SetBlinder(tr)
+
+		hashed, err := p.Hash(password)
+		if err != nil {
+			t.Fatalf("test #%d: hash error: %v\n", i, err)
+		}
+
+		var wg sync.WaitGroup
+		errs := make([]error, 8)
+		for j := range errs {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				errs[j] = p.Compare(hashed, password)
+			}(j)
+		}
+		wg.Wait()
+
+		for j, err := range errs {
+			if err != nil {
+				t.Fatalf("test #%d: compare #%d err: %v vs expected: %v\n", i, j, err, nil)
+			}
+		}
+		if err := p.Compare(hashed, []byte("wrong")); err != passwd.ErrMismatch {
+			t.Fatalf("test #%d: compare err: %v vs expected: %v\n", i, err, passwd.ErrMismatch)
+		}
+	}
+
+	// 9 requests without batching, far less with batching and caching.
+	if n := atomic.LoadInt32(&calls); n > 9+3 {
+		t.Fatalf("%d vault calls\n", n)
+	}
+
+	tr, _ := New(Config{Address: srv.URL, Token: "wrong", Key: "passwd"})
+	if _, err := tr.Blind([]byte("digest")); err != ErrResponse {
+		t.Fatalf("forbidden err: %v vs expected: %v\n", err, ErrResponse)
+	}
+	if _, err := New(Config{Address: srv.URL}); err != ErrConfig {
+		t.Fatalf("config err: %v vs expected: %v\n", err, ErrConfig)
+	}
+}
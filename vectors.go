@@ -0,0 +1,208 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+)
+
+//
+// vectors are hashes of a fixed password and fixed salts for every
+// profile and encoding, they are reproducible: generating them with a
+// later version of the package (or on another platform) must produce the
+// same set, and a stored set must keep verifying.
+// downstream teams commit a generated set and run CheckVectors() in their
+// CI to make sure upgrading the package does not change verification.
+//
+
+const (
+	vectorPassword = "correct horse battery staple"
+	vectorSecret   = "passwd reproducibility vector secret"
+	vectorLabel    = "passwd/vectors/v1/"
+)
+
+// vector formats
+const (
+	VectorNative = "native"
+	VectorPHC    = "phc"
+)
+
+// Vector is the hash of a fixed password with a fixed salt.
+type Vector struct {
+	Name     string `json:"name"`
+	Profile  string `json:"profile"`
+	Format   string `json:"format"`
+	Masked   bool   `json:"masked,omitempty"`
+	Secret   string `json:"secret,omitempty"` // hex encoded key, if key'ed
+	Password string `json:"password"`
+	Hash     string `json:"hash"`
+}
+
+// VectorError reports the vector failing verification.
+type VectorError struct {
+	Name string
+	Err  error
+}
+
+func (e *VectorError) Error() string {
+	return "vector " + e.Name + ": " + e.Err.Error()
+}
+
+// Unwrap returns the verification error.
+func (e *VectorError) Unwrap() error { return e.Err }
+
+// VectorProfiles are the profiles GenerateVectors() uses by default,
+// BcryptParanoid is left out: at cost 31 a single hash takes days.
+var VectorProfiles = []HashProfile{
+	Argon2idDefault,
+	Argon2idParanoid,
+	ScryptDefault,
+	ScryptParanoid,
+	BcryptDefault,
+}
+
+// vectorSalt derives the fixed salt of a vector from its name.
+func vectorSalt(name string) []byte {
+	sum := sha512.Sum512([]byte(vectorLabel + name))
+	return sum[:]
+}
+
+// vectorHash hashes password with the fixed salt instead of a random one.
+func vectorHash(params interface{}, salt, password []byte) ([]byte, error) {
+	switch v := params.(type) {
+	case *BcryptParams:
+		c := *v
+		c.Salt = salt[:bcryptSaltlen]
+		return c.generateFromPassword(password)
+	case *ScryptParams:
+		return v.generateFromParams(salt, password)
+	case *Argon2Params:
+		return v.generateFromParams(salt, password)
+	case *Pbkdf2Params:
+		return v.generateFromParams(salt, password)
+	}
+	return nil, ErrUnsupported
+}
+
+// vectorProfileFor returns the profile a vector is produced and verified
+// with.
+func vectorProfileFor(v *Vector) (*Profile, error) {
+	profile, ok := profileByName(v.Profile)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	p, err := New(profile)
+	if v.Masked {
+		p, err = NewMasked(profile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(v.Secret) > 0 {
+		secret, err := hex.DecodeString(v.Secret)
+		if err != nil {
+			return nil, ErrParse
+		}
+		err = p.SetKey(secret)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// GenerateVectors returns the vectors of the given profiles (VectorProfiles
+// if none), for each: the native and PHC encodings, and for argon2 and
+// scrypt the key'ed and masked variants.
+// the output only depends on the package version, it is meant to be
+// stored (i.e. as JSON) and verified later with CheckVectors().
+func GenerateVectors(profiles ...HashProfile) ([]Vector, error) {
+	if len(profiles) == 0 {
+		profiles = VectorProfiles
+	}
+
+	secret := hex.EncodeToString([]byte(vectorSecret))
+
+	var vectors []Vector
+	for _, profile := range profiles {
+		name, ok := profileName(profile)
+		if !ok {
+			return nil, ErrUnsupported
+		}
+
+		variants := []Vector{
+			{Name: name, Profile: name, Format: VectorNative},
+		}
+		if profile != BcryptDefault && profile != BcryptParanoid {
+			variants = append(variants,
+				Vector{Name: name + "-phc", Profile: name, Format: VectorPHC},
+				Vector{Name: name + "-keyed", Profile: name, Format: VectorNative, Secret: secret},
+				Vector{Name: name + "-masked", Profile: name, Format: VectorNative, Masked: true, Secret: secret},
+			)
+		}
+
+		for i := range variants {
+			v := &variants[i]
+			v.Password = vectorPassword
+
+			p, err := vectorProfileFor(v)
+			if err != nil {
+				return nil, err
+			}
+
+			hashed, err := vectorHash(p.params, vectorSalt(name), []byte(v.Password))
+			if err != nil {
+				return nil, err
+			}
+			if v.Format == VectorPHC {
+				hashed, err = Reencode(hashed, FormatPHC)
+				if err != nil {
+					return nil, err
+				}
+			}
+			v.Hash = string(hashed)
+		}
+		vectors = append(vectors, variants...)
+	}
+
+	return vectors, nil
+}
+
+// CheckVectors verifies every vector password against its hash, it
+// returns a *VectorError for the first one that does not verify.
+func CheckVectors(vectors []Vector) error {
+	for i := range vectors {
+		v := &vectors[i]
+
+		err := checkVector(v)
+		if err != nil {
+			return &VectorError{Name: v.Name, Err: err}
+		}
+	}
+	return nil
+}
+
+func checkVector(v *Vector) error {
+	p, err := vectorProfileFor(v)
+	if err != nil {
+		return err
+	}
+
+	hashed := []byte(v.Hash)
+	switch v.Format {
+	case VectorNative:
+	case VectorPHC:
+		hashed, err = Reencode(hashed, FormatNative)
+		if err != nil {
+			return err
+		}
+	default:
+		return ErrUnsupported
+	}
+
+	return p.Compare(hashed, []byte(v.Password))
+}
@@ -0,0 +1,202 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// proof-of-verification tokens.
+//
+// a successful Compare() mints a short-lived token, redeemed within its
+// TTL it proves the subject verified its password recently, step-up and
+// re-authentication flows skip the KDF:
+//
+// $2t$b64(ID)$EXPIRES$b64(hmac_sha3-256(label || 0x00 || ID || EXPIRES || subject || hashed, key)[:16])
+//
+// the token is bound to the stored hash, changing the password invalidates
+// the tokens minted before. tokens can be redeemed until they expire,
+// flows needing single use tokens revoke them once redeemed.
+//
+
+const (
+	idToken = "2t"
+
+	labelToken = "passwd/vtoken/v1"
+
+	tokenIDlen  = 16
+	tokenMaclen = 16
+)
+
+// TokenRevoker keeps the revoked tokens until they expire.
+type TokenRevoker interface {
+	Revoke(id string, expires time.Time) error
+	Revoked(id string) (bool, error)
+}
+
+// MemoryTokenRevoker is an in memory TokenRevoker.
+type MemoryTokenRevoker struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+// NewMemoryTokenRevoker returns an empty MemoryTokenRevoker.
+func NewMemoryTokenRevoker() *MemoryTokenRevoker {
+	return &MemoryTokenRevoker{revoked: make(map[string]time.Time)}
+}
+
+// Revoke revokes the token id until expires, expired entries are purged.
+func (m *MemoryTokenRevoker) Revoke(id string, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := now()
+	for k, e := range m.revoked {
+		if !t.Before(e) {
+			delete(m.revoked, k)
+		}
+	}
+	m.revoked[id] = expires
+	return nil
+}
+
+// Revoked returns true if the token id is revoked.
+func (m *MemoryTokenRevoker) Revoked(id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.revoked[id]
+	return ok, nil
+}
+
+// VerificationTokens mints and redeems proof-of-verification tokens.
+type VerificationTokens struct {
+	key     []byte
+	ttl     time.Duration
+	revoker TokenRevoker
+}
+
+// NewVerificationTokens returns VerificationTokens key'ed with key
+// (validated like SetSecret()), minting tokens valid for ttl, revoker is
+// optional.
+func NewVerificationTokens(key []byte, ttl time.Duration, revoker TokenRevoker) (*VerificationTokens, error) {
+	err := validateSecret(key)
+	if err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		return nil, ErrUnsupported
+	}
+	return &VerificationTokens{key: key, ttl: ttl, revoker: revoker}, nil
+}
+
+func (vt *VerificationTokens) mac(id []byte, expires int64, subject, hashed []byte) []byte {
+	var n [8]byte
+
+	h := hmac.New(newSHA3256, vt.key)
+	h.Write([]byte(labelToken))
+	h.Write([]byte{0x00})
+	h.Write(id)
+	binary.BigEndian.PutUint64(n[:], uint64(expires))
+	h.Write(n[:])
+	binary.BigEndian.PutUint64(n[:], uint64(len(subject)))
+	h.Write(n[:])
+	h.Write(subject)
+	h.Write(hashed)
+	return h.Sum(nil)[:tokenMaclen]
+}
+
+// Compare compares hashed against password with p and returns a token for
+// subject if they match.
+func (vt *VerificationTokens) Compare(p *Profile, subject, hashed, password []byte) (string, error) {
+	err := p.Compare(hashed, password)
+	if err != nil {
+		return "", err
+	}
+
+	id := make([]byte, tokenIDlen)
+	err = readRandom(id)
+	if err != nil {
+		return "", err
+	}
+	expires := now().Add(vt.ttl).Unix()
+
+	return fmt.Sprintf("%c%s%c%s%c%d%c%s",
+		separatorRune, idToken,
+		separatorRune, base64Encode(id),
+		separatorRune, expires,
+		separatorRune, base64Encode(vt.mac(id, expires, subject, hashed))), nil
+}
+
+// parse verifies token for subject and hashed and returns its identifier
+// and expiry.
+func (vt *VerificationTokens) parse(token string, subject, hashed []byte) (string, int64, error) {
+	fields := strings.Split(token, string(separatorRune))
+	if len(fields) != 5 || fields[0] != "" || fields[1] != idToken {
+		return "", 0, ErrParse
+	}
+
+	id, err := base64Decode([]byte(fields[2]))
+	if err != nil {
+		return "", 0, ErrParse
+	}
+	expires, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return "", 0, ErrParse
+	}
+	mac, err := base64Decode([]byte(fields[4]))
+	if err != nil {
+		return "", 0, ErrParse
+	}
+
+	if !hmac.Equal(mac, vt.mac(id, expires, subject, hashed)) {
+		return "", 0, ErrMismatch
+	}
+	return fields[2], expires, nil
+}
+
+// Redeem verifies token was minted for subject and its current hash, it
+// returns ErrMismatch if not, ErrExpired if it expired and ErrRevoked if
+// it was revoked.
+func (vt *VerificationTokens) Redeem(token string, subject, hashed []byte) error {
+	id, expires, err := vt.parse(token, subject, hashed)
+	if err != nil {
+		return err
+	}
+	if now().Unix() >= expires {
+		return ErrExpired
+	}
+
+	if vt.revoker != nil {
+		revoked, err := vt.revoker.Revoked(id)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return ErrRevoked
+		}
+	}
+	return nil
+}
+
+// Revoke revokes token (i.e. once redeemed, or at logout), it requires a
+// revoker.
+func (vt *VerificationTokens) Revoke(token string, subject, hashed []byte) error {
+	if vt.revoker == nil {
+		return ErrUnsupported
+	}
+
+	id, expires, err := vt.parse(token, subject, hashed)
+	if err != nil {
+		return err
+	}
+	return vt.revoker.Revoke(id, time.Unix(expires, 0))
+}
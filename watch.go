@@ -0,0 +1,138 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// Watcher polls a file (secret, profile configuration..) and hands its
+// content to a reload callback every time it changes, so long running
+// services can rotate peppers and parameters without a restart.
+// kubernetes/docker secret updates replace the file (symlink swap), the
+// content is always read as a whole.
+type Watcher struct {
+	path   string
+	reload func(content []byte) error
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	sum     [sha256.Size]byte
+	err     error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Watch loads path with reload, then polls it every interval, a failed
+// reload keeps the previous configuration in place and is reported by
+// Err(), the initial load error is returned.
+func Watch(path string, interval time.Duration, reload func(content []byte) error) (*Watcher, error) {
+	if interval <= 0 || reload == nil {
+		return nil, ErrUnsupported
+	}
+
+	w := Watcher{
+		path:   path,
+		reload: reload,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	_, err := w.Check()
+	if err != nil {
+		return nil, err
+	}
+
+	go w.loop(interval)
+	return &w, nil
+}
+
+// WatchSecret watches the secret file of fs, apply is called with the new
+// secret (i.e. to swap a ProfileHandle or call SetSecret()).
+func WatchSecret(fs FileSecret, interval time.Duration, apply func(secret []byte) error) (*Watcher, error) {
+	return Watch(fs.Path, interval, func([]byte) error {
+		// re-read through the provider for the permission checks and
+		// decoding.
+		secret, err := fs.Secret()
+		if err != nil {
+			return err
+		}
+		return apply(secret)
+	})
+}
+
+func (w *Watcher) loop(interval time.Duration) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.Check()
+		}
+	}
+}
+
+// Check polls the file immediately, it returns true if the content changed
+// and was reloaded.
+func (w *Watcher) Check() (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	fi, err := os.Stat(w.path)
+	if err != nil {
+		w.err = err
+		return false, err
+	}
+	if fi.ModTime().Equal(w.modTime) && fi.Size() == w.size && w.err == nil {
+		return false, nil
+	}
+
+	content, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		w.err = err
+		return false, err
+	}
+
+	sum := sha256.Sum256(content)
+	if bytes.Equal(sum[:], w.sum[:]) && w.err == nil {
+		w.modTime, w.size = fi.ModTime(), fi.Size()
+		return false, nil
+	}
+
+	err = w.reload(content)
+	if err != nil {
+		w.err = err
+		return false, err
+	}
+
+	w.modTime, w.size, w.sum, w.err = fi.ModTime(), fi.Size(), sum, nil
+	return true, nil
+}
+
+// Err returns the error of the last (failed) reload, nil once a reload
+// succeeded.
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Close stops the polling.
+func (w *Watcher) Close() error {
+	close(w.stop)
+	<-w.done
+	return nil
+}
@@ -0,0 +1,67 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"runtime"
+)
+
+//
+// sensitive material wiping.
+//
+// the internal copies of the passwords (transformed inputs, pre-hashes),
+// secrets derived buffers and salts are zeroed once used.
+// it is best effort: the Go runtime may have copied them (stack growth,
+// GC compaction of the callers' buffers) and strings cannot be wiped.
+// SetWipeInput() makes the profile zero the callers' password slices too.
+//
+
+// WipeBytes zeroes b.
+func WipeBytes(b []byte) {
+	wipe(b)
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+	runtime.KeepAlive(b)
+}
+
+// wipeCopy zeroes b unless it is orig or a prefix of it.
+func wipeCopy(b, orig []byte) {
+	if len(b) == 0 {
+		return
+	}
+	if len(orig) > 0 && &b[0] == &orig[0] {
+		return
+	}
+	wipe(b)
+}
+
+// SetWipeInput makes Hash(), Compare(), Derive() and the methods built on
+// them zero the password slice they are given once done, whatever the
+// outcome, the caller must not use it afterwards.
+func (p *Profile) SetWipeInput(on bool) error {
+	p.wipeInput = on
+	return nil
+}
+
+// wipePassword zeroes password if the profile wipes its input.
+func (p *Profile) wipePassword(password []byte) {
+	if p.wipeInput {
+		wipe(password)
+	}
+}
+
+// keep returns the profile leaving the password untouched, for the
+// methods using it more than once.
+func (p *Profile) keep() *Profile {
+	if !p.wipeInput {
+		return p
+	}
+	c := p.clone()
+	c.wipeInput = false
+	return c
+}
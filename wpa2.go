@@ -0,0 +1,40 @@
+//go:build go1.12
+// +build go1.12
+
+package passwd
+
+import (
+	"crypto/sha1"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+//
+// WPA2-PSK (IEEE 802.11i annex H.4).
+//
+// PSK = PBKDF2-HMAC-SHA1(passphrase, ssid, 4096, 32)
+//
+
+const (
+	wpa2Iterations = 4096
+	wpa2KeyLen     = 32
+)
+
+// DeriveWPA2PSK derives the 256 bits pre-shared key of the network ssid, the
+// passphrase is 8 to 63 printable ASCII characters and the ssid up to 32
+// bytes, ErrUnsupported otherwise.
+func DeriveWPA2PSK(passphrase, ssid []byte) ([]byte, error) {
+	if len(passphrase) < 8 || len(passphrase) > 63 {
+		return nil, ErrUnsupported
+	}
+	for _, c := range passphrase {
+		if c < 0x20 || c > 0x7e {
+			return nil, ErrUnsupported
+		}
+	}
+	if len(ssid) == 0 || len(ssid) > 32 {
+		return nil, ErrUnsupported
+	}
+
+	return pbkdf2.Key(passphrase, ssid, wpa2Iterations, wpa2KeyLen, sha1.New), nil
+}